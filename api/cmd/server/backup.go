@@ -0,0 +1,77 @@
+package main
+
+import (
+	"checkmate/api/internal/storage"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// server backup [-o file]  -> snapshot of the running database, into BACKUP_DIR when -o isn't given
+// a file ending in .gz is compressed, BACKUP_DIR backups follow BACKUP_COMPRESS and BACKUP_RETENTION
+func runBackupCommand(args []string) int {
+	logger := log.WithFields(log.Fields{
+		"func": "runBackupCommand",
+	})
+
+	flags := flag.NewFlagSet("backup", flag.ContinueOnError)
+	out := flags.String("o", "", "file to write the backup to (default: timestamped file in BACKUP_DIR)")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if err := storage.InitBackupSettings(); err != nil {
+		logger.WithError(err).Error("Invalid backup settings")
+		return 1
+	}
+
+	if err := storage.Open(); err != nil {
+		logger.WithError(err).Error("Failed to open database")
+		return 1
+	}
+	defer storage.DB.Close()
+
+	ctx := context.Background()
+
+	var info *storage.BackupInfo
+	var err error
+	if *out != "" {
+		info, err = storage.Backup(ctx, *out)
+	} else {
+		info, err = storage.BackupToDir(ctx)
+	}
+	if err != nil {
+		logger.WithError(err).Error("Backup failed")
+		return 1
+	}
+
+	fmt.Printf("backup written to %s (%d bytes, schema version %d)\n", info.Path, info.SizeBytes, info.SchemaVersion)
+	return 0
+}
+
+// server restore <file>  -> replaces the database with a backup, stop the server first
+func runRestoreCommand(args []string) int {
+	logger := log.WithFields(log.Fields{
+		"func": "runRestoreCommand",
+	})
+
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "usage: server restore <backup file>")
+		return 2
+	}
+
+	info, err := storage.Restore(context.Background(), args[0])
+	if err != nil {
+		logger.WithError(err).Error("Restore failed")
+		return 1
+	}
+
+	fmt.Printf("restored %s into %s (schema version %d)\n", args[0], storage.SQLitePath(), info.SchemaVersion)
+	if info.PreviousPath != "" {
+		fmt.Printf("previous database kept at %s\n", info.PreviousPath)
+	}
+	return 0
+}
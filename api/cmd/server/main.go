@@ -2,10 +2,12 @@ package main
 
 import (
 	"checkmate/api/internal/auth"
-	"checkmate/api/internal/handler"
+	"checkmate/api/internal/platform"
+	"checkmate/api/internal/service"
 	"checkmate/api/internal/storage"
 	"checkmate/api/internal/utils"
 	"context"
+	"expvar"
 	"net/http"
 	"os"
 	"os/signal"
@@ -33,6 +35,28 @@ func main() {
 		"func": "main",
 	})
 
+	// get environment variables -> before anything reads them, DATABASE_URL included
+	if err := godotenv.Load("./.env"); err != nil {
+		// Not necessary fail, since .env may not exist in production
+		logger.WithError(err).Warn("Warning: .env file not found")
+	} else {
+		logger.Debug("Environment variables loaded successfully")
+	}
+
+	// subcommands, ex `server migrate status` -> run and exit without starting the server
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "migrate":
+			os.Exit(runMigrateCommand(os.Args[2:]))
+		case "backup":
+			os.Exit(runBackupCommand(os.Args[2:]))
+		case "restore":
+			os.Exit(runRestoreCommand(os.Args[2:]))
+		default:
+			logger.WithField("command", os.Args[1]).Fatal("Unknown command")
+		}
+	}
+
 	// create package-level context key for request ID
 	utils.InitRequestIDKey()
 
@@ -43,18 +67,40 @@ func main() {
 	}
 	logger.WithField("directory", currentDir).Debug("Running from directory")
 
-	// init database
+	// init database, pending migrations are applied here
 	storage.InitDb()
-	logger.Debug("Database initialized successfully")
+	logger.WithField("backend", storage.Backend()).Debug("Database initialized successfully")
 
-	// get environment variables
-	err = godotenv.Load("./.env")
-	if err != nil {
-		// Not necessary fail, since .env may not exist in production
-		logger.WithError(err).Warn("Warning: .env file not found")
-	} else {
-		logger.Debug("Environment variables loaded successfully")
+	// scheduled backups, stopped on shutdown
+	if err := storage.InitBackupSettings(); err != nil {
+		logger.WithError(err).Fatal("Failed to load backup settings")
 	}
+	backgroundCtx, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+	storage.StartScheduledBackups(backgroundCtx)
+	logger.WithFields(log.Fields{
+		"dir":       storage.BackupDir,
+		"interval":  storage.BackupInterval,
+		"retention": storage.BackupRetention,
+	}).Debug("Backup settings loaded successfully")
+
+	// retention of the deployment history, compaction runs in the background
+	if err := service.InitRetentionSettings(); err != nil {
+		logger.WithError(err).Fatal("Failed to load retention settings")
+	}
+	service.StartCompaction(backgroundCtx)
+	logger.WithFields(log.Fields{
+		"event_max_age":         service.EventMaxAge,
+		"events_per_deployment": service.EventsPerDeployment,
+		"downsample_after":      service.DownsampleAfter,
+		"delivery_max_age":      service.DeliveryMaxAge,
+		"compaction_interval":   service.CompactionInterval,
+		"vacuum_interval":       service.VacuumInterval,
+	}).Debug("Retention settings loaded successfully")
+
+	// users allowed to use the /admin endpoints
+	adminCount := auth.InitAdmins()
+	logger.WithField("admins", adminCount).Debug("Admin users loaded")
 
 	// get Firebase credentials path to init auth
 	firebaseCredPath := os.Getenv("FIREBASE_CREDENTIALS_PATH")
@@ -75,16 +121,88 @@ func main() {
 	}
 	logger.Debug("Encryption initialized successfully")
 
+	// circuit breaker per credential for failing platforms
+	if err := service.InitBreakerSettings(); err != nil {
+		logger.WithError(err).Fatal("Failed to load circuit breaker settings")
+	}
+	logger.WithFields(log.Fields{
+		"failure_threshold": service.BreakerFailureThreshold,
+		"open_duration":     service.BreakerOpenDuration,
+	}).Debug("Circuit breaker settings loaded successfully")
+
+	// retries and rate limiting for platform api calls
+	if err := platform.InitHTTPClient(); err != nil {
+		logger.WithError(err).Fatal("Failed to initialize provider http client")
+	}
+	logger.Debug("Provider http client initialized successfully")
+
+	// cache ttls and stale-while-revalidate settings
+	if err := service.InitCacheSettings(); err != nil {
+		logger.WithError(err).Fatal("Failed to load cache settings")
+	}
+	logger.WithFields(log.Fields{
+		"ttl":                    service.CacheTTL,
+		"platform_ttls":          service.PlatformCacheTTL,
+		"stale_while_revalidate": service.CacheStaleWhileRevalidate,
+		"max_staleness":          service.CacheMaxStaleness,
+	}).Debug("Cache settings loaded successfully")
+
+	// heartbeat and revalidation of the live deployment streams
+	if err := service.InitStreamSettings(); err != nil {
+		logger.WithError(err).Fatal("Failed to load stream settings")
+	}
+	logger.WithFields(log.Fields{
+		"heartbeat_interval": service.StreamHeartbeatInterval,
+		"refresh_interval":   service.StreamRefreshInterval,
+	}).Debug("Stream settings loaded successfully")
+
+	// polling of the deployment logs followed over the dashboard websocket
+	if err := service.InitLogSettings(); err != nil {
+		logger.WithError(err).Fatal("Failed to load log settings")
+	}
+	logger.WithField("poll_interval", service.LogPollInterval).Debug("Log settings loaded successfully")
+
+	// outbound webhooks, the delivery worker sends the queued deliveries until shutdown
+	if err := service.InitWebhookSettings(); err != nil {
+		logger.WithError(err).Fatal("Failed to load webhook settings")
+	}
+	service.StartWebhookDeliveries(backgroundCtx)
+	logger.WithFields(log.Fields{
+		"timeout":                service.WebhookTimeout,
+		"max_attempts":           service.WebhookMaxAttempts,
+		"retry_base_delay":       service.WebhookRetryBaseDelay,
+		"allow_private_networks": service.WebhookAllowPrivateNetworks,
+	}).Debug("Webhook settings loaded successfully")
+
+	// email notifications over smtp, off without SMTP_HOST, and the daily digests
+	if err := service.InitEmailSettings(); err != nil {
+		logger.WithError(err).Fatal("Failed to load email settings")
+	}
+	service.StartEmailDigests(backgroundCtx)
+	logger.WithFields(log.Fields{
+		"enabled":     service.EmailEnabled(),
+		"host":        service.SMTPHost,
+		"port":        service.SMTPPort,
+		"tls":         service.SMTPTLS,
+		"from":        service.SMTPFrom,
+		"digest_hour": service.DigestHour,
+	}).Debug("Email settings loaded successfully")
+
+	// notification rules escalate failures that outlast their delay
+	service.StartEscalations(backgroundCtx)
+	logger.WithField("max_rules_per_user", service.MaxRulesPerUser).Debug("Notification escalations started")
+
 	mux := http.NewServeMux()
 
-	// endpoints
-	mux.HandleFunc("/", auth.AuthenticateWithRequestID(handler.GetCurrentUser))
+	// endpoints -> method + path patterns under /api/v1, the mux answers 405 with an Allow header for other methods
+	if err := registerRoutes(mux); err != nil {
+		logger.WithError(err).Fatal("Failed to register routes")
+	}
 
-	mux.HandleFunc("/deployments", auth.AuthenticateWithRequestID(handler.GetDeployments))
-	mux.HandleFunc("/credentials", auth.AuthenticateWithRequestID(handler.GetCredentials))
-	mux.HandleFunc("/credentials/new", auth.AuthenticateWithRequestID(handler.CreateCredentials))
-	mux.HandleFunc("/credentials/update/:id", auth.AuthenticateWithRequestID(handler.UpdateCredential))
-	mux.HandleFunc("/credentials/delete/:id", auth.AuthenticateWithRequestID(handler.DeleteCredential))
+	// expvar counters (provider retries, rate limits...) -> only outside production, the endpoint is not authenticated
+	if os.Getenv("ENV") != "production" {
+		mux.Handle("GET /debug/vars", expvar.Handler())
+	}
 
 	logger.Debug("Routes registered successfully")
 
@@ -92,11 +210,12 @@ func main() {
 	corsMiddleware := cors.New(cors.Options{
 		AllowedOrigins:   []string{"http://localhost:1420", "http://localhost:5173"}, // Tauri default dev port + current frontend
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Content-Type", "Authorization"},
+		AllowedHeaders:   []string{"Content-Type", "Authorization", "Cache-Control", "Pragma", "If-None-Match", "If-Modified-Since", "Last-Event-ID"},
+		ExposedHeaders:   []string{"ETag", "Last-Modified", "X-Request-ID", "Deprecation", "Link"},
 		AllowCredentials: true,
 	})
 
-	handler := corsMiddleware.Handler(mux)
+	handler := corsMiddleware.Handler(withJSONErrors(mux))
 	logger.Debug("CORS middleware applied")
 
 	server := &http.Server{
@@ -104,6 +223,9 @@ func main() {
 		Handler: handler,
 	}
 
+	// Shutdown doesn't interrupt open connections, the deployment streams would hold it until the deadline
+	server.RegisterOnShutdown(service.CloseDeploymentStreams)
+
 	// Start server in goroutine
 	go func() {
 		logger.WithField("port", server.Addr).Info("Server starting")
@@ -124,6 +246,9 @@ func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
+	// stop background jobs before the server
+	stopBackground()
+
 	// shutdown server
 	logger.Info("Shutting down server...")
 	if err := server.Shutdown(ctx); err != nil {
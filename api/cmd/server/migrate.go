@@ -0,0 +1,94 @@
+package main
+
+import (
+	"checkmate/api/internal/storage"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// server migrate status      -> lists migrations and whether they are applied
+// server migrate up [-to N]  -> applies pending migrations, up to version N when given
+func runMigrateCommand(args []string) int {
+	logger := log.WithFields(log.Fields{
+		"func": "runMigrateCommand",
+	})
+
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: server migrate <status|up> [-to version]")
+		return 2
+	}
+
+	if err := storage.Open(); err != nil {
+		logger.WithError(err).Error("Failed to open database")
+		return 1
+	}
+	defer storage.DB.Close()
+
+	ctx := context.Background()
+
+	switch args[0] {
+	case "status":
+		statuses, err := storage.GetMigrationStatus(ctx)
+		if err != nil {
+			logger.WithError(err).Error("Failed to get migration status")
+			return 1
+		}
+		current, err := storage.CurrentVersion(ctx)
+		if err != nil {
+			logger.WithError(err).Error("Failed to get schema version")
+			return 1
+		}
+
+		fmt.Printf("backend: %s\nschema version: %d\n\n", storage.Backend(), current)
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		for _, s := range statuses {
+			appliedAt := "pending"
+			if s.AppliedAt != nil {
+				appliedAt = s.AppliedAt.Local().Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(w, "%04d\t%s\t%s\n", s.Version, s.Name, appliedAt)
+		}
+		w.Flush()
+		return 0
+
+	case "up":
+		flags := flag.NewFlagSet("migrate up", flag.ContinueOnError)
+		target := flags.Int("to", 0, "version to migrate to (default: latest)")
+		if err := flags.Parse(args[1:]); err != nil {
+			return 2
+		}
+
+		var applied int
+		var err error
+		if *target > 0 {
+			applied, err = storage.MigrateTo(ctx, *target)
+		} else {
+			applied, err = storage.MigrateUp(ctx)
+		}
+		if err != nil {
+			logger.WithError(err).Error("Migration failed")
+			return 1
+		}
+
+		current, err := storage.CurrentVersion(ctx)
+		if err != nil {
+			logger.WithError(err).Error("Failed to get schema version")
+			return 1
+		}
+		logger.WithFields(log.Fields{
+			"applied": applied,
+			"version": current,
+		}).Info("Migrations complete")
+		return 0
+
+	default:
+		fmt.Fprintf(os.Stderr, "unknown migrate command %q, expected status or up\n", args[0])
+		return 2
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"checkmate/api/internal/auth"
+	"checkmate/api/internal/handler"
+	"checkmate/api/internal/model"
+	"checkmate/api/internal/openapi"
+	"checkmate/api/internal/utils"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// every documented route lives under this prefix
+const apiPrefix = "/api/v1"
+
+// one endpoint of the versioned api, pattern is relative to apiPrefix
+type route struct {
+	pattern string // "METHOD /path" as understood by http.ServeMux
+	handler http.HandlerFunc
+}
+
+// the /api/v1 endpoints, each of them must be described in openapi.json
+func apiRoutes() []route {
+	return []route{
+		{"GET /openapi.json", openapi.Handler},
+
+		{"GET /{$}", auth.AuthenticateWithRequestID(handler.GetCurrentUser)},
+
+		{"GET /deployments", auth.AuthenticateWithRequestID(handler.GetDeployments)},
+		{"POST /deployments/refresh", auth.AuthenticateWithRequestID(handler.RefreshDeployments)},
+		{"GET /deployments/events", auth.AuthenticateWithRequestID(handler.GetDeploymentEvents)},
+		{"GET /deployments/stream", auth.AuthenticateWithRequestID(handler.StreamDeployments)},
+		{"GET /deployments/{credentialId}/{deploymentId}", auth.AuthenticateWithRequestID(handler.GetDeployment)},
+
+		// dashboard websocket, the token can also come as a subprotocol since browsers can't set headers on it
+		{"GET /ws", auth.AuthenticateWebSocket(handler.DeploymentsWebSocket)},
+
+		{"GET /credentials", auth.AuthenticateWithRequestID(handler.GetCredentials)},
+		{"POST /credentials", auth.AuthenticateWithRequestID(handler.CreateCredentials)},
+		{"PUT /credentials/{id}", auth.AuthenticateWithRequestID(handler.UpdateCredential)},
+		{"DELETE /credentials/{id}", auth.AuthenticateWithRequestID(handler.DeleteCredential)},
+		{"PUT /credentials/{id}/cache-ttl", auth.AuthenticateWithRequestID(handler.UpdateCredentialCacheTTL)},
+
+		{"GET /webhooks", auth.AuthenticateWithRequestID(handler.GetWebhooks)},
+		{"POST /webhooks", auth.AuthenticateWithRequestID(handler.CreateWebhook)},
+		{"PUT /webhooks/{id}", auth.AuthenticateWithRequestID(handler.UpdateWebhook)},
+		{"DELETE /webhooks/{id}", auth.AuthenticateWithRequestID(handler.DeleteWebhook)},
+		{"GET /webhooks/{id}/deliveries", auth.AuthenticateWithRequestID(handler.GetWebhookDeliveries)},
+		{"POST /webhooks/{id}/test", auth.AuthenticateWithRequestID(handler.TestWebhook)},
+
+		{"GET /notification-rules", auth.AuthenticateWithRequestID(handler.GetNotificationRules)},
+		{"POST /notification-rules", auth.AuthenticateWithRequestID(handler.CreateNotificationRule)},
+		{"POST /notification-rules/preview", auth.AuthenticateWithRequestID(handler.PreviewNotificationRules)},
+		{"PUT /notification-rules/{id}", auth.AuthenticateWithRequestID(handler.UpdateNotificationRule)},
+		{"DELETE /notification-rules/{id}", auth.AuthenticateWithRequestID(handler.DeleteNotificationRule)},
+
+		// admin endpoints, only for ADMIN_UIDS
+		{"POST /admin/backup", auth.AuthenticateWithRequestID(auth.RequireAdmin(handler.CreateBackup))},
+		{"GET /admin/retention", auth.AuthenticateWithRequestID(auth.RequireAdmin(handler.GetRetentionStatus))},
+		{"POST /admin/retention", auth.AuthenticateWithRequestID(auth.RequireAdmin(handler.RunCompaction))},
+	}
+}
+
+// routes that never existed without apiPrefix, they get no unversioned alias
+var versionedOnly = map[string]bool{
+	"GET /openapi.json":                              true,
+	"GET /deployments/stream":                        true,
+	"GET /deployments/{credentialId}/{deploymentId}": true,
+	"GET /ws":                          true,
+	"GET /webhooks":                    true,
+	"POST /webhooks":                   true,
+	"PUT /webhooks/{id}":               true,
+	"DELETE /webhooks/{id}":            true,
+	"GET /webhooks/{id}/deliveries":    true,
+	"POST /webhooks/{id}/test":         true,
+	"GET /notification-rules":          true,
+	"POST /notification-rules":         true,
+	"POST /notification-rules/preview": true,
+	"PUT /notification-rules/{id}":     true,
+	"DELETE /notification-rules/{id}":  true,
+}
+
+// unversioned aliases that keep the response of the previous release instead of the /api/v1 one
+var unversionedHandlers = map[string]http.HandlerFunc{
+	"GET /deployments": auth.AuthenticateWithRequestID(handler.GetDeploymentsLegacy),
+}
+
+// old unversioned paths of the previous release (id in the query), kept as deprecated aliases
+// successor is relative to apiPrefix
+var legacyRoutes = []struct {
+	pattern, successor string
+	handler            http.HandlerFunc
+}{
+	{"POST /credentials/new", "/credentials", handler.CreateCredentials},
+	{"PUT /credentials/update", "/credentials/{id}", handler.UpdateCredential},
+	{"DELETE /credentials/delete", "/credentials/{id}", handler.DeleteCredential},
+}
+
+// registers the api under apiPrefix, the same routes without the prefix and the legacy paths as deprecated aliases
+// fails when a route is missing from the openapi document
+func registerRoutes(mux *http.ServeMux) error {
+	routes := apiRoutes()
+
+	patterns := make([]string, 0, len(routes))
+	for _, rt := range routes {
+		patterns = append(patterns, rt.pattern)
+	}
+	missing, err := openapi.MissingRoutes(patterns)
+	if err != nil {
+		return err
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("routes missing from openapi.json: %s", strings.Join(missing, ", "))
+	}
+
+	for _, rt := range routes {
+		method, path, _ := strings.Cut(rt.pattern, " ")
+		mux.HandleFunc(method+" "+apiPrefix+path, rt.handler)
+
+		// unversioned alias for clients of the previous release
+		if !versionedOnly[rt.pattern] {
+			aliasHandler := rt.handler
+			if h, ok := unversionedHandlers[rt.pattern]; ok {
+				aliasHandler = h
+			}
+			mux.HandleFunc(rt.pattern, handler.Deprecated(apiPrefix+strings.TrimSuffix(path, "{$}"), aliasHandler))
+		}
+	}
+
+	for _, rt := range legacyRoutes {
+		mux.HandleFunc(rt.pattern, handler.Deprecated(apiPrefix+rt.successor, auth.AuthenticateWithRequestID(rt.handler)))
+	}
+
+	return nil
+}
+
+// the mux answers unknown paths (404) and methods (405) in plain text itself,
+// those responses are rewritten as model.APIError like every other error
+func withJSONErrors(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, pattern := mux.Handler(r); pattern != "" {
+			mux.ServeHTTP(w, r)
+			return
+		}
+		mux.ServeHTTP(&muxErrorWriter{ResponseWriter: w, r: r}, r)
+	})
+}
+
+type muxErrorWriter struct {
+	http.ResponseWriter
+	r        *http.Request
+	replaced bool // the plain text body that follows is dropped
+}
+
+func (w *muxErrorWriter) WriteHeader(status int) {
+	switch status {
+	case http.StatusNotFound:
+		utils.WriteError(w.ResponseWriter, w.r, status, model.ErrorCodeNotFound, "Not found", nil)
+	case http.StatusMethodNotAllowed:
+		// the mux already set the Allow header
+		utils.WriteError(w.ResponseWriter, w.r, status, model.ErrorCodeMethodNotAllowed, "Method not allowed", nil)
+	default:
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+	w.replaced = true
+}
+
+func (w *muxErrorWriter) Write(b []byte) (int, error) {
+	if w.replaced {
+		return len(b), nil
+	}
+	return w.ResponseWriter.Write(b)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"checkmate/api/internal/openapi"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// every /api/v1 route is in openapi.json, so the document can't drift from the routes
+func TestRoutesAreDocumented(t *testing.T) {
+	var patterns []string
+	for _, rt := range apiRoutes() {
+		patterns = append(patterns, rt.pattern)
+	}
+
+	missing, err := openapi.MissingRoutes(patterns)
+	if err != nil {
+		t.Fatalf("check routes: %v", err)
+	}
+	if len(missing) > 0 {
+		t.Errorf("routes missing from openapi.json: %s", strings.Join(missing, ", "))
+	}
+}
+
+// and the other way around, every documented operation is served
+func TestDocumentedOperationsHaveRoutes(t *testing.T) {
+	operations, err := openapi.Operations()
+	if err != nil {
+		t.Fatalf("read operations: %v", err)
+	}
+
+	routed := make(map[string]bool)
+	for _, rt := range apiRoutes() {
+		method, path, _ := strings.Cut(rt.pattern, " ")
+		path = strings.TrimSuffix(path, "{$}")
+		if path != "/" {
+			path = strings.TrimSuffix(path, "/")
+		}
+		routed[method+" "+path] = true
+	}
+
+	for operation := range operations {
+		if !routed[operation] {
+			t.Errorf("%s is in openapi.json but has no route", operation)
+		}
+	}
+}
+
+// a versionedOnly entry that isn't a route anymore would quietly stop meaning anything
+func TestVersionedOnlyPatternsAreRoutes(t *testing.T) {
+	routes := make(map[string]bool)
+	for _, rt := range apiRoutes() {
+		routes[rt.pattern] = true
+	}
+
+	var patterns []string
+	for pattern := range versionedOnly {
+		if !routes[pattern] {
+			t.Errorf("versionedOnly has %q, which isn't in apiRoutes", pattern)
+		}
+		patterns = append(patterns, pattern)
+	}
+
+	missing, err := openapi.MissingRoutes(patterns)
+	if err != nil {
+		t.Fatalf("check routes: %v", err)
+	}
+	if len(missing) > 0 {
+		t.Errorf("versioned only routes missing from openapi.json: %s", strings.Join(missing, ", "))
+	}
+}
+
+// the mux panics on conflicting patterns, the versioned routes, their aliases and the legacy paths must all fit
+func TestRegisterRoutes(t *testing.T) {
+	if err := registerRoutes(http.NewServeMux()); err != nil {
+		t.Fatalf("register routes: %v", err)
+	}
+}
+
+// an unversioned handler only runs when its route gets an alias
+func TestUnversionedHandlersHaveAliases(t *testing.T) {
+	routes := make(map[string]bool)
+	for _, rt := range apiRoutes() {
+		routes[rt.pattern] = true
+	}
+
+	for pattern := range unversionedHandlers {
+		if !routes[pattern] {
+			t.Errorf("unversionedHandlers has %q, which isn't in apiRoutes", pattern)
+		}
+		if versionedOnly[pattern] {
+			t.Errorf("unversionedHandlers has %q, which is versioned only", pattern)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package auth
+
+import (
+	"checkmate/api/internal/model"
+	"checkmate/api/internal/utils"
+	"net/http"
+	"os"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// firebase uids allowed to use the admin endpoints
+var adminUIDs = map[string]bool{}
+
+// loads the admin uids from ADMIN_UIDS (comma separated), no admins when unset
+func InitAdmins() int {
+	adminUIDs = map[string]bool{}
+	for _, uid := range strings.Split(os.Getenv("ADMIN_UIDS"), ",") {
+		if uid = strings.TrimSpace(uid); uid != "" {
+			adminUIDs[uid] = true
+		}
+	}
+	return len(adminUIDs)
+}
+
+func IsAdmin(uid string) bool {
+	return adminUIDs[uid]
+}
+
+// RequireAdmin rejects users that aren't admins -> goes inside AuthenticateWithRequestID, it needs the uid
+func RequireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		uid, err := GetUserFromRequest(r)
+		if err != nil || !IsAdmin(uid) {
+			log.WithFields(log.Fields{
+				"func":       "RequireAdmin",
+				"path":       r.URL.Path,
+				"uid":        uid,
+				"request_id": GetRequestIDFromRequest(r),
+			}).Warn("Admin access denied")
+			utils.WriteError(w, r, http.StatusForbidden, model.ErrorCodeForbidden, "Admin access required", nil)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+}
@@ -1,6 +1,7 @@
 package auth
 
 import (
+	"checkmate/api/internal/model"
 	"checkmate/api/internal/utils"
 	"context"
 	"fmt"
@@ -64,7 +65,7 @@ func Authenticate(next http.HandlerFunc) http.HandlerFunc {
 		authHeader := r.Header.Get("Authorization")
 		if authHeader == "" {
 			logger.Warn("Authorization header missing")
-			http.Error(w, "Authorization header required", http.StatusUnauthorized)
+			utils.WriteError(w, r, http.StatusUnauthorized, model.ErrorCodeUnauthorized, "Authorization header required", nil)
 			return
 		}
 
@@ -72,7 +73,7 @@ func Authenticate(next http.HandlerFunc) http.HandlerFunc {
 		idToken := strings.TrimPrefix(authHeader, "Bearer ")
 		if idToken == authHeader {
 			logger.Warn("Invalid Authorization header format")
-			http.Error(w, "Authorization header format must be Bearer {token}", http.StatusUnauthorized)
+			utils.WriteError(w, r, http.StatusUnauthorized, model.ErrorCodeUnauthorized, "Authorization header format must be Bearer {token}", nil)
 			return
 		}
 
@@ -80,7 +81,7 @@ func Authenticate(next http.HandlerFunc) http.HandlerFunc {
 		token, err := authClient.VerifyIDToken(r.Context(), idToken)
 		if err != nil {
 			logger.WithError(err).Warn("Invalid token")
-			http.Error(w, fmt.Sprintf("Invalid token: %v", err), http.StatusUnauthorized)
+			utils.WriteError(w, r, http.StatusUnauthorized, model.ErrorCodeUnauthorized, "Invalid or expired token", nil)
 			return
 		}
 
@@ -105,6 +106,7 @@ func AuthenticateWithRequestID(next http.HandlerFunc) http.HandlerFunc {
 
 		// Create context with request ID
 		ctx := context.WithValue(r.Context(), utils.RequestIDKey, requestID)
+		r = r.WithContext(ctx) // so error responses carry the request ID
 
 		logger := log.WithFields(log.Fields{
 			"func":       "AuthenticateWithRequestID",
@@ -119,7 +121,7 @@ func AuthenticateWithRequestID(next http.HandlerFunc) http.HandlerFunc {
 		authHeader := r.Header.Get("Authorization")
 		if authHeader == "" {
 			logger.Warn("Authorization header missing")
-			http.Error(w, "Authorization header required", http.StatusUnauthorized)
+			utils.WriteError(w, r, http.StatusUnauthorized, model.ErrorCodeUnauthorized, "Authorization header required", nil)
 			return
 		}
 
@@ -127,7 +129,7 @@ func AuthenticateWithRequestID(next http.HandlerFunc) http.HandlerFunc {
 		idToken := strings.TrimPrefix(authHeader, "Bearer ")
 		if idToken == authHeader {
 			logger.Warn("Invalid Authorization header format")
-			http.Error(w, "Authorization header format must be Bearer {token}", http.StatusUnauthorized)
+			utils.WriteError(w, r, http.StatusUnauthorized, model.ErrorCodeUnauthorized, "Authorization header format must be Bearer {token}", nil)
 			return
 		}
 
@@ -135,7 +137,7 @@ func AuthenticateWithRequestID(next http.HandlerFunc) http.HandlerFunc {
 		token, err := authClient.VerifyIDToken(ctx, idToken)
 		if err != nil {
 			logger.WithError(err).Warn("Invalid token")
-			http.Error(w, fmt.Sprintf("Invalid token: %v", err), http.StatusUnauthorized)
+			utils.WriteError(w, r, http.StatusUnauthorized, model.ErrorCodeUnauthorized, "Invalid or expired token", nil)
 			return
 		}
 
@@ -149,6 +151,74 @@ func AuthenticateWithRequestID(next http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
+// subprotocol of the dashboard websocket
+// browsers can't set headers on the upgrade request so the token comes as a second offered subprotocol
+// -> new WebSocket(url, ["checkmate.v1", "bearer." + token]), the server only ever answers with WebSocketProtocol
+const (
+	WebSocketProtocol    = "checkmate.v1"
+	webSocketTokenPrefix = "bearer."
+)
+
+// AuthenticateWebSocket verifies the token of a websocket upgrade, from the Authorization header
+// or the Sec-WebSocket-Protocol values, failures are answered before the upgrade happens
+func AuthenticateWebSocket(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		requestID := utils.GenerateRequestID()
+		w.Header().Set("X-Request-ID", requestID)
+
+		ctx := context.WithValue(r.Context(), utils.RequestIDKey, requestID)
+		r = r.WithContext(ctx) // so error responses carry the request ID
+
+		logger := log.WithFields(log.Fields{
+			"func":       "AuthenticateWebSocket",
+			"path":       r.URL.Path,
+			"request_id": requestID,
+		})
+
+		logger.Debug("Processing websocket authentication request")
+
+		// same format as the http routes when the header is sent, otherwise the subprotocol
+		var idToken string
+		if authHeader := r.Header.Get("Authorization"); authHeader != "" {
+			var ok bool
+			idToken, ok = strings.CutPrefix(authHeader, "Bearer ")
+			if !ok {
+				logger.Warn("Invalid Authorization header format")
+				utils.WriteError(w, r, http.StatusUnauthorized, model.ErrorCodeUnauthorized, "Authorization header format must be Bearer {token}", nil)
+				return
+			}
+		} else {
+			for _, header := range r.Header.Values("Sec-WebSocket-Protocol") {
+				for _, protocol := range strings.Split(header, ",") {
+					if token, ok := strings.CutPrefix(strings.TrimSpace(protocol), webSocketTokenPrefix); ok {
+						idToken = token
+					}
+				}
+			}
+		}
+		if idToken == "" {
+			logger.Warn("Websocket token missing")
+			utils.WriteError(w, r, http.StatusUnauthorized, model.ErrorCodeUnauthorized, "Token required in the Authorization header or the bearer. subprotocol", nil)
+			return
+		}
+
+		// Verify token id
+		token, err := authClient.VerifyIDToken(ctx, idToken)
+		if err != nil {
+			logger.WithError(err).Warn("Invalid token")
+			utils.WriteError(w, r, http.StatusUnauthorized, model.ErrorCodeUnauthorized, "Invalid or expired token", nil)
+			return
+		}
+
+		logger.WithField("uid", token.UID).Debug("Websocket authentication successful")
+
+		ctx = context.WithValue(ctx, "user", token)
+		ctx = context.WithValue(ctx, "uid", token.UID)
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	}
+}
+
 // GetUserFromRequest extracts the user ID from the request context
 func GetUserFromRequest(r *http.Request) (string, error) {
 	uid, ok := r.Context().Value("uid").(string)
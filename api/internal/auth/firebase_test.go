@@ -0,0 +1,38 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// the websocket accepts the same Authorization header as the http routes, a raw token is rejected
+// before the token is ever verified
+func TestAuthenticateWebSocketRequiresBearer(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+	}{
+		{"raw token", "eyJhbGciOi.raw.token"},
+		{"other scheme", "Basic dXNlcjpwYXNz"},
+		{"lowercase bearer", "bearer eyJhbGciOi.raw.token"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called := false
+			h := AuthenticateWebSocket(func(w http.ResponseWriter, r *http.Request) { called = true })
+
+			r := httptest.NewRequest("GET", "/api/v1/ws", nil)
+			r.Header.Set("Authorization", tt.header)
+			// a valid looking subprotocol doesn't rescue a malformed header
+			r.Header.Set("Sec-WebSocket-Protocol", webSocketTokenPrefix+"token")
+			w := httptest.NewRecorder()
+			h(w, r)
+
+			if w.Code != http.StatusUnauthorized || called {
+				t.Fatalf("status %d, handler called %v, want 401 without calling it", w.Code, called)
+			}
+		})
+	}
+}
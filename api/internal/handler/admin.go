@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"checkmate/api/internal/model"
+	"checkmate/api/internal/service"
+	"checkmate/api/internal/storage"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// takes a backup of the database into the backup directory -> admin only
+func CreateBackup(w http.ResponseWriter, r *http.Request) {
+	logger := log.WithFields(log.Fields{
+		"handler":    "CreateBackup",
+		"request_id": r.Context().Value("request_id"),
+	})
+
+	logger.Info("Creating database backup started")
+
+	info, err := storage.BackupToDir(r.Context())
+	if errors.Is(err, storage.ErrBackupUnsupported) {
+		logger.WithError(err).Warn("Backup not supported")
+		writeError(w, r, http.StatusNotImplemented, model.ErrorCodeNotImplemented, err.Error())
+		return
+	} else if err != nil {
+		writeServiceError(w, r, logger, err, "Failed to create backup")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+
+	if err := json.NewEncoder(w).Encode(info); err != nil {
+		logger.WithError(err).Error("Failed to encode backup response")
+		return
+	}
+
+	logger.WithFields(log.Fields{
+		"path":       info.Path,
+		"size_bytes": info.SizeBytes,
+	}).Info("Database backup created")
+}
+
+// retention policy, history table sizes and the last compaction run
+func GetRetentionStatus(w http.ResponseWriter, r *http.Request) {
+	logger := log.WithFields(log.Fields{
+		"handler":    "GetRetentionStatus",
+		"request_id": r.Context().Value("request_id"),
+	})
+
+	status, err := service.GetRetentionStatus(r.Context())
+	if err != nil {
+		writeServiceError(w, r, logger, err, "Failed to get retention status")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		logger.WithError(err).Error("Failed to encode retention status")
+	}
+}
+
+// runs the compaction now and returns its result
+func RunCompaction(w http.ResponseWriter, r *http.Request) {
+	logger := log.WithFields(log.Fields{
+		"handler":    "RunCompaction",
+		"request_id": r.Context().Value("request_id"),
+	})
+
+	logger.Info("Manual compaction requested")
+
+	result, err := service.RunCompaction(r.Context())
+	if err != nil {
+		writeServiceError(w, r, logger, err, "Compaction failed")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		logger.WithError(err).Error("Failed to encode compaction result")
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"strconv"
+	"strings"
 
 	log "github.com/sirupsen/logrus"
 )
@@ -24,7 +25,7 @@ func GetCredentials(w http.ResponseWriter, r *http.Request) {
 	userID, err := auth.GetUserFromRequest(r)
 	if err != nil || userID == "" {
 		logger.WithError(err).Warn("Unauthorized access attempt")
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		writeError(w, r, http.StatusUnauthorized, model.ErrorCodeUnauthorized, "Unauthorized")
 		return
 	}
 
@@ -34,8 +35,7 @@ func GetCredentials(w http.ResponseWriter, r *http.Request) {
 	// get all credentials for user
 	credentials, err := service.GetPlatformCredentials(r.Context(), userID)
 	if err != nil {
-		logger.WithError(err).Error("Failed to get platform credentials")
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeServiceError(w, r, logger, err, "Failed to get credentials")
 		return
 	}
 
@@ -44,6 +44,11 @@ func GetCredentials(w http.ResponseWriter, r *http.Request) {
 	// convert to safe credentials (without API keys)
 	safeCredentials := utils.ConvertToSafeCredentials(credentials)
 
+	// attach circuit breaker state so the user can see unreachable platforms
+	for i := range safeCredentials {
+		safeCredentials[i].Health = service.GetCredentialHealth(safeCredentials[i].ID)
+	}
+
 	// prepare and send response
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
@@ -65,7 +70,7 @@ func CreateCredentials(w http.ResponseWriter, r *http.Request) {
 	userID, err := auth.GetUserFromRequest(r)
 	if err != nil || userID == "" {
 		logger.WithError(err).Warn("Unauthorized access attempt")
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		writeError(w, r, http.StatusUnauthorized, model.ErrorCodeUnauthorized, "Unauthorized")
 		return
 	}
 
@@ -76,17 +81,23 @@ func CreateCredentials(w http.ResponseWriter, r *http.Request) {
 	var input model.PlatformCredentialInput
 	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
 		logger.WithError(err).Warn("Failed to parse request body")
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, model.ErrorCodeInvalidRequest, "Invalid request body")
 		return
 	}
 
 	logger = logger.WithField("platform", input.Platform)
 	logger.Debug("Request body parsed successfully")
 
+	// cheap checks first, validating with the platform is an api call
+	input.Name = strings.TrimSpace(input.Name)
+	if err := service.ValidateCredentialName(input.Name); err != nil {
+		writeServiceError(w, r, logger, err, "Credential name validation failed")
+		return
+	}
+
 	// validate credential with platform before saving
 	if err := service.ValidateCredential(r.Context(), input.Platform, input.APIKey); err != nil {
-		logger.WithError(err).Warn("Credential validation failed")
-		http.Error(w, "Invalid credential: "+err.Error(), http.StatusBadRequest)
+		writeServiceError(w, r, logger, err, "Credential validation failed")
 		return
 	}
 
@@ -95,8 +106,7 @@ func CreateCredentials(w http.ResponseWriter, r *http.Request) {
 	//create credential
 	cred, err := service.CreatePlatformCredential(r.Context(), userID, &input)
 	if err != nil {
-		logger.WithError(err).Error("Failed to create platform credential")
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeServiceError(w, r, logger, err, "Failed to create credential")
 		return
 	}
 
@@ -124,25 +134,25 @@ func UpdateCredential(w http.ResponseWriter, r *http.Request) {
 	userID, err := auth.GetUserFromRequest(r)
 	if err != nil || userID == "" {
 		logger.WithError(err).Warn("Unauthorized access attempt")
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		writeError(w, r, http.StatusUnauthorized, model.ErrorCodeUnauthorized, "Unauthorized")
 		return
 	}
 
 	logger = logger.WithField("user_id", userID)
 	logger.Debug("User authenticated successfully")
 
-	// get credential ID from query params
-	idStr := r.URL.Query().Get("id")
+	// get credential ID from the path, the deprecated routes send it as ?id=
+	idStr := credentialIDParam(r)
 	if idStr == "" {
 		logger.Warn("Missing credential ID in request")
-		http.Error(w, "Missing credential ID", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, model.ErrorCodeInvalidRequest, "Missing credential ID")
 		return
 	}
 
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
 		logger.WithError(err).Warn("Invalid credential ID format")
-		http.Error(w, "Invalid credential ID", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, model.ErrorCodeInvalidRequest, "Invalid credential ID")
 		return
 	}
 
@@ -153,17 +163,25 @@ func UpdateCredential(w http.ResponseWriter, r *http.Request) {
 	var input model.PlatformCredentialInput
 	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
 		logger.WithError(err).Warn("Failed to parse request body")
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, model.ErrorCodeInvalidRequest, "Invalid request body")
 		return
 	}
 
 	logger = logger.WithField("platform", input.Platform)
 	logger.Debug("Request body parsed successfully")
 
+	// name is optional on update, empty keeps the current one
+	input.Name = strings.TrimSpace(input.Name)
+	if input.Name != "" {
+		if err := service.ValidateCredentialName(input.Name); err != nil {
+			writeServiceError(w, r, logger, err, "Credential name validation failed")
+			return
+		}
+	}
+
 	// validate credential before updating
 	if err := service.ValidateCredential(r.Context(), input.Platform, input.APIKey); err != nil {
-		logger.WithError(err).Warn("Credential validation failed")
-		http.Error(w, "Invalid credential: "+err.Error(), http.StatusBadRequest)
+		writeServiceError(w, r, logger, err, "Credential validation failed")
 		return
 	}
 
@@ -171,8 +189,7 @@ func UpdateCredential(w http.ResponseWriter, r *http.Request) {
 
 	// update credential
 	if err := service.UpdatePlatformCredential(r.Context(), id, userID, &input); err != nil {
-		logger.WithError(err).Error("Failed to update platform credential")
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeServiceError(w, r, logger, err, "Failed to update credential")
 		return
 	}
 
@@ -193,25 +210,25 @@ func DeleteCredential(w http.ResponseWriter, r *http.Request) {
 	userID, err := auth.GetUserFromRequest(r)
 	if err != nil || userID == "" {
 		logger.WithError(err).Warn("Unauthorized access attempt")
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		writeError(w, r, http.StatusUnauthorized, model.ErrorCodeUnauthorized, "Unauthorized")
 		return
 	}
 
 	logger = logger.WithField("user_id", userID)
 	logger.Debug("User authenticated successfully")
 
-	// get credential ID from query params
-	idStr := r.URL.Query().Get("id")
+	// get credential ID from the path, the deprecated routes send it as ?id=
+	idStr := credentialIDParam(r)
 	if idStr == "" {
 		logger.Warn("Missing credential ID in request")
-		http.Error(w, "Missing credential ID", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, model.ErrorCodeInvalidRequest, "Missing credential ID")
 		return
 	}
 
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
 		logger.WithError(err).Warn("Invalid credential ID format")
-		http.Error(w, "Invalid credential ID", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, model.ErrorCodeInvalidRequest, "Invalid credential ID")
 		return
 	}
 
@@ -220,8 +237,7 @@ func DeleteCredential(w http.ResponseWriter, r *http.Request) {
 
 	// delete credential
 	if err := service.DeletePlatformCredential(r.Context(), id, userID); err != nil {
-		logger.WithError(err).Error("Failed to delete platform credential")
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeServiceError(w, r, logger, err, "Failed to delete credential")
 		return
 	}
 
@@ -229,3 +245,72 @@ func DeleteCredential(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte(`{"message":"Credential deleted successfully"}`))
 }
+
+// sets or resets the cache ttl of one credential
+func UpdateCredentialCacheTTL(w http.ResponseWriter, r *http.Request) {
+	logger := log.WithFields(log.Fields{
+		"handler":    "UpdateCredentialCacheTTL",
+		"request_id": r.Context().Value("request_id"),
+	})
+
+	logger.Info("Updating credential cache ttl started")
+
+	// get user ID from context
+	userID, err := auth.GetUserFromRequest(r)
+	if err != nil || userID == "" {
+		logger.WithError(err).Warn("Unauthorized access attempt")
+		writeError(w, r, http.StatusUnauthorized, model.ErrorCodeUnauthorized, "Unauthorized")
+		return
+	}
+
+	logger = logger.WithField("user_id", userID)
+	logger.Debug("User authenticated successfully")
+
+	// get credential ID from the path
+	idStr := r.PathValue("id")
+	if idStr == "" {
+		logger.Warn("Missing credential ID in request")
+		writeError(w, r, http.StatusBadRequest, model.ErrorCodeInvalidRequest, "Missing credential ID")
+		return
+	}
+
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		logger.WithError(err).Warn("Invalid credential ID format")
+		writeError(w, r, http.StatusBadRequest, model.ErrorCodeInvalidRequest, "Invalid credential ID")
+		return
+	}
+
+	logger = logger.WithField("credential_id", id)
+	logger.Debug("Credential ID parsed successfully")
+
+	// parse request body
+	var input model.CacheTTLInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		logger.WithError(err).Warn("Failed to parse request body")
+		writeError(w, r, http.StatusBadRequest, model.ErrorCodeInvalidRequest, "Invalid request body")
+		return
+	}
+
+	if err := service.ValidateCacheTTL(input.CacheTTLSeconds); err != nil {
+		writeServiceError(w, r, logger, err, "Cache ttl validation failed")
+		return
+	}
+
+	if err := service.SetPlatformCredentialCacheTTL(r.Context(), id, userID, input.CacheTTLSeconds); err != nil {
+		writeServiceError(w, r, logger, err, "Failed to update credential cache ttl")
+		return
+	}
+
+	logger.Info("Credential cache ttl successfully updated")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"message":"Credential cache ttl updated successfully"}`))
+}
+
+// /credentials/{id} -> path value, old /credentials/update?id= style -> query param
+func credentialIDParam(r *http.Request) string {
+	if id := r.PathValue("id"); id != "" {
+		return id
+	}
+	return r.URL.Query().Get("id")
+}
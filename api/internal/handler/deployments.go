@@ -2,9 +2,16 @@ package handler
 
 import (
 	"checkmate/api/internal/auth"
+	"checkmate/api/internal/model"
 	"checkmate/api/internal/service"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 )
@@ -21,34 +28,312 @@ func GetDeployments(w http.ResponseWriter, r *http.Request) {
 	userID, err := auth.GetUserFromRequest(r)
 	if err != nil || userID == "" {
 		logger.WithError(err).Warn("Unauthorized access attempt")
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		writeError(w, r, http.StatusUnauthorized, model.ErrorCodeUnauthorized, "Unauthorized")
 		return
 	}
 
 	logger = logger.WithField("user_id", userID)
 	logger.Debug("User authenticated successfully")
 
+	query, err := parseDeploymentQuery(r)
+	if err != nil {
+		logger.WithError(err).Warn("Invalid deployments query")
+		writeError(w, r, http.StatusBadRequest, model.ErrorCodeInvalidRequest, err.Error())
+		return
+	}
+
+	// Cache-Control: no-cache -> skip our cache and go to the platforms
+	forceRefresh := hasNoCacheDirective(r)
+
 	//get deployments
-	deployments, err := service.GetAllUserDeployments(r.Context(), userID)
+	page, err := service.ListUserDeployments(r.Context(), userID, query, forceRefresh)
 	if err != nil {
-		logger.WithError(err).Error("Failed to retrieve user deployments")
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeServiceError(w, r, logger, err, "Failed to retrieve deployments")
+		return
+	}
+
+	logger.WithField("deployments_count", len(page.Deployments)).Debug("Retrieved deployments")
+
+	writeDeploymentsResponse(w, r, logger, page)
+}
+
+// unversioned GET /deployments of the previous release -> every deployment unpaginated as {"deployments": [...]}
+// filters, sorting and cursors only exist under /api/v1
+func GetDeploymentsLegacy(w http.ResponseWriter, r *http.Request) {
+	logger := log.WithFields(log.Fields{
+		"handler":    "GetDeploymentsLegacy",
+		"request_id": r.Context().Value("request_id"),
+	})
+
+	logger.Info("Getting deployments started")
+
+	//get the user id from context
+	userID, err := auth.GetUserFromRequest(r)
+	if err != nil || userID == "" {
+		logger.WithError(err).Warn("Unauthorized access attempt")
+		writeError(w, r, http.StatusUnauthorized, model.ErrorCodeUnauthorized, "Unauthorized")
+		return
+	}
+
+	logger = logger.WithField("user_id", userID)
+	logger.Debug("User authenticated successfully")
+
+	deployments, cacheInfos, err := service.GetAllUserDeployments(r.Context(), userID, hasNoCacheDirective(r))
+	if err != nil {
+		writeServiceError(w, r, logger, err, "Failed to retrieve deployments")
 		return
 	}
 
 	logger.WithField("deployments_count", len(deployments)).Debug("Retrieved deployments")
 
+	page := &model.DeploymentPage{Deployments: deployments, Cache: cacheInfos}
+	writeDeploymentsBody(w, r, logger, page, map[string]interface{}{
+		"deployments": deployments,
+	})
+}
+
+// one cached deployment of the user with its platform details, fetched on demand
+func GetDeployment(w http.ResponseWriter, r *http.Request) {
+	logger := log.WithFields(log.Fields{
+		"handler":    "GetDeployment",
+		"request_id": r.Context().Value("request_id"),
+	})
+
+	logger.Info("Getting deployment started")
+
+	//get the user id from context
+	userID, err := auth.GetUserFromRequest(r)
+	if err != nil || userID == "" {
+		logger.WithError(err).Warn("Unauthorized access attempt")
+		writeError(w, r, http.StatusUnauthorized, model.ErrorCodeUnauthorized, "Unauthorized")
+		return
+	}
+
+	logger = logger.WithField("user_id", userID)
+	logger.Debug("User authenticated successfully")
+
+	credentialID, err := strconv.Atoi(r.PathValue("credentialId"))
+	if err != nil {
+		logger.WithError(err).Warn("Invalid credential ID format")
+		writeError(w, r, http.StatusBadRequest, model.ErrorCodeInvalidRequest, "Invalid credential ID")
+		return
+	}
+	deploymentID := r.PathValue("deploymentId")
+
+	logger = logger.WithFields(log.Fields{
+		"credential_id": credentialID,
+		"deployment_id": deploymentID,
+	})
+
+	detail, err := service.GetDeploymentDetail(r.Context(), userID, credentialID, deploymentID)
+	if err != nil {
+		writeServiceError(w, r, logger, err, "Failed to retrieve deployment")
+		return
+	}
+
+	// details come live from the platform, nothing worth caching on the client
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "private, no-store")
+	if err := json.NewEncoder(w).Encode(detail); err != nil {
+		logger.WithError(err).Error("Failed to encode deployment response")
+		return
+	}
+
+	logger.WithField("has_details", detail.Details != nil).Info("Deployment successfully returned")
+}
+
+// GET /deployments query params, all optional
+// platform, credentialId, status (comma separated), serviceType, branch, name (substring),
+// sort (name, status, lastDeployedAt, "-" prefix for descending), limit, cursor
+func parseDeploymentQuery(r *http.Request) (model.DeploymentQuery, error) {
+	params := r.URL.Query()
+	query := model.DeploymentQuery{
+		Platform:    params.Get("platform"),
+		ServiceType: params.Get("serviceType"),
+		Branch:      params.Get("branch"),
+		Name:        strings.TrimSpace(params.Get("name")),
+		Cursor:      params.Get("cursor"),
+	}
+
+	if v := params.Get("credentialId"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			return query, fmt.Errorf("invalid credentialId")
+		}
+		query.CredentialID = &id
+	}
+
+	if v := params.Get("status"); v != "" {
+		for _, status := range strings.Split(v, ",") {
+			if status = strings.TrimSpace(status); status != "" {
+				query.Statuses = append(query.Statuses, model.DeploymentStatus(status))
+			}
+		}
+	}
+
+	if v := params.Get("sort"); v != "" {
+		query.Desc = strings.HasPrefix(v, "-")
+		query.Sort = model.DeploymentSort(strings.TrimPrefix(v, "-"))
+	}
+
+	if v := params.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			return query, fmt.Errorf("invalid limit")
+		}
+		query.Limit = limit
+	}
+
+	return query, nil
+}
+
+// refetches deployments from the platforms, ?credentialId= limits it to one credential
+func RefreshDeployments(w http.ResponseWriter, r *http.Request) {
+	logger := log.WithFields(log.Fields{
+		"handler":    "RefreshDeployments",
+		"request_id": r.Context().Value("request_id"),
+	})
+
+	logger.Info("Refreshing deployments started")
+
+	//get the user id from context
+	userID, err := auth.GetUserFromRequest(r)
+	if err != nil || userID == "" {
+		logger.WithError(err).Warn("Unauthorized access attempt")
+		writeError(w, r, http.StatusUnauthorized, model.ErrorCodeUnauthorized, "Unauthorized")
+		return
+	}
+
+	logger = logger.WithField("user_id", userID)
+	logger.Debug("User authenticated successfully")
+
+	// optional credential ID from query params
+	var credentialID *int
+	if idStr := r.URL.Query().Get("credentialId"); idStr != "" {
+		id, err := strconv.Atoi(idStr)
+		if err != nil {
+			logger.WithError(err).Warn("Invalid credential ID format")
+			writeError(w, r, http.StatusBadRequest, model.ErrorCodeInvalidRequest, "Invalid credential ID")
+			return
+		}
+		credentialID = &id
+		logger = logger.WithField("credential_id", id)
+	}
+
+	deployments, cacheInfos, err := service.RefreshDeployments(r.Context(), userID, credentialID)
+	if err != nil {
+		writeServiceError(w, r, logger, err, "Failed to refresh deployments")
+		return
+	}
+
+	logger.WithField("deployments_count", len(deployments)).Debug("Refreshed deployments")
+
+	writeDeploymentsResponse(w, r, logger, &model.DeploymentPage{Deployments: deployments, Cache: cacheInfos})
+}
+
+// writes the deployments with ETag/Last-Modified headers, answers 304 when the client copy is still current
+func writeDeploymentsResponse(w http.ResponseWriter, r *http.Request, logger *log.Entry, page *model.DeploymentPage) {
+	writeDeploymentsBody(w, r, logger, page, page)
+}
+
+// same with another body than the page, the headers are still computed from the page
+func writeDeploymentsBody(w http.ResponseWriter, r *http.Request, logger *log.Entry, page *model.DeploymentPage, body interface{}) {
+	etag, err := deploymentsETag(page)
+	if err != nil {
+		logger.WithError(err).Error("Failed to compute deployments etag")
+		writeError(w, r, http.StatusInternalServerError, model.ErrorCodeInternal, "Error encoding response")
+		return
+	}
+	lastModified := deploymentsLastModified(page.Deployments)
+
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "private, no-cache")
+	if !lastModified.IsZero() {
+		w.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+
+	if isNotModified(r, etag, lastModified) {
+		logger.Info("Deployments not modified")
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 
 	//* Note-> Remeber to decode on the frontend
-	if err := json.NewEncoder(w).Encode(map[string]interface{}{
-		"deployments": deployments,
-	}); err != nil {
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		// headers are already sent, nothing left to tell the client
 		logger.WithError(err).Error("Failed to encode deployments response")
-		http.Error(w, "Error encoding response", http.StatusInternalServerError)
 		return
 	}
 
 	logger.Info("Deployments successfully returned")
 }
+
+// checks for Cache-Control: no-cache (or Pragma: no-cache from older clients)
+func hasNoCacheDirective(r *http.Request) bool {
+	for _, directive := range strings.Split(r.Header.Get("Cache-Control"), ",") {
+		if strings.EqualFold(strings.TrimSpace(directive), "no-cache") {
+			return true
+		}
+	}
+	return strings.EqualFold(r.Header.Get("Pragma"), "no-cache")
+}
+
+// weak etag over the deployment data only, cache ages and the seen times move on every refresh and shouldn't invalidate it
+// the page comes sorted by the query so the order is part of what is hashed
+func deploymentsETag(page *model.DeploymentPage) (string, error) {
+	deployments := make([]model.Deployment, len(page.Deployments))
+	for i, dep := range page.Deployments {
+		dep.FirstSeenAt, dep.LastSeenAt = nil, nil
+		deployments[i] = dep
+	}
+
+	body, err := json.Marshal(struct {
+		Deployments []model.Deployment
+		NextCursor  string
+	}{deployments, page.NextCursor})
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(body)
+	return `W/"` + hex.EncodeToString(sum[:16]) + `"`, nil
+}
+
+// most recent change of the deployments data, refreshes that changed nothing don't move it
+func deploymentsLastModified(deployments []model.Deployment) time.Time {
+	var lastModified time.Time
+	for _, dep := range deployments {
+		if dep.LastUpdatedAt.After(lastModified) {
+			lastModified = dep.LastUpdatedAt
+		}
+	}
+	return lastModified
+}
+
+// conditional request check, If-None-Match wins over If-Modified-Since
+func isNotModified(r *http.Request, etag string, lastModified time.Time) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		for _, candidate := range strings.Split(inm, ",") {
+			candidate = strings.TrimSpace(candidate)
+			if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		}
+		return false
+	}
+
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" && !lastModified.IsZero() {
+		t, err := http.ParseTime(ims)
+		// http dates have second precision
+		return err == nil && !lastModified.Truncate(time.Second).After(t)
+	}
+
+	return false
+}
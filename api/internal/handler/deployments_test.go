@@ -0,0 +1,101 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func getDeployments(t *testing.T, userID string, header http.Header) *httptest.ResponseRecorder {
+	t.Helper()
+	r := authedRequest(http.MethodGet, "/api/v1/deployments", userID)
+	for name, values := range header {
+		r.Header[name] = values
+	}
+	w := httptest.NewRecorder()
+	GetDeployments(w, r)
+	return w
+}
+
+// refreshes that find nothing new keep the validators, so clients polling with them get 304
+func TestDeploymentsConditionalAcrossNoopRefresh(t *testing.T) {
+	openTestDB(t)
+	cred := createTestCredential(t, "user-etag")
+	render := startFakeRender(t, renderService("srv-1", "api", "live"))
+
+	first := getDeployments(t, cred.UserID, nil)
+	if first.Code != http.StatusOK {
+		t.Fatalf("first request got %d: %s", first.Code, first.Body)
+	}
+	etag, lastModified := first.Header().Get("ETag"), first.Header().Get("Last-Modified")
+	if etag == "" || lastModified == "" {
+		t.Fatalf("missing validators, ETag %q Last-Modified %q", etag, lastModified)
+	}
+
+	// past the second Last-Modified is precise to, a refresh time in it would show
+	time.Sleep(1100 * time.Millisecond)
+
+	cases := []struct {
+		name   string
+		header http.Header
+	}{
+		{"If-None-Match", http.Header{"If-None-Match": {etag}}},
+		{"If-Modified-Since", http.Header{"If-Modified-Since": {lastModified}}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			calls := render.listCalls.Load()
+			c.header.Set("Cache-Control", "no-cache")
+			w := getDeployments(t, cred.UserID, c.header)
+			if render.listCalls.Load() != calls+1 {
+				t.Fatal("Cache-Control: no-cache didn't refresh from the platform")
+			}
+			if w.Code != http.StatusNotModified {
+				t.Fatalf("got %d after a refresh that changed nothing, want 304", w.Code)
+			}
+			if got := w.Header().Get("ETag"); got != etag {
+				t.Errorf("ETag moved from %s to %s", etag, got)
+			}
+		})
+	}
+
+	// a real change does invalidate it
+	render.setStatus("srv-1", "failed")
+	w := getDeployments(t, cred.UserID, http.Header{"If-None-Match": {etag}, "Cache-Control": {"no-cache"}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d after the deployment changed, want 200", w.Code)
+	}
+	if w.Header().Get("ETag") == etag {
+		t.Error("ETag didn't change with the data")
+	}
+	if w.Header().Get("Last-Modified") == lastModified {
+		t.Error("Last-Modified didn't change with the data")
+	}
+}
+
+// within the cache ttl only no-cache goes to the platform
+func TestDeploymentsNoCacheForcesRefresh(t *testing.T) {
+	openTestDB(t)
+	cred := createTestCredential(t, "user-no-cache")
+	render := startFakeRender(t, renderService("srv-1", "api", "live"))
+
+	for i := 0; i < 2; i++ {
+		if w := getDeployments(t, cred.UserID, nil); w.Code != http.StatusOK {
+			t.Fatalf("got %d: %s", w.Code, w.Body)
+		}
+	}
+	if calls := render.listCalls.Load(); calls != 1 {
+		t.Fatalf("platform called %d times within the cache ttl, want 1", calls)
+	}
+
+	for _, header := range []http.Header{{"Cache-Control": {"no-cache"}}, {"Pragma": {"no-cache"}}} {
+		calls := render.listCalls.Load()
+		if w := getDeployments(t, cred.UserID, header); w.Code != http.StatusOK {
+			t.Fatalf("got %d: %s", w.Code, w.Body)
+		}
+		if render.listCalls.Load() != calls+1 {
+			t.Errorf("%v didn't refresh from the platform", header)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package handler
+
+import (
+	"net/http"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// marks a route as deprecated -> Deprecation header plus a Link to the route replacing it
+// wraps the whole chain so even rejected requests tell the client to move
+func Deprecated(successor string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.WithFields(log.Fields{
+			"func":      "Deprecated",
+			"method":    r.Method,
+			"path":      r.URL.Path,
+			"successor": successor,
+		}).Warn("Deprecated route called")
+
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Link", "<"+successor+`>; rel="successor-version"`)
+		next(w, r)
+	}
+}
@@ -0,0 +1,51 @@
+package handler
+
+import (
+	"checkmate/api/internal/model"
+	"checkmate/api/internal/service"
+	"checkmate/api/internal/utils"
+	"errors"
+	"net/http"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// service sentinel -> status and code of the response
+var serviceErrorStatus = []struct {
+	err    error
+	status int
+	code   string
+}{
+	{service.ErrInvalidInput, http.StatusBadRequest, model.ErrorCodeInvalidInput},
+	{service.ErrInvalidCredential, http.StatusUnprocessableEntity, model.ErrorCodeInvalidCredential},
+	{service.ErrNotFound, http.StatusNotFound, model.ErrorCodeNotFound},
+	{service.ErrForbidden, http.StatusForbidden, model.ErrorCodeForbidden},
+	{service.ErrConflict, http.StatusConflict, model.ErrorCodeConflict},
+	{service.ErrUpstreamUnavailable, http.StatusBadGateway, model.ErrorCodeUpstreamUnavailable},
+}
+
+// error raised by the handler itself (bad query param, missing auth...)
+func writeError(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	utils.WriteError(w, r, status, code, message, nil)
+}
+
+// logs and writes an error coming from the service layer
+// sentinel errors carry a message meant for the client, anything else is a 500 with fallback as the message
+// so internal details never reach the response
+func writeServiceError(w http.ResponseWriter, r *http.Request, logger *log.Entry, err error, fallback string) {
+	status, code, message := classifyServiceError(logger, err, fallback)
+	utils.WriteError(w, r, status, code, message, nil)
+}
+
+// logs a service error and picks the status, code and message shown to the client
+func classifyServiceError(logger *log.Entry, err error, fallback string) (int, string, string) {
+	for _, s := range serviceErrorStatus {
+		if errors.Is(err, s.err) {
+			logger.WithError(err).WithField("status", s.status).Warn(fallback)
+			return s.status, s.code, err.Error()
+		}
+	}
+
+	logger.WithError(err).Error(fallback)
+	return http.StatusInternalServerError, model.ErrorCodeInternal, fallback
+}
@@ -0,0 +1,100 @@
+package handler
+
+import (
+	"checkmate/api/internal/auth"
+	"checkmate/api/internal/model"
+	"checkmate/api/internal/service"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// status change history of the user's deployments
+// query params (all optional): credentialId, deploymentId, since, until (RFC3339), limit
+func GetDeploymentEvents(w http.ResponseWriter, r *http.Request) {
+	logger := log.WithFields(log.Fields{
+		"handler":    "GetDeploymentEvents",
+		"request_id": r.Context().Value("request_id"),
+	})
+
+	logger.Info("Getting deployment events started")
+
+	//get the user id from context
+	userID, err := auth.GetUserFromRequest(r)
+	if err != nil || userID == "" {
+		logger.WithError(err).Warn("Unauthorized access attempt")
+		writeError(w, r, http.StatusUnauthorized, model.ErrorCodeUnauthorized, "Unauthorized")
+		return
+	}
+
+	logger = logger.WithField("user_id", userID)
+	logger.Debug("User authenticated successfully")
+
+	query := r.URL.Query()
+	filter := model.DeploymentEventFilter{
+		DeploymentID: query.Get("deploymentId"),
+	}
+
+	if idStr := query.Get("credentialId"); idStr != "" {
+		id, err := strconv.Atoi(idStr)
+		if err != nil {
+			logger.WithError(err).Warn("Invalid credential ID format")
+			writeError(w, r, http.StatusBadRequest, model.ErrorCodeInvalidRequest, "Invalid credential ID")
+			return
+		}
+		filter.CredentialID = &id
+	}
+
+	if v := query.Get("since"); v != "" {
+		since, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			logger.WithError(err).Warn("Invalid since format")
+			writeError(w, r, http.StatusBadRequest, model.ErrorCodeInvalidRequest, "Invalid since, expected RFC3339")
+			return
+		}
+		filter.Since = &since
+	}
+
+	if v := query.Get("until"); v != "" {
+		until, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			logger.WithError(err).Warn("Invalid until format")
+			writeError(w, r, http.StatusBadRequest, model.ErrorCodeInvalidRequest, "Invalid until, expected RFC3339")
+			return
+		}
+		filter.Until = &until
+	}
+
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			logger.WithError(err).Warn("Invalid limit")
+			writeError(w, r, http.StatusBadRequest, model.ErrorCodeInvalidRequest, "Invalid limit")
+			return
+		}
+		filter.Limit = limit
+	}
+
+	events, err := service.GetDeploymentEvents(r.Context(), userID, filter)
+	if err != nil {
+		writeServiceError(w, r, logger, err, "Failed to retrieve deployment events")
+		return
+	}
+
+	logger.WithField("events_count", len(events)).Debug("Retrieved deployment events")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"events": events,
+	}); err != nil {
+		logger.WithError(err).Error("Failed to encode deployment events response")
+		return
+	}
+
+	logger.Info("Deployment events successfully returned")
+}
@@ -0,0 +1,124 @@
+package handler
+
+import (
+	"checkmate/api/internal/model"
+	"checkmate/api/internal/platform"
+	"checkmate/api/internal/storage"
+	"checkmate/api/internal/utils"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fresh sqlite database with the schema and an encryption key, the storage globals point at it for the duration of the test
+func openTestDB(t *testing.T) {
+	t.Helper()
+	t.Setenv("DATABASE_URL", "")
+	t.Setenv("SQLITE_PATH", filepath.Join(t.TempDir(), "checkmate.db"))
+	t.Setenv("ENCRYPTION_KEY", base64.StdEncoding.EncodeToString(make([]byte, 32)))
+	if err := utils.InitEncryption(); err != nil {
+		t.Fatalf("init encryption: %v", err)
+	}
+	if err := storage.Open(); err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	if _, err := storage.MigrateUp(context.Background()); err != nil {
+		t.Fatalf("migrate db: %v", err)
+	}
+	t.Cleanup(func() { storage.DB.Close() })
+}
+
+// user with one render credential
+func createTestCredential(t *testing.T, userID string) *model.PlatformCredential {
+	t.Helper()
+	ctx := context.Background()
+	if err := storage.Users.Create(ctx, &model.User{ID: userID, Email: userID + "@example.com", CreatedAt: time.Now()}); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	key, err := utils.EncryptString("rnd_" + userID)
+	if err != nil {
+		t.Fatalf("encrypt key: %v", err)
+	}
+	cred := &model.PlatformCredential{UserID: userID, Name: "render", Platform: "render", APIKey: key, CreatedAt: time.Now()}
+	if cred.ID, err = storage.Credentials.Create(ctx, cred); err != nil {
+		t.Fatalf("create credential: %v", err)
+	}
+	return cred
+}
+
+// makes the cache of the credential stale, the next read goes to the platform
+func expireCache(t *testing.T, credentialID int) {
+	t.Helper()
+	_, err := storage.DB.ExecContext(context.Background(),
+		`UPDATE platform_credentials SET cache_refreshed_at = ? WHERE id = ?`, time.Now().Add(-time.Hour).UTC(), credentialID)
+	if err != nil {
+		t.Fatalf("expire cache: %v", err)
+	}
+}
+
+// render api stand-in serving the given services, counts the GET /services calls
+type fakeRender struct {
+	mu        sync.Mutex
+	services  []model.RenderService
+	listCalls atomic.Int32
+}
+
+func startFakeRender(t *testing.T, services ...model.RenderService) *fakeRender {
+	t.Helper()
+	f := &fakeRender{services: services}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.URL.Path == "/services":
+			f.listCalls.Add(1)
+			f.mu.Lock()
+			list := make([]model.RenderServiceResponse, 0, len(f.services))
+			for _, s := range f.services {
+				list = append(list, model.RenderServiceResponse{Service: s})
+			}
+			f.mu.Unlock()
+			json.NewEncoder(w).Encode(list)
+		case strings.HasSuffix(r.URL.Path, "/deploys"):
+			w.Write([]byte("[]"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	previous := platform.RenderAPIBaseURL
+	platform.RenderAPIBaseURL = srv.URL
+	t.Cleanup(func() {
+		platform.RenderAPIBaseURL = previous
+		srv.Close()
+	})
+	return f
+}
+
+func (f *fakeRender) setStatus(id, status string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i := range f.services {
+		if f.services[i].ID == id {
+			f.services[i].Status = status
+			f.services[i].UpdatedAt = time.Now()
+		}
+	}
+}
+
+func renderService(id, name, status string) model.RenderService {
+	now := time.Now()
+	return model.RenderService{ID: id, Name: name, Type: "web_service", Branch: "main", Status: status, CreatedAt: now.Add(-time.Hour), UpdatedAt: now}
+}
+
+// request as the auth middleware hands it over
+func authedRequest(method, target, userID string) *http.Request {
+	r := httptest.NewRequest(method, target, nil)
+	return r.WithContext(context.WithValue(r.Context(), "uid", userID))
+}
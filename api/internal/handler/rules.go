@@ -0,0 +1,216 @@
+package handler
+
+import (
+	"checkmate/api/internal/auth"
+	"checkmate/api/internal/model"
+	"checkmate/api/internal/service"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func GetNotificationRules(w http.ResponseWriter, r *http.Request) {
+	logger := log.WithFields(log.Fields{
+		"handler":    "GetNotificationRules",
+		"request_id": r.Context().Value("request_id"),
+	})
+
+	logger.Info("Getting notification rules started")
+
+	// get user ID from context
+	userID, err := auth.GetUserFromRequest(r)
+	if err != nil || userID == "" {
+		logger.WithError(err).Warn("Unauthorized access attempt")
+		writeError(w, r, http.StatusUnauthorized, model.ErrorCodeUnauthorized, "Unauthorized")
+		return
+	}
+
+	logger = logger.WithField("user_id", userID)
+	logger.Debug("User authenticated successfully")
+
+	rules, err := service.GetNotificationRules(r.Context(), userID)
+	if err != nil {
+		writeServiceError(w, r, logger, err, "Failed to get notification rules")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"rules": rules,
+	})
+
+	logger.WithField("rules_count", len(rules)).Info("Notification rules successfully returned")
+}
+
+func CreateNotificationRule(w http.ResponseWriter, r *http.Request) {
+	logger := log.WithFields(log.Fields{
+		"handler":    "CreateNotificationRule",
+		"request_id": r.Context().Value("request_id"),
+	})
+
+	logger.Info("Creating notification rule started")
+
+	// get user ID from context
+	userID, err := auth.GetUserFromRequest(r)
+	if err != nil || userID == "" {
+		logger.WithError(err).Warn("Unauthorized access attempt")
+		writeError(w, r, http.StatusUnauthorized, model.ErrorCodeUnauthorized, "Unauthorized")
+		return
+	}
+
+	logger = logger.WithField("user_id", userID)
+	logger.Debug("User authenticated successfully")
+
+	// parse request body
+	var input model.NotificationRuleInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		logger.WithError(err).Warn("Failed to parse request body")
+		writeError(w, r, http.StatusBadRequest, model.ErrorCodeInvalidRequest, "Invalid request body")
+		return
+	}
+
+	rule, err := service.CreateNotificationRule(r.Context(), userID, &input)
+	if err != nil {
+		writeServiceError(w, r, logger, err, "Failed to create notification rule")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(rule)
+
+	logger.WithField("rule_id", rule.ID).Info("New notification rule successfully created and returned")
+}
+
+func UpdateNotificationRule(w http.ResponseWriter, r *http.Request) {
+	logger := log.WithFields(log.Fields{
+		"handler":    "UpdateNotificationRule",
+		"request_id": r.Context().Value("request_id"),
+	})
+
+	logger.Info("Updating notification rule started")
+
+	// get user ID from context
+	userID, err := auth.GetUserFromRequest(r)
+	if err != nil || userID == "" {
+		logger.WithError(err).Warn("Unauthorized access attempt")
+		writeError(w, r, http.StatusUnauthorized, model.ErrorCodeUnauthorized, "Unauthorized")
+		return
+	}
+
+	logger = logger.WithField("user_id", userID)
+	logger.Debug("User authenticated successfully")
+
+	id, ok := ruleIDParam(w, r, logger)
+	if !ok {
+		return
+	}
+	logger = logger.WithField("rule_id", id)
+
+	// parse request body
+	var input model.NotificationRuleInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		logger.WithError(err).Warn("Failed to parse request body")
+		writeError(w, r, http.StatusBadRequest, model.ErrorCodeInvalidRequest, "Invalid request body")
+		return
+	}
+
+	rule, err := service.UpdateNotificationRule(r.Context(), id, userID, &input)
+	if err != nil {
+		writeServiceError(w, r, logger, err, "Failed to update notification rule")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rule)
+
+	logger.Info("Notification rule successfully updated")
+}
+
+func DeleteNotificationRule(w http.ResponseWriter, r *http.Request) {
+	logger := log.WithFields(log.Fields{
+		"handler":    "DeleteNotificationRule",
+		"request_id": r.Context().Value("request_id"),
+	})
+
+	logger.Info("Deleting notification rule started")
+
+	// get user ID from context
+	userID, err := auth.GetUserFromRequest(r)
+	if err != nil || userID == "" {
+		logger.WithError(err).Warn("Unauthorized access attempt")
+		writeError(w, r, http.StatusUnauthorized, model.ErrorCodeUnauthorized, "Unauthorized")
+		return
+	}
+
+	logger = logger.WithField("user_id", userID)
+	logger.Debug("User authenticated successfully")
+
+	id, ok := ruleIDParam(w, r, logger)
+	if !ok {
+		return
+	}
+	logger = logger.WithField("rule_id", id)
+
+	if err := service.DeleteNotificationRule(r.Context(), id, userID); err != nil {
+		writeServiceError(w, r, logger, err, "Failed to delete notification rule")
+		return
+	}
+
+	logger.Info("Notification rule successfully deleted")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"message":"Notification rule deleted successfully"}`))
+}
+
+// dry run of the rules for a stored or made up event, nothing is sent or queued
+func PreviewNotificationRules(w http.ResponseWriter, r *http.Request) {
+	logger := log.WithFields(log.Fields{
+		"handler":    "PreviewNotificationRules",
+		"request_id": r.Context().Value("request_id"),
+	})
+
+	logger.Info("Previewing notification rules started")
+
+	// get user ID from context
+	userID, err := auth.GetUserFromRequest(r)
+	if err != nil || userID == "" {
+		logger.WithError(err).Warn("Unauthorized access attempt")
+		writeError(w, r, http.StatusUnauthorized, model.ErrorCodeUnauthorized, "Unauthorized")
+		return
+	}
+
+	logger = logger.WithField("user_id", userID)
+	logger.Debug("User authenticated successfully")
+
+	// parse request body
+	var input model.RulePreviewInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		logger.WithError(err).Warn("Failed to parse request body")
+		writeError(w, r, http.StatusBadRequest, model.ErrorCodeInvalidRequest, "Invalid request body")
+		return
+	}
+
+	preview, err := service.PreviewNotificationRules(r.Context(), userID, &input)
+	if err != nil {
+		writeServiceError(w, r, logger, err, "Failed to preview notification rules")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(preview)
+
+	logger.WithField("event_type", preview.EventType).Info("Notification rules preview successfully returned")
+}
+
+func ruleIDParam(w http.ResponseWriter, r *http.Request, logger *log.Entry) (int, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		logger.WithError(err).Warn("Invalid notification rule ID format")
+		writeError(w, r, http.StatusBadRequest, model.ErrorCodeInvalidRequest, "Invalid notification rule ID")
+		return 0, false
+	}
+	return id, true
+}
@@ -0,0 +1,203 @@
+package handler
+
+import (
+	"checkmate/api/internal/auth"
+	"checkmate/api/internal/model"
+	"checkmate/api/internal/service"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// how long the browser waits before reconnecting a dropped stream
+const streamRetry = 5 * time.Second
+
+// Server-Sent Events stream of the user's deployments
+// starts with a "snapshot" event (or the missed changes when Last-Event-ID is sent),
+// then one "added", "status_changed" or "removed" event per change, with the deployment event id as the SSE id
+func StreamDeployments(w http.ResponseWriter, r *http.Request) {
+	logger := log.WithFields(log.Fields{
+		"handler":    "StreamDeployments",
+		"request_id": r.Context().Value("request_id"),
+	})
+
+	logger.Info("Deployment stream started")
+
+	//get the user id from context
+	userID, err := auth.GetUserFromRequest(r)
+	if err != nil || userID == "" {
+		logger.WithError(err).Warn("Unauthorized access attempt")
+		writeError(w, r, http.StatusUnauthorized, model.ErrorCodeUnauthorized, "Unauthorized")
+		return
+	}
+
+	logger = logger.WithField("user_id", userID)
+	logger.Debug("User authenticated successfully")
+
+	var lastEventID int64
+	if v := strings.TrimSpace(r.Header.Get("Last-Event-ID")); v != "" {
+		lastEventID, err = strconv.ParseInt(v, 10, 64)
+		if err != nil || lastEventID < 0 {
+			logger.WithError(err).Warn("Invalid Last-Event-ID")
+			writeError(w, r, http.StatusBadRequest, model.ErrorCodeInvalidRequest, "Invalid Last-Event-ID")
+			return
+		}
+	}
+
+	// subscribe before reading the initial state so nothing published in between is lost,
+	// changes already covered by it are skipped by id below
+	sub := service.SubscribeDeployments(userID)
+	defer sub.Close()
+
+	stream := &eventStream{w: w, rc: http.NewResponseController(w)}
+
+	// the stream is long lived, the server write timeout doesn't apply to it
+	if err := stream.rc.SetWriteDeadline(time.Time{}); err != nil && err != http.ErrNotSupported {
+		logger.WithError(err).Warn("Failed to clear write deadline")
+	}
+
+	ctx := r.Context()
+
+	var replay []model.DeploymentChangeEvent
+	resumed := false
+	if lastEventID > 0 {
+		replay, resumed, err = service.ReplayDeploymentChanges(ctx, userID, lastEventID)
+		if err != nil {
+			writeServiceError(w, r, logger, err, "Failed to replay deployment changes")
+			return
+		}
+	}
+
+	var snapshot *model.DeploymentSnapshot
+	if !resumed {
+		if snapshot, err = service.GetDeploymentSnapshot(ctx, userID); err != nil {
+			writeServiceError(w, r, logger, err, "Failed to retrieve deployments")
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	// nginx buffers responses by default, that would hold the events back
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	fmt.Fprintf(w, "retry: %d\n\n", streamRetry.Milliseconds())
+
+	if resumed {
+		logger.WithFields(log.Fields{
+			"last_event_id":  lastEventID,
+			"replayed_count": len(replay),
+		}).Debug("Resuming deployment stream")
+		for _, change := range replay {
+			if err := stream.send(change.Event.ID, string(change.Type), change); err != nil {
+				logger.WithError(err).Debug("Deployment stream closed by client")
+				return
+			}
+		}
+	} else {
+		lastEventID = snapshot.LastEventID
+		if err := stream.send(snapshot.LastEventID, "snapshot", snapshot); err != nil {
+			logger.WithError(err).Debug("Deployment stream closed by client")
+			return
+		}
+	}
+	if err := stream.flush(); err != nil {
+		logger.WithError(err).Debug("Deployment stream closed by client")
+		return
+	}
+
+	// the replayed changes are read back by the first catch up and skipped there
+	cursor := service.NewStreamCursor(userID, lastEventID)
+	for _, change := range replay {
+		cursor.MarkSent(change.Event.ID)
+	}
+
+	heartbeat := time.NewTicker(service.StreamHeartbeatInterval)
+	defer heartbeat.Stop()
+	refresh := time.NewTicker(service.StreamRefreshInterval)
+	defer refresh.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Info("Deployment stream closed by client")
+			return
+
+		case change, ok := <-sub.C:
+			if !ok {
+				// shutdown or the stream fell behind, the client reconnects with Last-Event-ID
+				logger.Info("Deployment stream ended by server")
+				return
+			}
+			// already sent with the snapshot, a replay or an earlier catch up
+			if cursor.Sent(change.Event.ID) {
+				continue
+			}
+			// refreshes publish after their commit, two of them can publish out of id order
+			// -> read back what the stream doesn't have instead of sending this change alone, a lower id published late isn't lost
+			missed, ok, err := cursor.CatchUp(ctx)
+			if err != nil {
+				logger.WithError(err).Warn("Failed to read deployment changes, ending stream")
+				return
+			}
+			if !ok {
+				// the client reconnects with Last-Event-ID and gets a new snapshot
+				logger.WithField("last_event_id", lastEventID).Info("Deployment stream too far behind, ending it")
+				return
+			}
+			for _, change := range missed {
+				if err := stream.send(change.Event.ID, string(change.Type), change); err != nil {
+					logger.WithError(err).Debug("Deployment stream closed by client")
+					return
+				}
+				lastEventID = max(lastEventID, change.Event.ID)
+			}
+			if err := stream.flush(); err != nil {
+				logger.WithError(err).Debug("Deployment stream closed by client")
+				return
+			}
+
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				logger.WithError(err).Debug("Deployment stream closed by client")
+				return
+			}
+			if err := stream.flush(); err != nil {
+				logger.WithError(err).Debug("Deployment stream closed by client")
+				return
+			}
+
+		case <-refresh.C:
+			// goes through the cache rules like a poll would, changes come back through sub.C
+			if _, _, err := service.GetAllUserDeployments(ctx, userID, false); err != nil {
+				logger.WithError(err).Warn("Failed to revalidate deployments for stream")
+			}
+		}
+	}
+}
+
+// writes SSE messages, data is JSON on a single line
+type eventStream struct {
+	w  http.ResponseWriter
+	rc *http.ResponseController
+}
+
+func (s *eventStream) send(id int64, event string, data interface{}) error {
+	body, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(s.w, "id: %d\nevent: %s\ndata: %s\n\n", id, event, body)
+	return err
+}
+
+func (s *eventStream) flush() error {
+	return s.rc.Flush()
+}
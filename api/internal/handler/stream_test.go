@@ -0,0 +1,206 @@
+package handler
+
+import (
+	"bufio"
+	"checkmate/api/internal/model"
+	"checkmate/api/internal/service"
+	"checkmate/api/internal/storage"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// one SSE message, comment lines come back as event "comment"
+type sseMessage struct {
+	id    string
+	event string
+	data  string
+}
+
+type sseClient struct {
+	t     *testing.T
+	resp  *http.Response
+	lines *bufio.Scanner
+}
+
+// opens the stream of the user, the body is closed with the test before the server shuts down
+func openStream(t *testing.T, userID, lastEventID string) *sseClient {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		StreamDeployments(w, r.WithContext(context.WithValue(r.Context(), "uid", userID)))
+	}))
+	t.Cleanup(srv.Close)
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("open stream: %v", err)
+	}
+	// registered after srv.Close so it runs first
+	t.Cleanup(func() { resp.Body.Close() })
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("stream answered %d", resp.StatusCode)
+	}
+	return &sseClient{t: t, resp: resp, lines: bufio.NewScanner(resp.Body)}
+}
+
+// next message, the retry preamble is skipped
+func (c *sseClient) next() sseMessage {
+	c.t.Helper()
+	done := make(chan sseMessage, 1)
+	go func() {
+		var msg sseMessage
+		for c.lines.Scan() {
+			line := c.lines.Text()
+			switch {
+			case line == "":
+				if msg != (sseMessage{}) {
+					done <- msg
+					return
+				}
+			case strings.HasPrefix(line, ":"):
+				done <- sseMessage{event: "comment", data: strings.TrimSpace(line[1:])}
+				return
+			case strings.HasPrefix(line, "id: "):
+				msg.id = line[len("id: "):]
+			case strings.HasPrefix(line, "event: "):
+				msg.event = line[len("event: "):]
+			case strings.HasPrefix(line, "data: "):
+				msg.data = line[len("data: "):]
+			}
+		}
+		close(done)
+	}()
+
+	select {
+	case msg, ok := <-done:
+		if !ok {
+			c.t.Fatal("stream ended")
+		}
+		return msg
+	case <-time.After(5 * time.Second):
+		c.t.Fatal("no message on the stream")
+	}
+	return sseMessage{}
+}
+
+// stored events of srv-1 flipping between live and failed
+func writeEvents(t *testing.T, cred *model.PlatformCredential, n int) {
+	t.Helper()
+	events := make([]model.DeploymentEvent, n)
+	for i := range events {
+		old, status := model.DeploymentStatusLive, model.DeploymentStatusFailed
+		if i%2 == 1 {
+			old, status = status, old
+		}
+		events[i] = model.DeploymentEvent{PlatformCredentialID: cred.ID, DeploymentID: "srv-1", DeploymentName: "api", OldStatus: old, NewStatus: status, ObservedAt: time.Now()}
+	}
+	_, err := storage.Deployments.WriteCache(context.Background(), cred.ID, func(map[string]storage.CachedDeploymentState) (*storage.CacheWrite, error) {
+		return &storage.CacheWrite{At: time.Now(), Events: events}, nil
+	})
+	if err != nil {
+		t.Fatalf("write events: %v", err)
+	}
+}
+
+func TestStreamSnapshotThenChanges(t *testing.T) {
+	openTestDB(t)
+	cred := createTestCredential(t, "user-stream")
+	render := startFakeRender(t, renderService("srv-1", "api", "live"))
+
+	stream := openStream(t, cred.UserID, "")
+	msg := stream.next()
+	if msg.event != "snapshot" {
+		t.Fatalf("first message is %q, want snapshot", msg.event)
+	}
+	var snapshot model.DeploymentSnapshot
+	if err := json.Unmarshal([]byte(msg.data), &snapshot); err != nil {
+		t.Fatalf("decode snapshot: %v", err)
+	}
+	if len(snapshot.Deployments) != 1 || msg.id != strconv.FormatInt(snapshot.LastEventID, 10) {
+		t.Fatalf("snapshot has %d deployments and id %s, want 1 and its last event id %d", len(snapshot.Deployments), msg.id, snapshot.LastEventID)
+	}
+
+	render.setStatus("srv-1", "failed")
+	if _, _, err := service.RefreshDeployments(context.Background(), cred.UserID, nil); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	msg = stream.next()
+	var change model.DeploymentChangeEvent
+	if err := json.Unmarshal([]byte(msg.data), &change); err != nil {
+		t.Fatalf("decode change: %v", err)
+	}
+	if msg.event != string(model.DeploymentChangeStatusChanged) || change.Event.NewStatus != model.DeploymentStatusFailed {
+		t.Fatalf("got %s to %s, want status_changed to failed", msg.event, change.Event.NewStatus)
+	}
+	if msg.id != strconv.FormatInt(change.Event.ID, 10) {
+		t.Errorf("message id %s isn't the event id %d", msg.id, change.Event.ID)
+	}
+}
+
+func TestStreamResumesFromLastEventID(t *testing.T) {
+	openTestDB(t)
+	cred := createTestCredential(t, "user-resume")
+	render := startFakeRender(t, renderService("srv-1", "api", "live"))
+	// first load of the credential, a baseline without events
+	if _, _, err := service.RefreshDeployments(context.Background(), cred.UserID, nil); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	writeEvents(t, cred, 3)
+
+	stream := openStream(t, cred.UserID, "1")
+	for _, want := range []string{"2", "3"} {
+		msg := stream.next()
+		if msg.event != string(model.DeploymentChangeStatusChanged) || msg.id != want {
+			t.Fatalf("got %s %s, want the missed change %s", msg.event, msg.id, want)
+		}
+	}
+
+	// then live changes, the replayed ones aren't sent again
+	render.setStatus("srv-1", "failed")
+	if _, _, err := service.RefreshDeployments(context.Background(), cred.UserID, nil); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	if msg := stream.next(); msg.id != "4" {
+		t.Fatalf("got %s %s after the replay, want the new change 4", msg.event, msg.id)
+	}
+}
+
+// further behind than the replay limit the client starts over from a snapshot
+func TestStreamTooFarBehindGetsSnapshot(t *testing.T) {
+	openTestDB(t)
+	cred := createTestCredential(t, "user-behind")
+	startFakeRender(t, renderService("srv-1", "api", "live"))
+	writeEvents(t, cred, 600)
+
+	msg := openStream(t, cred.UserID, "1").next()
+	if msg.event != "snapshot" || msg.id != "600" {
+		t.Fatalf("got %s %s, want a snapshot at 600", msg.event, msg.id)
+	}
+}
+
+func TestStreamHeartbeat(t *testing.T) {
+	openTestDB(t)
+	cred := createTestCredential(t, "user-heartbeat")
+	startFakeRender(t, renderService("srv-1", "api", "live"))
+
+	previous := service.StreamHeartbeatInterval
+	service.StreamHeartbeatInterval = 20 * time.Millisecond
+	t.Cleanup(func() { service.StreamHeartbeatInterval = previous })
+
+	stream := openStream(t, cred.UserID, "")
+	if msg := stream.next(); msg.event != "snapshot" {
+		t.Fatalf("first message is %q, want snapshot", msg.event)
+	}
+	if msg := stream.next(); msg.event != "comment" || msg.data != "heartbeat" {
+		t.Fatalf("got %+v, want a heartbeat comment", msg)
+	}
+}
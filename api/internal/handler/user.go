@@ -5,45 +5,50 @@ import (
 	"checkmate/api/internal/model"
 	"checkmate/api/internal/service"
 	"encoding/json"
-	"log"
 	"net/http"
+
+	log "github.com/sirupsen/logrus"
 )
 
 // get current user profile
 func GetCurrentUser(w http.ResponseWriter, r *http.Request) {
-	log.Println("GetCurrentUser handler called")
+	logger := log.WithFields(log.Fields{
+		"handler":    "GetCurrentUser",
+		"request_id": r.Context().Value("request_id"),
+	})
+
+	logger.Info("Getting current user started")
 
 	// get user ID from request
 	userID, err := auth.GetUserFromRequest(r)
-	if err != nil {
-		log.Printf("Error getting user from request: %v", err)
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	if err != nil || userID == "" {
+		logger.WithError(err).Warn("Unauthorized access attempt")
+		writeError(w, r, http.StatusUnauthorized, model.ErrorCodeUnauthorized, "Unauthorized")
 		return
 	}
-	log.Printf("User ID from request: %s", userID)
+
+	logger = logger.WithField("user_id", userID)
+	logger.Debug("User authenticated successfully")
 
 	// get user from the database
 	user, err := service.GetUserById(r.Context(), userID)
 	if err != nil {
-		log.Printf("Error retrieving user: %v", err)
-		http.Error(w, "Error retrieving user", http.StatusInternalServerError)
+		writeServiceError(w, r, logger, err, "Error retrieving user")
 		return
 	}
 
 	// if user doesn't exist, create a new record
 	if user == nil {
-		log.Println("User not found in database. Creating new user...")
+		logger.Info("User not found in database, creating new user")
 
 		// get Firebase token to extract user info
 		token, err := auth.GetTokenFromRequest(r)
 		if err != nil {
-			log.Printf("Error getting token: %v", err)
-			http.Error(w, "Error getting token", http.StatusInternalServerError)
+			logger.WithError(err).Error("Failed to get token from request")
+			writeError(w, r, http.StatusInternalServerError, model.ErrorCodeInternal, "Error getting token")
 			return
 		}
 
-		log.Printf("Token retrieved for user %s", userID)
-
 		// create new user model with Firebase user data
 		user = &model.User{
 			ID: userID,
@@ -53,7 +58,7 @@ func GetCurrentUser(w http.ResponseWriter, r *http.Request) {
 		if email, ok := token.Claims["email"].(string); ok {
 			user.Email = email
 		} else {
-			log.Println("Warning: No email found in token claims")
+			logger.Warn("No email found in token claims")
 			// default email to avoid database constraints
 			user.Email = userID + "@unknown.com"
 		}
@@ -62,29 +67,26 @@ func GetCurrentUser(w http.ResponseWriter, r *http.Request) {
 		if name, ok := token.Claims["name"].(string); ok {
 			user.DisplayName = name
 		} else {
-			log.Println("No display name found in token claims")
+			logger.Debug("No display name found in token claims")
 		}
 
 		// Save new user
-		err = service.CreateUser(r.Context(), user)
-		if err != nil {
-			log.Printf("Error creating user: %v", err)
-			http.Error(w, "Error creating user", http.StatusInternalServerError)
+		if err := service.CreateUser(r.Context(), user); err != nil {
+			writeServiceError(w, r, logger, err, "Error creating user")
 			return
 		}
 
-		log.Println("User successfully created")
+		logger.Info("User successfully created")
 	} else {
-		log.Printf("User found in database: %s", user.Email)
+		logger.Debug("User found in database")
 	}
 
 	// return the user data
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(user); err != nil {
-		log.Printf("Error encoding user to JSON: %v", err)
-		http.Error(w, "Error encoding response", http.StatusInternalServerError)
+		logger.WithError(err).Error("Failed to encode user response")
 		return
 	}
 
-	log.Println("User data successfully returned")
+	logger.Info("User data successfully returned")
 }
@@ -0,0 +1,279 @@
+package handler
+
+import (
+	"checkmate/api/internal/auth"
+	"checkmate/api/internal/model"
+	"checkmate/api/internal/service"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func GetWebhooks(w http.ResponseWriter, r *http.Request) {
+	logger := log.WithFields(log.Fields{
+		"handler":    "GetWebhooks",
+		"request_id": r.Context().Value("request_id"),
+	})
+
+	logger.Info("Getting webhooks started")
+
+	// get user ID from context
+	userID, err := auth.GetUserFromRequest(r)
+	if err != nil || userID == "" {
+		logger.WithError(err).Warn("Unauthorized access attempt")
+		writeError(w, r, http.StatusUnauthorized, model.ErrorCodeUnauthorized, "Unauthorized")
+		return
+	}
+
+	logger = logger.WithField("user_id", userID)
+	logger.Debug("User authenticated successfully")
+
+	webhooks, err := service.GetWebhooks(r.Context(), userID)
+	if err != nil {
+		writeServiceError(w, r, logger, err, "Failed to get webhooks")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"webhooks": webhooks,
+	})
+
+	logger.WithField("webhooks_count", len(webhooks)).Info("Webhooks successfully returned")
+}
+
+// the response is the only place the signing secret is ever shown
+func CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	logger := log.WithFields(log.Fields{
+		"handler":    "CreateWebhook",
+		"request_id": r.Context().Value("request_id"),
+	})
+
+	logger.Info("Creating webhook started")
+
+	// get user ID from context
+	userID, err := auth.GetUserFromRequest(r)
+	if err != nil || userID == "" {
+		logger.WithError(err).Warn("Unauthorized access attempt")
+		writeError(w, r, http.StatusUnauthorized, model.ErrorCodeUnauthorized, "Unauthorized")
+		return
+	}
+
+	logger = logger.WithField("user_id", userID)
+	logger.Debug("User authenticated successfully")
+
+	//parse request body
+	var input model.WebhookInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		logger.WithError(err).Warn("Failed to parse request body")
+		writeError(w, r, http.StatusBadRequest, model.ErrorCodeInvalidRequest, "Invalid request body")
+		return
+	}
+
+	hook, err := service.CreateWebhook(r.Context(), userID, &input)
+	if err != nil {
+		writeServiceError(w, r, logger, err, "Failed to create webhook")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(hook)
+
+	logger.WithField("webhook_id", hook.ID).Info("New webhook successfully created and returned")
+}
+
+func UpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	logger := log.WithFields(log.Fields{
+		"handler":    "UpdateWebhook",
+		"request_id": r.Context().Value("request_id"),
+	})
+
+	logger.Info("Updating webhook started")
+
+	// get user ID from context
+	userID, err := auth.GetUserFromRequest(r)
+	if err != nil || userID == "" {
+		logger.WithError(err).Warn("Unauthorized access attempt")
+		writeError(w, r, http.StatusUnauthorized, model.ErrorCodeUnauthorized, "Unauthorized")
+		return
+	}
+
+	logger = logger.WithField("user_id", userID)
+	logger.Debug("User authenticated successfully")
+
+	id, ok := webhookIDParam(w, r, logger)
+	if !ok {
+		return
+	}
+	logger = logger.WithField("webhook_id", id)
+
+	// parse request body
+	var input model.WebhookInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		logger.WithError(err).Warn("Failed to parse request body")
+		writeError(w, r, http.StatusBadRequest, model.ErrorCodeInvalidRequest, "Invalid request body")
+		return
+	}
+
+	hook, err := service.UpdateWebhook(r.Context(), id, userID, &input)
+	if err != nil {
+		writeServiceError(w, r, logger, err, "Failed to update webhook")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(hook)
+
+	logger.Info("Webhook successfully updated")
+}
+
+func DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	logger := log.WithFields(log.Fields{
+		"handler":    "DeleteWebhook",
+		"request_id": r.Context().Value("request_id"),
+	})
+
+	logger.Info("Deleting webhook started")
+
+	// get user ID from context
+	userID, err := auth.GetUserFromRequest(r)
+	if err != nil || userID == "" {
+		logger.WithError(err).Warn("Unauthorized access attempt")
+		writeError(w, r, http.StatusUnauthorized, model.ErrorCodeUnauthorized, "Unauthorized")
+		return
+	}
+
+	logger = logger.WithField("user_id", userID)
+	logger.Debug("User authenticated successfully")
+
+	id, ok := webhookIDParam(w, r, logger)
+	if !ok {
+		return
+	}
+	logger = logger.WithField("webhook_id", id)
+
+	if err := service.DeleteWebhook(r.Context(), id, userID); err != nil {
+		writeServiceError(w, r, logger, err, "Failed to delete webhook")
+		return
+	}
+
+	logger.Info("Webhook successfully deleted")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"message":"Webhook deleted successfully"}`))
+}
+
+// delivery log of one webhook, newest first
+// query params (optional): limit, before (id of the last delivery of the previous page)
+func GetWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	logger := log.WithFields(log.Fields{
+		"handler":    "GetWebhookDeliveries",
+		"request_id": r.Context().Value("request_id"),
+	})
+
+	logger.Info("Getting webhook deliveries started")
+
+	// get user ID from context
+	userID, err := auth.GetUserFromRequest(r)
+	if err != nil || userID == "" {
+		logger.WithError(err).Warn("Unauthorized access attempt")
+		writeError(w, r, http.StatusUnauthorized, model.ErrorCodeUnauthorized, "Unauthorized")
+		return
+	}
+
+	logger = logger.WithField("user_id", userID)
+	logger.Debug("User authenticated successfully")
+
+	id, ok := webhookIDParam(w, r, logger)
+	if !ok {
+		return
+	}
+	logger = logger.WithField("webhook_id", id)
+
+	query := r.URL.Query()
+
+	limit := 0
+	if v := query.Get("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			logger.WithError(err).Warn("Invalid limit")
+			writeError(w, r, http.StatusBadRequest, model.ErrorCodeInvalidRequest, "Invalid limit")
+			return
+		}
+	}
+
+	var before int64
+	if v := query.Get("before"); v != "" {
+		before, err = strconv.ParseInt(v, 10, 64)
+		if err != nil || before <= 0 {
+			logger.WithError(err).Warn("Invalid before")
+			writeError(w, r, http.StatusBadRequest, model.ErrorCodeInvalidRequest, "Invalid before")
+			return
+		}
+	}
+
+	deliveries, err := service.GetWebhookDeliveries(r.Context(), id, userID, before, limit)
+	if err != nil {
+		writeServiceError(w, r, logger, err, "Failed to get webhook deliveries")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"deliveries": deliveries,
+	})
+
+	logger.WithField("deliveries_count", len(deliveries)).Info("Webhook deliveries successfully returned")
+}
+
+// sends a webhook.test event and answers with the delivery, a failed delivery is still a 200
+func TestWebhook(w http.ResponseWriter, r *http.Request) {
+	logger := log.WithFields(log.Fields{
+		"handler":    "TestWebhook",
+		"request_id": r.Context().Value("request_id"),
+	})
+
+	logger.Info("Testing webhook started")
+
+	// get user ID from context
+	userID, err := auth.GetUserFromRequest(r)
+	if err != nil || userID == "" {
+		logger.WithError(err).Warn("Unauthorized access attempt")
+		writeError(w, r, http.StatusUnauthorized, model.ErrorCodeUnauthorized, "Unauthorized")
+		return
+	}
+
+	logger = logger.WithField("user_id", userID)
+	logger.Debug("User authenticated successfully")
+
+	id, ok := webhookIDParam(w, r, logger)
+	if !ok {
+		return
+	}
+	logger = logger.WithField("webhook_id", id)
+
+	delivery, err := service.SendTestWebhook(r.Context(), id, userID)
+	if err != nil {
+		writeServiceError(w, r, logger, err, "Failed to send test webhook")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(delivery)
+
+	logger.WithField("status", delivery.Status).Info("Test webhook sent")
+}
+
+// parses the {id} path value, answers 400 itself when it isn't a number
+func webhookIDParam(w http.ResponseWriter, r *http.Request, logger *log.Entry) (int, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		logger.WithError(err).Warn("Invalid webhook ID format")
+		writeError(w, r, http.StatusBadRequest, model.ErrorCodeInvalidRequest, "Invalid webhook ID")
+		return 0, false
+	}
+	return id, true
+}
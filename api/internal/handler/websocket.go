@@ -0,0 +1,417 @@
+package handler
+
+import (
+	"checkmate/api/internal/auth"
+	"checkmate/api/internal/model"
+	"checkmate/api/internal/service"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/websocket"
+)
+
+//Dashboard websocket -> pushes the same deployment changes as the SSE stream and takes commands
+// (refresh a credential, follow a deployment's logs, acknowledge a failure) as JSON messages, see model.WSCommand
+
+const (
+	// a write that takes longer than this means the client stopped reading, the connection is dropped
+	wsWriteTimeout = 10 * time.Second
+	// messages waiting for the writer, producers block once it is full
+	wsSendQueueSize = 32
+	// commands are tiny, anything bigger is a broken or hostile client
+	wsMaxMessageBytes = 16 << 10
+	// commands handled at the same time, the next one waits so a client can't pile them up
+	wsMaxConcurrentCommands = 4
+	wsMaxLogSubscriptions   = 5
+)
+
+// upgrades to a websocket for the dashboard, authenticated at upgrade time by auth.AuthenticateWebSocket
+func DeploymentsWebSocket(w http.ResponseWriter, r *http.Request) {
+	logger := log.WithFields(log.Fields{
+		"handler":    "DeploymentsWebSocket",
+		"request_id": r.Context().Value("request_id"),
+	})
+
+	//get the user id from context
+	userID, err := auth.GetUserFromRequest(r)
+	if err != nil || userID == "" {
+		logger.WithError(err).Warn("Unauthorized access attempt")
+		writeError(w, r, http.StatusUnauthorized, model.ErrorCodeUnauthorized, "Unauthorized")
+		return
+	}
+
+	logger = logger.WithField("user_id", userID)
+
+	server := websocket.Server{
+		Handshake: func(config *websocket.Config, r *http.Request) error {
+			// answer with our protocol only, the other offered one is the token and must not be echoed.
+			// the origin isn't checked, the connection is authorized by the token and not by cookies
+			offered := config.Protocol
+			config.Protocol = nil
+			for _, protocol := range offered {
+				if protocol == auth.WebSocketProtocol {
+					config.Protocol = []string{protocol}
+				}
+			}
+			return nil
+		},
+		Handler: func(ws *websocket.Conn) {
+			ws.MaxPayloadBytes = wsMaxMessageBytes
+
+			// the request context isn't enough once the connection is hijacked, the conn has its own
+			ctx, cancel := context.WithCancel(context.WithoutCancel(r.Context()))
+			defer cancel()
+
+			conn := &dashboardConn{
+				ws:       ws,
+				userID:   userID,
+				logger:   logger,
+				ctx:      ctx,
+				cancel:   cancel,
+				out:      make(chan model.WSMessage, wsSendQueueSize),
+				commands: make(chan struct{}, wsMaxConcurrentCommands),
+				logSubs:  make(map[string]context.CancelFunc),
+			}
+			conn.serve()
+		},
+	}
+
+	logger.Info("Dashboard websocket opening")
+	server.ServeHTTP(w, r)
+	logger.Info("Dashboard websocket closed")
+}
+
+// one dashboard connection
+// the reader runs the commands, one writer owns the socket writes, everything else queues on out
+type dashboardConn struct {
+	ws     *websocket.Conn
+	userID string
+	logger *log.Entry
+
+	ctx    context.Context // ends with the connection
+	cancel context.CancelFunc
+
+	out      chan model.WSMessage
+	commands chan struct{} // semaphore of running commands
+
+	mu         sync.Mutex
+	logSubs    map[string]context.CancelFunc // by subscription id
+	nextSubID  int
+	closeCause string // sent in the closing message, first one wins
+}
+
+func (c *dashboardConn) serve() {
+	// subscribed before the snapshot is read so nothing published in between is lost,
+	// changes already in it are skipped by id
+	sub := service.SubscribeDeployments(c.userID)
+	defer sub.Close()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		c.writeLoop()
+	}()
+
+	// queued before any change, the client applies changes on top of it
+	snapshot, err := service.GetDeploymentSnapshot(c.ctx, c.userID)
+	if err != nil {
+		// like the SSE stream, no stream without its initial state
+		c.sendError("", err, "Failed to retrieve deployments")
+		c.stop("Failed to retrieve deployments, reconnect")
+		wg.Wait()
+		return
+	}
+	c.send(model.WSMessage{Type: model.WSMessageSnapshot, Data: snapshot})
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		c.forwardChanges(sub, service.NewStreamCursor(c.userID, snapshot.LastEventID))
+	}()
+
+	c.readLoop()
+
+	c.stop("")
+	wg.Wait()
+}
+
+// ends the connection, the writer sends the closing message and closes the socket
+func (c *dashboardConn) stop(cause string) {
+	c.mu.Lock()
+	if c.closeCause == "" {
+		c.closeCause = cause
+	}
+	c.mu.Unlock()
+	c.cancel()
+}
+
+// reads commands until the client goes away or the connection is stopped
+func (c *dashboardConn) readLoop() {
+	// a blocked Receive only returns once the socket is closed, which the writer does when ctx ends
+	for {
+		var cmd model.WSCommand
+		if err := websocket.JSON.Receive(c.ws, &cmd); err != nil {
+			var syntaxErr *json.SyntaxError
+			var typeErr *json.UnmarshalTypeError
+			switch {
+			case c.ctx.Err() != nil:
+			case errors.As(err, &syntaxErr), errors.As(err, &typeErr):
+				// the frame was read completely, the connection is still usable
+				c.sendInvalid("", "Invalid message, expected a JSON command")
+				continue
+			case errors.Is(err, websocket.ErrFrameTooLarge):
+				c.logger.Warn("Websocket message too large, closing")
+				c.stop("Message too large")
+			case !errors.Is(err, io.EOF):
+				c.logger.WithError(err).Debug("Websocket read failed")
+			}
+			return
+		}
+
+		// waits for a free slot, a client sending faster than its commands run stops being read
+		select {
+		case c.commands <- struct{}{}:
+		case <-c.ctx.Done():
+			return
+		}
+		go func() {
+			defer func() { <-c.commands }()
+			c.handleCommand(cmd)
+		}()
+	}
+}
+
+func (c *dashboardConn) handleCommand(cmd model.WSCommand) {
+	logger := c.logger.WithFields(log.Fields{
+		"command":    cmd.Type,
+		"command_id": cmd.ID,
+	})
+	logger.Debug("Websocket command received")
+
+	switch cmd.Type {
+	case model.WSCommandRefresh:
+		if cmd.CredentialID == 0 {
+			c.sendInvalid(cmd.ID, "credentialId is required")
+			return
+		}
+		deployments, cacheInfos, err := service.RefreshDeployments(c.ctx, c.userID, &cmd.CredentialID)
+		if err != nil {
+			c.sendError(cmd.ID, err, "Failed to refresh deployments")
+			return
+		}
+		c.send(model.WSMessage{Type: model.WSMessageResult, ID: cmd.ID, Data: &model.DeploymentPage{
+			Deployments: deployments,
+			Cache:       cacheInfos,
+		}})
+
+	case model.WSCommandSubscribeLogs:
+		if cmd.CredentialID == 0 || cmd.DeploymentID == "" {
+			c.sendInvalid(cmd.ID, "credentialId and deploymentId are required")
+			return
+		}
+		c.subscribeLogs(cmd)
+
+	case model.WSCommandUnsubscribeLogs:
+		c.mu.Lock()
+		stop, ok := c.logSubs[cmd.SubscriptionID]
+		delete(c.logSubs, cmd.SubscriptionID)
+		c.mu.Unlock()
+		if !ok {
+			c.send(model.WSMessage{Type: model.WSMessageError, ID: cmd.ID, Error: &model.APIError{
+				Code:    model.ErrorCodeNotFound,
+				Message: "Log subscription not found",
+			}})
+			return
+		}
+		stop()
+		c.send(model.WSMessage{Type: model.WSMessageResult, ID: cmd.ID, SubscriptionID: cmd.SubscriptionID})
+
+	case model.WSCommandAckAlert:
+		if cmd.EventID <= 0 {
+			c.sendInvalid(cmd.ID, "eventId is required")
+			return
+		}
+		event, err := service.AcknowledgeDeploymentEvent(c.ctx, c.userID, cmd.EventID)
+		if err != nil {
+			c.sendError(cmd.ID, err, "Failed to acknowledge alert")
+			return
+		}
+		c.send(model.WSMessage{Type: model.WSMessageResult, ID: cmd.ID, Data: event})
+
+	default:
+		c.sendInvalid(cmd.ID, "Unknown command type "+strconv.Quote(cmd.Type))
+	}
+}
+
+func (c *dashboardConn) subscribeLogs(cmd model.WSCommand) {
+	c.mu.Lock()
+	full := len(c.logSubs) >= wsMaxLogSubscriptions
+	c.mu.Unlock()
+	if full {
+		c.sendInvalid(cmd.ID, "Too many log subscriptions on this connection")
+		return
+	}
+
+	tail, err := service.OpenDeploymentLogs(c.ctx, c.userID, cmd.CredentialID, cmd.DeploymentID)
+	if err != nil {
+		c.sendError(cmd.ID, err, "Failed to subscribe to logs")
+		return
+	}
+
+	ctx, stop := context.WithCancel(c.ctx)
+
+	c.mu.Lock()
+	// checked again, other subscribe commands may have run meanwhile
+	if len(c.logSubs) >= wsMaxLogSubscriptions {
+		c.mu.Unlock()
+		stop()
+		c.sendInvalid(cmd.ID, "Too many log subscriptions on this connection")
+		return
+	}
+	c.nextSubID++
+	subID := "logs-" + strconv.Itoa(c.nextSubID)
+	c.logSubs[subID] = stop
+	c.mu.Unlock()
+
+	c.send(model.WSMessage{Type: model.WSMessageResult, ID: cmd.ID, SubscriptionID: subID})
+
+	go func() {
+		defer stop()
+
+		// blocks while the queue is full, the tail doesn't poll again until the client caught up
+		err := tail.Run(ctx, func(lines []model.LogLine) error {
+			if !c.sendCtx(ctx, model.WSMessage{Type: model.WSMessageLogs, SubscriptionID: subID, Data: lines}) {
+				return ctx.Err()
+			}
+			return nil
+		})
+
+		c.mu.Lock()
+		_, active := c.logSubs[subID]
+		delete(c.logSubs, subID)
+		c.mu.Unlock()
+
+		// ended on its own (deployment gone...), not by unsubscribe or the connection closing
+		if err != nil && active && c.ctx.Err() == nil {
+			msg := model.WSMessage{Type: model.WSMessageLogsEnded, SubscriptionID: subID}
+			if !errors.Is(err, context.Canceled) {
+				_, code, message := classifyServiceError(c.logger, err, "Log subscription failed")
+				msg.Error = &model.APIError{Code: code, Message: message}
+			}
+			c.send(msg)
+		}
+	}()
+}
+
+// pushes deployment changes until the subscription ends
+// same catch up as the SSE stream, a change is only the signal to read back what the client doesn't have
+func (c *dashboardConn) forwardChanges(sub *service.DeploymentSubscription, cursor *service.StreamCursor) {
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case change, ok := <-sub.C:
+			if !ok {
+				// shutdown, or this client fell so far behind that the broker dropped it
+				c.stop("Server closed the stream, reconnect")
+				return
+			}
+			if cursor.Sent(change.Event.ID) {
+				continue
+			}
+			missed, ok, err := cursor.CatchUp(c.ctx)
+			if err != nil {
+				if c.ctx.Err() == nil {
+					c.logger.WithError(err).Warn("Failed to read deployment changes, closing")
+					c.stop("Failed to read deployment changes, reconnect")
+				}
+				return
+			}
+			if !ok {
+				c.logger.Info("Dashboard websocket too far behind, closing")
+				c.stop("Server closed the stream, reconnect")
+				return
+			}
+			for _, change := range missed {
+				if !c.send(model.WSMessage{Type: model.WSMessageDeploymentChange, Data: change}) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// the only goroutine writing to the socket
+func (c *dashboardConn) writeLoop() {
+	heartbeat := time.NewTicker(service.StreamHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		var msg model.WSMessage
+		select {
+		case <-c.ctx.Done():
+			c.mu.Lock()
+			cause := c.closeCause
+			c.mu.Unlock()
+			if cause != "" {
+				c.write(model.WSMessage{Type: model.WSMessageClosing, Data: map[string]string{"reason": cause}})
+			}
+			// also unblocks the reader
+			c.ws.Close()
+			return
+		case msg = <-c.out:
+		case <-heartbeat.C:
+			msg = model.WSMessage{Type: model.WSMessagePing}
+		}
+
+		if err := c.write(msg); err != nil {
+			c.logger.WithError(err).Info("Websocket write failed, closing")
+			c.stop("")
+		}
+	}
+}
+
+func (c *dashboardConn) write(msg model.WSMessage) error {
+	if err := c.ws.SetWriteDeadline(time.Now().Add(wsWriteTimeout)); err != nil {
+		return err
+	}
+	return websocket.JSON.Send(c.ws, msg)
+}
+
+// queues a message, blocks while the queue is full, false when the connection ended first
+func (c *dashboardConn) send(msg model.WSMessage) bool {
+	return c.sendCtx(c.ctx, msg)
+}
+
+func (c *dashboardConn) sendCtx(ctx context.Context, msg model.WSMessage) bool {
+	select {
+	case c.out <- msg:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (c *dashboardConn) sendInvalid(id, message string) {
+	c.send(model.WSMessage{Type: model.WSMessageError, ID: id, Error: &model.APIError{
+		Code:    model.ErrorCodeInvalidRequest,
+		Message: message,
+	}})
+}
+
+// same mapping as writeServiceError, internal details never reach the client
+func (c *dashboardConn) sendError(id string, err error, fallback string) {
+	_, code, message := classifyServiceError(c.logger, err, fallback)
+	c.send(model.WSMessage{Type: model.WSMessageError, ID: id, Error: &model.APIError{
+		Code:    code,
+		Message: message,
+	}})
+}
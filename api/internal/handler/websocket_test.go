@@ -0,0 +1,87 @@
+package handler
+
+import (
+	"checkmate/api/internal/model"
+	"checkmate/api/internal/service"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// message with the data left encoded
+type wsReceived struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+func dialDashboard(t *testing.T, userID string) *websocket.Conn {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		DeploymentsWebSocket(w, r.WithContext(context.WithValue(r.Context(), "uid", userID)))
+	}))
+	t.Cleanup(srv.Close)
+
+	ws, err := websocket.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), "", srv.URL)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	// closed before the server shuts down
+	t.Cleanup(func() { ws.Close() })
+	return ws
+}
+
+func receiveWS(t *testing.T, ws *websocket.Conn) wsReceived {
+	t.Helper()
+	ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		var msg wsReceived
+		if err := websocket.JSON.Receive(ws, &msg); err != nil {
+			t.Fatalf("receive: %v", err)
+		}
+		if msg.Type != model.WSMessagePing {
+			return msg
+		}
+	}
+}
+
+// the snapshot comes first even when reading it refreshes and publishes, later changes aren't repeats of it
+func TestDashboardSnapshotBeforeChanges(t *testing.T) {
+	openTestDB(t)
+	cred := createTestCredential(t, "user-ws")
+	render := startFakeRender(t, renderService("srv-1", "api", "live"))
+	// cached, then changed on the platform with the cache expired -> reading the snapshot refreshes and publishes the change
+	if _, _, err := service.RefreshDeployments(context.Background(), cred.UserID, nil); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	render.setStatus("srv-1", "failed")
+	expireCache(t, cred.ID)
+
+	ws := dialDashboard(t, cred.UserID)
+	msg := receiveWS(t, ws)
+	if msg.Type != model.WSMessageSnapshot {
+		t.Fatalf("first message is %s, want snapshot", msg.Type)
+	}
+	var snapshot model.DeploymentSnapshot
+	if err := json.Unmarshal(msg.Data, &snapshot); err != nil {
+		t.Fatalf("decode snapshot: %v", err)
+	}
+
+	msg = receiveWS(t, ws)
+	var change model.DeploymentChangeEvent
+	if err := json.Unmarshal(msg.Data, &change); err != nil {
+		t.Fatalf("decode change: %v", err)
+	}
+	// published while the snapshot was read, after its last event id so it's still sent
+	if msg.Type != model.WSMessageDeploymentChange || change.Event.NewStatus != model.DeploymentStatusFailed {
+		t.Fatalf("got %s to %s, want the change to failed", msg.Type, change.Event.NewStatus)
+	}
+	if change.Event.ID <= snapshot.LastEventID {
+		t.Errorf("change %d is already in the snapshot (up to %d)", change.Event.ID, snapshot.LastEventID)
+	}
+}
@@ -0,0 +1,33 @@
+package model
+
+import (
+	"time"
+)
+
+// reasons for serving cached data that is no longer fresh
+const (
+	StaleReasonRefreshing          = "refreshing"           // cache expired, refresh running in the background
+	StaleReasonPlatformUnavailable = "platform_unavailable" // platform call failed, serving last known data
+)
+
+// cache state of the deployments of one credential -> returned alongside the deployments
+type CacheInfo struct {
+	PlatformCredentialID int       `json:"platformCredentialID"`
+	LastUpdatedAt        time.Time `json:"lastUpdatedAt"`
+	AgeSeconds           int64     `json:"ageSeconds"`
+	TTLSeconds           int64     `json:"ttlSeconds"` // effective ttl for the credential
+	NextRefreshAt        time.Time `json:"nextRefreshAt"`
+	Stale                bool      `json:"stale"`
+	StaleReason          string    `json:"staleReason,omitempty"`
+
+	Changes *CacheWriteResult `json:"changes,omitempty"` // set when this request refreshed the cache
+}
+
+// what a cache refresh did to the cached deployments of one credential
+type CacheWriteResult struct {
+	Added     int `json:"added"`
+	Changed   int `json:"changed"`
+	Unchanged int `json:"unchanged"`
+	Missing   int `json:"missing"` // not returned by the platform but still inside the grace period
+	Removed   int `json:"removed"` // marked as gone
+}
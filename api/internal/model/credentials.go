@@ -8,23 +8,52 @@ import (
 
 // stored in sql db
 type PlatformCredential struct {
-	ID        int       `json:"id"`
-	UserID    string    `json:"userId"`
-	Platform  string    `json:"platform"`
-	APIKey    string    `json:"apiKey"` // will be encrypted in storage
-	CreatedAt time.Time `json:"createdAt"`
+	ID              int       `json:"id"`
+	UserID          string    `json:"userId"`
+	Name            string    `json:"name"` // chosen by the user, unique per user
+	Platform        string    `json:"platform"`
+	APIKey          string    `json:"apiKey"` // will be encrypted in storage
+	CreatedAt       time.Time `json:"createdAt"`
+	CacheTTLSeconds *int      `json:"cacheTtlSeconds"` // overrides the platform/global cache ttl when set
 }
 
 // credentials without sensitive info -> meant for the return values to the client
 type SafeCredential struct {
-	ID        int       `json:"id"`
-	UserID    string    `json:"user_id"`
-	Platform  string    `json:"platform"`
-	CreatedAt time.Time `json:"created_at"`
+	ID              int       `json:"id"`
+	UserID          string    `json:"user_id"`
+	Name            string    `json:"name"`
+	Platform        string    `json:"platform"`
+	CreatedAt       time.Time `json:"created_at"`
+	CacheTTLSeconds *int      `json:"cache_ttl_seconds"` // nil means the platform/global ttl applies
+
+	Health *CredentialHealth `json:"health,omitempty"`
+}
+
+type BreakerState string
+
+const (
+	BreakerClosed   BreakerState = "closed"    // platform reachable
+	BreakerOpen     BreakerState = "open"      // platform calls skipped, cached data served
+	BreakerHalfOpen BreakerState = "half_open" // trial call in progress
+)
+
+// circuit breaker state of a credential -> lets the user see "Render: unreachable since 10:42"
+type CredentialHealth struct {
+	State               BreakerState `json:"state"`
+	ConsecutiveFailures int          `json:"consecutiveFailures"`
+	UnreachableSince    *time.Time   `json:"unreachableSince,omitempty"`
+	LastFailureAt       *time.Time   `json:"lastFailureAt,omitempty"`
+	NextAttemptAt       *time.Time   `json:"nextAttemptAt,omitempty"`
 }
 
 // user input
 type PlatformCredentialInput struct {
+	Name     string `json:"name"` // ex "Render - personal", optional on update to keep the current name
 	Platform string `json:"platform"`
 	APIKey   string `json:"apiKey"`
 }
+
+// user input for the per credential cache ttl -> null resets to the platform/global ttl
+type CacheTTLInput struct {
+	CacheTTLSeconds *int `json:"cacheTtlSeconds"`
+}
@@ -12,6 +12,7 @@ const (
 	DeploymentStatusCanceled  DeploymentStatus = "canceled"
 	DeploymentStatusFailed    DeploymentStatus = "failed"
 	DeploymentStatusUnknown   DeploymentStatus = "unknown"
+	DeploymentStatusGone      DeploymentStatus = "gone" // no longer returned by the platform
 )
 
 type Deployment struct {
@@ -26,4 +27,61 @@ type Deployment struct {
 	Framework            string                 `json:"framework"`
 	LastUpdatedAt        time.Time              `json:"lastUpdatedAt"`
 	Metadata             map[string]interface{} `json:"metadata"`
+	FirstSeenAt          *time.Time             `json:"firstSeenAt"`
+	LastSeenAt           *time.Time             `json:"lastSeenAt"`
+}
+
+type DeploymentSort string
+
+const (
+	DeploymentSortName         DeploymentSort = "name"
+	DeploymentSortStatus       DeploymentSort = "status" // then by name
+	DeploymentSortLastDeployed DeploymentSort = "lastDeployedAt"
+)
+
+// filters, sort and page of a deployments listing, zero values mean no filter
+type DeploymentQuery struct {
+	Platform     string
+	CredentialID *int
+	Statuses     []DeploymentStatus
+	ServiceType  string
+	Branch       string
+	Name         string // case insensitive substring
+	Sort         DeploymentSort
+	Desc         bool
+	Limit        int
+	Cursor       string // opaque, nextCursor of the previous page
+}
+
+// one page of a deployments listing
+type DeploymentPage struct {
+	Deployments []Deployment `json:"deployments"`
+	Cache       []CacheInfo  `json:"cache"`
+	NextCursor  string       `json:"nextCursor,omitempty"` // empty on the last page
+}
+
+// platform details of one deployment, fetched on demand for the detail view
+type DeploymentDetails struct {
+	LatestDeploy  *DeployInfo `json:"latestDeploy"`  // nil when it was never deployed
+	InstanceCount *int        `json:"instanceCount"` // nil when the service type has no instances
+	Plan          string      `json:"plan,omitempty"`
+	Region        string      `json:"region,omitempty"`
+	Runtime       string      `json:"runtime,omitempty"`
+}
+
+// cached deployment with its platform details
+type DeploymentDetail struct {
+	Deployment
+	Details      *DeploymentDetails `json:"details"`                // nil when the platform couldn't be asked
+	DetailsError string             `json:"detailsError,omitempty"` // why details is nil
+}
+
+// latest deploy of a deployment as reported by the platform
+type DeployInfo struct {
+	ID            string     `json:"id"`
+	Status        string     `json:"status"`
+	CommitID      string     `json:"commitId"`
+	CommitMessage string     `json:"commitMessage"`
+	CreatedAt     time.Time  `json:"createdAt"`
+	FinishedAt    *time.Time `json:"finishedAt"`
 }
@@ -0,0 +1,24 @@
+package model
+
+// error body of every failed api request
+type APIError struct {
+	Code      string      `json:"code"`    // stable, meant for clients to branch on
+	Message   string      `json:"message"` // human readable, safe to show to the user
+	RequestID string      `json:"requestId,omitempty"`
+	Details   interface{} `json:"details,omitempty"`
+}
+
+// values of APIError.Code
+const (
+	ErrorCodeInvalidRequest      = "invalid_request" // malformed body or parameters
+	ErrorCodeInvalidInput        = "invalid_input"   // well formed but fails validation
+	ErrorCodeInvalidCredential   = "invalid_credential"
+	ErrorCodeUnauthorized        = "unauthorized"
+	ErrorCodeForbidden           = "forbidden"
+	ErrorCodeNotFound            = "not_found"
+	ErrorCodeMethodNotAllowed    = "method_not_allowed"
+	ErrorCodeConflict            = "conflict"
+	ErrorCodeUpstreamUnavailable = "upstream_unavailable"
+	ErrorCodeNotImplemented      = "not_implemented"
+	ErrorCodeInternal            = "internal_error"
+)
@@ -0,0 +1,64 @@
+package model
+
+import (
+	"time"
+)
+
+// one observed status transition of a deployment
+type DeploymentEvent struct {
+	ID                   int64            `json:"id"`
+	PlatformCredentialID int              `json:"platformCredentialID"`
+	DeploymentID         string           `json:"deploymentId"`
+	DeploymentName       string           `json:"deploymentName"`
+	OldStatus            DeploymentStatus `json:"oldStatus"` // empty the first time a deployment is seen
+	NewStatus            DeploymentStatus `json:"newStatus"`
+	DeployID             string           `json:"deployId,omitempty"`
+	CommitID             string           `json:"commitId,omitempty"`
+	CommitMessage        string           `json:"commitMessage,omitempty"`
+	ObservedAt           time.Time        `json:"observedAt"`
+	AcknowledgedAt       *time.Time       `json:"acknowledgedAt,omitempty"` // failures only, set from the dashboard
+}
+
+// query options for deployment events, zero values mean no filter
+type DeploymentEventFilter struct {
+	CredentialID *int
+	DeploymentID string
+	Since        *time.Time
+	Until        *time.Time
+	Limit        int
+}
+
+// kind of change pushed on the deployments stream
+type DeploymentChange string
+
+const (
+	DeploymentChangeAdded         DeploymentChange = "added"
+	DeploymentChangeStatusChanged DeploymentChange = "status_changed"
+	DeploymentChangeRemoved       DeploymentChange = "removed"
+)
+
+// one change pushed on the deployments stream, built from a stored deployment event
+type DeploymentChangeEvent struct {
+	Type       DeploymentChange `json:"type"`
+	Event      DeploymentEvent  `json:"event"`
+	Deployment *Deployment      `json:"deployment,omitempty"` // cached state after the change, nil when removed
+}
+
+// first message of the deployments stream, later changes apply on top of it
+type DeploymentSnapshot struct {
+	Deployments []Deployment `json:"deployments"`
+	Cache       []CacheInfo  `json:"cache"`
+	LastEventID int64        `json:"lastEventId"` // newest event already reflected in the snapshot
+}
+
+// type of change an event stands for
+func (e DeploymentEvent) Change() DeploymentChange {
+	switch {
+	case e.OldStatus == "":
+		return DeploymentChangeAdded
+	case e.NewStatus == DeploymentStatusGone:
+		return DeploymentChangeRemoved
+	default:
+		return DeploymentChangeStatusChanged
+	}
+}
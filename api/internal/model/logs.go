@@ -0,0 +1,21 @@
+package model
+
+import (
+	"time"
+)
+
+// one log line of a deployment as reported by the platform
+type LogLine struct {
+	ID        string    `json:"id"`
+	Timestamp time.Time `json:"timestamp"`
+	Message   string    `json:"message"`
+	Level     string    `json:"level,omitempty"`
+	Type      string    `json:"type,omitempty"` // app, build, request...
+}
+
+// log lines from a start time, oldest first
+type LogPage struct {
+	Lines   []LogLine
+	HasMore bool      // more lines after Next are already available
+	Next    time.Time // start of the following page
+}
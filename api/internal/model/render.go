@@ -1,13 +1,11 @@
 package model
 
 import (
-	"net/http"
 	"time"
 )
 
 type RenderClient struct {
 	ApiKey string
-	Client *http.Client
 }
 
 // render returns an array of this
@@ -23,12 +21,17 @@ type RenderService struct {
 	AutoDeploy   string    `json:"autoDeploy"`
 	Repo         string    `json:"repo"`
 	DashboardURL string    `json:"dashboardUrl"`
+	OwnerID      string    `json:"ownerId"` // workspace, the logs api is queried by it
 
 	ServiceDetails struct {
 		BuildCommand string `json:"buildCommand"`
 		PublishPath  string `json:"publishPath"`
 		URL          string `json:"url"`
 		BuildPlan    string `json:"buildPlan"`
+		Plan         string `json:"plan"`
+		Region       string `json:"region"`
+		Runtime      string `json:"runtime"`
+		NumInstances *int   `json:"numInstances"` // not sent for static sites
 		ParentServer *struct {
 			ID   string `json:"id"`
 			Name string `json:"name"`
@@ -45,3 +48,39 @@ type RenderServicesResponse struct {
 	Services []RenderServiceResponse `json:"services"`
 	Cursor   string                  `json:"cursor,omitempty"`
 }
+
+// render returns an array of this for GET /services/{id}/deploys
+type RenderDeployResponse struct {
+	Deploy RenderDeploy `json:"deploy"`
+	Cursor string       `json:"cursor,omitempty"`
+}
+
+// GET /logs response
+type RenderLogsResponse struct {
+	HasMore       bool        `json:"hasMore"`
+	NextStartTime time.Time   `json:"nextStartTime"`
+	Logs          []RenderLog `json:"logs"`
+}
+
+type RenderLog struct {
+	ID        string    `json:"id"`
+	Timestamp time.Time `json:"timestamp"`
+	Message   string    `json:"message"`
+	Labels    []struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	} `json:"labels"`
+}
+
+type RenderDeploy struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+	Commit struct {
+		ID      string    `json:"id"`
+		Message string    `json:"message"`
+		At      time.Time `json:"createdAt"`
+	} `json:"commit"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	UpdatedAt  time.Time  `json:"updatedAt"`
+	FinishedAt *time.Time `json:"finishedAt"`
+}
@@ -0,0 +1,48 @@
+package model
+
+import (
+	"time"
+)
+
+// how much deployment history is kept, zero values disable the rule
+type RetentionPolicy struct {
+	EventMaxAgeSeconds          int64 `json:"eventMaxAgeSeconds"`          // events older than this are deleted
+	EventsPerDeployment         int   `json:"eventsPerDeployment"`         // newest events kept per deployment
+	DownsampleAfterSeconds      int64 `json:"downsampleAfterSeconds"`      // older events keep only the first and last transition of each day
+	GoneDeploymentMaxAgeSeconds int64 `json:"goneDeploymentMaxAgeSeconds"` // gone deployments are removed from the cache after this
+	DeliveryMaxAgeSeconds       int64 `json:"deliveryMaxAgeSeconds"`       // finished webhook deliveries are deleted after this
+	CompactionIntervalSeconds   int64 `json:"compactionIntervalSeconds"`
+	VacuumIntervalSeconds       int64 `json:"vacuumIntervalSeconds"`
+}
+
+// what one compaction run did
+type CompactionResult struct {
+	StartedAt         time.Time `json:"startedAt"`
+	DurationMs        int64     `json:"durationMs"`
+	ExpiredEvents     int64     `json:"expiredEvents"`     // deleted for age
+	TrimmedEvents     int64     `json:"trimmedEvents"`     // deleted over the per deployment limit
+	DownsampledEvents int64     `json:"downsampledEvents"` // deleted by downsampling
+	RemovedGone       int64     `json:"removedGone"`       // gone deployments removed from the cache
+	ExpiredDeliveries int64     `json:"expiredDeliveries"` // webhook delivery log entries deleted for age
+	Analyzed          bool      `json:"analyzed"`
+	Vacuumed          bool      `json:"vacuumed"`
+	Error             string    `json:"error,omitempty"`
+}
+
+// sizes of the history tables, for the admin endpoint
+type StorageStats struct {
+	Backend           string     `json:"backend"`
+	SizeBytes         int64      `json:"sizeBytes"`
+	DeploymentEvents  int64      `json:"deploymentEvents"`
+	CachedDeployments int64      `json:"cachedDeployments"`
+	OldestEventAt     *time.Time `json:"oldestEventAt,omitempty"`
+}
+
+// retention settings with the state of the compaction job
+type RetentionStatus struct {
+	Policy       RetentionPolicy   `json:"policy"`
+	Storage      *StorageStats     `json:"storage,omitempty"`
+	LastRun      *CompactionResult `json:"lastRun,omitempty"`
+	NextRunAt    *time.Time        `json:"nextRunAt,omitempty"`
+	LastVacuumAt *time.Time        `json:"lastVacuumAt,omitempty"`
+}
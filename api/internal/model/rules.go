@@ -0,0 +1,99 @@
+package model
+
+import "time"
+
+// what a notification rule does with the events it matches
+type NotificationRuleAction string
+
+const (
+	NotificationRuleNotify NotificationRuleAction = "notify" // sends the events to its webhooks
+	NotificationRuleMute   NotificationRuleAction = "mute"   // drops them, quiet hours are a mute rule with a schedule
+)
+
+// rule of a user deciding which webhooks an event goes to, conditions left empty match anything
+type NotificationRule struct {
+	ID      int                    `json:"id"`
+	UserID  string                 `json:"userId"`
+	Name    string                 `json:"name"`
+	Action  NotificationRuleAction `json:"action"`
+	Enabled bool                   `json:"enabled"`
+
+	CredentialIDs    []int              `json:"credentialIds"`
+	Branches         []string           `json:"branches"` // glob patterns, ex "main" or "release/*"
+	Services         []string           `json:"services"` // glob patterns on the deployment name
+	EventTypes       []WebhookEventType `json:"eventTypes"`
+	ExceptEventTypes []WebhookEventType `json:"exceptEventTypes"`
+	Schedule         *RuleSchedule      `json:"schedule,omitempty"` // nil -> at any time
+
+	WebhookIDs           []int `json:"webhookIds"`           // webhooks the rule applies to, empty means all
+	DedupMinutes         int   `json:"dedupMinutes"`         // notify: drops an event already sent for the deployment within this window
+	EscalateAfterMinutes int   `json:"escalateAfterMinutes"` // notify: failures lasting that long, unacknowledged, go to EscalateWebhookIDs
+	EscalateWebhookIDs   []int `json:"escalateWebhookIds"`
+
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// daily window a rule applies in, end before start wraps past midnight
+type RuleSchedule struct {
+	Start    string `json:"start"`    // HH:MM
+	End      string `json:"end"`      // HH:MM
+	Timezone string `json:"timezone"` // IANA name, empty means UTC
+}
+
+// user input
+type NotificationRuleInput struct {
+	Name                 string                 `json:"name"`
+	Action               NotificationRuleAction `json:"action"`
+	CredentialIDs        []int                  `json:"credentialIds"`
+	Branches             []string               `json:"branches"`
+	Services             []string               `json:"services"`
+	EventTypes           []WebhookEventType     `json:"eventTypes"`
+	ExceptEventTypes     []WebhookEventType     `json:"exceptEventTypes"`
+	Schedule             *RuleSchedule          `json:"schedule"`
+	WebhookIDs           []int                  `json:"webhookIds"`
+	DedupMinutes         int                    `json:"dedupMinutes"`
+	EscalateAfterMinutes int                    `json:"escalateAfterMinutes"`
+	EscalateWebhookIDs   []int                  `json:"escalateWebhookIds"`
+	Enabled              *bool                  `json:"enabled"` // nil -> enabled on create, unchanged on update
+}
+
+// event to run through the rules, either a stored one or a made up one
+type RulePreviewInput struct {
+	EventID int64 `json:"eventId"` // a stored event of the user, the fields below but at are ignored when set
+
+	CredentialID int              `json:"credentialId"`
+	DeploymentID string           `json:"deploymentId"` // a cached deployment of the credential, for its name and branch
+	OldStatus    DeploymentStatus `json:"oldStatus"`
+	NewStatus    DeploymentStatus `json:"newStatus"`
+	At           *time.Time       `json:"at"` // when it happens for the schedules, nil means now or when the stored event was seen
+}
+
+// what the rules decide for an event
+type RulePreview struct {
+	EventType   WebhookEventType     `json:"eventType,omitempty"` // empty when the event isn't notified at all
+	At          time.Time            `json:"at"`
+	Rules       []RuleMatch          `json:"rules"`
+	Webhooks    []WebhookDecision    `json:"webhooks"`
+	Escalations []EscalationDecision `json:"escalations"`
+}
+
+type RuleMatch struct {
+	RuleID  int                    `json:"ruleId"`
+	Name    string                 `json:"name"`
+	Action  NotificationRuleAction `json:"action"`
+	Matched bool                   `json:"matched"`
+	Reason  string                 `json:"reason,omitempty"` // why it didn't match
+}
+
+type WebhookDecision struct {
+	WebhookID int         `json:"webhookId"`
+	Type      WebhookType `json:"type"`
+	Deliver   bool        `json:"deliver"`
+	Reason    string      `json:"reason"`
+}
+
+type EscalationDecision struct {
+	RuleID     int       `json:"ruleId"`
+	WebhookIDs []int     `json:"webhookIds"`
+	DueAt      time.Time `json:"dueAt"`
+}
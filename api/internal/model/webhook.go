@@ -0,0 +1,109 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// what a webhook can be notified about
+type WebhookEventType string
+
+const (
+	WebhookEventDeploymentFailed    WebhookEventType = "deployment.failed"    // a deployment went to failed
+	WebhookEventDeploymentRecovered WebhookEventType = "deployment.recovered" // live again after a failure, deploys in between don't matter
+	WebhookEventDeploymentDeploying WebhookEventType = "deployment.deploying" // a new deploy started
+	WebhookEventDeploymentSucceeded WebhookEventType = "deployment.succeeded" // deploying -> live
+	WebhookEventDigest              WebhookEventType = "digest.daily"         // summary of the last day, email webhooks only
+	WebhookEventDeploymentEscalated WebhookEventType = "deployment.escalated" // failure still there after the delay of a rule, sent to the rule's webhooks only
+	WebhookEventTest                WebhookEventType = "webhook.test"         // sent by the test endpoint only, can't be subscribed to
+)
+
+// what a webhook posts
+type WebhookType string
+
+const (
+	WebhookTypeGeneric WebhookType = "generic" // signed WebhookPayload
+	WebhookTypeSlack   WebhookType = "slack"   // Block Kit message, to an incoming webhook or with a bot token to a channel
+	WebhookTypeDiscord WebhookType = "discord" // embed
+	WebhookTypeEmail   WebhookType = "email"   // text and html mail to the addresses of a mailto: url
+)
+
+// outbound webhook of a user
+type Webhook struct {
+	ID            int                `json:"id"`
+	UserID        string             `json:"userId"`
+	Type          WebhookType        `json:"type"`
+	URL           string             `json:"url"`
+	EventTypes    []WebhookEventType `json:"eventTypes"`
+	CredentialIDs []int              `json:"credentialIds"`          // only events of these credentials, empty means all
+	Statuses      []DeploymentStatus `json:"statuses"`               // only events to these statuses, empty means all
+	SlackChannel  string             `json:"slackChannel,omitempty"` // slack with a bot token, messages of a deploy are threaded
+	DiscordForum  bool               `json:"discordForum,omitempty"` // discord forum channel, one post per deploy
+	// generic: hmac key, only returned once when the webhook is created
+	// slack with a bot token: the token, never returned. encrypted in storage
+	Secret       string     `json:"secret,omitempty"`
+	Enabled      bool       `json:"enabled"`
+	CreatedAt    time.Time  `json:"createdAt"`
+	LastDigestAt *time.Time `json:"lastDigestAt,omitempty"` // digest time of the last daily digest queued
+}
+
+// user input
+type WebhookInput struct {
+	Type          WebhookType        `json:"type"` // empty means generic
+	URL           string             `json:"url"`  // not used for slack with a bot token, mailto: for email
+	EventTypes    []WebhookEventType `json:"eventTypes"`
+	CredentialIDs []int              `json:"credentialIds"`
+	Statuses      []DeploymentStatus `json:"statuses"`
+	SlackChannel  string             `json:"slackChannel"`
+	SlackBotToken string             `json:"slackBotToken"` // needed with slackChannel, empty on update keeps the current one
+	DiscordForum  bool               `json:"discordForum"`
+	Enabled       *bool              `json:"enabled"` // nil -> enabled on create, unchanged on update
+}
+
+// threaded chats: slack with a bot token and discord forums
+func (w *Webhook) Threaded() bool {
+	return (w.Type == WebhookTypeSlack && w.SlackChannel != "") || (w.Type == WebhookTypeDiscord && w.DiscordForum)
+}
+
+// body POSTed to generic webhooks, the same bytes on every attempt
+type WebhookPayload struct {
+	Type       WebhookEventType `json:"type"`
+	CreatedAt  time.Time        `json:"createdAt"`
+	Platform   string           `json:"platform,omitempty"`
+	Event      *DeploymentEvent `json:"event,omitempty"`
+	Deployment *Deployment      `json:"deployment,omitempty"` // cached state when the event was seen
+	Message    string           `json:"message,omitempty"`    // test events only
+}
+
+// queued for email webhooks, the recipients are only taken from the webhook when it is sent
+type EmailMessage struct {
+	Subject string `json:"subject"`
+	Text    string `json:"text"`
+	HTML    string `json:"html"`
+}
+
+type WebhookDeliveryStatus string
+
+const (
+	WebhookDeliveryPending   WebhookDeliveryStatus = "pending" // waiting for its first attempt or a retry
+	WebhookDeliverySucceeded WebhookDeliveryStatus = "succeeded"
+	WebhookDeliveryFailed    WebhookDeliveryStatus = "failed" // out of attempts
+)
+
+// one payload sent (or being sent) to a webhook, the delivery log entry
+type WebhookDelivery struct {
+	ID             int64                 `json:"id"`
+	WebhookID      int                   `json:"webhookId"`
+	EventType      WebhookEventType      `json:"eventType"`
+	EventID        *int64                `json:"eventId,omitempty"` // deployment event, nil for test deliveries
+	Payload        json.RawMessage       `json:"payload"`           // WebhookPayload, the chat message for slack and discord, EmailMessage for email
+	Status         WebhookDeliveryStatus `json:"status"`
+	Attempts       int                   `json:"attempts"`
+	ResponseStatus *int                  `json:"responseStatus,omitempty"` // of the last attempt, the smtp reply code for email
+	Error          string                `json:"error,omitempty"`          // of the last attempt
+	DurationMs     *int64                `json:"durationMs,omitempty"`
+	CreatedAt      time.Time             `json:"createdAt"`
+	NextAttemptAt  *time.Time            `json:"nextAttemptAt,omitempty"`
+	CompletedAt    *time.Time            `json:"completedAt,omitempty"`
+	ThreadKey      string                `json:"-"` // deploy the message belongs to, threaded chats only
+}
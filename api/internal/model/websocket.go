@@ -0,0 +1,40 @@
+package model
+
+// commands the dashboard sends over the websocket
+const (
+	WSCommandRefresh         = "refresh"          // credentialId, refetches its deployments
+	WSCommandSubscribeLogs   = "subscribe_logs"   // credentialId + deploymentId, answers with a subscriptionId
+	WSCommandUnsubscribeLogs = "unsubscribe_logs" // subscriptionId
+	WSCommandAckAlert        = "ack_alert"        // eventId of a failure event
+)
+
+// messages the server sends over the websocket
+const (
+	WSMessageResult           = "result"            // answer to a command, id is the command id
+	WSMessageError            = "error"             // failed command (id set) or bad message (id empty)
+	WSMessageSnapshot         = "snapshot"          // DeploymentSnapshot, first message of the connection
+	WSMessageDeploymentChange = "deployment_change" // DeploymentChangeEvent
+	WSMessageLogs             = "logs"              // []LogLine of a log subscription
+	WSMessageLogsEnded        = "logs_ended"        // the log subscription stopped on its own, error says why
+	WSMessagePing             = "ping"              // keepalive on idle connections
+	WSMessageClosing          = "closing"           // sent right before the server closes the connection
+)
+
+// command from the client, fields besides id and type depend on the type
+type WSCommand struct {
+	ID             string `json:"id,omitempty"` // chosen by the client, echoed in the answer
+	Type           string `json:"type"`
+	CredentialID   int    `json:"credentialId,omitempty"`
+	DeploymentID   string `json:"deploymentId,omitempty"`
+	SubscriptionID string `json:"subscriptionId,omitempty"`
+	EventID        int64  `json:"eventId,omitempty"`
+}
+
+// message from the server
+type WSMessage struct {
+	Type           string      `json:"type"`
+	ID             string      `json:"id,omitempty"`
+	SubscriptionID string      `json:"subscriptionId,omitempty"`
+	Data           interface{} `json:"data,omitempty"`
+	Error          *APIError   `json:"error,omitempty"`
+}
@@ -0,0 +1,84 @@
+package openapi
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+//OpenAPI 3 document of the /api/v1 routes
+// -> openapi.json is written by hand and embedded in the binary
+// -> paths are relative to the /api/v1 server url and use the same {param} syntax as the mux patterns
+
+//go:embed openapi.json
+var spec []byte
+
+// serves the document, no auth so tools can fetch it
+func Handler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	w.WriteHeader(http.StatusOK)
+
+	if _, err := w.Write(spec); err != nil {
+		log.WithFields(log.Fields{
+			"handler":    "OpenAPI",
+			"request_id": r.Context().Value("request_id"),
+		}).WithError(err).Error("Failed to write openapi document")
+	}
+}
+
+// "METHOD /path" of every operation in the document
+func Operations() (map[string]bool, error) {
+	var doc struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(spec, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse openapi document: %w", err)
+	}
+
+	operations := make(map[string]bool)
+	for path, item := range doc.Paths {
+		for method := range item {
+			// path items also hold parameters, summary...
+			switch method {
+			case "get", "put", "post", "delete", "patch", "head", "options":
+				operations[strings.ToUpper(method)+" "+path] = true
+			}
+		}
+	}
+	return operations, nil
+}
+
+// mux patterns ("GET /credentials/{id}", relative to /api/v1) that have no operation in the document
+// the server refuses to start when this isn't empty so the document can't drift from the routes
+func MissingRoutes(patterns []string) ([]string, error) {
+	operations, err := Operations()
+	if err != nil {
+		return nil, err
+	}
+
+	var missing []string
+	for _, pattern := range patterns {
+		method, path, ok := strings.Cut(pattern, " ")
+		if !ok {
+			return nil, fmt.Errorf("route %q has no method", pattern)
+		}
+		// "/{$}" only matches the path itself, openapi paths always do
+		path = strings.TrimSuffix(path, "{$}")
+		if path != "/" {
+			path = strings.TrimSuffix(path, "/")
+		}
+
+		if !operations[method+" "+path] {
+			missing = append(missing, pattern)
+		}
+	}
+
+	sort.Strings(missing)
+	return missing, nil
+}
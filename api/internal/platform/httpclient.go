@@ -0,0 +1,370 @@
+package platform
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"expvar"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
+)
+
+// http client shared by all providers
+// -> retries 429/5xx honoring Retry-After, exponential backoff with jitter
+// -> throttles each credential with a token bucket and pauses it when the platform says the rate limit is used up
+
+const (
+	DefaultProviderTimeout    = 30 * time.Second
+	DefaultProviderMaxRetries = 3
+	DefaultProviderRateLimit  = 5.0 // requests per second per credential
+	DefaultProviderRateBurst  = 10
+
+	retryBaseDelay = 500 * time.Millisecond
+	retryMaxDelay  = 30 * time.Second
+	// longer waits than this are not worth holding a request open for
+	maxRetryAfter = 60 * time.Second
+	// throttles of credentials that sent nothing for this long are dropped,
+	// deleted credentials and rotated api keys would otherwise stay in the map forever
+	throttleIdleTTL = 30 * time.Minute
+)
+
+type HTTPClient struct {
+	client     *http.Client
+	maxRetries int
+	rateLimit  rate.Limit
+	rateBurst  int
+
+	mu        sync.Mutex
+	throttle  map[string]*credentialThrottle
+	lastSweep time.Time
+}
+
+// per credential rate limiting state
+type credentialThrottle struct {
+	limiter *rate.Limiter
+
+	mu           sync.Mutex
+	blockedUntil time.Time // set when the platform reports no requests left
+	lastUsed     time.Time // guarded by HTTPClient.mu
+}
+
+// counters for provider calls, also published in expvar as "provider_http"
+type HTTPMetrics struct {
+	Requests    expvar.Int // requests sent to platforms, retries included
+	Retries     expvar.Int
+	RateLimited expvar.Int // 429 responses
+	ServerErrs  expvar.Int // 5xx responses
+	Throttled   expvar.Int // requests that had to wait for the token bucket or a rate limit reset
+	Failures    expvar.Int // requests that failed after all retries
+}
+
+var (
+	metrics       = &HTTPMetrics{}
+	defaultClient = NewHTTPClient(DefaultProviderMaxRetries, DefaultProviderRateLimit, DefaultProviderRateBurst)
+)
+
+func init() {
+	m := expvar.NewMap("provider_http")
+	m.Set("requests", &metrics.Requests)
+	m.Set("retries", &metrics.Retries)
+	m.Set("rate_limited", &metrics.RateLimited)
+	m.Set("server_errors", &metrics.ServerErrs)
+	m.Set("throttled", &metrics.Throttled)
+	m.Set("failures", &metrics.Failures)
+}
+
+func NewHTTPClient(maxRetries int, rateLimit float64, rateBurst int) *HTTPClient {
+	return &HTTPClient{
+		client: &http.Client{
+			Timeout: DefaultProviderTimeout,
+		},
+		maxRetries: maxRetries,
+		rateLimit:  rate.Limit(rateLimit),
+		rateBurst:  rateBurst,
+		throttle:   make(map[string]*credentialThrottle),
+		lastSweep:  time.Now(),
+	}
+}
+
+// loads the shared client settings from the environment
+// PROVIDER_MAX_RETRIES, PROVIDER_RATE_LIMIT (requests/second per credential) and PROVIDER_RATE_BURST
+func InitHTTPClient() error {
+	maxRetries := DefaultProviderMaxRetries
+	if v := os.Getenv("PROVIDER_MAX_RETRIES"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid PROVIDER_MAX_RETRIES %q", v)
+		}
+		maxRetries = n
+	}
+
+	rateLimit := DefaultProviderRateLimit
+	if v := os.Getenv("PROVIDER_RATE_LIMIT"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f <= 0 {
+			return fmt.Errorf("invalid PROVIDER_RATE_LIMIT %q", v)
+		}
+		rateLimit = f
+	}
+
+	rateBurst := DefaultProviderRateBurst
+	if v := os.Getenv("PROVIDER_RATE_BURST"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return fmt.Errorf("invalid PROVIDER_RATE_BURST %q", v)
+		}
+		rateBurst = n
+	}
+
+	defaultClient = NewHTTPClient(maxRetries, rateLimit, rateBurst)
+	return nil
+}
+
+// current values of the provider http counters
+func Metrics() map[string]int64 {
+	return map[string]int64{
+		"requests":      metrics.Requests.Value(),
+		"retries":       metrics.Retries.Value(),
+		"rate_limited":  metrics.RateLimited.Value(),
+		"server_errors": metrics.ServerErrs.Value(),
+		"throttled":     metrics.Throttled.Value(),
+		"failures":      metrics.Failures.Value(),
+	}
+}
+
+// key to throttle a credential by without keeping the api key around in plain text
+func ThrottleKey(apiKey string) string {
+	sum := sha256.Sum256([]byte(apiKey))
+	return hex.EncodeToString(sum[:8])
+}
+
+// sends the request, throttled under throttleKey and retried on 429/5xx and network errors
+// the caller closes the body of the returned response like with http.Client.Do
+func (c *HTTPClient) Do(req *http.Request, throttleKey string) (*http.Response, error) {
+	ctx := req.Context()
+	logger := log.WithFields(log.Fields{
+		"func":       "HTTPClient.Do",
+		"host":       req.URL.Host,
+		"path":       req.URL.Path,
+		"request_id": ctx.Value("request_id"),
+	})
+
+	throttle := c.throttleFor(throttleKey)
+
+	for attempt := 0; ; attempt++ {
+		if err := throttle.wait(ctx); err != nil {
+			metrics.Failures.Add(1)
+			return nil, err
+		}
+
+		// request bodies can only be read once, get a fresh one for retries
+		if attempt > 0 && req.Body != nil {
+			if req.GetBody == nil {
+				metrics.Failures.Add(1)
+				return nil, fmt.Errorf("cannot retry request with a body that can't be replayed")
+			}
+			body, err := req.GetBody()
+			if err != nil {
+				metrics.Failures.Add(1)
+				return nil, fmt.Errorf("failed to replay request body: %w", err)
+			}
+			req.Body = body
+		}
+
+		metrics.Requests.Add(1)
+		resp, err := c.client.Do(req)
+
+		var retryAfter time.Duration
+		if err == nil {
+			throttle.observe(resp.Header)
+
+			switch {
+			case resp.StatusCode == http.StatusTooManyRequests:
+				metrics.RateLimited.Add(1)
+				retryAfter = parseRetryAfter(resp.Header)
+			case resp.StatusCode >= 500:
+				metrics.ServerErrs.Add(1)
+				retryAfter = parseRetryAfter(resp.Header)
+			default:
+				return resp, nil
+			}
+		} else if ctx.Err() != nil {
+			// caller is gone, retrying is pointless
+			metrics.Failures.Add(1)
+			return nil, err
+		}
+
+		if attempt >= c.maxRetries || retryAfter > maxRetryAfter {
+			metrics.Failures.Add(1)
+			// hand the last response to the caller so it can report the status
+			return resp, err
+		}
+
+		delay := retryAfter
+		if delay == 0 {
+			delay = backoff(attempt)
+		}
+
+		retryLogger := logger.WithFields(log.Fields{
+			"attempt": attempt + 1,
+			"delay":   delay,
+		})
+		if err != nil {
+			retryLogger.WithError(err).Warn("Provider request failed, retrying")
+		} else {
+			retryLogger.WithField("status", resp.StatusCode).Warn("Provider request got retryable status, retrying")
+			// drain so the connection can be reused
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		metrics.Retries.Add(1)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			metrics.Failures.Add(1)
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func (c *HTTPClient) throttleFor(key string) *credentialThrottle {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(c.lastSweep) >= throttleIdleTTL {
+		c.sweepIdle(now)
+	}
+
+	t, ok := c.throttle[key]
+	if !ok {
+		t = &credentialThrottle{limiter: rate.NewLimiter(c.rateLimit, c.rateBurst)}
+		c.throttle[key] = t
+	}
+	t.lastUsed = now
+	return t
+}
+
+// drops throttles idle for throttleIdleTTL, a paused one is kept until its pause is over
+// an idle token bucket is full again anyway so a new one behaves the same, caller holds c.mu
+func (c *HTTPClient) sweepIdle(now time.Time) {
+	for key, t := range c.throttle {
+		if now.Sub(t.lastUsed) < throttleIdleTTL {
+			continue
+		}
+		t.mu.Lock()
+		paused := now.Before(t.blockedUntil)
+		t.mu.Unlock()
+		if !paused {
+			delete(c.throttle, key)
+		}
+	}
+	c.lastSweep = now
+}
+
+// blocks until the credential is allowed to send another request
+func (t *credentialThrottle) wait(ctx context.Context) error {
+	t.mu.Lock()
+	pause := time.Until(t.blockedUntil)
+	t.mu.Unlock()
+
+	if pause > 0 {
+		metrics.Throttled.Add(1)
+		timer := time.NewTimer(pause)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+
+	if !t.limiter.Allow() {
+		metrics.Throttled.Add(1)
+		return t.limiter.Wait(ctx)
+	}
+	return nil
+}
+
+// reads the rate limit headers -> Ratelimit-Remaining/Ratelimit-Reset (render) or the X-RateLimit-* variants
+func (t *credentialThrottle) observe(header http.Header) {
+	remaining := firstHeader(header, "Ratelimit-Remaining", "X-Ratelimit-Remaining")
+	if remaining != "0" {
+		return
+	}
+
+	reset := parseRateLimitReset(firstHeader(header, "Ratelimit-Reset", "X-Ratelimit-Reset"))
+	if reset <= 0 {
+		return
+	}
+	if reset > maxRetryAfter {
+		reset = maxRetryAfter
+	}
+
+	t.mu.Lock()
+	t.blockedUntil = time.Now().Add(reset)
+	t.mu.Unlock()
+}
+
+func firstHeader(header http.Header, keys ...string) string {
+	for _, key := range keys {
+		if v := header.Get(key); v != "" {
+			return strings.TrimSpace(v)
+		}
+	}
+	return ""
+}
+
+// Retry-After is either seconds or an http date
+func parseRetryAfter(header http.Header) time.Duration {
+	v := strings.TrimSpace(header.Get("Retry-After"))
+	if v == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(v); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// reset headers are seconds until reset, some apis send a unix timestamp instead
+func parseRateLimitReset(v string) time.Duration {
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n <= 0 {
+		return 0
+	}
+
+	// anything this big is an epoch timestamp
+	if n > 1_000_000_000 {
+		return time.Until(time.Unix(n, 0))
+	}
+	return time.Duration(n) * time.Second
+}
+
+// exponential backoff with full jitter
+func backoff(attempt int) time.Duration {
+	delay := retryBaseDelay << attempt
+	if delay <= 0 || delay > retryMaxDelay {
+		delay = retryMaxDelay
+	}
+	return time.Duration(rand.Int63n(int64(delay))) + time.Millisecond
+}
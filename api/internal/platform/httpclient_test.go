@@ -0,0 +1,161 @@
+package platform
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// server answering the nth call (from 0) with respond, counts the calls
+func startCountingServer(t *testing.T, respond func(n int, w http.ResponseWriter, r *http.Request)) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		respond(int(calls.Add(1))-1, w, r)
+	}))
+	t.Cleanup(server.Close)
+	return server, &calls
+}
+
+func get(t *testing.T, ctx context.Context, client *HTTPClient, url string) (*http.Response, error) {
+	t.Helper()
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		t.Fatalf("new request: %v", err)
+	}
+	return client.Do(req, t.Name())
+}
+
+func TestHTTPClientHonorsRetryAfter(t *testing.T) {
+	server, calls := startCountingServer(t, func(n int, w http.ResponseWriter, r *http.Request) {
+		if n == 0 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte("ok"))
+	})
+	client := NewHTTPClient(3, 100, 100)
+
+	start := time.Now()
+	resp, err := get(t, context.Background(), client, server.URL)
+	if err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK || calls.Load() != 2 {
+		t.Fatalf("got %d after %d calls, want 200 after the retry", resp.StatusCode, calls.Load())
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("retried after %v, Retry-After asked for 1s", elapsed)
+	}
+}
+
+// a wait longer than maxRetryAfter isn't worth holding the request, the 429 goes back to the caller
+func TestHTTPClientLongRetryAfterNotRetried(t *testing.T) {
+	server, calls := startCountingServer(t, func(n int, w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+
+	resp, err := get(t, context.Background(), NewHTTPClient(3, 100, 100), server.URL)
+	if err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusTooManyRequests || calls.Load() != 1 {
+		t.Errorf("got %d after %d calls, want the 429 after one call", resp.StatusCode, calls.Load())
+	}
+}
+
+func TestHTTPClientRetriesServerErrors(t *testing.T) {
+	statuses := []int{http.StatusServiceUnavailable, http.StatusBadGateway}
+	server, calls := startCountingServer(t, func(n int, w http.ResponseWriter, r *http.Request) {
+		// the body is sent again with every attempt
+		body, _ := io.ReadAll(r.Body)
+		if string(body) != `{"q":1}` {
+			t.Errorf("attempt %d got body %q", n, body)
+		}
+		if n < len(statuses) {
+			w.WriteHeader(statuses[n])
+			return
+		}
+		w.Write([]byte("ok"))
+	})
+
+	req, err := http.NewRequest("POST", server.URL, strings.NewReader(`{"q":1}`))
+	if err != nil {
+		t.Fatalf("new request: %v", err)
+	}
+	resp, err := NewHTTPClient(3, 100, 100).Do(req, t.Name())
+	if err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || calls.Load() != 3 {
+		t.Fatalf("got %d after %d calls, want 200 after two retries", resp.StatusCode, calls.Load())
+	}
+}
+
+// out of retries the last response is handed back so the caller can report its status
+func TestHTTPClientServerErrorsExhaustRetries(t *testing.T) {
+	server, calls := startCountingServer(t, func(n int, w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	resp, err := get(t, context.Background(), NewHTTPClient(1, 100, 100), server.URL)
+	if err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusInternalServerError || calls.Load() != 2 {
+		t.Errorf("got %d after %d calls, want the 500 after one retry", resp.StatusCode, calls.Load())
+	}
+}
+
+func TestHTTPClientClientErrorsNotRetried(t *testing.T) {
+	for _, status := range []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound} {
+		server, calls := startCountingServer(t, func(n int, w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(status)
+		})
+
+		resp, err := get(t, context.Background(), NewHTTPClient(3, 100, 100), server.URL)
+		if err != nil {
+			t.Fatalf("Do on %d: %v", status, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != status || calls.Load() != 1 {
+			t.Errorf("got %d after %d calls, want %d after one call", resp.StatusCode, calls.Load(), status)
+		}
+	}
+}
+
+// the caller going away ends the wait before the next attempt
+func TestHTTPClientCancelDuringBackoff(t *testing.T) {
+	server, calls := startCountingServer(t, func(n int, w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "30")
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	start := time.Now()
+	resp, err := get(t, ctx, NewHTTPClient(3, 100, 100), server.URL)
+	if !errors.Is(err, context.Canceled) || resp != nil {
+		t.Fatalf("got response %v and err %v, want context.Canceled", resp, err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("returned after %v, want right after the cancel", elapsed)
+	}
+	if calls.Load() != 1 {
+		t.Errorf("%d calls, want 1", calls.Load())
+	}
+}
@@ -4,49 +4,68 @@ import (
 	"checkmate/api/internal/model"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
 	"time"
 )
 
-const renderAPIBaseURL = "https://api.render.com/v1"
+var (
+	// root of the render api, tests point it at a local stand-in
+	RenderAPIBaseURL = "https://api.render.com/v1"
+
+	// the platform rejected the api key
+	ErrUnauthorized = errors.New("invalid API key")
+	// the platform doesn't know the requested resource
+	ErrNotFound = errors.New("not found on the platform")
+)
 
 // implements operations for the Render platform
 type RenderProvider struct {
 	client *model.RenderClient
+	http   *HTTPClient
 }
 
 func NewRenderProvider(apiKey string) *RenderProvider {
 	return &RenderProvider{
 		client: &model.RenderClient{
 			ApiKey: apiKey,
-			Client: &http.Client{
-				Timeout: 30 * time.Second,
-			},
 		},
+		http: defaultClient,
 	}
 }
 
-// verify valid api key
-func (p *RenderProvider) VerifyCredentials(ctx context.Context) error {
-	req, err := http.NewRequestWithContext(ctx, "GET", renderAPIBaseURL+"/services", nil)
+// sends an authenticated GET to the render api through the shared client
+func (p *RenderProvider) get(ctx context.Context, path string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", RenderAPIBaseURL+path, nil)
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	req.Header.Set("Authorization", "Bearer "+p.client.ApiKey)
 	req.Header.Set("Accept", "application/json")
 
-	resp, err := p.client.Client.Do(req)
+	resp, err := p.http.Do(req, ThrottleKey(p.client.ApiKey))
 	if err != nil {
-		return fmt.Errorf("failed to execute request: %w", err)
+		return nil, fmt.Errorf("failed to execute request: %w", err)
+	}
+	return resp, nil
+}
+
+// verify valid api key
+func (p *RenderProvider) VerifyCredentials(ctx context.Context) error {
+	resp, err := p.get(ctx, "/services")
+	if err != nil {
+		return err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode == http.StatusUnauthorized {
-		return fmt.Errorf("invalid API key")
+		return ErrUnauthorized
 	} else if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
 		return fmt.Errorf("received non-OK response: %d, body: %s", resp.StatusCode, string(body))
@@ -56,21 +75,15 @@ func (p *RenderProvider) VerifyCredentials(ctx context.Context) error {
 }
 
 func (p *RenderProvider) GetServices(ctx context.Context) ([]model.Deployment, error) {
-	req, err := http.NewRequestWithContext(ctx, "GET", renderAPIBaseURL+"/services", nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
-
-	req.Header.Set("Authorization", "Bearer "+p.client.ApiKey)
-	req.Header.Set("Accept", "application/json")
-
-	resp, err := p.client.Client.Do(req)
+	resp, err := p.get(ctx, "/services")
 	if err != nil {
-		return nil, fmt.Errorf("failed to execute request: %w", err)
+		return nil, err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
+	if resp.StatusCode == http.StatusUnauthorized {
+		return nil, ErrUnauthorized
+	} else if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
 		return nil, fmt.Errorf("received non-OK response: %d, body: %s", resp.StatusCode, string(body))
 	}
@@ -129,6 +142,161 @@ func (p *RenderProvider) GetServices(ctx context.Context) ([]model.Deployment, e
 	return deployments, nil
 }
 
+// gets the most recent deploy of a service
+func (p *RenderProvider) GetLatestDeploy(ctx context.Context, serviceID string) (*model.DeployInfo, error) {
+	resp, err := p.get(ctx, "/services/"+url.PathEscape(serviceID)+"/deploys?limit=1")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized:
+		return nil, ErrUnauthorized
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, ErrNotFound
+	case resp.StatusCode != http.StatusOK:
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("received non-OK response: %d, body: %s", resp.StatusCode, string(body))
+	}
+
+	var deployResponses []model.RenderDeployResponse
+	if err := json.NewDecoder(resp.Body).Decode(&deployResponses); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	// service was never deployed
+	if len(deployResponses) == 0 {
+		return nil, nil
+	}
+
+	deploy := deployResponses[0].Deploy
+	return &model.DeployInfo{
+		ID:            deploy.ID,
+		Status:        deploy.Status,
+		CommitID:      deploy.Commit.ID,
+		CommitMessage: deploy.Commit.Message,
+		CreatedAt:     deploy.CreatedAt,
+		FinishedAt:    deploy.FinishedAt,
+	}, nil
+}
+
+// GET /services/{id}, unlike the list a single service isn't wrapped in {"service": ...}
+func (p *RenderProvider) getService(ctx context.Context, serviceID string) (*model.RenderService, error) {
+	resp, err := p.get(ctx, "/services/"+url.PathEscape(serviceID))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized:
+		return nil, ErrUnauthorized
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, ErrNotFound
+	case resp.StatusCode != http.StatusOK:
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("received non-OK response: %d, body: %s", resp.StatusCode, string(body))
+	}
+
+	var service model.RenderService
+	if err := json.NewDecoder(resp.Body).Decode(&service); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return &service, nil
+}
+
+// service settings and latest deploy of one service, for the deployment detail view
+func (p *RenderProvider) GetServiceDetails(ctx context.Context, serviceID string) (*model.DeploymentDetails, error) {
+	service, err := p.getService(ctx, serviceID)
+	if err != nil {
+		return nil, err
+	}
+
+	details := &model.DeploymentDetails{
+		InstanceCount: service.ServiceDetails.NumInstances,
+		Plan:          service.ServiceDetails.Plan,
+		Region:        service.ServiceDetails.Region,
+		Runtime:       service.ServiceDetails.Runtime,
+	}
+
+	details.LatestDeploy, err = p.GetLatestDeploy(ctx, serviceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get latest deploy: %w", err)
+	}
+
+	return details, nil
+}
+
+// workspace of a service, needed to query its logs
+func (p *RenderProvider) GetServiceOwner(ctx context.Context, serviceID string) (string, error) {
+	service, err := p.getService(ctx, serviceID)
+	if err != nil {
+		return "", err
+	}
+	return service.OwnerID, nil
+}
+
+// log lines of a service from start on, oldest first
+func (p *RenderProvider) GetLogs(ctx context.Context, ownerID, serviceID string, start time.Time, limit int) (*model.LogPage, error) {
+	query := url.Values{}
+	query.Set("ownerId", ownerID)
+	query.Set("resource", serviceID)
+	query.Set("startTime", start.UTC().Format(time.RFC3339Nano))
+	query.Set("direction", "forward")
+	query.Set("limit", strconv.Itoa(limit))
+
+	resp, err := p.get(ctx, "/logs?"+query.Encode())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized:
+		return nil, ErrUnauthorized
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, ErrNotFound
+	case resp.StatusCode != http.StatusOK:
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("received non-OK response: %d, body: %s", resp.StatusCode, string(body))
+	}
+
+	var logsResponse model.RenderLogsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&logsResponse); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	page := &model.LogPage{
+		Lines:   make([]model.LogLine, 0, len(logsResponse.Logs)),
+		HasMore: logsResponse.HasMore,
+	}
+	for _, log := range logsResponse.Logs {
+		line := model.LogLine{ID: log.ID, Timestamp: log.Timestamp, Message: log.Message}
+		for _, label := range log.Labels {
+			switch label.Name {
+			case "level":
+				line.Level = label.Value
+			case "type":
+				line.Type = label.Value
+			}
+		}
+		page.Lines = append(page.Lines, line)
+	}
+
+	// nextStartTime is only meaningful while there are more pages, otherwise continue right after the last line
+	switch n := len(page.Lines); {
+	case page.HasMore && !logsResponse.NextStartTime.IsZero():
+		page.Next = logsResponse.NextStartTime
+	case n > 0:
+		page.Next = page.Lines[n-1].Timestamp.Add(time.Nanosecond)
+	default:
+		page.Next = start
+	}
+
+	return page, nil
+}
+
 // todo there are more status in render, need to check them out
 func (p *RenderProvider) determineDeploymentStatus(service model.RenderService) model.DeploymentStatus {
 	switch strings.ToLower(service.Status) {
@@ -0,0 +1,52 @@
+package platform
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// 401 and 404 come back as the sentinel errors the services map to statuses, on every render call
+func TestRenderStatusMapping(t *testing.T) {
+	tests := []struct {
+		status int
+		want   error
+	}{
+		{http.StatusUnauthorized, ErrUnauthorized},
+		{http.StatusNotFound, ErrNotFound},
+	}
+
+	calls := map[string]func(p *RenderProvider) error{
+		"GetLatestDeploy": func(p *RenderProvider) error {
+			_, err := p.GetLatestDeploy(context.Background(), "srv-1")
+			return err
+		},
+		"GetServiceDetails": func(p *RenderProvider) error {
+			_, err := p.GetServiceDetails(context.Background(), "srv-1")
+			return err
+		},
+		"GetServiceOwner": func(p *RenderProvider) error {
+			_, err := p.GetServiceOwner(context.Background(), "srv-1")
+			return err
+		},
+	}
+
+	for _, tt := range tests {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(tt.status)
+		}))
+		base := RenderAPIBaseURL
+		RenderAPIBaseURL = server.URL
+
+		for name, call := range calls {
+			if err := call(NewRenderProvider("rnd_test")); !errors.Is(err, tt.want) {
+				t.Errorf("%s on %d: got %v, want %v", name, tt.status, err, tt.want)
+			}
+		}
+
+		RenderAPIBaseURL = base
+		server.Close()
+	}
+}
@@ -0,0 +1,202 @@
+package service
+
+import (
+	"checkmate/api/internal/model"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+//Circuit breaker per credential -> stops calling a platform that keeps failing for a credential
+// closed -> normal, calls go through
+// open -> calls are skipped and cached data is served, until the open duration passes
+// half open -> one trial call, success closes the breaker, failure opens it again for twice as long
+//             other calls are skipped while the trial is running
+
+const (
+	DefaultBreakerFailureThreshold = 3
+	DefaultBreakerOpenDuration     = 1 * time.Minute
+	breakerMaxOpenDuration         = 30 * time.Minute
+	// a trial call that never reports back (caller gone) stops blocking the next one after this
+	breakerTrialTimeout = 2 * cacheRefreshTimeout
+)
+
+var (
+	// consecutive failures that open the breaker
+	BreakerFailureThreshold = DefaultBreakerFailureThreshold
+	// how long the breaker stays open before the first trial call
+	BreakerOpenDuration = DefaultBreakerOpenDuration
+
+	ErrCircuitOpen = newError(ErrUpstreamUnavailable, "platform unreachable for this credential, circuit breaker is open")
+)
+
+type circuitBreaker struct {
+	mu                  sync.Mutex
+	state               model.BreakerState
+	consecutiveFailures int
+	openDuration        time.Duration
+	unreachableSince    time.Time
+	lastFailureAt       time.Time
+	nextAttemptAt       time.Time
+	trialUntil          time.Time // half open -> the trial call in flight holds the breaker until then
+}
+
+var (
+	breakersMu sync.Mutex
+	breakers   = make(map[int]*circuitBreaker)
+)
+
+// loads breaker settings from the environment -> BREAKER_FAILURE_THRESHOLD and BREAKER_OPEN_DURATION
+func InitBreakerSettings() error {
+	if v := os.Getenv("BREAKER_FAILURE_THRESHOLD"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return fmt.Errorf("invalid BREAKER_FAILURE_THRESHOLD %q", v)
+		}
+		BreakerFailureThreshold = n
+	}
+
+	var err error
+	if BreakerOpenDuration, err = durationFromEnv("BREAKER_OPEN_DURATION", DefaultBreakerOpenDuration); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func breakerFor(credentialID int) *circuitBreaker {
+	breakersMu.Lock()
+	defer breakersMu.Unlock()
+
+	b, ok := breakers[credentialID]
+	if !ok {
+		b = &circuitBreaker{state: model.BreakerClosed, openDuration: BreakerOpenDuration}
+		breakers[credentialID] = b
+	}
+	return b
+}
+
+// forgets the breaker of a credential -> after the api key changes or the credential is deleted
+func resetBreaker(credentialID int) {
+	breakersMu.Lock()
+	defer breakersMu.Unlock()
+	delete(breakers, credentialID)
+}
+
+// checks if a platform call can be made, moves an open breaker to half open once its time is up
+// half open lets a single trial call through, whoever gets true must record the outcome
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	switch b.state {
+	case model.BreakerOpen:
+		if now.Before(b.nextAttemptAt) {
+			return false
+		}
+		b.state = model.BreakerHalfOpen
+		b.trialUntil = now.Add(breakerTrialTimeout)
+		return true
+	case model.BreakerHalfOpen:
+		if now.Before(b.trialUntil) {
+			return false
+		}
+		// the last trial never reported back, let another one through
+		b.trialUntil = now.Add(breakerTrialTimeout)
+		return true
+	default:
+		return true
+	}
+}
+
+func (b *circuitBreaker) recordSuccess(credentialID int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state != model.BreakerClosed {
+		log.WithFields(log.Fields{
+			"func":              "circuitBreaker.recordSuccess",
+			"credential_id":     credentialID,
+			"unreachable_since": b.unreachableSince,
+		}).Info("Platform reachable again, closing circuit breaker")
+	}
+
+	b.state = model.BreakerClosed
+	b.consecutiveFailures = 0
+	b.openDuration = BreakerOpenDuration
+	b.unreachableSince = time.Time{}
+	b.nextAttemptAt = time.Time{}
+	b.trialUntil = time.Time{}
+}
+
+func (b *circuitBreaker) recordFailure(credentialID int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.consecutiveFailures++
+	b.lastFailureAt = now
+	if b.unreachableSince.IsZero() {
+		b.unreachableSince = now
+	}
+
+	switch {
+	case b.state == model.BreakerHalfOpen:
+		// trial call failed, back off further
+		b.openDuration *= 2
+		if b.openDuration > breakerMaxOpenDuration {
+			b.openDuration = breakerMaxOpenDuration
+		}
+	case b.consecutiveFailures < BreakerFailureThreshold:
+		return
+	}
+
+	b.state = model.BreakerOpen
+	b.nextAttemptAt = now.Add(b.openDuration)
+	b.trialUntil = time.Time{}
+
+	log.WithFields(log.Fields{
+		"func":                 "circuitBreaker.recordFailure",
+		"credential_id":        credentialID,
+		"consecutive_failures": b.consecutiveFailures,
+		"next_attempt_at":      b.nextAttemptAt,
+	}).Warn("Opening circuit breaker for credential")
+}
+
+// breaker state of a credential for the credential listing
+func GetCredentialHealth(credentialID int) *model.CredentialHealth {
+	breakersMu.Lock()
+	b, ok := breakers[credentialID]
+	breakersMu.Unlock()
+
+	// no calls made yet since startup
+	if !ok {
+		return &model.CredentialHealth{State: model.BreakerClosed}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	health := &model.CredentialHealth{
+		State:               b.state,
+		ConsecutiveFailures: b.consecutiveFailures,
+	}
+	if !b.unreachableSince.IsZero() {
+		since := b.unreachableSince
+		health.UnreachableSince = &since
+	}
+	if !b.lastFailureAt.IsZero() {
+		last := b.lastFailureAt
+		health.LastFailureAt = &last
+	}
+	if b.state == model.BreakerOpen {
+		next := b.nextAttemptAt
+		health.NextAttemptAt = &next
+	}
+	return health
+}
@@ -0,0 +1,204 @@
+package service
+
+import (
+	"checkmate/api/internal/model"
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// an open breaker whose time is up
+func expiredBreaker() *circuitBreaker {
+	return &circuitBreaker{
+		state:         model.BreakerOpen,
+		openDuration:  BreakerOpenDuration,
+		nextAttemptAt: time.Now().Add(-time.Second),
+	}
+}
+
+// callers outside the refresh singleflight (details, logs) race for the trial, only one may get it
+func TestBreakerHalfOpenAllowsOneTrial(t *testing.T) {
+	b := expiredBreaker()
+
+	var allowed atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if b.allow() {
+				allowed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := allowed.Load(); n != 1 {
+		t.Fatalf("%d trial calls allowed, want 1", n)
+	}
+	if b.state != model.BreakerHalfOpen {
+		t.Fatalf("breaker is %s, want half open", b.state)
+	}
+
+	// success closes it for everyone
+	b.recordSuccess(1)
+	if !b.allow() || !b.allow() {
+		t.Fatal("closed breaker refused a call")
+	}
+}
+
+func TestBreakerFailedTrialReopens(t *testing.T) {
+	b := expiredBreaker()
+	if !b.allow() {
+		t.Fatal("trial call refused")
+	}
+	b.recordFailure(1)
+
+	if b.state != model.BreakerOpen || b.allow() {
+		t.Fatalf("breaker is %s after a failed trial, want open and refusing calls", b.state)
+	}
+	if b.openDuration != 2*BreakerOpenDuration {
+		t.Errorf("open for %v after a failed trial, want %v", b.openDuration, 2*BreakerOpenDuration)
+	}
+}
+
+// a trial whose caller went away without reporting doesn't hold the breaker forever
+func TestBreakerAbandonedTrialExpires(t *testing.T) {
+	b := expiredBreaker()
+	if !b.allow() {
+		t.Fatal("trial call refused")
+	}
+	if b.allow() {
+		t.Fatal("second call allowed while the trial runs")
+	}
+
+	b.trialUntil = time.Now().Add(-time.Second)
+	if !b.allow() {
+		t.Fatal("no new trial after the last one expired")
+	}
+	if b.allow() {
+		t.Fatal("second call allowed while the new trial runs")
+	}
+}
+
+func TestBreakerOpensAfterConsecutiveFailures(t *testing.T) {
+	b := &circuitBreaker{state: model.BreakerClosed, openDuration: BreakerOpenDuration}
+
+	for i := 1; i < BreakerFailureThreshold; i++ {
+		b.recordFailure(1)
+		if b.state != model.BreakerClosed || !b.allow() {
+			t.Fatalf("breaker is %s after %d failures, want closed", b.state, i)
+		}
+	}
+	// a success in between starts the count over
+	b.recordSuccess(1)
+	for i := 0; i < BreakerFailureThreshold-1; i++ {
+		b.recordFailure(1)
+	}
+	if b.state != model.BreakerClosed {
+		t.Fatalf("breaker is %s, the success should have reset the count", b.state)
+	}
+
+	b.recordFailure(1)
+	if b.state != model.BreakerOpen || b.allow() {
+		t.Fatalf("breaker is %s after %d failures in a row, want open and refusing calls", b.state, BreakerFailureThreshold)
+	}
+	if wait := time.Until(b.nextAttemptAt); wait <= 0 || wait > BreakerOpenDuration {
+		t.Errorf("next attempt in %v, want within %v", wait, BreakerOpenDuration)
+	}
+}
+
+// every failed trial doubles the open duration, up to breakerMaxOpenDuration
+func TestBreakerBackoffIsCapped(t *testing.T) {
+	b := expiredBreaker()
+	want := BreakerOpenDuration
+	for i := 0; i < 10; i++ {
+		b.nextAttemptAt = time.Now().Add(-time.Second)
+		if !b.allow() {
+			t.Fatalf("trial %d refused", i)
+		}
+		b.recordFailure(1)
+
+		want *= 2
+		if want > breakerMaxOpenDuration {
+			want = breakerMaxOpenDuration
+		}
+		if b.openDuration != want {
+			t.Fatalf("open for %v after %d failed trials, want %v", b.openDuration, i+1, want)
+		}
+	}
+
+	// closing starts over from the configured duration
+	b.nextAttemptAt = time.Now().Add(-time.Second)
+	b.allow()
+	b.recordSuccess(1)
+	if b.openDuration != BreakerOpenDuration {
+		t.Errorf("open duration %v after closing, want %v", b.openDuration, BreakerOpenDuration)
+	}
+}
+
+// a revoked key: the refreshes fall back to the cache and once the breaker is open the platform isn't called anymore
+func TestBreakerServesCacheWhilePlatformFails(t *testing.T) {
+	openTestDB(t)
+	cred := createTestCredential(t, "user-breaker")
+	render := startFakeRender(t, renderService("srv-1", "api", "live"), renderService("srv-2", "worker", "live"))
+	ctx := context.Background()
+
+	if _, _, err := GetFreshOrUpdateCache(ctx, cred, true); err != nil {
+		t.Fatalf("first refresh: %v", err)
+	}
+	if health := GetCredentialHealth(cred.ID); health.State != model.BreakerClosed || health.UnreachableSince != nil {
+		t.Fatalf("health after a good refresh = %+v, want closed", health)
+	}
+
+	render.failStatus.Store(401)
+	refresh := func() *model.CacheInfo {
+		t.Helper()
+		deployments, info, err := GetFreshOrUpdateCache(ctx, cred, true)
+		if err != nil {
+			t.Fatalf("refresh with the platform down: %v", err)
+		}
+		if len(deployments) != 2 || !info.Stale || info.StaleReason != model.StaleReasonPlatformUnavailable {
+			t.Fatalf("got %d deployments and cache info %+v, want the 2 cached ones marked stale", len(deployments), info)
+		}
+		return info
+	}
+
+	for i := 0; i < BreakerFailureThreshold; i++ {
+		refresh()
+	}
+	calls := render.listCalls.Load()
+	if calls != int32(1+BreakerFailureThreshold) {
+		t.Fatalf("%d platform calls, want one per refresh", calls)
+	}
+
+	health := GetCredentialHealth(cred.ID)
+	if health.State != model.BreakerOpen || health.ConsecutiveFailures != BreakerFailureThreshold ||
+		health.UnreachableSince == nil || health.LastFailureAt == nil || health.NextAttemptAt == nil {
+		t.Fatalf("health with the breaker open = %+v", health)
+	}
+	since := *health.UnreachableSince
+
+	// short circuited, still the cached data
+	refresh()
+	if n := render.listCalls.Load(); n != calls {
+		t.Fatalf("open breaker still called the platform, %d calls", n)
+	}
+
+	// the platform is back when the breaker half opens
+	render.failStatus.Store(0)
+	breakerFor(cred.ID).nextAttemptAt = time.Now().Add(-time.Second)
+	_, info, err := GetFreshOrUpdateCache(ctx, cred, true)
+	if err != nil || info.Stale {
+		t.Fatalf("refresh after recovery: cache info %+v, err %v", info, err)
+	}
+	if n := render.listCalls.Load(); n != calls+1 {
+		t.Fatalf("%d platform calls after the trial, want %d", n, calls+1)
+	}
+	health = GetCredentialHealth(cred.ID)
+	if health.State != model.BreakerClosed || health.ConsecutiveFailures != 0 || health.UnreachableSince != nil {
+		t.Errorf("health after recovery = %+v, want closed and reachable (was unreachable since %v)", health, since)
+	}
+}
@@ -0,0 +1,141 @@
+package service
+
+import (
+	"checkmate/api/internal/model"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+//Cache settings and freshness rules for the deployment cache
+
+const (
+	DefaultCacheTTL                  = 30 * time.Second // how long cached deployments are considered fresh
+	DefaultCacheStaleWhileRevalidate = 5 * time.Minute  // stale data served right away while refreshing in background
+	DefaultCacheMaxStaleness         = 24 * time.Hour   // stale data served when the platform is down
+	DefaultDeploymentGoneGracePeriod = 15 * time.Minute // missing deployments kept as is before being marked gone
+	cacheRefreshTimeout              = 30 * time.Second
+
+	// bounds for the per credential ttl set through the api
+	MinCredentialCacheTTLSeconds = 5
+	MaxCredentialCacheTTLSeconds = 24 * 60 * 60
+)
+
+var (
+	// global ttl, used when neither the credential nor its platform has one
+	CacheTTL = DefaultCacheTTL
+	// ttl per platform -> ex longer for rate limited apis
+	PlatformCacheTTL = map[string]time.Duration{}
+	// how long after expiring the cache is still returned immediately while a refresh runs in the background
+	CacheStaleWhileRevalidate = DefaultCacheStaleWhileRevalidate
+	// oldest cache we are willing to serve when the platform call fails
+	CacheMaxStaleness = DefaultCacheMaxStaleness
+	// how long a deployment can be missing from the platform response before it is marked gone
+	DeploymentGoneGracePeriod = DefaultDeploymentGoneGracePeriod
+)
+
+// platforms that can have their own ttl -> CACHE_TTL_<PLATFORM>
+var supportedPlatforms = []string{"render", "vercel"}
+
+// coalesces concurrent refreshes of the same credential -> keyed by credential id
+var refreshGroup singleflight.Group
+
+// loads cache settings from the environment, all values are go durations (ex "10m")
+// CACHE_TTL, CACHE_TTL_<PLATFORM>, CACHE_STALE_WHILE_REVALIDATE, CACHE_MAX_STALENESS and DEPLOYMENT_GONE_GRACE_PERIOD
+func InitCacheSettings() error {
+	var err error
+
+	if CacheTTL, err = durationFromEnv("CACHE_TTL", DefaultCacheTTL); err != nil {
+		return err
+	}
+
+	for _, p := range supportedPlatforms {
+		key := "CACHE_TTL_" + strings.ToUpper(p)
+		if os.Getenv(key) == "" {
+			continue
+		}
+		ttl, err := durationFromEnv(key, CacheTTL)
+		if err != nil {
+			return err
+		}
+		PlatformCacheTTL[p] = ttl
+	}
+
+	if CacheStaleWhileRevalidate, err = durationFromEnv("CACHE_STALE_WHILE_REVALIDATE", DefaultCacheStaleWhileRevalidate); err != nil {
+		return err
+	}
+
+	if CacheMaxStaleness, err = durationFromEnv("CACHE_MAX_STALENESS", DefaultCacheMaxStaleness); err != nil {
+		return err
+	}
+
+	if DeploymentGoneGracePeriod, err = durationFromEnv("DEPLOYMENT_GONE_GRACE_PERIOD", DefaultDeploymentGoneGracePeriod); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// reads a non negative duration from the environment, returns the default when not set
+func durationFromEnv(key string, def time.Duration) (time.Duration, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return def, nil
+	}
+
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid %s %q", key, v)
+	}
+	return d, nil
+}
+
+// ttl that applies to a credential -> credential override, then platform, then global
+func EffectiveCacheTTL(cred *model.PlatformCredential) time.Duration {
+	if cred.CacheTTLSeconds != nil {
+		return time.Duration(*cred.CacheTTLSeconds) * time.Second
+	}
+	if ttl, ok := PlatformCacheTTL[cred.Platform]; ok {
+		return ttl
+	}
+	return CacheTTL
+}
+
+// checks if cached data is still valid (less than ttl old)
+func IsCacheFresh(lastUpdatedAt time.Time, ttl time.Duration) bool {
+	return time.Since(lastUpdatedAt) < ttl
+}
+
+// checks if expired cached data can still be returned while refreshing in the background
+func IsCacheRevalidatable(lastUpdatedAt time.Time, ttl time.Duration) bool {
+	return time.Since(lastUpdatedAt) < ttl+CacheStaleWhileRevalidate
+}
+
+// checks if cached data is recent enough to be served when the platform is unavailable
+func IsCacheServable(lastUpdatedAt time.Time) bool {
+	return time.Since(lastUpdatedAt) < CacheMaxStaleness
+}
+
+// builds the cache info returned to the client
+func newCacheInfo(credentialID int, lastUpdated time.Time, ttl time.Duration, staleReason string) *model.CacheInfo {
+	now := time.Now()
+
+	// if the cache already expired the refresh is due now
+	nextRefresh := lastUpdated.Add(ttl)
+	if nextRefresh.Before(now) {
+		nextRefresh = now
+	}
+
+	return &model.CacheInfo{
+		PlatformCredentialID: credentialID,
+		LastUpdatedAt:        lastUpdated,
+		AgeSeconds:           int64(now.Sub(lastUpdated).Seconds()),
+		TTLSeconds:           int64(ttl.Seconds()),
+		NextRefreshAt:        nextRefresh,
+		Stale:                staleReason != "",
+		StaleReason:          staleReason,
+	}
+}
@@ -0,0 +1,362 @@
+package service
+
+import (
+	"checkmate/api/internal/model"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+//Slack and Discord messages -> the same event rendered as Block Kit for slack and as an embed for discord
+// the message is what gets queued, the channel and the thread are only added when it is sent
+
+const (
+	slackPostMessageURL = "https://slack.com/api/chat.postMessage"
+
+	// slack rejects longer header and field texts, discord longer embed parts
+	slackHeaderMaxLength  = 150
+	slackFieldMaxLength   = 2000
+	discordTitleMaxLength = 256
+	discordFieldMaxLength = 1024
+	discordThreadMaxName  = 100
+	// only the first line of a commit message is shown
+	commitMessageMaxLength = 200
+	shortCommitLength      = 7
+
+	discordColorFailed    = 0xE01E5A
+	discordColorLive      = 0x2EB67D
+	discordColorDeploying = 0x36C5F0
+	discordColorOther     = 0x99AAB5
+)
+
+// hosts discord webhooks are served from
+var discordWebhookHosts = []string{"discord.com", "discordapp.com", "ptb.discord.com", "canary.discord.com"}
+
+// what a chat message says, built from an event and the cached deployment
+type chatMessage struct {
+	EventType     model.WebhookEventType
+	Headline      string
+	Service       string
+	Platform      string
+	OldStatus     model.DeploymentStatus
+	NewStatus     model.DeploymentStatus
+	Branch        string
+	CommitID      string
+	CommitMessage string
+	DashboardURL  string // empty when the platform doesn't have one
+	At            time.Time
+}
+
+func newChatMessage(eventType model.WebhookEventType, platform string, event *model.DeploymentEvent, deployment *model.Deployment, at time.Time) chatMessage {
+	msg := chatMessage{
+		EventType: eventType,
+		Platform:  platform,
+		At:        at,
+	}
+	if event == nil {
+		msg.Headline = "Test message from checkmate"
+		return msg
+	}
+
+	msg.Service = event.DeploymentName
+	msg.OldStatus = event.OldStatus
+	msg.NewStatus = event.NewStatus
+	msg.CommitID = event.CommitID
+	msg.CommitMessage = firstLine(event.CommitMessage, commitMessageMaxLength)
+	if deployment != nil {
+		msg.Branch = deployment.Branch
+		if u, ok := deployment.Metadata["dashboardUrl"].(string); ok {
+			msg.DashboardURL = u
+		}
+	}
+
+	switch eventType {
+	case model.WebhookEventDeploymentFailed:
+		msg.Headline = msg.Service + " failed"
+	case model.WebhookEventDeploymentRecovered:
+		msg.Headline = msg.Service + " recovered"
+	case model.WebhookEventDeploymentSucceeded:
+		msg.Headline = msg.Service + " deployed"
+	case model.WebhookEventDeploymentDeploying:
+		msg.Headline = msg.Service + " is deploying"
+	case model.WebhookEventDeploymentEscalated:
+		msg.Headline = fmt.Sprintf("%s still failing after %d minutes", msg.Service, int(at.Sub(event.ObservedAt).Minutes()))
+	default:
+		msg.Headline = fmt.Sprintf("%s is %s", msg.Service, msg.NewStatus)
+	}
+	return msg
+}
+
+// short sha followed by the commit message, empty without a commit
+func (m *chatMessage) CommitLine() string {
+	if m.CommitID == "" {
+		return ""
+	}
+	sha := m.CommitID
+	if len(sha) > shortCommitLength {
+		sha = sha[:shortCommitLength]
+	}
+	if m.CommitMessage == "" {
+		return sha
+	}
+	return sha + " " + m.CommitMessage
+}
+
+func (m *chatMessage) StatusChange() string {
+	if m.OldStatus == "" {
+		return string(m.NewStatus)
+	}
+	return fmt.Sprintf("%s → %s", m.OldStatus, m.NewStatus)
+}
+
+// Block Kit message, text is the fallback shown in notifications
+func slackMessage(m chatMessage) map[string]interface{} {
+	blocks := []map[string]interface{}{
+		{
+			"type": "header",
+			"text": map[string]interface{}{
+				"type":  "plain_text",
+				"text":  truncateRunes(slackStatusEmoji(m.NewStatus)+m.Headline, slackHeaderMaxLength),
+				"emoji": true,
+			},
+		},
+	}
+
+	var fields []map[string]interface{}
+	addField := func(name, value string) {
+		if value == "" {
+			return
+		}
+		fields = append(fields, map[string]interface{}{
+			"type": "mrkdwn",
+			"text": truncateRunes(fmt.Sprintf("*%s*\n%s", name, slackEscape(value)), slackFieldMaxLength),
+		})
+	}
+	addField("Service", m.Service)
+	addField("Platform", m.Platform)
+	if m.NewStatus != "" {
+		addField("Status", m.StatusChange())
+	}
+	addField("Branch", m.Branch)
+	if len(fields) > 0 {
+		blocks = append(blocks, map[string]interface{}{"type": "section", "fields": fields})
+	}
+
+	if commit := m.CommitLine(); commit != "" {
+		blocks = append(blocks, map[string]interface{}{
+			"type": "section",
+			"text": map[string]interface{}{
+				"type": "mrkdwn",
+				"text": truncateRunes("*Commit*\n"+slackEscape(commit), slackFieldMaxLength),
+			},
+		})
+	}
+
+	if m.DashboardURL != "" {
+		blocks = append(blocks, map[string]interface{}{
+			"type": "actions",
+			"elements": []map[string]interface{}{{
+				"type": "button",
+				"text": map[string]interface{}{"type": "plain_text", "text": "Open dashboard"},
+				"url":  m.DashboardURL,
+			}},
+		})
+	}
+
+	// rendered in the reader's timezone, the text after | is for clients that can't
+	blocks = append(blocks, map[string]interface{}{
+		"type": "context",
+		"elements": []map[string]interface{}{{
+			"type": "mrkdwn",
+			"text": fmt.Sprintf("<!date^%d^{date_short_pretty} at {time}|%s>", m.At.Unix(), m.At.UTC().Format(time.RFC1123)),
+		}},
+	})
+
+	return map[string]interface{}{
+		"text":   slackEscape(m.Headline),
+		"blocks": blocks,
+	}
+}
+
+func slackStatusEmoji(status model.DeploymentStatus) string {
+	switch status {
+	case model.DeploymentStatusFailed:
+		return "🔴 "
+	case model.DeploymentStatusLive:
+		return "🟢 "
+	case model.DeploymentStatusDeploying:
+		return "🔵 "
+	}
+	return ""
+}
+
+// &, < and > are control characters in slack text
+func slackEscape(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
+
+// webhook body with one embed, the forum thread name is added when it is sent
+func discordMessage(m chatMessage) map[string]interface{} {
+	embed := map[string]interface{}{
+		"title":     truncateRunes(m.Headline, discordTitleMaxLength),
+		"color":     discordColor(m.NewStatus),
+		"timestamp": m.At.UTC().Format(time.RFC3339),
+		"footer":    map[string]interface{}{"text": "checkmate"},
+	}
+	if m.EventType == model.WebhookEventTest {
+		embed["description"] = "This webhook is set up correctly."
+	}
+	if m.DashboardURL != "" {
+		embed["url"] = m.DashboardURL
+	}
+
+	var fields []map[string]interface{}
+	addField := func(name, value string, inline bool) {
+		if value == "" {
+			return
+		}
+		fields = append(fields, map[string]interface{}{
+			"name":   name,
+			"value":  truncateRunes(value, discordFieldMaxLength),
+			"inline": inline,
+		})
+	}
+	addField("Service", m.Service, true)
+	addField("Platform", m.Platform, true)
+	if m.NewStatus != "" {
+		addField("Status", m.StatusChange(), true)
+	}
+	addField("Branch", m.Branch, true)
+	addField("Commit", m.CommitLine(), false)
+	if len(fields) > 0 {
+		embed["fields"] = fields
+	}
+
+	return map[string]interface{}{
+		"embeds":           []map[string]interface{}{embed},
+		"allowed_mentions": map[string]interface{}{"parse": []string{}}, // commit messages can't ping anyone
+	}
+}
+
+func discordColor(status model.DeploymentStatus) int {
+	switch status {
+	case model.DeploymentStatusFailed:
+		return discordColorFailed
+	case model.DeploymentStatusLive:
+		return discordColorLive
+	case model.DeploymentStatusDeploying:
+		return discordColorDeploying
+	}
+	return discordColorOther
+}
+
+// name of the forum post of a deploy, service and short commit taken from the queued message
+// messages without a service (tests) use their title
+func discordThreadName(payload map[string]interface{}, fallback string) string {
+	var title, service, commit string
+	if embeds, ok := payload["embeds"].([]interface{}); ok && len(embeds) > 0 {
+		if embed, ok := embeds[0].(map[string]interface{}); ok {
+			title, _ = embed["title"].(string)
+			fields, _ := embed["fields"].([]interface{})
+			for _, f := range fields {
+				field, _ := f.(map[string]interface{})
+				value, _ := field["value"].(string)
+				switch field["name"] {
+				case "Service":
+					service = value
+				case "Commit":
+					commit, _, _ = strings.Cut(value, " ")
+				}
+			}
+		}
+	}
+
+	name := fallback
+	switch {
+	case service != "" && commit != "":
+		name = service + " · " + commit
+	case service != "":
+		name = service
+	case title != "":
+		name = title
+	}
+	return truncateRunes(name, discordThreadMaxName)
+}
+
+// body queued for a webhook of the given type
+func webhookPayload(hookType model.WebhookType, eventType model.WebhookEventType, platform string, event *model.DeploymentEvent, deployment *model.Deployment, at time.Time) ([]byte, error) {
+	switch hookType {
+	case model.WebhookTypeSlack:
+		return json.Marshal(slackMessage(newChatMessage(eventType, platform, event, deployment, at)))
+	case model.WebhookTypeDiscord:
+		return json.Marshal(discordMessage(newChatMessage(eventType, platform, event, deployment, at)))
+	case model.WebhookTypeEmail:
+		msg, err := eventEmail(newChatMessage(eventType, platform, event, deployment, at))
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(msg)
+	}
+
+	payload := model.WebhookPayload{
+		Type:       eventType,
+		CreatedAt:  at.UTC(),
+		Platform:   platform,
+		Event:      event,
+		Deployment: deployment,
+	}
+	if event == nil {
+		payload.Message = "Test event from checkmate"
+	}
+	return json.Marshal(payload)
+}
+
+// key of the thread an event belongs to, empty when the event isn't about a known deploy
+func webhookThreadKey(event *model.DeploymentEvent) string {
+	if event == nil || event.DeployID == "" {
+		return ""
+	}
+	return fmt.Sprintf("%d/%s/%s", event.PlatformCredentialID, event.DeploymentID, event.DeployID)
+}
+
+// checks a slack incoming webhook or discord webhook url points at the chat
+func validateChatURL(hookType model.WebhookType, u *url.URL) error {
+	if u.Scheme != "https" {
+		return newError(ErrInvalidInput, "%s webhook url must be https", hookType)
+	}
+	host := strings.ToLower(u.Hostname())
+	switch hookType {
+	case model.WebhookTypeSlack:
+		if host != "hooks.slack.com" || !strings.HasPrefix(u.Path, "/services/") {
+			return newError(ErrInvalidInput, "url must be a slack incoming webhook (https://hooks.slack.com/services/...)")
+		}
+	case model.WebhookTypeDiscord:
+		known := false
+		for _, h := range discordWebhookHosts {
+			known = known || host == h
+		}
+		if !known || !strings.HasPrefix(u.Path, "/api/webhooks/") {
+			return newError(ErrInvalidInput, "url must be a discord webhook (https://discord.com/api/webhooks/...)")
+		}
+	}
+	return nil
+}
+
+// first line of s, cut to max runes
+func firstLine(s string, max int) string {
+	s = strings.TrimSpace(s)
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		s = strings.TrimSpace(s[:i])
+	}
+	return truncateRunes(s, max)
+}
+
+func truncateRunes(s string, max int) string {
+	runes := []rune(s)
+	if len(runes) <= max {
+		return s
+	}
+	return string(runes[:max-1]) + "…"
+}
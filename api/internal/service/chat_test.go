@@ -0,0 +1,182 @@
+package service
+
+import (
+	"bytes"
+	"checkmate/api/internal/model"
+	"encoding/json"
+	"errors"
+	"flag"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// compares got with testdata/name, -update rewrites the file instead
+func checkGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *updateGolden {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("create testdata: %v", err)
+		}
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatalf("write golden file: %v", err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read golden file (run with -update to create it): %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s differs from the golden file\ngot:\n%s\nwant:\n%s", name, got, want)
+	}
+}
+
+func TestChatPayloads(t *testing.T) {
+	at := time.Date(2026, 3, 1, 10, 42, 0, 0, time.UTC)
+	deployment := &model.Deployment{
+		ID:       "srv-1",
+		Name:     "api",
+		Branch:   "main",
+		Metadata: map[string]interface{}{"dashboardUrl": "https://dashboard.render.com/web/srv-1"},
+	}
+	failed := &model.DeploymentEvent{
+		ID:                   7,
+		PlatformCredentialID: 1,
+		DeploymentID:         "srv-1",
+		DeploymentName:       "api",
+		OldStatus:            model.DeploymentStatusLive,
+		NewStatus:            model.DeploymentStatusFailed,
+		DeployID:             "dep-1",
+		CommitID:             "0123456789abcdef0123456789abcdef01234567",
+		CommitMessage:        "Fix <script> & *bold* handling\n\nlonger description that isn't shown",
+		ObservedAt:           at.Add(-45 * time.Minute),
+	}
+	// multi byte runes so the cut is checked in runes, not bytes
+	long := strings.Repeat("é", 300)
+	longEvent := &model.DeploymentEvent{
+		DeploymentID:   "srv-2",
+		DeploymentName: long,
+		NewStatus:      model.DeploymentStatusLive,
+		CommitID:       "abc",
+		CommitMessage:  strings.Repeat("x", 300),
+	}
+	longDeployment := &model.Deployment{ID: "srv-2", Name: long, Branch: strings.Repeat("b", 2100)}
+
+	tests := []struct {
+		name       string
+		eventType  model.WebhookEventType
+		event      *model.DeploymentEvent
+		deployment *model.Deployment
+	}{
+		{"failed", model.WebhookEventDeploymentFailed, failed, deployment},
+		{"escalated", model.WebhookEventDeploymentEscalated, failed, deployment},
+		{"test", model.WebhookEventTest, nil, nil},
+		{"truncated", model.WebhookEventDeploymentSucceeded, longEvent, longDeployment},
+	}
+
+	for _, tt := range tests {
+		for _, hookType := range []model.WebhookType{model.WebhookTypeSlack, model.WebhookTypeDiscord} {
+			t.Run(string(hookType)+"/"+tt.name, func(t *testing.T) {
+				payload, err := webhookPayload(hookType, tt.eventType, "render", tt.event, tt.deployment, at)
+				if err != nil {
+					t.Fatalf("webhook payload: %v", err)
+				}
+				// the bytes as queued, indented to keep the golden files readable
+				var indented bytes.Buffer
+				if err := json.Indent(&indented, payload, "", "  "); err != nil {
+					t.Fatalf("indent payload: %v", err)
+				}
+				indented.WriteByte('\n')
+				checkGolden(t, filepath.Join("chat", string(hookType)+"_"+tt.name+".json"), indented.Bytes())
+			})
+		}
+	}
+}
+
+// thread names are read back from the queued discord payload, after a json round trip
+func TestDiscordThreadName(t *testing.T) {
+	at := time.Date(2026, 3, 1, 10, 42, 0, 0, time.UTC)
+	queued := func(m chatMessage) map[string]interface{} {
+		t.Helper()
+		body, err := json.Marshal(discordMessage(m))
+		if err != nil {
+			t.Fatalf("marshal: %v", err)
+		}
+		var payload map[string]interface{}
+		if err := json.Unmarshal(body, &payload); err != nil {
+			t.Fatalf("unmarshal: %v", err)
+		}
+		return payload
+	}
+	event := &model.DeploymentEvent{
+		DeploymentName: "api",
+		NewStatus:      model.DeploymentStatusFailed,
+		CommitID:       "0123456789abcdef",
+		CommitMessage:  "fix the build",
+	}
+	withoutCommit := *event
+	withoutCommit.CommitID = ""
+	long := *event
+	long.DeploymentName = strings.Repeat("é", 150)
+
+	tests := []struct {
+		name    string
+		payload map[string]interface{}
+		want    string
+	}{
+		{"service and commit", queued(newChatMessage(model.WebhookEventDeploymentFailed, "render", event, nil, at)), "api · 0123456"},
+		{"service only", queued(newChatMessage(model.WebhookEventDeploymentFailed, "render", &withoutCommit, nil, at)), "api"},
+		{"test message", queued(newChatMessage(model.WebhookEventTest, "render", nil, nil, at)), "Test message from checkmate"},
+		{"cut to the discord limit", queued(newChatMessage(model.WebhookEventDeploymentFailed, "render", &long, nil, at)), strings.Repeat("é", discordThreadMaxName-1) + "…"},
+		{"empty payload", map[string]interface{}{}, "fallback"},
+		{"unexpected shape", map[string]interface{}{"embeds": "nope"}, "fallback"},
+	}
+	for _, tt := range tests {
+		if got := discordThreadName(tt.payload, "fallback"); got != tt.want {
+			t.Errorf("%s: thread name %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestValidateChatURL(t *testing.T) {
+	tests := []struct {
+		hookType model.WebhookType
+		url      string
+		valid    bool
+	}{
+		{model.WebhookTypeSlack, "https://hooks.slack.com/services/T000/B000/XXXX", true},
+		{model.WebhookTypeSlack, "https://HOOKS.slack.com/services/T000/B000/XXXX", true},
+		{model.WebhookTypeSlack, "http://hooks.slack.com/services/T000/B000/XXXX", false},
+		{model.WebhookTypeSlack, "https://hooks.slack.com/workflows/T000/XXXX", false},
+		{model.WebhookTypeSlack, "https://hooks.slack.com.example.com/services/T000", false},
+		{model.WebhookTypeSlack, "https://example.com/services/T000/B000/XXXX", false},
+		{model.WebhookTypeDiscord, "https://discord.com/api/webhooks/1/abc", true},
+		{model.WebhookTypeDiscord, "https://discordapp.com/api/webhooks/1/abc", true},
+		{model.WebhookTypeDiscord, "https://ptb.discord.com/api/webhooks/1/abc", true},
+		{model.WebhookTypeDiscord, "https://canary.discord.com/api/webhooks/1/abc", true},
+		{model.WebhookTypeDiscord, "http://discord.com/api/webhooks/1/abc", false},
+		{model.WebhookTypeDiscord, "https://discord.com/api/channels/1", false},
+		{model.WebhookTypeDiscord, "https://evil.discord.com.example.com/api/webhooks/1/abc", false},
+		{model.WebhookTypeDiscord, "https://hooks.slack.com/services/T000/B000/XXXX", false},
+	}
+	for _, tt := range tests {
+		u, err := url.Parse(tt.url)
+		if err != nil {
+			t.Fatalf("parse %s: %v", tt.url, err)
+		}
+		err = validateChatURL(tt.hookType, u)
+		if tt.valid && err != nil {
+			t.Errorf("%s %s: got %v, want valid", tt.hookType, tt.url, err)
+		}
+		if !tt.valid && !errors.Is(err, ErrInvalidInput) {
+			t.Errorf("%s %s: got %v, want ErrInvalidInput", tt.hookType, tt.url, err)
+		}
+	}
+}
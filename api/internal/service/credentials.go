@@ -6,14 +6,23 @@ import (
 	"checkmate/api/internal/storage"
 	"checkmate/api/internal/utils"
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	log "github.com/sirupsen/logrus"
 )
 
 //Credentials CRUD operations
 
+const MaxCredentialNameLength = 100
+
+// the user already has a credential with that name
+var ErrDuplicateCredentialName = newError(ErrConflict, "a credential with this name already exists")
+
 // get all platform credentials -> for getting all the deployments -> when loading dashboard
 // should only be used internally
 func GetPlatformCredentials(ctx context.Context, userID string) ([]model.PlatformCredential, error) {
@@ -25,35 +34,21 @@ func GetPlatformCredentials(ctx context.Context, userID string) ([]model.Platfor
 
 	logger.Debug("Getting platform credentials started")
 
-	query := `SELECT id, user_id, platform, api_key, created_at 
-        FROM platform_credentials
-        WHERE user_id = ?;`
-
-	rows, err := storage.DB.QueryContext(ctx, query, userID)
+	//this what we'll be returning -> array of all credentials
+	credentials, err := storage.Credentials.ListByUser(ctx, userID)
 	if err != nil {
 		logger.WithError(err).Error("Failed to query platform credentials")
 		return nil, fmt.Errorf("failed to query platform credentials: %w", err)
 	}
-	defer rows.Close()
 
-	//this what we'll be returning -> array of all credentials
-	var credentials []model.PlatformCredential
-
-	//copy the result of row in cred and append it to credentials the got the next row
-	for rows.Next() {
-		var cred model.PlatformCredential
-		if err := rows.Scan(&cred.ID, &cred.UserID, &cred.Platform, &cred.APIKey, &cred.CreatedAt); err != nil {
-			logger.WithError(err).Error("Failed to scan credential row")
-			return nil, fmt.Errorf("failed to scan credential row: %w", err)
-		}
+	for i := range credentials {
 		//decrypt the api key
 		//this should only be used internally so there should not be a problem
-		cred.APIKey, err = utils.DecryptString(cred.APIKey)
+		credentials[i].APIKey, err = utils.DecryptString(credentials[i].APIKey)
 		if err != nil {
 			logger.WithError(err).Error("Failed to decrypt API key")
 			return nil, fmt.Errorf("failed to decrypt API key: %w", err)
 		}
-		credentials = append(credentials, cred)
 	}
 
 	logger.WithField("credentials_count", len(credentials)).Debug("Retrieved platform credentials successfully")
@@ -71,15 +66,12 @@ func GetPlatformCredentialByID(ctx context.Context, id int, userID string) (*mod
 
 	logger.Debug("Getting platform credential by ID started")
 
-	query := `SELECT id, user_id, platform, api_key, created_at 
-              FROM platform_credentials
-              WHERE id = ? AND user_id = ?;`
-
-	var cred model.PlatformCredential
-	err := storage.DB.QueryRowContext(ctx, query, id, userID).Scan(
-		&cred.ID, &cred.UserID, &cred.Platform, &cred.APIKey, &cred.CreatedAt)
-
-	if err != nil {
+	cred, err := storage.Credentials.GetByID(ctx, id, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		// other users' credentials look the same as missing ones
+		logger.Warn("Credential not found")
+		return nil, newError(ErrNotFound, "credential %d not found", id)
+	} else if err != nil {
 		logger.WithError(err).Error("Failed to get credential")
 		return nil, fmt.Errorf("failed to get credential: %w", err)
 	}
@@ -93,7 +85,7 @@ func GetPlatformCredentialByID(ctx context.Context, id int, userID string) (*mod
 	logger.WithFields(log.Fields{
 		"platform": cred.Platform,
 	}).Debug("Retrieved platform credential successfully")
-	return &cred, nil
+	return cred, nil
 }
 
 // create new plstform credentials
@@ -107,19 +99,22 @@ func CreatePlatformCredential(ctx context.Context, userID string, input *model.P
 
 	logger.Debug("Creating platform credential started")
 
+	input.Name = strings.TrimSpace(input.Name)
+	if err := ValidateCredentialName(input.Name); err != nil {
+		logger.WithError(err).Warn("Validation failed for credential name")
+		return nil, err
+	}
+
 	//validate credentials before creating cred
 	//todo considere deleting this one, we already validate on the handler
 	err := ValidateCredential(ctx, input.Platform, input.APIKey)
 	if err != nil {
 		logger.WithError(err).Warn("Validation failed for credential")
-		return nil, fmt.Errorf("invalid credentials: %w", err)
+		return nil, err
 	}
 
 	logger.Debug("Credential validated successfully")
 
-	query := `INSERT INTO platform_credentials (user_id, platform, api_key, created_at)
-          VALUES (?, ?, ?, ?, ?)`
-
 	now := time.Now()
 
 	//encrypt the api key before storage
@@ -131,28 +126,26 @@ func CreatePlatformCredential(ctx context.Context, userID string, input *model.P
 
 	logger.Debug("API key encrypted successfully")
 
-	result, err := storage.DB.ExecContext(
-		ctx, query, userID, input.Platform, encryptedAPIKey, now)
-	if err != nil {
-		logger.WithError(err).Error("Failed to create platform credential in database")
-		return nil, fmt.Errorf("failed to create platform credential: %w", err)
-	}
-
-	//get the id of the last insert to return it to the user
-	id, err := result.LastInsertId()
-	if err != nil {
-		logger.WithError(err).Error("Failed to get last insert ID")
-		return nil, fmt.Errorf("failed to get last insert ID: %w", err)
-	}
-
-	logger.WithField("credential_id", id).Info("Platform credential created successfully")
-	return &model.PlatformCredential{
-		ID:        int(id),
+	cred := &model.PlatformCredential{
 		UserID:    userID,
+		Name:      input.Name,
 		Platform:  input.Platform,
 		APIKey:    encryptedAPIKey,
 		CreatedAt: now,
-	}, nil
+	}
+
+	//the id is returned to the user
+	cred.ID, err = storage.Credentials.Create(ctx, cred)
+	if errors.Is(err, storage.ErrDuplicate) {
+		logger.Warn("Credential name already in use")
+		return nil, ErrDuplicateCredentialName
+	} else if err != nil {
+		logger.WithError(err).Error("Failed to create platform credential in database")
+		return nil, fmt.Errorf("failed to create platform credential: %w", err)
+	}
+
+	logger.WithField("credential_id", cred.ID).Info("Platform credential created successfully")
+	return cred, nil
 }
 
 // for updating platform credential ->needs cred id and user id and the whole PlatformCredentialInput (keep this in mind for the frontend)
@@ -167,6 +160,15 @@ func UpdatePlatformCredential(ctx context.Context, id int, userID string, input
 
 	logger.Debug("Updating platform credential started")
 
+	// the name is optional here, empty keeps the current one
+	input.Name = strings.TrimSpace(input.Name)
+	if input.Name != "" {
+		if err := ValidateCredentialName(input.Name); err != nil {
+			logger.WithError(err).Warn("Validation failed for credential name")
+			return err
+		}
+	}
+
 	encryptedAPIKey, err := utils.EncryptString(input.APIKey)
 	if err != nil {
 		logger.WithError(err).Error("Failed to encrypt API key")
@@ -175,29 +177,23 @@ func UpdatePlatformCredential(ctx context.Context, id int, userID string, input
 
 	logger.Debug("API key encrypted successfully")
 
-	query := `UPDATE platform_credentials
-              SET platform = ?, api_key = ?
-              WHERE id = ? AND user_id = ?`
-
-	result, err := storage.DB.ExecContext(
-		ctx, query, input.Platform, encryptedAPIKey, id, userID)
-
-	if err != nil {
+	found, err := storage.Credentials.Update(ctx, id, userID, input.Name, input.Platform, encryptedAPIKey)
+	if errors.Is(err, storage.ErrDuplicate) {
+		logger.Warn("Credential name already in use")
+		return ErrDuplicateCredentialName
+	} else if err != nil {
 		logger.WithError(err).Error("Failed to update platform credential in database")
 		return fmt.Errorf("failed to update platform credential: %w", err)
 	}
 
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		logger.WithError(err).Error("Failed to get rows affected")
-		return fmt.Errorf("failed to get rows affected: %w", err)
-	}
-
-	if rowsAffected == 0 {
+	if !found {
 		logger.Warn("Credential not found or user doesn't have permission to update it")
-		return fmt.Errorf("credential not found or you don't have permission to update it")
+		return newError(ErrNotFound, "credential %d not found", id)
 	}
 
+	// new api key, past failures don't say anything about it
+	resetBreaker(id)
+
 	logger.Info("Platform credential updated successfully")
 	return nil
 }
@@ -213,29 +209,78 @@ func DeletePlatformCredential(ctx context.Context, id int, userID string) error
 
 	logger.Debug("Deleting platform credential started")
 
-	query := `DELETE FROM platform_credentials WHERE id = ? AND user_id = ?`
-
-	result, err := storage.DB.ExecContext(ctx, query, id, userID)
+	found, err := storage.Credentials.Delete(ctx, id, userID)
 	if err != nil {
 		logger.WithError(err).Error("Failed to delete platform credential from database")
 		return fmt.Errorf("failed to delete platform credential: %w", err)
 	}
 
-	rowsAffected, err := result.RowsAffected()
+	if !found {
+		logger.Warn("Credential not found or user doesn't have permission to delete it")
+		return newError(ErrNotFound, "credential %d not found", id)
+	}
+
+	resetBreaker(id)
+
+	logger.Info("Platform credential deleted successfully")
+	return nil
+}
+
+// sets the cache ttl of a credential, nil resets it to the platform/global ttl
+func SetPlatformCredentialCacheTTL(ctx context.Context, id int, userID string, ttlSeconds *int) error {
+	logger := log.WithFields(log.Fields{
+		"func":          "SetPlatformCredentialCacheTTL",
+		"credential_id": id,
+		"user_id":       userID,
+		"request_id":    ctx.Value("request_id"),
+	})
+
+	logger.Debug("Setting credential cache ttl started")
+
+	if err := ValidateCacheTTL(ttlSeconds); err != nil {
+		logger.WithError(err).Warn("Validation failed for cache ttl")
+		return err
+	}
+
+	found, err := storage.Credentials.SetCacheTTL(ctx, id, userID, ttlSeconds)
 	if err != nil {
-		logger.WithError(err).Error("Failed to get rows affected")
-		return fmt.Errorf("failed to get rows affected: %w", err)
+		logger.WithError(err).Error("Failed to update credential cache ttl in database")
+		return fmt.Errorf("failed to update credential cache ttl: %w", err)
 	}
 
-	if rowsAffected == 0 {
-		logger.Warn("Credential not found or user doesn't have permission to delete it")
-		return fmt.Errorf("credential not found or you don't have permission to delete it")
+	if !found {
+		logger.Warn("Credential not found or user doesn't have permission to update it")
+		return newError(ErrNotFound, "credential %d not found", id)
 	}
 
-	logger.Info("Platform credential deleted successfully")
+	logger.WithField("ttl_seconds", ttlSeconds).Info("Credential cache ttl updated successfully")
 	return nil
 }
 
+// checks a credential name is set and not too long, expects it already trimmed
+func ValidateCredentialName(name string) error {
+	if name == "" {
+		return newError(ErrInvalidInput, "credential name is required")
+	}
+	if utf8.RuneCountInString(name) > MaxCredentialNameLength {
+		return newError(ErrInvalidInput, "credential name must be at most %d characters", MaxCredentialNameLength)
+	}
+	return nil
+}
+
+// checks a per credential cache ttl is inside the allowed range, nil is always valid
+func ValidateCacheTTL(ttlSeconds *int) error {
+	if ttlSeconds == nil {
+		return nil
+	}
+	if *ttlSeconds < MinCredentialCacheTTLSeconds || *ttlSeconds > MaxCredentialCacheTTLSeconds {
+		return newError(ErrInvalidInput, "cache ttl must be between %d and %d seconds", MinCredentialCacheTTLSeconds, MaxCredentialCacheTTLSeconds)
+	}
+	return nil
+}
+
+// checks the api key against the platform
+// ErrInvalidCredential when the platform rejects it, ErrUpstreamUnavailable when the platform can't tell
 func ValidateCredential(ctx context.Context, platformName string, apiKey string) error {
 	logger := log.WithFields(log.Fields{
 		"func":       "ValidateCredential",
@@ -250,18 +295,21 @@ func ValidateCredential(ctx context.Context, platformName string, apiKey string)
 		logger.Debug("Validating Render credentials")
 		client := platform.NewRenderProvider(apiKey)
 		err := client.VerifyCredentials(ctx)
-		if err != nil {
+		if errors.Is(err, platform.ErrUnauthorized) {
+			logger.WithError(err).Warn("Render rejected the API key")
+			return newError(ErrInvalidCredential, "render rejected the API key")
+		} else if err != nil {
 			logger.WithError(err).Warn("Render credential validation failed")
-		} else {
-			logger.Debug("Render credential validated successfully")
+			return newError(ErrUpstreamUnavailable, "render is unavailable, try again later")
 		}
-		return err
+		logger.Debug("Render credential validated successfully")
+		return nil
 	case "vercel":
 		logger.Warn("Vercel validation not implemented")
 		// TODO: Implement Vercel validation
-		return fmt.Errorf("vercel validation not implemented")
+		return newError(ErrInvalidInput, "vercel is not supported yet")
 	default:
 		logger.Warn("Unsupported platform specified")
-		return fmt.Errorf("unsupported platform: %s", platformName)
+		return newError(ErrInvalidInput, "unsupported platform: %s", platformName)
 	}
 }
@@ -5,25 +5,36 @@ import (
 	"checkmate/api/internal/platform"
 	"checkmate/api/internal/storage"
 	"context"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strconv"
 	"time"
 
 	log "github.com/sirupsen/logrus"
 )
 
+// page size of the deployments listing
 const (
-	CacheTTL = 30 //seconds that the cached deployments are considered fresh
+	DefaultDeploymentsPageSize = 100
+	MaxDeploymentsPageSize     = 500
 )
 
-// checks if cached data is still valid (less than CacheTTL seconds old)
-func IsCacheFresh(lastUpdatedAt time.Time) bool {
-	return time.Since(lastUpdatedAt) < time.Duration(CacheTTL)*time.Second
+// how a refresh changes the cache of one credential
+type cacheWritePlan struct {
+	write  *storage.CacheWrite
+	result model.CacheWriteResult
 }
 
 // save deployment data on cache
-func StoreCachedDeployment(ctx context.Context, credentialID int, deployments []model.Deployment) error {
+// rows are diffed against the current cache and upserted, unchanged rows keep their last_updated_at,
+// deployments missing from the response are kept and only marked gone after DeploymentGoneGracePeriod
+// returns the added/changed/removed counts and the status transitions recorded in deployment_events
+func StoreCachedDeployment(ctx context.Context, credentialID int, deployments []model.Deployment) (*model.CacheWriteResult, []model.DeploymentEvent, error) {
 	logger := log.WithFields(log.Fields{
 		"func":              "StoreCachedDeployment",
 		"credential_id":     credentialID,
@@ -33,76 +44,131 @@ func StoreCachedDeployment(ctx context.Context, credentialID int, deployments []
 
 	logger.Debug("Storing deployments in cache started")
 
-	tx, err := storage.DB.BeginTx(ctx, nil)
-	if err != nil {
-		logger.WithError(err).Error("Failed to begin transaction")
-		return fmt.Errorf("failed to begin transaction: %w", err)
-	}
-	defer tx.Rollback() //roll back if not committed
+	now := time.Now() //we need this to insert in the last_updated_at
 
-	_, err = tx.ExecContext(ctx,
-		"DELETE FROM deployment_cache WHERE platform_credential_id = ?",
-		credentialID)
+	// the diff runs inside the repository's write transaction so it sees the cache as it is written
+	var plan *cacheWritePlan
+	_, err := storage.Deployments.WriteCache(ctx, credentialID, func(previous map[string]storage.CachedDeploymentState) (*storage.CacheWrite, error) {
+		var err error
+		plan, err = planCacheWrite(credentialID, previous, deployments, now)
+		if err != nil {
+			return nil, fmt.Errorf("failed to diff deployments against cache: %w", err)
+		}
+		return plan.write, nil
+	})
 	if err != nil {
-		logger.WithError(err).Error("Failed to clear existing cache")
-		return fmt.Errorf("failed to clear existing cache: %w", err)
+		logger.WithError(err).Error("Failed to store deployments in cache")
+		return nil, nil, err
 	}
 
-	logger.Debug("Cleared existing cache entries")
-
-	//insert new deployments into cache
-	now := time.Now() //we need this to insert in the last_updated_at
+	logger.WithFields(log.Fields{
+		"added":        plan.result.Added,
+		"changed":      plan.result.Changed,
+		"unchanged":    plan.result.Unchanged,
+		"missing":      plan.result.Missing,
+		"removed":      plan.result.Removed,
+		"events_count": len(plan.write.Events),
+	}).Info("Successfully stored deployments in cache")
+	return &plan.result, plan.write.Events, nil
+}
 
-	stmt, err := tx.PrepareContext(ctx, `
-		INSERT INTO deployment_cache (
-			id, platform_credential_id, name, status, url, 
-			last_deployed_at, branch, service_type, framework, 
-			last_updated_at, metadata
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-	`)
-	if err != nil {
-		logger.WithError(err).Error("Failed to prepare statement")
-		return fmt.Errorf("failed to prepare statement: %w", err)
+// compares fresh deployments against the cache and decides what to write
+// an empty cache is the first load of the credential, that is the baseline so no events are produced
+func planCacheWrite(credentialID int, previous map[string]storage.CachedDeploymentState, deployments []model.Deployment, now time.Time) (*cacheWritePlan, error) {
+	write := &storage.CacheWrite{At: now}
+	plan := &cacheWritePlan{write: write}
+	firstLoad := len(previous) == 0
+	present := make(map[string]bool, len(deployments))
+
+	newEvent := func(id, name string, oldStatus, newStatus model.DeploymentStatus) model.DeploymentEvent {
+		return model.DeploymentEvent{
+			PlatformCredentialID: credentialID,
+			DeploymentID:         id,
+			DeploymentName:       name,
+			OldStatus:            oldStatus,
+			NewStatus:            newStatus,
+			ObservedAt:           now,
+		}
 	}
-	defer stmt.Close()
 
 	for _, dep := range deployments {
-		// Convert metadata to JSON string
-		metadataJSON, err := json.Marshal(dep.Metadata)
+		present[dep.ID] = true
+
+		fingerprint, err := deploymentFingerprint(dep)
 		if err != nil {
-			logger.WithError(err).Error("Failed to marshal metadata")
-			return fmt.Errorf("failed to marshal metadata: %w", err)
+			return nil, err
 		}
 
-		// handle null last_deployed_at
-		var lastDeployedAt sql.NullTime
-		if dep.LastDeployedAt != nil {
-			lastDeployedAt = sql.NullTime{
-				Time:  *dep.LastDeployedAt,
-				Valid: true,
+		prev, cached := previous[dep.ID]
+		switch {
+		case !cached:
+			plan.result.Added++
+			write.Upserts = append(write.Upserts, storage.CachedDeployment{Deployment: dep, Fingerprint: fingerprint})
+			// not seen before -> new deployment, old status stays empty
+			if !firstLoad {
+				write.Events = append(write.Events, newEvent(dep.ID, dep.Name, "", dep.Status))
+			}
+		case prev.Status == model.DeploymentStatusGone:
+			// back after being marked gone, the fingerprint can't tell since the gone update kept it
+			plan.result.Changed++
+			write.Upserts = append(write.Upserts, storage.CachedDeployment{Deployment: dep, Fingerprint: fingerprint})
+			write.Events = append(write.Events, newEvent(dep.ID, dep.Name, prev.Status, dep.Status))
+		case prev.Fingerprint != fingerprint:
+			plan.result.Changed++
+			write.Upserts = append(write.Upserts, storage.CachedDeployment{Deployment: dep, Fingerprint: fingerprint})
+			if prev.Status != dep.Status {
+				write.Events = append(write.Events, newEvent(dep.ID, dep.Name, prev.Status, dep.Status))
 			}
+		default:
+			plan.result.Unchanged++
+			write.Seen = append(write.Seen, dep.ID)
+		}
+	}
+
+	// deployments the platform didn't return this time
+	for id, prev := range previous {
+		if present[id] || prev.Status == model.DeploymentStatusGone {
+			continue
 		}
 
-		_, err = stmt.ExecContext(ctx,
-			dep.ID, credentialID, dep.Name, string(dep.Status), dep.URL,
-			lastDeployedAt, dep.Branch, dep.ServiceType, dep.Framework,
-			now, metadataJSON)
-		if err != nil {
-			logger.WithFields(log.Fields{
-				"deployment_id":   dep.ID,
-				"deployment_name": dep.Name,
-			}).WithError(err).Error("Failed to cache deployment")
-			return fmt.Errorf("failed to cache deployment %s: %w", dep.ID, err)
+		// flaky responses shouldn't make services vanish, wait for the grace period
+		if now.Sub(prev.LastSeenAt) < DeploymentGoneGracePeriod {
+			plan.result.Missing++
+			continue
 		}
+
+		plan.result.Removed++
+		write.Gone = append(write.Gone, id)
+		write.Events = append(write.Events, newEvent(id, prev.Name, prev.Status, model.DeploymentStatusGone))
 	}
 
-	if err := tx.Commit(); err != nil {
-		logger.WithError(err).Error("Failed to commit transaction")
-		return fmt.Errorf("failed to commit transaction: %w", err)
+	return plan, nil
+}
+
+// hash of the platform data of a deployment, used to detect changes without comparing every column
+func deploymentFingerprint(dep model.Deployment) (string, error) {
+	var lastDeployedAt *time.Time
+	if dep.LastDeployedAt != nil {
+		t := dep.LastDeployedAt.UTC()
+		lastDeployedAt = &t
 	}
 
-	logger.Info("Successfully stored deployments in cache")
-	return nil
+	body, err := json.Marshal(struct {
+		Name           string
+		Status         model.DeploymentStatus
+		URL            string
+		LastDeployedAt *time.Time
+		Branch         string
+		ServiceType    string
+		Framework      string
+		Metadata       map[string]interface{}
+	}{dep.Name, dep.Status, dep.URL, lastDeployedAt, dep.Branch, dep.ServiceType, dep.Framework, dep.Metadata})
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:]), nil
 }
 
 // get cached deployments for a platform
@@ -115,64 +181,17 @@ func GetCachedDeployments(ctx context.Context, credentialID int) ([]model.Deploy
 
 	logger.Debug("Getting cached deployments started")
 
-	query := `
-		SELECT 
-			id, name, status, url, last_deployed_at, branch, 
-			service_type, framework, last_updated_at, metadata
-		FROM deployment_cache
-		WHERE platform_credential_id = ?
-	`
-
-	rows, err := storage.DB.QueryContext(ctx, query, credentialID)
+	deployments, err := storage.Deployments.ListCached(ctx, credentialID)
 	if err != nil {
 		logger.WithError(err).Error("Failed to query cached deployments")
 		return nil, time.Time{}, fmt.Errorf("failed to query cached deployments: %w", err)
 	}
-	defer rows.Close()
 
-	var deployments []model.Deployment
 	var lastUpdatedAt time.Time
-
-	for rows.Next() {
-		var dep model.Deployment
-		var status string
-		var metadataJSON string
-		var lastDeployedAt sql.NullTime
-
-		err := rows.Scan(
-			&dep.ID, &dep.Name, &status, &dep.URL, &lastDeployedAt, &dep.Branch,
-			&dep.ServiceType, &dep.Framework, &lastUpdatedAt, &metadataJSON,
-		)
-		if err != nil {
-			logger.WithError(err).Error("Failed to scan deployment row")
-			return nil, time.Time{}, fmt.Errorf("failed to scan deployment row: %w", err)
-		}
-
-		// Convert status string to DeploymentStatus
-		dep.Status = model.DeploymentStatus(status)
-
-		// Convert NullTime to *time.Time
-		if lastDeployedAt.Valid {
-			dep.LastDeployedAt = &lastDeployedAt.Time
-		}
-
-		// Parse metadata JSON
-		if metadataJSON != "" {
-			var metadata map[string]interface{}
-			if err := json.Unmarshal([]byte(metadataJSON), &metadata); err != nil {
-				logger.WithFields(log.Fields{
-					"deployment_id":   dep.ID,
-					"deployment_name": dep.Name,
-				}).WithError(err).Error("Failed to unmarshal metadata")
-				return nil, time.Time{}, fmt.Errorf("failed to unmarshal metadata: %w", err)
-			}
-			dep.Metadata = metadata
-		} else {
-			dep.Metadata = make(map[string]interface{})
+	for _, dep := range deployments {
+		if dep.LastUpdatedAt.After(lastUpdatedAt) {
+			lastUpdatedAt = dep.LastUpdatedAt
 		}
-
-		dep.LastUpdatedAt = lastUpdatedAt
-		deployments = append(deployments, dep)
 	}
 
 	logger.WithFields(log.Fields{
@@ -182,7 +201,7 @@ func GetCachedDeployments(ctx context.Context, credentialID int) ([]model.Deploy
 	return deployments, lastUpdatedAt, nil
 }
 
-// checks if cache exists for a credential
+// checks if cache exists for a credential -> returns when it was last refreshed from the platform
 func CacheExists(ctx context.Context, credentialID int) (bool, time.Time, error) {
 	logger := log.WithFields(log.Fields{
 		"func":          "CacheExists",
@@ -192,81 +211,37 @@ func CacheExists(ctx context.Context, credentialID int) (bool, time.Time, error)
 
 	logger.Debug("Checking if cache exists")
 
-	query := `
-        SELECT COUNT(*), MAX(last_updated_at) 
-        FROM deployment_cache 
-        WHERE platform_credential_id = ?
-    `
-
-	var count int
-	var lastUpdatedStr sql.NullString
-
-	err := storage.DB.QueryRowContext(ctx, query, credentialID).Scan(&count, &lastUpdatedStr)
+	refreshedAt, err := storage.Credentials.GetCacheRefreshedAt(ctx, credentialID)
 	if err != nil {
 		logger.WithError(err).Error("Failed to check cache existence")
 		return false, time.Time{}, fmt.Errorf("failed to check cache existence: %w", err)
 	}
 
-	// if no rows or null last_updated_at, cache doesn't exist
-	if count == 0 || !lastUpdatedStr.Valid {
+	// credential not found or never refreshed, cache doesn't exist
+	if refreshedAt == nil {
 		logger.Debug("Cache does not exist")
 		return false, time.Time{}, nil
 	}
 
-	// Log the raw timestamp for debugging
-	logger.WithField("raw_timestamp", lastUpdatedStr.String).Debug("Raw timestamp from database")
-
-	// For SQLite timestamps - use a more permissive parser
-	lastUpdated, err := parseSQLiteTimestamp(lastUpdatedStr.String)
-	if err != nil {
-		logger.WithError(err).Error("Failed to parse last_updated_at timestamp")
-		return false, time.Time{}, fmt.Errorf("failed to parse timestamp: %w", err)
-	}
-
 	logger.WithFields(log.Fields{
 		"cache_exists":    true,
-		"last_updated_at": lastUpdated,
+		"last_updated_at": *refreshedAt,
 	}).Debug("Cache check complete")
-	return true, lastUpdated, nil
-}
-
-// Helper function to parse SQLite timestamps in various formats
-func parseSQLiteTimestamp(timestamp string) (time.Time, error) {
-	// Try multiple formats that SQLite might use
-	formats := []string{
-		"2006-01-02 15:04:05.999999999-07:00", // Format from your error message
-		"2006-01-02 15:04:05.999999999",       // Without timezone
-		"2006-01-02 15:04:05-07:00",           // With timezone, no fractional seconds
-		"2006-01-02 15:04:05",                 // Basic format
-		time.RFC3339,                          // Standard format
-	}
-
-	var parseErr error
-	for _, format := range formats {
-		t, err := time.Parse(format, timestamp)
-		if err == nil {
-			return t, nil
-		}
-		parseErr = err
-	}
-
-	// If we can't parse with standard formats, try a more aggressive approach
-	// This handles cases where SQLite might have strange formats
-	t, err := time.ParseInLocation("2006-01-02 15:04:05.999999999-07:00", timestamp, time.Local)
-	if err == nil {
-		return t, nil
-	}
-
-	// Return the last error if all parsing attempts fail
-	return time.Time{}, parseErr
+	return true, *refreshedAt, nil
 }
 
 // gets fresh deployments from cache or updates cache if stale
-func GetFreshOrUpdateCache(ctx context.Context, cred *model.PlatformCredential) ([]model.Deployment, error) {
+// -> forceRefresh skips the cache and always calls the platform (stale fallback still applies)
+// -> fresh cache is returned as is
+// -> expired cache inside the stale-while-revalidate window is returned marked as stale and refreshed in background
+// -> otherwise the platform is called, and if that fails we fall back to the cache up to CacheMaxStaleness
+// -> while the credential's circuit breaker is open the platform call is skipped and treated as failed
+func GetFreshOrUpdateCache(ctx context.Context, cred *model.PlatformCredential, forceRefresh bool) ([]model.Deployment, *model.CacheInfo, error) {
 	logger := log.WithFields(log.Fields{
 		"func":          "GetFreshOrUpdateCache",
 		"credential_id": cred.ID,
 		"platform":      cred.Platform,
+		"force_refresh": forceRefresh,
 		"request_id":    ctx.Value("request_id"),
 	})
 
@@ -276,38 +251,172 @@ func GetFreshOrUpdateCache(ctx context.Context, cred *model.PlatformCredential)
 	exists, lastUpdated, err := CacheExists(ctx, cred.ID)
 	if err != nil {
 		logger.WithError(err).Error("Failed to check if cache exists")
-		return nil, err
+		return nil, nil, err
 	}
 
-	if exists && IsCacheFresh(lastUpdated) {
+	ttl := EffectiveCacheTTL(cred)
+	logger = logger.WithField("cache_ttl", ttl)
+
+	if !forceRefresh && exists && IsCacheFresh(lastUpdated, ttl) {
 		// cache is fresh, return cached data
 		logger.WithField("last_updated_at", lastUpdated).Debug("Cache is fresh, using cached data")
 		deployments, _, err := GetCachedDeployments(ctx, cred.ID)
 		if err != nil {
 			logger.WithError(err).Error("Failed to retrieve cached deployments")
-			return nil, fmt.Errorf("failed to retrieve cached deployments: %w", err)
+			return nil, nil, fmt.Errorf("failed to retrieve cached deployments: %w", err)
 		}
-		return deployments, nil
+		return deployments, newCacheInfo(cred.ID, lastUpdated, ttl, ""), nil
 	}
 
-	// if cache doesn't exist or is stale, fetch fresh data from platform
+	if !forceRefresh && exists && IsCacheRevalidatable(lastUpdated, ttl) {
+		// cache expired recently, return it right away and refresh in background
+		logger.WithField("last_updated_at", lastUpdated).Debug("Cache is stale, serving it while revalidating")
+		deployments, _, err := GetCachedDeployments(ctx, cred.ID)
+		if err != nil {
+			logger.WithError(err).Error("Failed to retrieve cached deployments")
+			return nil, nil, fmt.Errorf("failed to retrieve cached deployments: %w", err)
+		}
+
+		refreshCacheInBackground(ctx, *cred)
+		return deployments, newCacheInfo(cred.ID, lastUpdated, ttl, model.StaleReasonRefreshing), nil
+	}
+
+	// if cache doesn't exist or is too old, fetch fresh data from platform
 	logger.Debug("Cache is stale or doesn't exist, fetching fresh data")
+	deployments, changes, err := refreshCache(ctx, cred)
+	if err != nil {
+		if exists && IsCacheServable(lastUpdated) {
+			// platform is down (or the breaker is open), keep serving the last known data
+			logger.WithError(err).WithField("last_updated_at", lastUpdated).Warn("Failed to refresh cache, serving stale data")
+			cached, _, cacheErr := GetCachedDeployments(ctx, cred.ID)
+			if cacheErr != nil {
+				logger.WithError(cacheErr).Error("Failed to retrieve cached deployments")
+				return nil, nil, fmt.Errorf("failed to retrieve cached deployments: %w", cacheErr)
+			}
+			return cached, newCacheInfo(cred.ID, lastUpdated, ttl, model.StaleReasonPlatformUnavailable), nil
+		}
+		return nil, nil, err
+	}
+
+	logger.WithField("deployments_count", len(deployments)).Info("Successfully retrieved fresh deployments")
+	cacheInfo := newCacheInfo(cred.ID, time.Now(), ttl, "")
+	cacheInfo.Changes = changes
+	return deployments, cacheInfo, nil
+}
+
+// fetches deployments from the platform and stores them in the cache
+// only one refresh per credential is in flight at a time, concurrent callers wait for it and share its result
+func refreshCache(ctx context.Context, cred *model.PlatformCredential) ([]model.Deployment, *model.CacheWriteResult, error) {
+	logger := log.WithFields(log.Fields{
+		"func":          "refreshCache",
+		"credential_id": cred.ID,
+		"platform":      cred.Platform,
+		"request_id":    ctx.Value("request_id"),
+	})
+
+	// the shared fetch must not die with the request that started it, other callers may be waiting on it
+	fetchCtx := context.WithoutCancel(ctx)
+	credCopy := *cred
+
+	resultCh := refreshGroup.DoChan(strconv.Itoa(cred.ID), func() (interface{}, error) {
+		fetchCtx, cancel := context.WithTimeout(fetchCtx, cacheRefreshTimeout)
+		defer cancel()
+		return fetchAndStoreDeployments(fetchCtx, &credCopy)
+	})
+
+	select {
+	case <-ctx.Done():
+		logger.WithError(ctx.Err()).Warn("Gave up waiting for cache refresh")
+		return nil, nil, ctx.Err()
+	case result := <-resultCh:
+		if result.Err != nil {
+			return nil, nil, result.Err
+		}
+		if result.Shared {
+			logger.Debug("Joined in-flight cache refresh")
+		}
+
+		// every caller gets its own slice so nobody modifies the shared result
+		shared := result.Val.(*refreshResult)
+		deployments := make([]model.Deployment, len(shared.deployments))
+		copy(deployments, shared.deployments)
+		changes := *shared.changes
+		return deployments, &changes, nil
+	}
+}
+
+// what a refresh produced, shared between the callers of refreshCache
+type refreshResult struct {
+	deployments []model.Deployment
+	changes     *model.CacheWriteResult
+}
+
+// does the actual platform call and cache write -> always called through refreshCache
+func fetchAndStoreDeployments(ctx context.Context, cred *model.PlatformCredential) (*refreshResult, error) {
+	logger := log.WithFields(log.Fields{
+		"func":          "fetchAndStoreDeployments",
+		"credential_id": cred.ID,
+		"platform":      cred.Platform,
+		"request_id":    ctx.Value("request_id"),
+	})
+
+	breaker := breakerFor(cred.ID)
+	if !breaker.allow() {
+		logger.Debug("Circuit breaker open, skipping platform call")
+		return nil, ErrCircuitOpen
+	}
+
 	deployments, err := fetchDeploymentsFromPlatform(ctx, cred)
 	if err != nil {
+		breaker.recordFailure(cred.ID)
 		logger.WithError(err).Error("Failed to fetch deployments from platform")
-		return nil, fmt.Errorf("failed to fetch deployments from platform: %w", err)
+		return nil, newError(ErrUpstreamUnavailable, "platform unavailable, can't refresh deployments")
 	}
+	breaker.recordSuccess(cred.ID)
 
 	// update cache with fresh data
 	logger.Debug("Updating cache with fresh data")
-	err = StoreCachedDeployment(ctx, cred.ID, deployments)
+	changes, events, err := StoreCachedDeployment(ctx, cred.ID, deployments)
 	if err != nil {
 		logger.WithError(err).Error("Failed to update cache")
 		return nil, fmt.Errorf("failed to update cache: %w", err)
 	}
 
-	logger.WithField("deployments_count", len(deployments)).Info("Successfully retrieved fresh deployments")
-	return deployments, nil
+	// commit and deploy id come from another platform call, only worth it for the few deployments that changed
+	if len(events) > 0 {
+		logger.WithField("events_count", len(events)).Debug("Detected deployment status changes")
+		enrichDeploymentEvents(ctx, cred, events)
+	}
+
+	// read back from the cache, it also has the deployments still inside the grace period
+	cached, _, err := GetCachedDeployments(ctx, cred.ID)
+	if err != nil {
+		logger.WithError(err).Error("Failed to retrieve cached deployments")
+		return nil, fmt.Errorf("failed to retrieve cached deployments: %w", err)
+	}
+
+	// live updates for the open streams of the owner
+	publishDeploymentChanges(cred.UserID, events, cached)
+	queueWebhookDeliveries(ctx, cred, events, cached)
+
+	return &refreshResult{deployments: cached, changes: changes}, nil
+}
+
+// refreshes the cache without blocking the request
+// takes a copy of the credential and detaches from the request context so the refresh outlives the request
+func refreshCacheInBackground(ctx context.Context, cred model.PlatformCredential) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), cacheRefreshTimeout)
+
+	go func() {
+		defer cancel()
+		if _, _, err := refreshCache(ctx, &cred); err != nil {
+			log.WithFields(log.Fields{
+				"func":          "refreshCacheInBackground",
+				"credential_id": cred.ID,
+				"request_id":    ctx.Value("request_id"),
+			}).WithError(err).Warn("Background cache refresh failed")
+		}
+	}()
 }
 
 // fetches fresh deployment data from the platform
@@ -351,16 +460,113 @@ func fetchDeploymentsFromPlatform(ctx context.Context, cred *model.PlatformCrede
 	}
 }
 
+// fetches the latest deploy of one deployment from the platform, nil when it was never deployed
+func fetchLatestDeployFromPlatform(ctx context.Context, cred *model.PlatformCredential, deploymentID string) (*model.DeployInfo, error) {
+	switch cred.Platform {
+	case "render":
+		client := platform.NewRenderProvider(cred.APIKey)
+		deploy, err := client.GetLatestDeploy(ctx, deploymentID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch Render deploy: %w", err)
+		}
+		return deploy, nil
+
+	case "vercel":
+		// TODO: Implement Vercel client
+		return nil, fmt.Errorf("vercel platform not implemented")
+
+	default:
+		return nil, fmt.Errorf("unsupported platform: %s", cred.Platform)
+	}
+}
+
+// fetches the detail view data of one deployment from the platform
+func fetchDeploymentDetailsFromPlatform(ctx context.Context, cred *model.PlatformCredential, deploymentID string) (*model.DeploymentDetails, error) {
+	switch cred.Platform {
+	case "render":
+		client := platform.NewRenderProvider(cred.APIKey)
+		details, err := client.GetServiceDetails(ctx, deploymentID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch Render service details: %w", err)
+		}
+		return details, nil
+
+	case "vercel":
+		// TODO: Implement Vercel client
+		return nil, fmt.Errorf("vercel platform not implemented")
+
+	default:
+		return nil, fmt.Errorf("unsupported platform: %s", cred.Platform)
+	}
+}
+
+// gets one cached deployment of the user plus its details straight from the platform
+// the details are best effort -> when the platform can't be reached the cached deployment
+// is still returned with detailsError saying why they're missing
+func GetDeploymentDetail(ctx context.Context, userID string, credentialID int, deploymentID string) (*model.DeploymentDetail, error) {
+	logger := log.WithFields(log.Fields{
+		"func":          "GetDeploymentDetail",
+		"user_id":       userID,
+		"credential_id": credentialID,
+		"deployment_id": deploymentID,
+		"request_id":    ctx.Value("request_id"),
+	})
+
+	// ownership check, someone else's credential is a plain not found
+	cred, err := GetPlatformCredentialByID(ctx, credentialID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	deployment, err := storage.Deployments.Get(ctx, credentialID, deploymentID)
+	if errors.Is(err, sql.ErrNoRows) {
+		logger.Debug("Deployment not found in cache")
+		return nil, newError(ErrNotFound, "deployment %s not found", deploymentID)
+	} else if err != nil {
+		logger.WithError(err).Error("Failed to get cached deployment")
+		return nil, fmt.Errorf("failed to get cached deployment: %w", err)
+	}
+
+	detail := &model.DeploymentDetail{Deployment: *deployment}
+
+	breaker := breakerFor(cred.ID)
+	if !breaker.allow() {
+		logger.Debug("Circuit breaker open, skipping platform call")
+		detail.DetailsError = ErrCircuitOpen.Error()
+		return detail, nil
+	}
+
+	details, err := fetchDeploymentDetailsFromPlatform(ctx, cred, deploymentID)
+	switch {
+	case errors.Is(err, platform.ErrNotFound):
+		// still cached but already removed on the platform, the next refresh marks it gone
+		breaker.recordSuccess(cred.ID)
+		logger.Debug("Deployment no longer exists on the platform")
+		detail.DetailsError = "deployment no longer exists on the platform"
+	case err != nil:
+		breaker.recordFailure(cred.ID)
+		logger.WithError(err).Warn("Failed to fetch deployment details from platform")
+		detail.DetailsError = "platform details unavailable"
+	default:
+		breaker.recordSuccess(cred.ID)
+		detail.Details = details
+	}
+
+	return detail, nil
+}
+
 // gets deployments for all user credentials this is the main function here
 // workflow-> first get all platform credentials associated to the user id -> check if cache is fresh or stale
 // -> if is fresh it returns the cache
 // -> if not, fetch the data from the paltform ->case render/case vercel/etc-> update the cache and return it
 // -> append each deployment to the array and return it
-func GetAllUserDeployments(ctx context.Context, userID string) ([]model.Deployment, error) {
+// forceRefresh bypasses the cache for every credential (Cache-Control: no-cache)
+func GetAllUserDeployments(ctx context.Context, userID string, forceRefresh bool) ([]model.Deployment, []model.CacheInfo, error) {
 	logger := log.WithFields(log.Fields{
-		"func":       "GetAllUserDeployments",
-		"user_id":    userID,
-		"request_id": ctx.Value("request_id"),
+		"func":          "GetAllUserDeployments",
+		"user_id":       userID,
+		"force_refresh": forceRefresh,
+		"request_id":    ctx.Value("request_id"),
 	})
 
 	logger.Info("Getting all user deployments started")
@@ -369,13 +575,184 @@ func GetAllUserDeployments(ctx context.Context, userID string) ([]model.Deployme
 	creds, err := GetPlatformCredentials(ctx, userID)
 	if err != nil {
 		logger.WithError(err).Error("Failed to get user credentials")
-		return nil, fmt.Errorf("failed to get user credentials: %w", err)
+		return nil, nil, fmt.Errorf("failed to get user credentials: %w", err)
 	}
 
 	logger.WithField("credentials_count", len(creds)).Debug("Retrieved user credentials")
 
+	allDeployments, cacheInfos := collectDeployments(ctx, logger, creds, forceRefresh)
+
+	logger.WithField("total_deployments", len(allDeployments)).Info("Successfully retrieved all user deployments")
+	return allDeployments, cacheInfos, nil
+}
+
+// lists the user's deployments filtered, sorted and paged by the database
+// the caches of the matching credentials are brought up to date first, same rules as GetAllUserDeployments
+func ListUserDeployments(ctx context.Context, userID string, query model.DeploymentQuery, forceRefresh bool) (*model.DeploymentPage, error) {
+	logger := log.WithFields(log.Fields{
+		"func":          "ListUserDeployments",
+		"user_id":       userID,
+		"force_refresh": forceRefresh,
+		"request_id":    ctx.Value("request_id"),
+	})
+
+	logger.Info("Listing user deployments started")
+
+	if err := normalizeDeploymentQuery(&query); err != nil {
+		logger.WithError(err).Warn("Invalid deployments query")
+		return nil, err
+	}
+
+	var after *storage.DeploymentCursor
+	if query.Cursor != "" {
+		cursor, err := decodeDeploymentsCursor(query)
+		if err != nil {
+			logger.WithError(err).Warn("Invalid deployments cursor")
+			return nil, err
+		}
+		after = cursor
+	}
+
+	creds, err := GetPlatformCredentials(ctx, userID)
+	if err != nil {
+		logger.WithError(err).Error("Failed to get user credentials")
+		return nil, fmt.Errorf("failed to get user credentials: %w", err)
+	}
+
+	// only the credentials the filter can match need a fresh cache
+	matching := creds[:0]
+	for _, cred := range creds {
+		if query.Platform != "" && cred.Platform != query.Platform {
+			continue
+		}
+		if query.CredentialID != nil && cred.ID != *query.CredentialID {
+			continue
+		}
+		matching = append(matching, cred)
+	}
+
+	_, cacheInfos := collectDeployments(ctx, logger, matching, forceRefresh)
+
+	// credentials that failed without a servable cache are left out, like in GetAllUserDeployments
+	credentialIDs := make([]int, 0, len(cacheInfos))
+	for _, info := range cacheInfos {
+		credentialIDs = append(credentialIDs, info.PlatformCredentialID)
+	}
+
+	deployments, next, err := storage.Deployments.List(ctx, userID, credentialIDs, query, after)
+	if err != nil {
+		logger.WithError(err).Error("Failed to list cached deployments")
+		return nil, fmt.Errorf("failed to list cached deployments: %w", err)
+	}
+
+	page := &model.DeploymentPage{Deployments: deployments, Cache: cacheInfos}
+	if next != nil {
+		if page.NextCursor, err = encodeDeploymentsCursor(query, next); err != nil {
+			logger.WithError(err).Error("Failed to encode deployments cursor")
+			return nil, err
+		}
+	}
+
+	logger.WithFields(log.Fields{
+		"deployments_count": len(deployments),
+		"has_more":          next != nil,
+	}).Info("Successfully listed user deployments")
+	return page, nil
+}
+
+// defaults and validation of a deployments query
+func normalizeDeploymentQuery(query *model.DeploymentQuery) error {
+	switch query.Sort {
+	case "":
+		query.Sort = model.DeploymentSortName
+	case model.DeploymentSortName, model.DeploymentSortStatus, model.DeploymentSortLastDeployed:
+	default:
+		return newError(ErrInvalidInput, "invalid sort %q, expected name, status or lastDeployedAt", query.Sort)
+	}
+
+	for _, status := range query.Statuses {
+		switch status {
+		case model.DeploymentStatusLive, model.DeploymentStatusDeploying, model.DeploymentStatusCanceled,
+			model.DeploymentStatusFailed, model.DeploymentStatusUnknown, model.DeploymentStatusGone:
+		default:
+			return newError(ErrInvalidInput, "invalid status %q", status)
+		}
+	}
+
+	if query.Limit <= 0 {
+		query.Limit = DefaultDeploymentsPageSize
+	} else if query.Limit > MaxDeploymentsPageSize {
+		query.Limit = MaxDeploymentsPageSize
+	}
+	return nil
+}
+
+// what the opaque cursor handed to the client holds
+// the sort is kept so a cursor can't be replayed against another order
+type deploymentsCursor struct {
+	Sort  model.DeploymentSort     `json:"sort"`
+	Desc  bool                     `json:"desc"`
+	After storage.DeploymentCursor `json:"after"`
+}
+
+func encodeDeploymentsCursor(query model.DeploymentQuery, after *storage.DeploymentCursor) (string, error) {
+	body, err := json.Marshal(deploymentsCursor{Sort: query.Sort, Desc: query.Desc, After: *after})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode cursor: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(body), nil
+}
+
+func decodeDeploymentsCursor(query model.DeploymentQuery) (*storage.DeploymentCursor, error) {
+	body, err := base64.RawURLEncoding.DecodeString(query.Cursor)
+	if err != nil {
+		return nil, newError(ErrInvalidInput, "invalid cursor")
+	}
+
+	var cursor deploymentsCursor
+	if err := json.Unmarshal(body, &cursor); err != nil {
+		return nil, newError(ErrInvalidInput, "invalid cursor")
+	}
+	if cursor.Sort != query.Sort || cursor.Desc != query.Desc {
+		return nil, newError(ErrInvalidInput, "cursor belongs to another sort order")
+	}
+	return &cursor.After, nil
+}
+
+// refetches deployments from the platforms ignoring the cache
+// credentialID limits the refresh to one credential, nil refreshes all of the user's credentials
+func RefreshDeployments(ctx context.Context, userID string, credentialID *int) ([]model.Deployment, []model.CacheInfo, error) {
+	logger := log.WithFields(log.Fields{
+		"func":       "RefreshDeployments",
+		"user_id":    userID,
+		"request_id": ctx.Value("request_id"),
+	})
+
+	if credentialID == nil {
+		logger.Info("Refreshing all user deployments")
+		return GetAllUserDeployments(ctx, userID, true)
+	}
+
+	logger = logger.WithField("credential_id", *credentialID)
+	logger.Info("Refreshing credential deployments")
+
+	cred, err := GetPlatformCredentialByID(ctx, *credentialID, userID)
+	if err != nil {
+		logger.WithError(err).Warn("Failed to get credential to refresh")
+		return nil, nil, err
+	}
+
+	deployments, cacheInfos := collectDeployments(ctx, logger, []model.PlatformCredential{*cred}, true)
+
+	logger.WithField("deployments_count", len(deployments)).Info("Credential deployments refreshed")
+	return deployments, cacheInfos, nil
+}
+
+// gets the deployments of each credential, a failing credential is logged and skipped
+func collectDeployments(ctx context.Context, logger *log.Entry, creds []model.PlatformCredential, forceRefresh bool) ([]model.Deployment, []model.CacheInfo) {
 	// Collect all deployments from all credentials
 	var allDeployments []model.Deployment
+	cacheInfos := make([]model.CacheInfo, 0, len(creds))
 
 	//all deployment assosiated to one credential should have
 	//the same platform_credential_id
@@ -386,18 +763,17 @@ func GetAllUserDeployments(ctx context.Context, userID string) ([]model.Deployme
 		})
 
 		credLogger.Debug("Processing credential")
-		deployments, err := GetFreshOrUpdateCache(ctx, &cred)
+		deployments, cacheInfo, err := GetFreshOrUpdateCache(ctx, &cred, forceRefresh)
 		if err != nil {
 			// Log error but continue with other credentials
 			credLogger.WithError(err).Warn("Error fetching deployments for credential, continuing with others")
-			fmt.Printf("Error fetching deployments for credential %d: %v\n", cred.ID, err)
 			continue
 		}
 
 		credLogger.WithField("deployments_count", len(deployments)).Debug("Retrieved deployments for credential")
 		allDeployments = append(allDeployments, deployments...)
+		cacheInfos = append(cacheInfos, *cacheInfo)
 	}
 
-	logger.WithField("total_deployments", len(allDeployments)).Info("Successfully retrieved all user deployments")
-	return allDeployments, nil
+	return allDeployments, cacheInfos
 }
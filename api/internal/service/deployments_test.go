@@ -0,0 +1,237 @@
+package service
+
+import (
+	"checkmate/api/internal/model"
+	"checkmate/api/internal/storage"
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRefreshCacheCoalescesConcurrentCallers(t *testing.T) {
+	openTestDB(t)
+	cred := createTestCredential(t, "user-coalesce")
+	render := startFakeRender(t, renderService("srv-1", "api", "live"), renderService("srv-2", "worker", "live"))
+	// long enough for every caller to arrive while the first fetch is in flight
+	render.delay = 200 * time.Millisecond
+
+	const callers = 20
+	var wg sync.WaitGroup
+	errs := make(chan error, callers)
+	counts := make(chan int, callers)
+	start := make(chan struct{})
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			deployments, _, err := GetFreshOrUpdateCache(context.Background(), cred, false)
+			if err != nil {
+				errs <- err
+				return
+			}
+			counts <- len(deployments)
+		}()
+	}
+	close(start)
+	wg.Wait()
+	close(errs)
+	close(counts)
+
+	for err := range errs {
+		t.Fatalf("GetFreshOrUpdateCache: %v", err)
+	}
+	for n := range counts {
+		if n != 2 {
+			t.Errorf("caller got %d deployments, want 2", n)
+		}
+	}
+	if calls := render.listCalls.Load(); calls != 1 {
+		t.Fatalf("platform was called %d times for %d concurrent callers, want 1", calls, callers)
+	}
+
+	// the cache is fresh now, later callers don't reach the platform either
+	if _, _, err := GetFreshOrUpdateCache(context.Background(), cred, false); err != nil {
+		t.Fatalf("GetFreshOrUpdateCache: %v", err)
+	}
+	if calls := render.listCalls.Load(); calls != 1 {
+		t.Fatalf("fresh cache still called the platform, %d calls", calls)
+	}
+}
+
+// a deployment marked gone that comes back as it was is live again, not left gone for retention to delete
+func TestGoneDeploymentReappearsUnchanged(t *testing.T) {
+	openTestDB(t)
+	cred := createTestCredential(t, "user-gone")
+	api := renderService("srv-1", "api", "live")
+	render := startFakeRender(t, api, renderService("srv-2", "worker", "live"))
+	ctx := context.Background()
+
+	previous := DeploymentGoneGracePeriod
+	DeploymentGoneGracePeriod = 0
+	t.Cleanup(func() { DeploymentGoneGracePeriod = previous })
+
+	refresh := func() {
+		t.Helper()
+		if _, _, err := GetFreshOrUpdateCache(ctx, cred, true); err != nil {
+			t.Fatalf("refresh: %v", err)
+		}
+	}
+	status := func() model.DeploymentStatus {
+		t.Helper()
+		deployments, err := storage.Deployments.ListCached(ctx, cred.ID)
+		if err != nil {
+			t.Fatalf("list cached: %v", err)
+		}
+		for _, d := range deployments {
+			if d.ID == "srv-1" {
+				return d.Status
+			}
+		}
+		t.Fatal("srv-1 isn't cached")
+		return ""
+	}
+
+	refresh()
+	render.setServices(renderService("srv-2", "worker", "live"))
+	refresh()
+	if s := status(); s != model.DeploymentStatusGone {
+		t.Fatalf("missing deployment is %s, want gone", s)
+	}
+
+	// the very same service, its fingerprint didn't change
+	render.setServices(api, renderService("srv-2", "worker", "live"))
+	refresh()
+	if s := status(); s != model.DeploymentStatusLive {
+		t.Fatalf("deployment that came back is %s, want live", s)
+	}
+
+	events, err := storage.Deployments.ListEvents(ctx, cred.UserID, model.DeploymentEventFilter{CredentialID: &cred.ID, DeploymentID: "srv-1", Limit: 10})
+	if err != nil {
+		t.Fatalf("list events: %v", err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("got %d events, want live -> gone and gone -> live", len(events))
+	}
+	// newest first
+	if events[0].OldStatus != model.DeploymentStatusGone || events[0].NewStatus != model.DeploymentStatusLive {
+		t.Errorf("last event is %s -> %s, want gone -> live", events[0].OldStatus, events[0].NewStatus)
+	}
+}
+
+// expired inside the stale-while-revalidate window: every caller gets the old data right away, one refresh runs behind them
+func TestStaleWhileRevalidate(t *testing.T) {
+	openTestDB(t)
+	cred := createTestCredential(t, "user-swr")
+	render := startFakeRender(t, renderService("srv-1", "api", "live"), renderService("srv-2", "worker", "live"))
+	ctx := context.Background()
+
+	if _, _, err := GetFreshOrUpdateCache(ctx, cred, false); err != nil {
+		t.Fatalf("first refresh: %v", err)
+	}
+	ttl := EffectiveCacheTTL(cred)
+	ageCache(t, cred.ID, ttl+time.Minute)
+	render.setServices(renderService("srv-1", "api", "live"), renderService("srv-2", "worker", "live"), renderService("srv-3", "cron", "live"))
+	// every caller arrives while the background refresh is still running
+	render.delay = 200 * time.Millisecond
+
+	const callers = 10
+	var wg sync.WaitGroup
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			deployments, info, err := GetFreshOrUpdateCache(ctx, cred, false)
+			if err != nil {
+				t.Errorf("GetFreshOrUpdateCache: %v", err)
+				return
+			}
+			if len(deployments) != 2 || !info.Stale || info.StaleReason != model.StaleReasonRefreshing {
+				t.Errorf("got %d deployments and cache info %+v, want the 2 cached ones marked as refreshing", len(deployments), info)
+			}
+			if want := int64((ttl + time.Minute).Seconds()); info.AgeSeconds < want {
+				t.Errorf("cache age %ds, want at least %ds", info.AgeSeconds, want)
+			}
+		}()
+	}
+	wg.Wait()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		_, refreshedAt, err := CacheExists(ctx, cred.ID)
+		if err != nil {
+			t.Fatalf("cache exists: %v", err)
+		}
+		if IsCacheFresh(refreshedAt, ttl) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("background refresh never updated the cache")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if calls := render.listCalls.Load(); calls != 2 {
+		t.Fatalf("%d platform calls, want the first refresh and one background refresh", calls)
+	}
+
+	deployments, info, err := GetFreshOrUpdateCache(ctx, cred, false)
+	if err != nil || info.Stale || len(deployments) != 3 {
+		t.Fatalf("after the refresh: %d deployments, cache info %+v, err %v, want the 3 fresh ones", len(deployments), info, err)
+	}
+	if calls := render.listCalls.Load(); calls != 2 {
+		t.Errorf("%d platform calls after the refresh, want 2", calls)
+	}
+}
+
+// past the revalidate window the platform is called, when it fails the cache is served up to CacheMaxStaleness
+func TestServeStaleOnPlatformError(t *testing.T) {
+	openTestDB(t)
+	cred := createTestCredential(t, "user-stale")
+	render := startFakeRender(t, renderService("srv-1", "api", "live"), renderService("srv-2", "worker", "live"))
+	ctx := context.Background()
+
+	if _, _, err := GetFreshOrUpdateCache(ctx, cred, false); err != nil {
+		t.Fatalf("first refresh: %v", err)
+	}
+	ageCache(t, cred.ID, 2*time.Hour)
+	render.failStatus.Store(401)
+
+	deployments, info, err := GetFreshOrUpdateCache(ctx, cred, false)
+	if err != nil {
+		t.Fatalf("GetFreshOrUpdateCache with the platform down: %v", err)
+	}
+	if len(deployments) != 2 || !info.Stale || info.StaleReason != model.StaleReasonPlatformUnavailable {
+		t.Fatalf("got %d deployments and cache info %+v, want the 2 cached ones marked as platform unavailable", len(deployments), info)
+	}
+	if info.AgeSeconds < 7200 || info.AgeSeconds > 7260 {
+		t.Errorf("cache age %ds, want about two hours", info.AgeSeconds)
+	}
+	if calls := render.listCalls.Load(); calls != 2 {
+		t.Errorf("%d platform calls, want 2", calls)
+	}
+
+	// older than the max staleness the cache isn't served anymore
+	previous := CacheMaxStaleness
+	CacheMaxStaleness = time.Hour
+	t.Cleanup(func() { CacheMaxStaleness = previous })
+	if deployments, _, err := GetFreshOrUpdateCache(ctx, cred, false); !errors.Is(err, ErrUpstreamUnavailable) || deployments != nil {
+		t.Errorf("cache past the max staleness: got %d deployments and err %v, want ErrUpstreamUnavailable", len(deployments), err)
+	}
+}
+
+func TestEmptyCachePlatformError(t *testing.T) {
+	openTestDB(t)
+	cred := createTestCredential(t, "user-empty")
+	render := startFakeRender(t, renderService("srv-1", "api", "live"))
+	render.failStatus.Store(401)
+
+	deployments, info, err := GetFreshOrUpdateCache(context.Background(), cred, false)
+	if !errors.Is(err, ErrUpstreamUnavailable) {
+		t.Fatalf("got err %v, want ErrUpstreamUnavailable", err)
+	}
+	if deployments != nil || info != nil {
+		t.Errorf("got %d deployments and cache info %+v with the error, want none", len(deployments), info)
+	}
+}
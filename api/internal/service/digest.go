@@ -0,0 +1,311 @@
+package service
+
+import (
+	"checkmate/api/internal/model"
+	"checkmate/api/internal/storage"
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+//Daily digest -> email webhooks subscribed to digest.daily get a summary of the last 24 hours once a day:
+// deployments by status, deploys, failures and recoveries seen, and the uptime of every deployment
+
+const (
+	DefaultDigestHour = 8 // utc
+
+	digestWindow = 24 * time.Hour
+	// how often the scheduler looks for digests to queue, a digest is at most this late
+	digestCheckInterval = 5 * time.Minute
+	// events read for one digest, a user with more only gets an approximate uptime
+	digestMaxEvents = 10000
+)
+
+// set with the smtp settings, see InitEmailSettings
+var DigestHour = DefaultDigestHour
+
+// what the digest templates get
+type digestData struct {
+	From, To    time.Time
+	Deployments int
+	Live        int
+	Failing     int
+	Deploying   int
+	Other       int
+	// events of the window
+	Deploys    int
+	Failures   int
+	Recoveries int
+	Uptime     string // over every deployment, "n/a" when nothing was observed
+	Services   []digestService
+}
+
+type digestService struct {
+	Name         string
+	Platform     string
+	Credential   string
+	Status       model.DeploymentStatus
+	Color        string
+	Uptime       string
+	Failures     int
+	DashboardURL string
+}
+
+// digest time of the last digest due at or before now
+func lastDigestDue(now time.Time) time.Time {
+	now = now.UTC()
+	due := time.Date(now.Year(), now.Month(), now.Day(), DigestHour, 0, 0, 0, time.UTC)
+	if now.Before(due) {
+		due = due.Add(-digestWindow)
+	}
+	return due
+}
+
+// queues the digests that are due until ctx is cancelled, only runs when email is configured
+func StartEmailDigests(ctx context.Context) {
+	if !EmailEnabled() {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(digestCheckInterval)
+		defer ticker.Stop()
+
+		for {
+			queueDueDigests(ctx, time.Now())
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// queues a digest delivery for every email webhook that didn't get the last one due
+// a digest missed while the server was down is sent once it is back, for the window that ended at its due time
+func queueDueDigests(ctx context.Context, now time.Time) {
+	logger := log.WithFields(log.Fields{
+		"func": "queueDueDigests",
+	})
+
+	due := lastDigestDue(now)
+	webhooks, err := storage.Webhooks.ListDigestsDue(ctx, due)
+	if err != nil {
+		if ctx.Err() == nil {
+			logger.WithError(err).Error("Failed to query due digests")
+		}
+		return
+	}
+
+	queued := 0
+	for i := range webhooks {
+		hook := &webhooks[i]
+		hookLogger := logger.WithFields(log.Fields{
+			"webhook_id": hook.ID,
+			"user_id":    hook.UserID,
+		})
+
+		// claimed first so two instances don't both send it, a digest that fails to build is skipped for the day
+		claimed, err := storage.Webhooks.MarkDigestQueued(ctx, hook.ID, due)
+		if err != nil {
+			hookLogger.WithError(err).Error("Failed to mark digest queued")
+			continue
+		}
+		if !claimed {
+			continue
+		}
+
+		msg, err := buildDigest(ctx, hook, due.Add(-digestWindow), due)
+		if err != nil {
+			hookLogger.WithError(err).Error("Failed to build digest")
+			continue
+		}
+		payload, err := json.Marshal(msg)
+		if err != nil {
+			hookLogger.WithError(err).Error("Failed to encode digest")
+			continue
+		}
+
+		now := time.Now()
+		delivery := &model.WebhookDelivery{
+			WebhookID:     hook.ID,
+			EventType:     model.WebhookEventDigest,
+			Payload:       payload,
+			Status:        model.WebhookDeliveryPending,
+			CreatedAt:     now,
+			NextAttemptAt: &now,
+		}
+		if _, err := storage.Webhooks.CreateDelivery(ctx, delivery); err != nil {
+			hookLogger.WithError(err).Error("Failed to queue digest")
+			continue
+		}
+		queued++
+	}
+
+	if queued > 0 {
+		logger.WithFields(log.Fields{
+			"digests_count": queued,
+			"due":           due,
+		}).Info("Queued daily digests")
+		wakeDeliveryWorker()
+	}
+}
+
+// renders the digest of the user of the webhook for [from, to), limited to the credentials of its filter
+func buildDigest(ctx context.Context, hook *model.Webhook, from, to time.Time) (*model.EmailMessage, error) {
+	creds, err := storage.Credentials.ListByUser(ctx, hook.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query credentials: %w", err)
+	}
+
+	events, err := storage.Deployments.ListEvents(ctx, hook.UserID, model.DeploymentEventFilter{
+		Since: &from,
+		Until: &to,
+		Limit: digestMaxEvents,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query deployment events: %w", err)
+	}
+	// oldest first, per deployment
+	byDeployment := make(map[string][]model.DeploymentEvent)
+	for i := len(events) - 1; i >= 0; i-- {
+		key := fmt.Sprintf("%d/%s", events[i].PlatformCredentialID, events[i].DeploymentID)
+		byDeployment[key] = append(byDeployment[key], events[i])
+	}
+
+	data := digestData{From: from, To: to}
+	var upTotal, observedTotal time.Duration
+	for _, cred := range creds {
+		if len(hook.CredentialIDs) > 0 && !slices.Contains(hook.CredentialIDs, cred.ID) {
+			continue
+		}
+		deployments, err := storage.Deployments.ListCached(ctx, cred.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query deployments of credential %d: %w", cred.ID, err)
+		}
+
+		for _, d := range deployments {
+			data.Deployments++
+			switch d.Status {
+			case model.DeploymentStatusLive:
+				data.Live++
+			case model.DeploymentStatusFailed:
+				data.Failing++
+			case model.DeploymentStatusDeploying:
+				data.Deploying++
+			default:
+				data.Other++
+			}
+
+			service := digestService{
+				Name:       d.Name,
+				Platform:   cred.Platform,
+				Credential: cred.Name,
+				Status:     d.Status,
+				Color:      fmt.Sprintf("#%06X", discordColor(d.Status)),
+				Uptime:     "n/a",
+			}
+			if u, ok := d.Metadata["dashboardUrl"].(string); ok {
+				service.DashboardURL = u
+			}
+
+			deploymentEvents := byDeployment[fmt.Sprintf("%d/%s", cred.ID, d.ID)]
+			for i := range deploymentEvents {
+				eventType, _ := webhookEventType(deploymentEvents[i], settledStatusBefore(ctx, &deploymentEvents[i]))
+				switch eventType {
+				case model.WebhookEventDeploymentDeploying:
+					data.Deploys++
+				case model.WebhookEventDeploymentFailed:
+					data.Failures++
+					service.Failures++
+				case model.WebhookEventDeploymentRecovered:
+					data.Recoveries++
+				}
+			}
+
+			up, observed := deploymentUptime(d.Status, d.FirstSeenAt, deploymentEvents, from, to)
+			if observed > 0 {
+				service.Uptime = formatUptime(up, observed)
+				upTotal += up
+				observedTotal += observed
+			}
+			data.Services = append(data.Services, service)
+		}
+	}
+
+	data.Uptime = "n/a"
+	if observedTotal > 0 {
+		data.Uptime = formatUptime(upTotal, observedTotal)
+	}
+
+	// failing ones first, then by name
+	sort.SliceStable(data.Services, func(i, j int) bool {
+		fi := data.Services[i].Status == model.DeploymentStatusFailed
+		fj := data.Services[j].Status == model.DeploymentStatusFailed
+		if fi != fj {
+			return fi
+		}
+		return data.Services[i].Name < data.Services[j].Name
+	})
+
+	subject := fmt.Sprintf("%sDaily digest for %s", emailSubjectPrefix, to.UTC().Format("Mon, 02 Jan"))
+	if data.Failures > 0 {
+		subject += fmt.Sprintf(": %d failures", data.Failures)
+	}
+	return renderEmail(subject, "digest", &data)
+}
+
+// time a deployment was up and time it was observed in [from, to), events oldest first
+// failed is down, unknown and gone aren't counted, every other status is up (a deploy in progress
+// or a canceled one leaves the previous version serving)
+func deploymentUptime(current model.DeploymentStatus, firstSeenAt *time.Time, events []model.DeploymentEvent, from, to time.Time) (up, observed time.Duration) {
+	start := from
+	if firstSeenAt != nil && firstSeenAt.After(start) {
+		start = *firstSeenAt
+	}
+
+	// the status at the start is the one the first event changed, or the current one without events
+	status := current
+	if len(events) > 0 {
+		status = events[0].OldStatus
+		if status == "" {
+			// first seen inside the window
+			start = events[0].ObservedAt
+		}
+	}
+
+	add := func(until time.Time) {
+		if !until.After(start) {
+			return
+		}
+		d := until.Sub(start)
+		switch status {
+		case model.DeploymentStatusUnknown, model.DeploymentStatusGone, "":
+		case model.DeploymentStatusFailed:
+			observed += d
+		default:
+			observed += d
+			up += d
+		}
+		start = until
+	}
+
+	for _, e := range events {
+		add(e.ObservedAt)
+		status = e.NewStatus
+	}
+	add(to)
+	return up, observed
+}
+
+func formatUptime(up, observed time.Duration) string {
+	return strconv.FormatFloat(100*float64(up)/float64(observed), 'f', 2, 64) + "%"
+}
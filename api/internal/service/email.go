@@ -0,0 +1,327 @@
+package service
+
+import (
+	"bytes"
+	"checkmate/api/internal/model"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+//Email notifications -> webhooks of type email are sent over SMTP instead of http
+// the url is mailto: with the recipients, every message has a text and an html part rendered from templates/email
+
+const (
+	DefaultSMTPPort    = 587
+	DefaultSMTPTimeout = 10 * time.Second
+
+	MaxEmailRecipients = 10
+
+	SMTPTLSStartTLS = "starttls" // plain connection upgraded with STARTTLS, refuses servers that don't offer it
+	SMTPTLSImplicit = "tls"      // TLS from the first byte, usually port 465
+	SMTPTLSNone     = "none"     // plain text, for local relays and test servers only
+
+	emailSubjectPrefix = "[checkmate] "
+)
+
+var (
+	SMTPHost     = "" // empty -> email notifications are off
+	SMTPPort     = DefaultSMTPPort
+	SMTPUsername = ""
+	SMTPPassword = ""
+	SMTPFrom     = ""
+	SMTPTLS      = SMTPTLSStartTLS
+	SMTPTimeout  = DefaultSMTPTimeout
+)
+
+//go:embed templates/email/*.tmpl
+var emailTemplateFiles embed.FS
+
+var (
+	emailTextTemplates = texttemplate.Must(texttemplate.ParseFS(emailTemplateFiles, "templates/email/*.txt.tmpl"))
+	emailHTMLTemplates = htmltemplate.Must(htmltemplate.ParseFS(emailTemplateFiles, "templates/email/*.html.tmpl"))
+)
+
+var errEmailDisabled = errors.New("email notifications are not configured on this server")
+
+// loads the smtp server settings from the environment
+// SMTP_HOST enables email, SMTP_PORT, SMTP_USERNAME and SMTP_PASSWORD (auth is skipped without a username),
+// SMTP_FROM (defaults to the username), SMTP_TLS is starttls, tls or none, SMTP_TIMEOUT a go duration,
+// EMAIL_DIGEST_HOUR the utc hour (0-23) daily digests are sent at
+func InitEmailSettings() error {
+	var err error
+
+	SMTPHost = os.Getenv("SMTP_HOST")
+	SMTPUsername = os.Getenv("SMTP_USERNAME")
+	SMTPPassword = os.Getenv("SMTP_PASSWORD")
+
+	SMTPPort = DefaultSMTPPort
+	if v := os.Getenv("SMTP_PORT"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 65535 {
+			return fmt.Errorf("invalid SMTP_PORT %q", v)
+		}
+		SMTPPort = n
+	}
+
+	SMTPTLS = SMTPTLSStartTLS
+	if v := os.Getenv("SMTP_TLS"); v != "" {
+		switch v {
+		case SMTPTLSStartTLS, SMTPTLSImplicit, SMTPTLSNone:
+			SMTPTLS = v
+		default:
+			return fmt.Errorf("invalid SMTP_TLS %q, expected starttls, tls or none", v)
+		}
+	}
+
+	if SMTPTimeout, err = durationFromEnv("SMTP_TIMEOUT", DefaultSMTPTimeout); err != nil {
+		return err
+	}
+
+	DigestHour = DefaultDigestHour
+	if v := os.Getenv("EMAIL_DIGEST_HOUR"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > 23 {
+			return fmt.Errorf("invalid EMAIL_DIGEST_HOUR %q", v)
+		}
+		DigestHour = n
+	}
+
+	SMTPFrom = os.Getenv("SMTP_FROM")
+	if SMTPFrom == "" {
+		SMTPFrom = SMTPUsername
+	}
+	if SMTPHost != "" {
+		if _, err := mail.ParseAddress(SMTPFrom); err != nil {
+			return fmt.Errorf("invalid SMTP_FROM %q, a sender address is required with SMTP_HOST", SMTPFrom)
+		}
+	}
+	return nil
+}
+
+func EmailEnabled() bool {
+	return SMTPHost != ""
+}
+
+// recipients of a mailto: url, mailto:a@example.com,b@example.com
+func emailRecipients(rawURL string) ([]string, error) {
+	list, ok := strings.CutPrefix(rawURL, "mailto:")
+	if !ok {
+		return nil, newError(ErrInvalidInput, "email url must be mailto: followed by the recipients")
+	}
+
+	var recipients []string
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(list, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		addr, err := mail.ParseAddress(part)
+		if err != nil {
+			return nil, newError(ErrInvalidInput, "invalid email address %q", part)
+		}
+		if !seen[strings.ToLower(addr.Address)] {
+			seen[strings.ToLower(addr.Address)] = true
+			recipients = append(recipients, addr.Address)
+		}
+	}
+	if len(recipients) == 0 {
+		return nil, newError(ErrInvalidInput, "at least one email address is required")
+	}
+	if len(recipients) > MaxEmailRecipients {
+		return nil, newError(ErrInvalidInput, "too many email addresses (max %d)", MaxEmailRecipients)
+	}
+	return recipients, nil
+}
+
+// what the event templates get
+type emailEvent struct {
+	chatMessage
+	Color string
+}
+
+// renders the email of a deployment event or of the test message
+func eventEmail(m chatMessage) (*model.EmailMessage, error) {
+	data := &emailEvent{chatMessage: m, Color: fmt.Sprintf("#%06X", discordColor(m.NewStatus))}
+	subject := emailSubjectPrefix + m.Headline
+	if m.EventType == model.WebhookEventTest {
+		subject = emailSubjectPrefix + "Test email"
+	}
+	return renderEmail(subject, "event", data)
+}
+
+// runs the text and html templates of name with the same data
+func renderEmail(subject string, name string, data interface{}) (*model.EmailMessage, error) {
+	var text, html bytes.Buffer
+	if err := emailTextTemplates.ExecuteTemplate(&text, name+".txt.tmpl", data); err != nil {
+		return nil, fmt.Errorf("failed to render %s email: %w", name, err)
+	}
+	if err := emailHTMLTemplates.ExecuteTemplate(&html, name+".html.tmpl", data); err != nil {
+		return nil, fmt.Errorf("failed to render %s email: %w", name, err)
+	}
+	return &model.EmailMessage{Subject: subject, Text: text.String(), HTML: html.String()}, nil
+}
+
+// sends the message to the recipients, headers are added as is
+// returns the last smtp reply code (0 when the server never answered one) and why the message wasn't sent
+func sendEmail(ctx context.Context, to []string, msg *model.EmailMessage, headers map[string]string) (int, error) {
+	if !EmailEnabled() {
+		return 0, errEmailDisabled
+	}
+
+	body, err := buildEmail(to, msg, headers)
+	if err != nil {
+		return 0, err
+	}
+
+	addr := net.JoinHostPort(SMTPHost, strconv.Itoa(SMTPPort))
+	dialer := &net.Dialer{Timeout: SMTPTimeout}
+	var conn net.Conn
+	if SMTPTLS == SMTPTLSImplicit {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: &tls.Config{ServerName: SMTPHost}}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to connect to smtp server: %w", err)
+	}
+	// one deadline for the whole conversation, and a stop closes the connection mid conversation
+	conn.SetDeadline(time.Now().Add(SMTPTimeout))
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	client, err := smtp.NewClient(conn, SMTPHost)
+	if err != nil {
+		conn.Close()
+		return smtpCode(err), fmt.Errorf("smtp greeting failed: %w", err)
+	}
+	defer client.Close()
+
+	if SMTPTLS == SMTPTLSStartTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return 0, errors.New("smtp server doesn't offer STARTTLS")
+		}
+		if err := client.StartTLS(&tls.Config{ServerName: SMTPHost}); err != nil {
+			return smtpCode(err), fmt.Errorf("smtp starttls failed: %w", err)
+		}
+	}
+
+	if SMTPUsername != "" {
+		// PlainAuth only sends the password over TLS (or to localhost)
+		if err := client.Auth(smtp.PlainAuth("", SMTPUsername, SMTPPassword, SMTPHost)); err != nil {
+			return smtpCode(err), fmt.Errorf("smtp auth failed: %w", err)
+		}
+	}
+
+	from, _ := mail.ParseAddress(SMTPFrom)
+	if err := client.Mail(from.Address); err != nil {
+		return smtpCode(err), fmt.Errorf("smtp MAIL FROM refused: %w", err)
+	}
+	for _, rcpt := range to {
+		if err := client.Rcpt(rcpt); err != nil {
+			return smtpCode(err), fmt.Errorf("smtp recipient %s refused: %w", rcpt, err)
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return smtpCode(err), fmt.Errorf("smtp DATA refused: %w", err)
+	}
+	if _, err := w.Write(body); err != nil {
+		return 0, fmt.Errorf("failed to write email: %w", err)
+	}
+	// the reply to the end of the data is the one that says if the message was taken
+	if err := w.Close(); err != nil {
+		return smtpCode(err), fmt.Errorf("smtp server refused the email: %w", err)
+	}
+
+	// the message is accepted at this point, a failing QUIT doesn't change that
+	client.Quit()
+	return 250, nil
+}
+
+// reply code of an smtp error, 0 for network errors
+func smtpCode(err error) int {
+	var protoErr *textproto.Error
+	if errors.As(err, &protoErr) {
+		return protoErr.Code
+	}
+	return 0
+}
+
+// multipart/alternative message with a quoted-printable text part then the html part
+func buildEmail(to []string, msg *model.EmailMessage, headers map[string]string) ([]byte, error) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+
+	header := func(name, value string) {
+		fmt.Fprintf(&buf, "%s: %s\r\n", name, value)
+	}
+	header("From", SMTPFrom)
+	header("To", strings.Join(to, ", "))
+	header("Subject", mime.QEncoding.Encode("utf-8", msg.Subject))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("Message-ID", newMessageID())
+	header("MIME-Version", "1.0")
+	header("Content-Type", `multipart/alternative; boundary="`+mw.Boundary()+`"`)
+	for name, value := range headers {
+		header(name, value)
+	}
+	buf.WriteString("\r\n")
+
+	for _, part := range []struct {
+		contentType string
+		content     string
+	}{
+		{"text/plain; charset=utf-8", msg.Text},
+		{"text/html; charset=utf-8", msg.HTML},
+	} {
+		w, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to build email: %w", err)
+		}
+		qp := quotedprintable.NewWriter(w)
+		// the writer turns line breaks into crlf
+		if _, err := qp.Write([]byte(part.content)); err != nil {
+			return nil, fmt.Errorf("failed to build email: %w", err)
+		}
+		qp.Close()
+	}
+	if err := mw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to build email: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func newMessageID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	domain := "checkmate"
+	if from, err := mail.ParseAddress(SMTPFrom); err == nil {
+		if _, host, ok := strings.Cut(from.Address, "@"); ok {
+			domain = host
+		}
+	}
+	return "<" + hex.EncodeToString(b) + "@" + domain + ">"
+}
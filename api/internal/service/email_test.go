@@ -0,0 +1,286 @@
+package service
+
+import (
+	"bufio"
+	"checkmate/api/internal/model"
+	"checkmate/api/internal/storage"
+	"context"
+	"encoding/json"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// what the smtp stand-in got in one transaction
+type receivedEmail struct {
+	from string
+	to   []string
+	data string
+}
+
+// minimal smtp server on a random local port, accepts everything and hands each message over
+// points the smtp settings at itself, plain text without auth
+func startFakeSMTP(t *testing.T) <-chan receivedEmail {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	received := make(chan receivedEmail, 10)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveSMTP(conn, received)
+		}
+	}()
+
+	host, port, _ := net.SplitHostPort(ln.Addr().String())
+	previous := []string{SMTPHost, SMTPFrom, SMTPUsername, SMTPTLS}
+	previousPort := SMTPPort
+	SMTPHost, SMTPFrom, SMTPUsername, SMTPTLS = host, "Checkmate <alerts@example.com>", "", SMTPTLSNone
+	SMTPPort, _ = strconv.Atoi(port)
+	t.Cleanup(func() {
+		ln.Close()
+		SMTPHost, SMTPFrom, SMTPUsername, SMTPTLS = previous[0], previous[1], previous[2], previous[3]
+		SMTPPort = previousPort
+	})
+	return received
+}
+
+func serveSMTP(conn net.Conn, received chan<- receivedEmail) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { io.WriteString(conn, line+"\r\n") }
+
+	reply("220 localhost ready")
+	var msg receivedEmail
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		verb := strings.ToUpper(line)
+		switch {
+		case strings.HasPrefix(verb, "EHLO"), strings.HasPrefix(verb, "HELO"):
+			reply("250 localhost")
+		case strings.HasPrefix(verb, "MAIL FROM:"):
+			msg = receivedEmail{from: strings.Trim(line[len("MAIL FROM:"):], "<> ")}
+			reply("250 ok")
+		case strings.HasPrefix(verb, "RCPT TO:"):
+			msg.to = append(msg.to, strings.Trim(line[len("RCPT TO:"):], "<> "))
+			reply("250 ok")
+		case verb == "DATA":
+			reply("354 go ahead")
+			var data strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				// dot stuffing
+				data.WriteString(strings.TrimPrefix(l, "."))
+			}
+			msg.data = data.String()
+			received <- msg
+			reply("250 queued")
+		case verb == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 ok")
+		}
+	}
+}
+
+// the message and its text part, decoded
+func parseEmail(t *testing.T, data string) (*mail.Message, string) {
+	t.Helper()
+	msg, err := mail.ReadMessage(strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("parse email: %v", err)
+	}
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("content type %q, want multipart/alternative", msg.Header.Get("Content-Type"))
+	}
+
+	var text string
+	var types []string
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("read part: %v", err)
+		}
+		// quoted-printable is decoded by the reader
+		body, err := io.ReadAll(part)
+		if err != nil {
+			t.Fatalf("read part: %v", err)
+		}
+		types = append(types, part.Header.Get("Content-Type"))
+		if strings.HasPrefix(part.Header.Get("Content-Type"), "text/plain") {
+			text = string(body)
+		}
+	}
+	if strings.Join(types, ", ") != "text/plain; charset=utf-8, text/html; charset=utf-8" {
+		t.Fatalf("parts are %v, want text then html", types)
+	}
+	return msg, text
+}
+
+func checkEnvelope(t *testing.T, got receivedEmail, to []string) {
+	t.Helper()
+	if got.from != "alerts@example.com" {
+		t.Errorf("MAIL FROM %q, want alerts@example.com", got.from)
+	}
+	if strings.Join(got.to, ",") != strings.Join(to, ",") {
+		t.Errorf("RCPT TO %v, want %v", got.to, to)
+	}
+}
+
+func subject(t *testing.T, msg *mail.Message) string {
+	t.Helper()
+	s, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		t.Fatalf("decode subject: %v", err)
+	}
+	return s
+}
+
+func receive(t *testing.T, received <-chan receivedEmail) receivedEmail {
+	t.Helper()
+	select {
+	case got := <-received:
+		return got
+	case <-time.After(5 * time.Second):
+		t.Fatal("smtp server got nothing")
+	}
+	return receivedEmail{}
+}
+
+func TestEmailNotificationDelivery(t *testing.T) {
+	received := startFakeSMTP(t)
+	ctx := context.Background()
+
+	now := time.Now()
+	event := &model.DeploymentEvent{
+		ID:             7,
+		DeploymentID:   "srv-1",
+		DeploymentName: "api",
+		OldStatus:      model.DeploymentStatusLive,
+		NewStatus:      model.DeploymentStatusFailed,
+		CommitID:       "0123456789abcdef",
+		CommitMessage:  "break things",
+		ObservedAt:     now,
+	}
+	deployment := &model.Deployment{ID: "srv-1", Name: "api", Branch: "main", Status: model.DeploymentStatusFailed}
+	payload, err := webhookPayload(model.WebhookTypeEmail, model.WebhookEventDeploymentFailed, "render", event, deployment, now)
+	if err != nil {
+		t.Fatalf("build payload: %v", err)
+	}
+
+	code, err := sendEmailDelivery(ctx, &storage.ClaimedDelivery{
+		Delivery: model.WebhookDelivery{ID: 42, EventType: model.WebhookEventDeploymentFailed, Payload: payload},
+		Webhook:  model.Webhook{Type: model.WebhookTypeEmail, URL: "mailto:ops@example.com, Dev <dev@example.com>"},
+	})
+	if err != nil || code != 250 {
+		t.Fatalf("send: code %d, %v", code, err)
+	}
+
+	got := receive(t, received)
+	checkEnvelope(t, got, []string{"ops@example.com", "dev@example.com"})
+	msg, text := parseEmail(t, got.data)
+
+	headers := map[string]string{
+		"From":                 "Checkmate <alerts@example.com>",
+		"To":                   "ops@example.com, dev@example.com",
+		"X-Checkmate-Event":    "deployment.failed",
+		"X-Checkmate-Delivery": "42",
+	}
+	for name, want := range headers {
+		if v := msg.Header.Get(name); v != want {
+			t.Errorf("%s header %q, want %q", name, v, want)
+		}
+	}
+	if !strings.HasSuffix(msg.Header.Get("Message-ID"), "@example.com>") {
+		t.Errorf("Message-ID %q isn't on the sender domain", msg.Header.Get("Message-ID"))
+	}
+	if s := subject(t, msg); s != "[checkmate] api failed" {
+		t.Errorf("subject %q, want [checkmate] api failed", s)
+	}
+	for _, want := range []string{"api failed", "Service:   api", "Branch:    main", "0123456 break things"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("text part doesn't have %q:\n%s", want, text)
+		}
+	}
+}
+
+func TestEmailDigestDelivery(t *testing.T) {
+	openTestDB(t)
+	received := startFakeSMTP(t)
+	cred := createTestCredential(t, "user-digest")
+	render := startFakeRender(t, renderService("srv-1", "api", "live"), renderService("srv-2", "worker", "live"))
+	ctx := context.Background()
+
+	for _, status := range []string{"live", "failed"} {
+		render.setStatus("srv-2", status)
+		if _, _, err := GetFreshOrUpdateCache(ctx, cred, true); err != nil {
+			t.Fatalf("refresh: %v", err)
+		}
+	}
+
+	now := time.Now()
+	hook := &model.Webhook{UserID: cred.UserID, Type: model.WebhookTypeEmail, URL: "mailto:ops@example.com"}
+	msg, err := buildDigest(ctx, hook, now.Add(-digestWindow), now.Add(time.Minute))
+	if err != nil {
+		t.Fatalf("build digest: %v", err)
+	}
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		t.Fatalf("encode digest: %v", err)
+	}
+
+	code, err := sendEmailDelivery(ctx, &storage.ClaimedDelivery{
+		Delivery: model.WebhookDelivery{ID: 43, EventType: model.WebhookEventDigest, Payload: payload},
+		Webhook:  *hook,
+	})
+	if err != nil || code != 250 {
+		t.Fatalf("send: code %d, %v", code, err)
+	}
+
+	got := receive(t, received)
+	checkEnvelope(t, got, []string{"ops@example.com"})
+	email, text := parseEmail(t, got.data)
+
+	if v := email.Header.Get("X-Checkmate-Event"); v != "digest.daily" {
+		t.Errorf("X-Checkmate-Event %q, want digest.daily", v)
+	}
+	if s := subject(t, email); !strings.HasPrefix(s, "[checkmate] Daily digest for ") || !strings.HasSuffix(s, ": 1 failures") {
+		t.Errorf("subject %q, want the daily digest with 1 failure", s)
+	}
+	for _, want := range []string{"Deployments: 2 (1 live, 1 failing", "1 failures", "worker (render, ", "api (render, "} {
+		if !strings.Contains(text, want) {
+			t.Errorf("text part doesn't have %q:\n%s", want, text)
+		}
+	}
+	// failing deployments are listed first
+	if strings.Index(text, "worker (render") > strings.Index(text, "api (render") {
+		t.Errorf("failing deployment isn't listed first:\n%s", text)
+	}
+}
@@ -0,0 +1,33 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+)
+
+//Errors returned to the handlers
+// -> every error a client can do something about matches one of these sentinels with errors.Is,
+// the handlers map them to a status code, anything else is an internal error
+
+var (
+	ErrInvalidInput        = errors.New("invalid input")
+	ErrInvalidCredential   = errors.New("invalid credential")
+	ErrNotFound            = errors.New("not found")
+	ErrForbidden           = errors.New("forbidden")
+	ErrConflict            = errors.New("conflict")
+	ErrUpstreamUnavailable = errors.New("upstream unavailable")
+)
+
+// error with a message meant for the client that still matches its sentinel
+type serviceError struct {
+	kind    error
+	message string
+}
+
+func (e *serviceError) Error() string { return e.message }
+func (e *serviceError) Unwrap() error { return e.kind }
+
+// newError(ErrNotFound, "credential %d not found", id)
+func newError(kind error, format string, args ...interface{}) error {
+	return &serviceError{kind: kind, message: fmt.Sprintf(format, args...)}
+}
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"checkmate/api/internal/model"
+	"checkmate/api/internal/storage"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+//Deployment status history -> computed by diffing fresh platform data against the cache
+
+const (
+	DefaultDeploymentEventsLimit = 100
+	MaxDeploymentEventsLimit     = 1000
+)
+
+// adds deploy id and commit to already stored events, best effort -> an event without commit is better than no event
+func enrichDeploymentEvents(ctx context.Context, cred *model.PlatformCredential, events []model.DeploymentEvent) {
+	logger := log.WithFields(log.Fields{
+		"func":          "enrichDeploymentEvents",
+		"credential_id": cred.ID,
+		"request_id":    ctx.Value("request_id"),
+	})
+
+	for i := range events {
+		// nothing to look up for a deployment that no longer exists
+		if events[i].NewStatus == model.DeploymentStatusGone {
+			continue
+		}
+
+		deploy, err := fetchLatestDeployFromPlatform(ctx, cred, events[i].DeploymentID)
+		if err != nil {
+			logger.WithError(err).WithField("deployment_id", events[i].DeploymentID).Warn("Failed to get latest deploy for event")
+			continue
+		}
+		if deploy == nil {
+			continue
+		}
+
+		events[i].DeployID = deploy.ID
+		events[i].CommitID = deploy.CommitID
+		events[i].CommitMessage = deploy.CommitMessage
+
+		if err := storage.Deployments.SetEventDeploy(ctx, events[i].ID, deploy); err != nil {
+			logger.WithError(err).WithField("event_id", events[i].ID).Warn("Failed to save deploy of event")
+		}
+	}
+}
+
+// gets the status history of the user's deployments, newest first
+func GetDeploymentEvents(ctx context.Context, userID string, filter model.DeploymentEventFilter) ([]model.DeploymentEvent, error) {
+	logger := log.WithFields(log.Fields{
+		"func":       "GetDeploymentEvents",
+		"user_id":    userID,
+		"request_id": ctx.Value("request_id"),
+	})
+
+	logger.Debug("Getting deployment events started")
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = DefaultDeploymentEventsLimit
+	} else if limit > MaxDeploymentEventsLimit {
+		limit = MaxDeploymentEventsLimit
+	}
+	filter.Limit = limit
+
+	events, err := storage.Deployments.ListEvents(ctx, userID, filter)
+	if err != nil {
+		logger.WithError(err).Error("Failed to query deployment events")
+		return nil, fmt.Errorf("failed to query deployment events: %w", err)
+	}
+
+	logger.WithField("events_count", len(events)).Debug("Retrieved deployment events successfully")
+	return events, nil
+}
+
+// acknowledges a failure event of the user (an alert seen from the dashboard)
+func AcknowledgeDeploymentEvent(ctx context.Context, userID string, eventID int64) (*model.DeploymentEvent, error) {
+	logger := log.WithFields(log.Fields{
+		"func":       "AcknowledgeDeploymentEvent",
+		"user_id":    userID,
+		"event_id":   eventID,
+		"request_id": ctx.Value("request_id"),
+	})
+
+	event, err := storage.Deployments.AcknowledgeEvent(ctx, userID, eventID, time.Now())
+	if errors.Is(err, sql.ErrNoRows) {
+		// other users' events and non failures look the same as missing ones
+		logger.Warn("Failure event not found")
+		return nil, newError(ErrNotFound, "failure event %d not found", eventID)
+	} else if err != nil {
+		logger.WithError(err).Error("Failed to acknowledge event")
+		return nil, fmt.Errorf("failed to acknowledge event: %w", err)
+	}
+
+	logger.Info("Failure event acknowledged")
+	return event, nil
+}
@@ -0,0 +1,129 @@
+package service
+
+import (
+	"checkmate/api/internal/model"
+	"checkmate/api/internal/platform"
+	"checkmate/api/internal/storage"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fresh sqlite database with the schema, the storage globals point at it for the duration of the test
+func openTestDB(t *testing.T) {
+	t.Helper()
+	t.Setenv("DATABASE_URL", "")
+	t.Setenv("SQLITE_PATH", filepath.Join(t.TempDir(), "checkmate.db"))
+	if err := storage.Open(); err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	if _, err := storage.MigrateUp(context.Background()); err != nil {
+		t.Fatalf("migrate db: %v", err)
+	}
+	t.Cleanup(func() { storage.DB.Close() })
+}
+
+// user with one render credential, the api key is stored as is (the services get it decrypted)
+func createTestCredential(t *testing.T, userID string) *model.PlatformCredential {
+	t.Helper()
+	ctx := context.Background()
+	if err := storage.Users.Create(ctx, &model.User{ID: userID, Email: userID + "@example.com", CreatedAt: time.Now()}); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	cred := &model.PlatformCredential{UserID: userID, Name: "render", Platform: "render", APIKey: "rnd_" + userID, CreatedAt: time.Now()}
+	id, err := storage.Credentials.Create(ctx, cred)
+	if err != nil {
+		t.Fatalf("create credential: %v", err)
+	}
+	cred.ID = id
+	// ids restart with every database, the breakers are kept per id
+	t.Cleanup(func() { resetBreaker(id) })
+	return cred
+}
+
+// moves the last refresh of the credential's cache back by age
+func ageCache(t *testing.T, credentialID int, age time.Duration) {
+	t.Helper()
+	_, err := storage.DB.ExecContext(context.Background(),
+		`UPDATE platform_credentials SET cache_refreshed_at = ? WHERE id = ?`, time.Now().Add(-age).UTC(), credentialID)
+	if err != nil {
+		t.Fatalf("age cache: %v", err)
+	}
+}
+
+// render api stand-in serving the given services, counts the GET /services calls
+type fakeRender struct {
+	mu       sync.Mutex
+	services []model.RenderService
+	delay    time.Duration // held before answering GET /services
+
+	listCalls  atomic.Int32
+	failStatus atomic.Int32 // GET /services answers with this status when set, 401 isn't retried by the client
+}
+
+func startFakeRender(t *testing.T, services ...model.RenderService) *fakeRender {
+	t.Helper()
+	f := &fakeRender{services: services}
+	srv := httptest.NewServer(http.HandlerFunc(f.serveHTTP))
+	previous := platform.RenderAPIBaseURL
+	platform.RenderAPIBaseURL = srv.URL
+	t.Cleanup(func() {
+		platform.RenderAPIBaseURL = previous
+		srv.Close()
+	})
+	return f
+}
+
+func (f *fakeRender) setStatus(id, status string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i := range f.services {
+		if f.services[i].ID == id {
+			f.services[i].Status = status
+			f.services[i].UpdatedAt = time.Now()
+		}
+	}
+}
+
+// replaces what GET /services returns
+func (f *fakeRender) setServices(services ...model.RenderService) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.services = services
+}
+
+func (f *fakeRender) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case r.URL.Path == "/services":
+		f.listCalls.Add(1)
+		time.Sleep(f.delay)
+		if status := f.failStatus.Load(); status != 0 {
+			http.Error(w, `{"message":"unauthorized"}`, int(status))
+			return
+		}
+		f.mu.Lock()
+		list := make([]model.RenderServiceResponse, 0, len(f.services))
+		for _, s := range f.services {
+			list = append(list, model.RenderServiceResponse{Service: s})
+		}
+		f.mu.Unlock()
+		json.NewEncoder(w).Encode(list)
+	case strings.HasSuffix(r.URL.Path, "/deploys"):
+		w.Write([]byte("[]"))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func renderService(id, name, status string) model.RenderService {
+	now := time.Now()
+	return model.RenderService{ID: id, Name: name, Type: "web_service", Branch: "main", Status: status, CreatedAt: now.Add(-time.Hour), UpdatedAt: now}
+}
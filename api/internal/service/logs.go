@@ -0,0 +1,151 @@
+package service
+
+import (
+	"checkmate/api/internal/model"
+	"checkmate/api/internal/platform"
+	"checkmate/api/internal/storage"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+//Deployment logs -> the platforms only have polling apis, a tail polls from the last line it has seen
+
+const (
+	DefaultLogPollInterval = 5 * time.Second
+	// lines from before the subscription that are sent first
+	logTailBacklog = 5 * time.Minute
+	logPageSize    = 100
+)
+
+// how often a log tail asks the platform for new lines -> LOG_POLL_INTERVAL
+var LogPollInterval = DefaultLogPollInterval
+
+// loads log settings from the environment -> LOG_POLL_INTERVAL
+func InitLogSettings() error {
+	var err error
+	LogPollInterval, err = durationFromEnv("LOG_POLL_INTERVAL", DefaultLogPollInterval)
+	return err
+}
+
+// follows the logs of one deployment, created by OpenDeploymentLogs
+type LogTail struct {
+	CredentialID int
+	DeploymentID string
+
+	fetch func(ctx context.Context, start time.Time) (*model.LogPage, error)
+}
+
+// checks that the deployment belongs to the user and its platform has logs, nothing is sent yet
+func OpenDeploymentLogs(ctx context.Context, userID string, credentialID int, deploymentID string) (*LogTail, error) {
+	logger := log.WithFields(log.Fields{
+		"func":          "OpenDeploymentLogs",
+		"user_id":       userID,
+		"credential_id": credentialID,
+		"deployment_id": deploymentID,
+		"request_id":    ctx.Value("request_id"),
+	})
+
+	// ownership check, someone else's credential is a plain not found
+	cred, err := GetPlatformCredentialByID(ctx, credentialID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := storage.Deployments.Get(ctx, credentialID, deploymentID); errors.Is(err, sql.ErrNoRows) {
+		logger.Debug("Deployment not found in cache")
+		return nil, newError(ErrNotFound, "deployment %s not found", deploymentID)
+	} else if err != nil {
+		logger.WithError(err).Error("Failed to get cached deployment")
+		return nil, fmt.Errorf("failed to get cached deployment: %w", err)
+	}
+
+	tail := &LogTail{CredentialID: cred.ID, DeploymentID: deploymentID}
+
+	switch cred.Platform {
+	case "render":
+		client := platform.NewRenderProvider(cred.APIKey)
+
+		breaker := breakerFor(cred.ID)
+		if !breaker.allow() {
+			return nil, ErrCircuitOpen
+		}
+		// the logs api is queried by workspace
+		ownerID, err := client.GetServiceOwner(ctx, deploymentID)
+		if errors.Is(err, platform.ErrNotFound) {
+			breaker.recordSuccess(cred.ID)
+			return nil, newError(ErrNotFound, "deployment %s no longer exists on the platform", deploymentID)
+		} else if err != nil {
+			breaker.recordFailure(cred.ID)
+			logger.WithError(err).Warn("Failed to get service owner")
+			return nil, newError(ErrUpstreamUnavailable, "platform unavailable, can't read logs")
+		}
+		breaker.recordSuccess(cred.ID)
+
+		tail.fetch = func(ctx context.Context, start time.Time) (*model.LogPage, error) {
+			return client.GetLogs(ctx, ownerID, deploymentID, start, logPageSize)
+		}
+
+	case "vercel":
+		// TODO: Implement Vercel client
+		return nil, newError(ErrInvalidInput, "logs are not supported for vercel yet")
+
+	default:
+		return nil, newError(ErrInvalidInput, "unsupported platform: %s", cred.Platform)
+	}
+
+	return tail, nil
+}
+
+// polls the platform until ctx ends or send fails, send gets each batch of new lines oldest first
+// the next poll only starts once send returns, a slow client slows the tail down instead of piling lines up
+func (t *LogTail) Run(ctx context.Context, send func([]model.LogLine) error) error {
+	logger := log.WithFields(log.Fields{
+		"func":          "LogTail.Run",
+		"credential_id": t.CredentialID,
+		"deployment_id": t.DeploymentID,
+		"request_id":    ctx.Value("request_id"),
+	})
+
+	start := time.Now().Add(-logTailBacklog)
+	breaker := breakerFor(t.CredentialID)
+
+	for {
+		if breaker.allow() {
+			page, err := t.fetch(ctx, start)
+			switch {
+			case ctx.Err() != nil:
+				return nil
+			case errors.Is(err, platform.ErrNotFound):
+				breaker.recordSuccess(t.CredentialID)
+				return newError(ErrNotFound, "deployment %s no longer exists on the platform", t.DeploymentID)
+			case err != nil:
+				// keep the tail, the next poll starts from the same point
+				breaker.recordFailure(t.CredentialID)
+				logger.WithError(err).Warn("Failed to fetch logs")
+			default:
+				breaker.recordSuccess(t.CredentialID)
+				if len(page.Lines) > 0 {
+					if err := send(page.Lines); err != nil {
+						return err
+					}
+				}
+				start = page.Next
+				// a full page means the platform has more right now, no need to wait
+				if page.HasMore {
+					continue
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(LogPollInterval):
+		}
+	}
+}
@@ -0,0 +1,259 @@
+package service
+
+import (
+	"checkmate/api/internal/model"
+	"checkmate/api/internal/storage"
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+//Retention of the deployment history -> a background job prunes and downsamples old events,
+// drops long gone deployments from the cache and keeps the database compact
+
+const (
+	DefaultEventMaxAge          = 90 * 24 * time.Hour
+	DefaultEventsPerDeployment  = 1000
+	DefaultDownsampleAfter      = 30 * 24 * time.Hour
+	DefaultGoneDeploymentMaxAge = 30 * 24 * time.Hour
+	DefaultDeliveryMaxAge       = 30 * 24 * time.Hour
+	DefaultCompactionInterval   = 24 * time.Hour
+	DefaultVacuumInterval       = 7 * 24 * time.Hour
+)
+
+// retention rules, a zero value disables the rule
+var (
+	EventMaxAge          = DefaultEventMaxAge
+	EventsPerDeployment  = DefaultEventsPerDeployment
+	DownsampleAfter      = DefaultDownsampleAfter
+	GoneDeploymentMaxAge = DefaultGoneDeploymentMaxAge
+	DeliveryMaxAge       = DefaultDeliveryMaxAge
+	CompactionInterval   = DefaultCompactionInterval
+	VacuumInterval       = DefaultVacuumInterval
+)
+
+// state of the compaction job, shown by the admin endpoint
+var compaction struct {
+	running sync.Mutex // one run at a time, scheduled or manual
+
+	mu         sync.Mutex
+	lastRun    *model.CompactionResult
+	lastVacuum time.Time
+	nextRun    time.Time
+}
+
+// loads the retention policy from the environment
+// RETENTION_EVENT_MAX_AGE, RETENTION_DOWNSAMPLE_AFTER, RETENTION_GONE_DEPLOYMENT_MAX_AGE, RETENTION_DELIVERY_MAX_AGE,
+// COMPACTION_INTERVAL and VACUUM_INTERVAL are go durations, RETENTION_EVENTS_PER_DEPLOYMENT is a count, 0 disables any of them
+func InitRetentionSettings() error {
+	var err error
+
+	if EventMaxAge, err = durationFromEnv("RETENTION_EVENT_MAX_AGE", DefaultEventMaxAge); err != nil {
+		return err
+	}
+
+	EventsPerDeployment = DefaultEventsPerDeployment
+	if v := os.Getenv("RETENTION_EVENTS_PER_DEPLOYMENT"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid RETENTION_EVENTS_PER_DEPLOYMENT %q", v)
+		}
+		EventsPerDeployment = n
+	}
+
+	if DownsampleAfter, err = durationFromEnv("RETENTION_DOWNSAMPLE_AFTER", DefaultDownsampleAfter); err != nil {
+		return err
+	}
+
+	if GoneDeploymentMaxAge, err = durationFromEnv("RETENTION_GONE_DEPLOYMENT_MAX_AGE", DefaultGoneDeploymentMaxAge); err != nil {
+		return err
+	}
+
+	if DeliveryMaxAge, err = durationFromEnv("RETENTION_DELIVERY_MAX_AGE", DefaultDeliveryMaxAge); err != nil {
+		return err
+	}
+
+	if CompactionInterval, err = durationFromEnv("COMPACTION_INTERVAL", DefaultCompactionInterval); err != nil {
+		return err
+	}
+
+	if VacuumInterval, err = durationFromEnv("VACUUM_INTERVAL", DefaultVacuumInterval); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// current policy as returned by the api
+func CurrentRetentionPolicy() model.RetentionPolicy {
+	return model.RetentionPolicy{
+		EventMaxAgeSeconds:          int64(EventMaxAge.Seconds()),
+		EventsPerDeployment:         EventsPerDeployment,
+		DownsampleAfterSeconds:      int64(DownsampleAfter.Seconds()),
+		GoneDeploymentMaxAgeSeconds: int64(GoneDeploymentMaxAge.Seconds()),
+		DeliveryMaxAgeSeconds:       int64(DeliveryMaxAge.Seconds()),
+		CompactionIntervalSeconds:   int64(CompactionInterval.Seconds()),
+		VacuumIntervalSeconds:       int64(VacuumInterval.Seconds()),
+	}
+}
+
+// runs the compaction every CompactionInterval until ctx is cancelled, no-op when the interval is 0
+func StartCompaction(ctx context.Context) {
+	if CompactionInterval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(CompactionInterval)
+		defer ticker.Stop()
+
+		setNextCompaction(time.Now().Add(CompactionInterval))
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				setNextCompaction(time.Now().Add(CompactionInterval))
+				// errors are logged and kept in the last run, the next tick tries again
+				RunCompaction(ctx)
+			}
+		}
+	}()
+}
+
+func setNextCompaction(t time.Time) {
+	compaction.mu.Lock()
+	compaction.nextRun = t
+	compaction.mu.Unlock()
+}
+
+// applies the retention policy once
+// order matters: downsampling before the per deployment limit so the limit counts what is left
+func RunCompaction(ctx context.Context) (*model.CompactionResult, error) {
+	logger := log.WithFields(log.Fields{
+		"func":       "RunCompaction",
+		"request_id": ctx.Value("request_id"),
+	})
+
+	compaction.running.Lock()
+	defer compaction.running.Unlock()
+
+	logger.Info("Compaction started")
+
+	now := time.Now()
+	result := &model.CompactionResult{StartedAt: now.UTC()}
+	err := compact(ctx, logger, now, result)
+	result.DurationMs = time.Since(now).Milliseconds()
+	if err != nil {
+		result.Error = err.Error()
+		logger.WithError(err).Error("Compaction failed")
+	}
+
+	compaction.mu.Lock()
+	compaction.lastRun = result
+	if result.Vacuumed {
+		compaction.lastVacuum = now
+	}
+	compaction.mu.Unlock()
+
+	if err != nil {
+		return result, err
+	}
+
+	logger.WithFields(log.Fields{
+		"expired_events":     result.ExpiredEvents,
+		"downsampled_events": result.DownsampledEvents,
+		"trimmed_events":     result.TrimmedEvents,
+		"removed_gone":       result.RemovedGone,
+		"expired_deliveries": result.ExpiredDeliveries,
+		"vacuumed":           result.Vacuumed,
+		"duration_ms":        result.DurationMs,
+	}).Info("Compaction finished")
+	return result, nil
+}
+
+func compact(ctx context.Context, logger *log.Entry, now time.Time, result *model.CompactionResult) error {
+	var err error
+
+	if EventMaxAge > 0 {
+		if result.ExpiredEvents, err = storage.Maintenance.DeleteEventsBefore(ctx, now.Add(-EventMaxAge)); err != nil {
+			return fmt.Errorf("failed to delete expired events: %w", err)
+		}
+	}
+
+	if DownsampleAfter > 0 {
+		if result.DownsampledEvents, err = storage.Maintenance.DownsampleEventsBefore(ctx, now.Add(-DownsampleAfter)); err != nil {
+			return fmt.Errorf("failed to downsample events: %w", err)
+		}
+	}
+
+	if EventsPerDeployment > 0 {
+		if result.TrimmedEvents, err = storage.Maintenance.TrimEventsPerDeployment(ctx, EventsPerDeployment); err != nil {
+			return fmt.Errorf("failed to trim events per deployment: %w", err)
+		}
+	}
+
+	if GoneDeploymentMaxAge > 0 {
+		if result.RemovedGone, err = storage.Maintenance.DeleteGoneDeploymentsBefore(ctx, now.Add(-GoneDeploymentMaxAge)); err != nil {
+			return fmt.Errorf("failed to remove gone deployments: %w", err)
+		}
+	}
+
+	if DeliveryMaxAge > 0 {
+		if result.ExpiredDeliveries, err = storage.Maintenance.DeleteWebhookDeliveriesBefore(ctx, now.Add(-DeliveryMaxAge)); err != nil {
+			return fmt.Errorf("failed to delete expired webhook deliveries: %w", err)
+		}
+	}
+
+	if err := storage.Maintenance.Analyze(ctx); err != nil {
+		return fmt.Errorf("failed to analyze database: %w", err)
+	}
+	result.Analyzed = true
+
+	compaction.mu.Lock()
+	lastVacuum := compaction.lastVacuum
+	compaction.mu.Unlock()
+
+	// first run after a start counts as due, the last vacuum time isn't persisted
+	if VacuumInterval > 0 && now.Sub(lastVacuum) >= VacuumInterval {
+		logger.Debug("Vacuuming database")
+		if err := storage.Maintenance.Vacuum(ctx); err != nil {
+			return fmt.Errorf("failed to vacuum database: %w", err)
+		}
+		result.Vacuumed = true
+	}
+
+	return nil
+}
+
+// policy, table sizes and compaction state for the admin endpoint
+func GetRetentionStatus(ctx context.Context) (*model.RetentionStatus, error) {
+	stats, err := storage.Maintenance.Stats(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get storage stats: %w", err)
+	}
+
+	status := &model.RetentionStatus{
+		Policy:  CurrentRetentionPolicy(),
+		Storage: stats,
+	}
+
+	compaction.mu.Lock()
+	defer compaction.mu.Unlock()
+
+	status.LastRun = compaction.lastRun
+	if !compaction.nextRun.IsZero() {
+		next := compaction.nextRun
+		status.NextRunAt = &next
+	}
+	if !compaction.lastVacuum.IsZero() {
+		lastVacuum := compaction.lastVacuum
+		status.LastVacuumAt = &lastVacuum
+	}
+	return status, nil
+}
@@ -0,0 +1,813 @@
+package service
+
+import (
+	"checkmate/api/internal/model"
+	"checkmate/api/internal/storage"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+	"time"
+	_ "time/tzdata" // rule timezones also resolve in containers without zoneinfo
+
+	log "github.com/sirupsen/logrus"
+)
+
+//Notification rules -> once a user has enabled rules they decide which webhooks an event goes to
+// a webhook still needs to subscribe to the event type and pass its own filters, then for that webhook:
+// any matching mute rule drops the event, and when notify rules apply to the webhook one of them has to match
+// notify rules can drop repeats within a window (flapping services alert once) and escalate failures that last
+
+const (
+	MaxRulesPerUser      = 50
+	MaxRuleNameLength    = 100
+	MaxRulePatterns      = 20
+	MaxRulePatternLength = 200
+	MaxDedupMinutes      = 24 * 60
+	MaxEscalateMinutes   = 7 * 24 * 60
+
+	// how often due escalations are looked for, an escalation is at most this late
+	escalationCheckInterval = time.Minute
+	escalationBatchSize     = 100
+)
+
+// event types a rule can match, the deployment ones webhooks subscribe to
+var ruleEventTypes = []model.WebhookEventType{
+	model.WebhookEventDeploymentFailed,
+	model.WebhookEventDeploymentRecovered,
+	model.WebhookEventDeploymentDeploying,
+	model.WebhookEventDeploymentSucceeded,
+}
+
+// checks a rule input, names and patterns are trimmed and the lists deduplicated
+// the credentials and webhooks it points at are checked against the user's in checkRuleReferences
+func ValidateNotificationRuleInput(input *model.NotificationRuleInput) error {
+	input.Name = strings.TrimSpace(input.Name)
+	if input.Name == "" {
+		return newError(ErrInvalidInput, "name is required")
+	}
+	if len([]rune(input.Name)) > MaxRuleNameLength {
+		return newError(ErrInvalidInput, "name is too long (max %d characters)", MaxRuleNameLength)
+	}
+
+	switch input.Action {
+	case model.NotificationRuleNotify, model.NotificationRuleMute:
+	default:
+		return newError(ErrInvalidInput, "invalid action %q, expected notify or mute", input.Action)
+	}
+
+	var err error
+	if input.Branches, err = rulePatterns("branches", input.Branches); err != nil {
+		return err
+	}
+	if input.Services, err = rulePatterns("services", input.Services); err != nil {
+		return err
+	}
+	if input.EventTypes, err = ruleEventTypeList("eventTypes", input.EventTypes); err != nil {
+		return err
+	}
+	if input.ExceptEventTypes, err = ruleEventTypeList("exceptEventTypes", input.ExceptEventTypes); err != nil {
+		return err
+	}
+	for _, t := range input.ExceptEventTypes {
+		if slices.Contains(input.EventTypes, t) {
+			return newError(ErrInvalidInput, "%s can't be in both eventTypes and exceptEventTypes", t)
+		}
+	}
+
+	if s := input.Schedule; s != nil {
+		s.Start = strings.TrimSpace(s.Start)
+		s.End = strings.TrimSpace(s.End)
+		s.Timezone = strings.TrimSpace(s.Timezone)
+		if _, err := scheduleMinutes(s.Start); err != nil {
+			return newError(ErrInvalidInput, "schedule start must be HH:MM")
+		}
+		if _, err := scheduleMinutes(s.End); err != nil {
+			return newError(ErrInvalidInput, "schedule end must be HH:MM")
+		}
+		if s.Start == s.End {
+			return newError(ErrInvalidInput, "schedule start and end must differ")
+		}
+		if s.Timezone == "" {
+			s.Timezone = "UTC"
+		}
+		if _, err := time.LoadLocation(s.Timezone); err != nil || strings.EqualFold(s.Timezone, "local") {
+			return newError(ErrInvalidInput, "unknown timezone %q", s.Timezone)
+		}
+	}
+
+	input.CredentialIDs = uniqueIDs(input.CredentialIDs)
+	input.WebhookIDs = uniqueIDs(input.WebhookIDs)
+	input.EscalateWebhookIDs = uniqueIDs(input.EscalateWebhookIDs)
+
+	if input.DedupMinutes < 0 || input.DedupMinutes > MaxDedupMinutes {
+		return newError(ErrInvalidInput, "dedupMinutes must be between 0 and %d", MaxDedupMinutes)
+	}
+	if input.EscalateAfterMinutes < 0 || input.EscalateAfterMinutes > MaxEscalateMinutes {
+		return newError(ErrInvalidInput, "escalateAfterMinutes must be between 0 and %d", MaxEscalateMinutes)
+	}
+	if input.Action == model.NotificationRuleMute && (input.DedupMinutes > 0 || input.EscalateAfterMinutes > 0 || len(input.EscalateWebhookIDs) > 0) {
+		return newError(ErrInvalidInput, "dedupMinutes and escalation are for notify rules only")
+	}
+	if input.EscalateAfterMinutes > 0 && len(input.EscalateWebhookIDs) == 0 {
+		return newError(ErrInvalidInput, "escalateWebhookIds is required with escalateAfterMinutes")
+	}
+	if input.EscalateAfterMinutes == 0 && len(input.EscalateWebhookIDs) > 0 {
+		return newError(ErrInvalidInput, "escalateWebhookIds needs escalateAfterMinutes")
+	}
+	return nil
+}
+
+// trimmed, deduplicated glob patterns, path.Match syntax
+func rulePatterns(field string, patterns []string) ([]string, error) {
+	if len(patterns) > MaxRulePatterns {
+		return nil, newError(ErrInvalidInput, "too many %s (max %d)", field, MaxRulePatterns)
+	}
+	list := []string{}
+	for _, p := range patterns {
+		p = strings.TrimSpace(p)
+		if p == "" || slices.Contains(list, p) {
+			continue
+		}
+		if len(p) > MaxRulePatternLength {
+			return nil, newError(ErrInvalidInput, "%s pattern is too long (max %d characters)", field, MaxRulePatternLength)
+		}
+		// lists are stored comma separated
+		if strings.Contains(p, ",") {
+			return nil, newError(ErrInvalidInput, "%s pattern %q can't contain a comma", field, p)
+		}
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, newError(ErrInvalidInput, "invalid %s pattern %q", field, p)
+		}
+		list = append(list, p)
+	}
+	return list, nil
+}
+
+func ruleEventTypeList(field string, types []model.WebhookEventType) ([]model.WebhookEventType, error) {
+	list := []model.WebhookEventType{}
+	for _, t := range types {
+		if !slices.Contains(ruleEventTypes, t) {
+			return nil, newError(ErrInvalidInput, "invalid event type %q in %s", t, field)
+		}
+		if !slices.Contains(list, t) {
+			list = append(list, t)
+		}
+	}
+	return list, nil
+}
+
+func uniqueIDs(ids []int) []int {
+	list := []int{}
+	for _, id := range ids {
+		if !slices.Contains(list, id) {
+			list = append(list, id)
+		}
+	}
+	return list
+}
+
+// minutes since midnight of HH:MM
+func scheduleMinutes(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil || len(s) != 5 {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// the credentials and webhooks of the rule have to be the user's
+func checkRuleReferences(ctx context.Context, logger *log.Entry, userID string, input *model.NotificationRuleInput) error {
+	if err := checkWebhookCredentials(ctx, logger, userID, input.CredentialIDs); err != nil {
+		return err
+	}
+	if len(input.WebhookIDs) == 0 && len(input.EscalateWebhookIDs) == 0 {
+		return nil
+	}
+	webhooks, err := storage.Webhooks.ListByUser(ctx, userID)
+	if err != nil {
+		logger.WithError(err).Error("Failed to query webhooks")
+		return fmt.Errorf("failed to query webhooks: %w", err)
+	}
+	owned := make(map[int]bool, len(webhooks))
+	for _, hook := range webhooks {
+		owned[hook.ID] = true
+	}
+	for _, id := range append(slices.Clone(input.WebhookIDs), input.EscalateWebhookIDs...) {
+		if !owned[id] {
+			return newError(ErrInvalidInput, "webhook %d not found", id)
+		}
+	}
+	return nil
+}
+
+// copies the validated input, enabled is left to the caller
+func applyRuleInput(rule *model.NotificationRule, input *model.NotificationRuleInput) {
+	rule.Name = input.Name
+	rule.Action = input.Action
+	rule.CredentialIDs = input.CredentialIDs
+	rule.Branches = input.Branches
+	rule.Services = input.Services
+	rule.EventTypes = input.EventTypes
+	rule.ExceptEventTypes = input.ExceptEventTypes
+	rule.Schedule = input.Schedule
+	rule.WebhookIDs = input.WebhookIDs
+	rule.DedupMinutes = input.DedupMinutes
+	rule.EscalateAfterMinutes = input.EscalateAfterMinutes
+	rule.EscalateWebhookIDs = input.EscalateWebhookIDs
+}
+
+func GetNotificationRules(ctx context.Context, userID string) ([]model.NotificationRule, error) {
+	logger := log.WithFields(log.Fields{
+		"func":       "GetNotificationRules",
+		"user_id":    userID,
+		"request_id": ctx.Value("request_id"),
+	})
+
+	rules, err := storage.Rules.ListByUser(ctx, userID)
+	if err != nil {
+		logger.WithError(err).Error("Failed to query notification rules")
+		return nil, fmt.Errorf("failed to query notification rules: %w", err)
+	}
+
+	logger.WithField("rules_count", len(rules)).Debug("Retrieved notification rules successfully")
+	return rules, nil
+}
+
+func CreateNotificationRule(ctx context.Context, userID string, input *model.NotificationRuleInput) (*model.NotificationRule, error) {
+	logger := log.WithFields(log.Fields{
+		"func":       "CreateNotificationRule",
+		"user_id":    userID,
+		"request_id": ctx.Value("request_id"),
+	})
+
+	logger.Debug("Creating notification rule started")
+
+	if err := ValidateNotificationRuleInput(input); err != nil {
+		logger.WithError(err).Warn("Validation failed for notification rule")
+		return nil, err
+	}
+
+	existing, err := storage.Rules.ListByUser(ctx, userID)
+	if err != nil {
+		logger.WithError(err).Error("Failed to query notification rules")
+		return nil, fmt.Errorf("failed to query notification rules: %w", err)
+	}
+	if len(existing) >= MaxRulesPerUser {
+		logger.Warn("Notification rule limit reached")
+		return nil, newError(ErrConflict, "notification rule limit reached (max %d)", MaxRulesPerUser)
+	}
+	if err := checkRuleReferences(ctx, logger, userID, input); err != nil {
+		return nil, err
+	}
+
+	rule := &model.NotificationRule{
+		UserID:    userID,
+		Enabled:   input.Enabled == nil || *input.Enabled,
+		CreatedAt: time.Now(),
+	}
+	applyRuleInput(rule, input)
+
+	rule.ID, err = storage.Rules.Create(ctx, rule)
+	if err != nil {
+		logger.WithError(err).Error("Failed to create notification rule in database")
+		return nil, fmt.Errorf("failed to create notification rule: %w", err)
+	}
+
+	logger.WithFields(log.Fields{
+		"rule_id": rule.ID,
+		"action":  rule.Action,
+	}).Info("Notification rule created successfully")
+	return rule, nil
+}
+
+// replaces the rule, enabled only changes when it is set
+// escalations already pending stay, they are checked against the rule when due
+func UpdateNotificationRule(ctx context.Context, id int, userID string, input *model.NotificationRuleInput) (*model.NotificationRule, error) {
+	logger := log.WithFields(log.Fields{
+		"func":       "UpdateNotificationRule",
+		"rule_id":    id,
+		"user_id":    userID,
+		"request_id": ctx.Value("request_id"),
+	})
+
+	logger.Debug("Updating notification rule started")
+
+	if err := ValidateNotificationRuleInput(input); err != nil {
+		logger.WithError(err).Warn("Validation failed for notification rule")
+		return nil, err
+	}
+
+	rule, err := storage.Rules.GetByID(ctx, id, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		logger.Warn("Notification rule not found")
+		return nil, newError(ErrNotFound, "notification rule %d not found", id)
+	} else if err != nil {
+		logger.WithError(err).Error("Failed to get notification rule")
+		return nil, fmt.Errorf("failed to get notification rule: %w", err)
+	}
+	if err := checkRuleReferences(ctx, logger, userID, input); err != nil {
+		return nil, err
+	}
+
+	applyRuleInput(rule, input)
+	if input.Enabled != nil {
+		rule.Enabled = *input.Enabled
+	}
+
+	found, err := storage.Rules.Update(ctx, rule)
+	if err != nil {
+		logger.WithError(err).Error("Failed to update notification rule in database")
+		return nil, fmt.Errorf("failed to update notification rule: %w", err)
+	}
+	// deleted in between
+	if !found {
+		logger.Warn("Notification rule not found")
+		return nil, newError(ErrNotFound, "notification rule %d not found", id)
+	}
+
+	logger.Info("Notification rule updated successfully")
+	return rule, nil
+}
+
+// removes the rule, its pending escalations are dropped with it
+func DeleteNotificationRule(ctx context.Context, id int, userID string) error {
+	logger := log.WithFields(log.Fields{
+		"func":       "DeleteNotificationRule",
+		"rule_id":    id,
+		"user_id":    userID,
+		"request_id": ctx.Value("request_id"),
+	})
+
+	found, err := storage.Rules.Delete(ctx, id, userID)
+	if err != nil {
+		logger.WithError(err).Error("Failed to delete notification rule from database")
+		return fmt.Errorf("failed to delete notification rule: %w", err)
+	}
+	if !found {
+		logger.Warn("Notification rule not found")
+		return newError(ErrNotFound, "notification rule %d not found", id)
+	}
+
+	logger.Info("Notification rule deleted successfully")
+	return nil
+}
+
+// runs a stored or made up event through the rules and webhooks of the user without sending anything
+func PreviewNotificationRules(ctx context.Context, userID string, input *model.RulePreviewInput) (*model.RulePreview, error) {
+	logger := log.WithFields(log.Fields{
+		"func":       "PreviewNotificationRules",
+		"user_id":    userID,
+		"request_id": ctx.Value("request_id"),
+	})
+
+	var event *model.DeploymentEvent
+	var deployment *model.Deployment
+	var err error
+
+	if input.EventID != 0 {
+		event, err = storage.Deployments.GetEvent(ctx, userID, input.EventID)
+		if errors.Is(err, sql.ErrNoRows) {
+			logger.Warn("Event not found")
+			return nil, newError(ErrNotFound, "event %d not found", input.EventID)
+		} else if err != nil {
+			logger.WithError(err).Error("Failed to get event")
+			return nil, fmt.Errorf("failed to get event: %w", err)
+		}
+		// the branch comes from the cache, gone from it the event is still previewed without one
+		deployment, err = storage.Deployments.Get(ctx, event.PlatformCredentialID, event.DeploymentID)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			logger.WithError(err).Error("Failed to get cached deployment")
+			return nil, fmt.Errorf("failed to get cached deployment: %w", err)
+		}
+	} else {
+		if input.CredentialID == 0 || input.DeploymentID == "" || input.NewStatus == "" {
+			return nil, newError(ErrInvalidInput, "eventId, or credentialId, deploymentId and newStatus are required")
+		}
+		if _, err := storage.Credentials.GetByID(ctx, input.CredentialID, userID); errors.Is(err, sql.ErrNoRows) {
+			return nil, newError(ErrNotFound, "credential %d not found", input.CredentialID)
+		} else if err != nil {
+			logger.WithError(err).Error("Failed to get credential")
+			return nil, fmt.Errorf("failed to get credential: %w", err)
+		}
+		deployment, err = storage.Deployments.Get(ctx, input.CredentialID, input.DeploymentID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, newError(ErrNotFound, "deployment %q not found", input.DeploymentID)
+		} else if err != nil {
+			logger.WithError(err).Error("Failed to get cached deployment")
+			return nil, fmt.Errorf("failed to get cached deployment: %w", err)
+		}
+
+		oldStatus := input.OldStatus
+		if oldStatus == "" {
+			oldStatus = deployment.Status
+		}
+		for _, status := range []model.DeploymentStatus{oldStatus, input.NewStatus} {
+			switch status {
+			case model.DeploymentStatusLive, model.DeploymentStatusDeploying, model.DeploymentStatusCanceled,
+				model.DeploymentStatusFailed, model.DeploymentStatusUnknown, model.DeploymentStatusGone:
+			default:
+				return nil, newError(ErrInvalidInput, "invalid status %q", status)
+			}
+		}
+		event = &model.DeploymentEvent{
+			PlatformCredentialID: input.CredentialID,
+			DeploymentID:         deployment.ID,
+			DeploymentName:       deployment.Name,
+			OldStatus:            oldStatus,
+			NewStatus:            input.NewStatus,
+			ObservedAt:           time.Now(),
+		}
+	}
+
+	at := event.ObservedAt
+	if input.At != nil {
+		at = *input.At
+	}
+
+	preview := &model.RulePreview{
+		At:          at,
+		Rules:       []model.RuleMatch{},
+		Webhooks:    []model.WebhookDecision{},
+		Escalations: []model.EscalationDecision{},
+	}
+	eventType, ok := webhookEventType(*event, settledStatusBefore(ctx, event))
+	if !ok {
+		logger.Debug("Event isn't notified")
+		return preview, nil
+	}
+
+	rules, err := storage.Rules.ListByUser(ctx, userID)
+	if err != nil {
+		logger.WithError(err).Error("Failed to query notification rules")
+		return nil, fmt.Errorf("failed to query notification rules: %w", err)
+	}
+	webhooks, err := storage.Webhooks.ListByUser(ctx, userID)
+	if err != nil {
+		logger.WithError(err).Error("Failed to query webhooks")
+		return nil, fmt.Errorf("failed to query webhooks: %w", err)
+	}
+
+	preview, err = planNotifications(ctx, rules, webhooks, event, eventType, deployment, at)
+	if err != nil {
+		logger.WithError(err).Error("Failed to plan notifications")
+		return nil, err
+	}
+
+	logger.WithFields(log.Fields{
+		"event_type":     eventType,
+		"webhooks_count": len(preview.Webhooks),
+	}).Debug("Previewed notification rules successfully")
+	return preview, nil
+}
+
+// decides which webhooks get the event and which rules escalate it, at is when it happens for the schedules
+// and the dedup windows, the only side effect is reading the delivery log
+func planNotifications(ctx context.Context, rules []model.NotificationRule, webhooks []model.Webhook, event *model.DeploymentEvent,
+	eventType model.WebhookEventType, deployment *model.Deployment, at time.Time) (*model.RulePreview, error) {
+	plan := &model.RulePreview{
+		EventType:   eventType,
+		At:          at,
+		Rules:       []model.RuleMatch{},
+		Webhooks:    []model.WebhookDecision{},
+		Escalations: []model.EscalationDecision{},
+	}
+
+	// the conditions of every rule, the webhooks a rule applies to are checked per webhook below
+	var matched []*model.NotificationRule
+	active := 0
+	for i := range rules {
+		rule := &rules[i]
+		match := model.RuleMatch{RuleID: rule.ID, Name: rule.Name, Action: rule.Action}
+		if rule.Enabled {
+			active++
+			match.Reason = ruleMismatch(rule, event, eventType, deployment, at)
+			match.Matched = match.Reason == ""
+		} else {
+			match.Reason = "rule is disabled"
+		}
+		if match.Matched {
+			matched = append(matched, rule)
+			if rule.Action == model.NotificationRuleNotify && rule.EscalateAfterMinutes > 0 && eventType == model.WebhookEventDeploymentFailed {
+				plan.Escalations = append(plan.Escalations, model.EscalationDecision{
+					RuleID:     rule.ID,
+					WebhookIDs: rule.EscalateWebhookIDs,
+					DueAt:      at.Add(time.Duration(rule.EscalateAfterMinutes) * time.Minute),
+				})
+			}
+		}
+		plan.Rules = append(plan.Rules, match)
+	}
+
+	for i := range webhooks {
+		hook := &webhooks[i]
+		decision := model.WebhookDecision{WebhookID: hook.ID, Type: hook.Type}
+		switch {
+		case !hook.Enabled:
+			decision.Reason = "webhook is disabled"
+		case !hasEventType(hook, eventType):
+			decision.Reason = fmt.Sprintf("webhook isn't subscribed to %s", eventType)
+		case !matchesWebhookFilters(hook, event):
+			decision.Reason = "filtered out by the webhook's credential or status filter"
+		case active == 0:
+			decision.Deliver = true
+			decision.Reason = "no rules, every subscribed webhook gets the event"
+		default:
+			var err error
+			if decision.Deliver, decision.Reason, err = ruleDecision(ctx, rules, matched, hook, event, eventType, at); err != nil {
+				return nil, err
+			}
+		}
+		plan.Webhooks = append(plan.Webhooks, decision)
+	}
+	return plan, nil
+}
+
+// what the rules decide for one webhook that wants the event, matched are the enabled rules whose conditions match
+func ruleDecision(ctx context.Context, rules []model.NotificationRule, matched []*model.NotificationRule, hook *model.Webhook,
+	event *model.DeploymentEvent, eventType model.WebhookEventType, at time.Time) (bool, string, error) {
+	appliesTo := func(rule *model.NotificationRule) bool {
+		return len(rule.WebhookIDs) == 0 || slices.Contains(rule.WebhookIDs, hook.ID)
+	}
+
+	var notify *model.NotificationRule
+	dedup := 0
+	for _, rule := range matched {
+		if !appliesTo(rule) {
+			continue
+		}
+		if rule.Action == model.NotificationRuleMute {
+			return false, fmt.Sprintf("muted by rule %q", rule.Name), nil
+		}
+		if notify == nil {
+			notify = rule
+		}
+		dedup = max(dedup, rule.DedupMinutes)
+	}
+
+	if notify == nil {
+		// notify rules only restrict the webhooks they apply to
+		for i := range rules {
+			if rules[i].Enabled && rules[i].Action == model.NotificationRuleNotify && appliesTo(&rules[i]) {
+				return false, "no notify rule for this webhook matches", nil
+			}
+		}
+		return true, "no notify rule applies to this webhook, delivered by default", nil
+	}
+
+	if dedup > 0 {
+		last, err := storage.Webhooks.LastDeliveryAt(ctx, hook.ID, eventType, event.PlatformCredentialID, event.DeploymentID, at)
+		if err != nil {
+			return false, "", fmt.Errorf("failed to query last delivery: %w", err)
+		}
+		if last != nil && at.Sub(*last) < time.Duration(dedup)*time.Minute {
+			return false, fmt.Sprintf("duplicate, already sent at %s (dedup %d minutes)", last.UTC().Format(time.RFC3339), dedup), nil
+		}
+	}
+	return true, fmt.Sprintf("matched rule %q", notify.Name), nil
+}
+
+// why the conditions of the rule don't match the event, empty when they do
+func ruleMismatch(rule *model.NotificationRule, event *model.DeploymentEvent, eventType model.WebhookEventType, deployment *model.Deployment, at time.Time) string {
+	if len(rule.CredentialIDs) > 0 && !slices.Contains(rule.CredentialIDs, event.PlatformCredentialID) {
+		return fmt.Sprintf("credential %d isn't in the rule", event.PlatformCredentialID)
+	}
+	if len(rule.EventTypes) > 0 && !slices.Contains(rule.EventTypes, eventType) {
+		return fmt.Sprintf("%s isn't in eventTypes", eventType)
+	}
+	if slices.Contains(rule.ExceptEventTypes, eventType) {
+		return fmt.Sprintf("%s is in exceptEventTypes", eventType)
+	}
+	if len(rule.Services) > 0 && !matchesAnyPattern(rule.Services, event.DeploymentName) {
+		return fmt.Sprintf("service %q doesn't match", event.DeploymentName)
+	}
+	if len(rule.Branches) > 0 {
+		if deployment == nil || deployment.Branch == "" {
+			return "branch of the deployment is unknown"
+		}
+		if !matchesAnyPattern(rule.Branches, deployment.Branch) {
+			return fmt.Sprintf("branch %q doesn't match", deployment.Branch)
+		}
+	}
+	if rule.Schedule != nil {
+		in, local := inSchedule(rule.Schedule, at)
+		if !in {
+			return fmt.Sprintf("%s is outside %s-%s %s", local, rule.Schedule.Start, rule.Schedule.End, rule.Schedule.Timezone)
+		}
+	}
+	return ""
+}
+
+func matchesAnyPattern(patterns []string, s string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, s); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// at is inside the daily window of the schedule, start included and end excluded, also returns at as HH:MM in
+// the schedule's timezone, an end before the start wraps past midnight (22:00-07:00)
+func inSchedule(s *model.RuleSchedule, at time.Time) (bool, string) {
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	local := at.In(loc)
+	now := local.Hour()*60 + local.Minute()
+	start, _ := scheduleMinutes(s.Start)
+	end, _ := scheduleMinutes(s.End)
+
+	in := now >= start && now < end
+	if end < start {
+		in = now >= start || now < end
+	}
+	return in, local.Format("15:04")
+}
+
+// escalations the plans of a refresh asked for, a failure seen twice is only escalated once per rule
+func queueEscalations(ctx context.Context, logger *log.Entry, event *model.DeploymentEvent, escalations []model.EscalationDecision, at time.Time) {
+	for _, e := range escalations {
+		if err := storage.Rules.CreateEscalation(ctx, e.RuleID, event.ID, e.DueAt, at); err != nil {
+			logger.WithError(err).WithFields(log.Fields{
+				"rule_id":  e.RuleID,
+				"event_id": event.ID,
+			}).Error("Failed to queue escalation")
+		}
+	}
+}
+
+// sends the escalations that are due until ctx is cancelled
+func StartEscalations(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(escalationCheckInterval)
+		defer ticker.Stop()
+
+		for {
+			runDueEscalations(ctx, time.Now())
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// escalates every due failure that is still there, the others are cancelled
+func runDueEscalations(ctx context.Context, now time.Time) {
+	logger := log.WithFields(log.Fields{
+		"func": "runDueEscalations",
+	})
+
+	escalations, err := storage.Rules.ListDueEscalations(ctx, now, escalationBatchSize)
+	if err != nil {
+		if ctx.Err() == nil {
+			logger.WithError(err).Error("Failed to query due escalations")
+		}
+		return
+	}
+
+	queued := 0
+	for i := range escalations {
+		n, err := escalate(ctx, &escalations[i], now)
+		if err != nil {
+			logger.WithError(err).WithFields(log.Fields{
+				"escalation_id": escalations[i].ID,
+				"rule_id":       escalations[i].RuleID,
+				"event_id":      escalations[i].EventID,
+			}).Error("Failed to escalate")
+			continue
+		}
+		queued += n
+	}
+
+	if queued > 0 {
+		logger.WithField("deliveries_count", queued).Info("Queued escalations")
+		wakeDeliveryWorker()
+	}
+}
+
+// queues deployment.escalated to the escalation webhooks of the rule when the failure is still the latest
+// state of the deployment and nobody acknowledged it, returns the number of deliveries queued
+// escalations go to the webhooks the user picked for them, mutes and subscriptions don't apply
+func escalate(ctx context.Context, e *storage.Escalation, now time.Time) (int, error) {
+	rule, err := storage.Rules.GetByID(ctx, e.RuleID, e.UserID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get notification rule: %w", err)
+	}
+	event, err := storage.Deployments.GetEvent(ctx, e.UserID, e.EventID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return 0, fmt.Errorf("failed to get event: %w", err)
+	}
+
+	var deployment *model.Deployment
+	reason := ""
+	switch {
+	case !rule.Enabled || rule.EscalateAfterMinutes == 0:
+		reason = "rule disabled or no longer escalating"
+	case event == nil:
+		reason = "event is gone"
+	case event.AcknowledgedAt != nil:
+		reason = "failure acknowledged"
+	default:
+		latest, err := storage.Deployments.ListEvents(ctx, e.UserID, model.DeploymentEventFilter{
+			CredentialID: &event.PlatformCredentialID,
+			DeploymentID: event.DeploymentID,
+			Limit:        1,
+		})
+		if err != nil {
+			return 0, fmt.Errorf("failed to query deployment events: %w", err)
+		}
+		deployment, err = storage.Deployments.Get(ctx, event.PlatformCredentialID, event.DeploymentID)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return 0, fmt.Errorf("failed to get cached deployment: %w", err)
+		}
+		if len(latest) == 0 || latest[0].ID != event.ID || deployment == nil || deployment.Status != model.DeploymentStatusFailed {
+			reason = "deployment changed since the failure"
+		}
+	}
+
+	logger := log.WithFields(log.Fields{
+		"func":          "escalate",
+		"escalation_id": e.ID,
+		"rule_id":       e.RuleID,
+		"event_id":      e.EventID,
+		"user_id":       e.UserID,
+	})
+
+	if reason != "" {
+		if _, err := storage.Rules.CompleteEscalation(ctx, e.ID, storage.EscalationCancelled, now); err != nil {
+			return 0, fmt.Errorf("failed to cancel escalation: %w", err)
+		}
+		logger.WithField("reason", reason).Debug("Escalation cancelled")
+		return 0, nil
+	}
+
+	cred, err := storage.Credentials.GetByID(ctx, event.PlatformCredentialID, e.UserID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get credential: %w", err)
+	}
+	webhooks, err := storage.Webhooks.ListByUser(ctx, e.UserID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query webhooks: %w", err)
+	}
+
+	// built before the claim, anything failing up to here leaves the escalation pending for the next run
+	// a payload that can't be encoded only skips its webhook, like in queueWebhookDeliveries
+	var targets []*model.Webhook
+	payloads := make(map[model.WebhookType][]byte)
+	for i := range webhooks {
+		hook := &webhooks[i]
+		if !hook.Enabled || !slices.Contains(rule.EscalateWebhookIDs, hook.ID) {
+			continue
+		}
+		if _, ok := payloads[hook.Type]; !ok {
+			payload, err := webhookPayload(hook.Type, model.WebhookEventDeploymentEscalated, cred.Platform, event, deployment, now)
+			if err != nil {
+				logger.WithError(err).WithField("webhook_id", hook.ID).Error("Failed to encode webhook payload")
+				continue
+			}
+			payloads[hook.Type] = payload
+		}
+		targets = append(targets, hook)
+	}
+
+	// claimed first so two instances don't both send it
+	claimed, err := storage.Rules.CompleteEscalation(ctx, e.ID, storage.EscalationSent, now)
+	if err != nil {
+		return 0, fmt.Errorf("failed to mark escalation sent: %w", err)
+	}
+	if !claimed {
+		return 0, nil
+	}
+
+	queued := 0
+	for _, hook := range targets {
+		delivery := &model.WebhookDelivery{
+			WebhookID:     hook.ID,
+			EventType:     model.WebhookEventDeploymentEscalated,
+			EventID:       &event.ID,
+			Payload:       payloads[hook.Type],
+			Status:        model.WebhookDeliveryPending,
+			CreatedAt:     now,
+			NextAttemptAt: &now,
+		}
+		if hook.Threaded() {
+			delivery.ThreadKey = webhookThreadKey(event)
+		}
+		if _, err := storage.Webhooks.CreateDelivery(ctx, delivery); err != nil {
+			logger.WithError(err).WithField("webhook_id", hook.ID).Error("Failed to queue escalation delivery")
+			continue
+		}
+		queued++
+	}
+
+	logger.WithField("deliveries_count", queued).Info("Failure escalated")
+	return queued, nil
+}
@@ -0,0 +1,482 @@
+package service
+
+import (
+	"checkmate/api/internal/model"
+	"checkmate/api/internal/storage"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInSchedule(t *testing.T) {
+	at := func(s string) time.Time {
+		t.Helper()
+		v, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+
+	cases := []struct {
+		name      string
+		schedule  model.RuleSchedule
+		at        string
+		want      bool
+		wantLocal string
+	}{
+		{"start is included", model.RuleSchedule{Start: "09:00", End: "17:00", Timezone: "UTC"}, "2026-06-10T09:00:00Z", true, "09:00"},
+		{"last minute", model.RuleSchedule{Start: "09:00", End: "17:00", Timezone: "UTC"}, "2026-06-10T16:59:59Z", true, "16:59"},
+		{"end is excluded", model.RuleSchedule{Start: "09:00", End: "17:00", Timezone: "UTC"}, "2026-06-10T17:00:00Z", false, "17:00"},
+		{"before start", model.RuleSchedule{Start: "09:00", End: "17:00", Timezone: "UTC"}, "2026-06-10T08:59:00Z", false, "08:59"},
+
+		{"wrapped, evening", model.RuleSchedule{Start: "22:00", End: "07:00", Timezone: "UTC"}, "2026-06-10T23:30:00Z", true, "23:30"},
+		{"wrapped, after midnight", model.RuleSchedule{Start: "22:00", End: "07:00", Timezone: "UTC"}, "2026-06-10T03:00:00Z", true, "03:00"},
+		{"wrapped, start is included", model.RuleSchedule{Start: "22:00", End: "07:00", Timezone: "UTC"}, "2026-06-10T22:00:00Z", true, "22:00"},
+		{"wrapped, end is excluded", model.RuleSchedule{Start: "22:00", End: "07:00", Timezone: "UTC"}, "2026-06-10T07:00:00Z", false, "07:00"},
+		{"wrapped, daytime", model.RuleSchedule{Start: "22:00", End: "07:00", Timezone: "UTC"}, "2026-06-10T12:00:00Z", false, "12:00"},
+
+		// 14:00 utc is 09:00 in new york in winter, 10:00 in summer
+		{"timezone, winter", model.RuleSchedule{Start: "09:00", End: "10:00", Timezone: "America/New_York"}, "2026-01-15T14:00:00Z", true, "09:00"},
+		{"timezone, summer", model.RuleSchedule{Start: "09:00", End: "10:00", Timezone: "America/New_York"}, "2026-07-15T14:00:00Z", false, "10:00"},
+		{"timezone, late in utc", model.RuleSchedule{Start: "22:00", End: "07:00", Timezone: "Asia/Tokyo"}, "2026-06-10T14:00:00Z", true, "23:00"},
+
+		// berlin skips 02:00-03:00 on 2026-03-29, the window is read on the wall clock
+		{"dst day, before the jump", model.RuleSchedule{Start: "01:00", End: "03:00", Timezone: "Europe/Berlin"}, "2026-03-29T00:30:00Z", true, "01:30"},
+		{"dst day, after the jump", model.RuleSchedule{Start: "01:00", End: "03:00", Timezone: "Europe/Berlin"}, "2026-03-29T01:00:00Z", false, "03:00"},
+		{"dst day, wrapped", model.RuleSchedule{Start: "22:00", End: "07:00", Timezone: "Europe/Berlin"}, "2026-03-29T04:59:00Z", true, "06:59"},
+		{"dst day, wrapped end", model.RuleSchedule{Start: "22:00", End: "07:00", Timezone: "Europe/Berlin"}, "2026-03-29T05:00:00Z", false, "07:00"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			in, local := inSchedule(&c.schedule, at(c.at))
+			if in != c.want || local != c.wantLocal {
+				t.Errorf("inSchedule(%s-%s %s, %s) = %v %s, want %v %s",
+					c.schedule.Start, c.schedule.End, c.schedule.Timezone, c.at, in, local, c.want, c.wantLocal)
+			}
+		})
+	}
+}
+
+func TestRuleMismatch(t *testing.T) {
+	event := &model.DeploymentEvent{PlatformCredentialID: 1, DeploymentID: "srv-1", DeploymentName: "api-prod", OldStatus: model.DeploymentStatusLive, NewStatus: model.DeploymentStatusFailed}
+	deployment := &model.Deployment{ID: "srv-1", Branch: "release/1.2"}
+	at := time.Date(2026, 6, 10, 12, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		name       string
+		rule       model.NotificationRule
+		deployment *model.Deployment
+		want       string // start of the reason, empty for a match
+	}{
+		{"no conditions", model.NotificationRule{}, deployment, ""},
+		{"credential", model.NotificationRule{CredentialIDs: []int{2}}, deployment, "credential 1 isn't in the rule"},
+		{"event type", model.NotificationRule{EventTypes: []model.WebhookEventType{model.WebhookEventDeploymentRecovered}}, deployment, "deployment.failed isn't in eventTypes"},
+		{"except event type", model.NotificationRule{ExceptEventTypes: []model.WebhookEventType{model.WebhookEventDeploymentFailed}}, deployment, "deployment.failed is in exceptEventTypes"},
+		{"service glob", model.NotificationRule{Services: []string{"api-*"}}, deployment, ""},
+		{"service glob mismatch", model.NotificationRule{Services: []string{"worker-*"}}, deployment, `service "api-prod" doesn't match`},
+		{"branch glob", model.NotificationRule{Branches: []string{"main", "release/*"}}, deployment, ""},
+		{"branch mismatch", model.NotificationRule{Branches: []string{"main"}}, deployment, `branch "release/1.2" doesn't match`},
+		{"branch unknown", model.NotificationRule{Branches: []string{"main"}}, nil, "branch of the deployment is unknown"},
+		{"in schedule", model.NotificationRule{Schedule: &model.RuleSchedule{Start: "09:00", End: "17:00", Timezone: "UTC"}}, deployment, ""},
+		{"outside schedule", model.NotificationRule{Schedule: &model.RuleSchedule{Start: "22:00", End: "07:00", Timezone: "UTC"}}, deployment, "12:00 is outside 22:00-07:00 UTC"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := ruleMismatch(&c.rule, event, model.WebhookEventDeploymentFailed, c.deployment, at)
+			if c.want == "" && got != "" || !strings.HasPrefix(got, c.want) {
+				t.Errorf("ruleMismatch = %q, want %q", got, c.want)
+			}
+		})
+	}
+}
+
+// decisions for two webhooks subscribed to failures, 1 and 2
+func TestPlanNotificationsDecisions(t *testing.T) {
+	event := &model.DeploymentEvent{PlatformCredentialID: 1, DeploymentID: "srv-1", DeploymentName: "api", OldStatus: model.DeploymentStatusLive, NewStatus: model.DeploymentStatusFailed}
+	webhooks := []model.Webhook{
+		{ID: 1, Type: model.WebhookTypeGeneric, Enabled: true, EventTypes: []model.WebhookEventType{model.WebhookEventDeploymentFailed}},
+		{ID: 2, Type: model.WebhookTypeSlack, Enabled: true, EventTypes: []model.WebhookEventType{model.WebhookEventDeploymentFailed}},
+	}
+	notify := func(id int, name string, webhookIDs []int, services ...string) model.NotificationRule {
+		return model.NotificationRule{ID: id, Name: name, Action: model.NotificationRuleNotify, Enabled: true, WebhookIDs: webhookIDs, Services: services}
+	}
+	mute := func(id int, name string, webhookIDs []int, services ...string) model.NotificationRule {
+		rule := notify(id, name, webhookIDs, services...)
+		rule.Action = model.NotificationRuleMute
+		return rule
+	}
+
+	type decision struct {
+		deliver bool
+		reason  string
+	}
+	cases := []struct {
+		name  string
+		rules []model.NotificationRule
+		want  [2]decision
+	}{
+		{
+			"no rules",
+			nil,
+			[2]decision{{true, "no rules"}, {true, "no rules"}},
+		},
+		{
+			"disabled rules count as none",
+			[]model.NotificationRule{{ID: 1, Name: "off", Action: model.NotificationRuleMute}},
+			[2]decision{{true, "no rules"}, {true, "no rules"}},
+		},
+		{
+			"mute beats notify",
+			[]model.NotificationRule{notify(1, "everything", nil), mute(2, "quiet api", nil, "api")},
+			[2]decision{{false, `muted by rule "quiet api"`}, {false, `muted by rule "quiet api"`}},
+		},
+		{
+			"mute scoped to a webhook",
+			[]model.NotificationRule{notify(1, "everything", nil), mute(2, "quiet slack", []int{2})},
+			[2]decision{{true, `matched rule "everything"`}, {false, `muted by rule "quiet slack"`}},
+		},
+		{
+			"notify scoped to a webhook",
+			[]model.NotificationRule{notify(1, "generic only", []int{1})},
+			[2]decision{{true, `matched rule "generic only"`}, {true, "no notify rule applies to this webhook"}},
+		},
+		{
+			"no notify rule for the webhook matches",
+			[]model.NotificationRule{notify(1, "workers", []int{1}, "worker-*"), notify(2, "api on slack", []int{2}, "api")},
+			[2]decision{{false, "no notify rule for this webhook matches"}, {true, `matched rule "api on slack"`}},
+		},
+		{
+			"non matching mute",
+			[]model.NotificationRule{mute(1, "quiet workers", nil, "worker-*")},
+			[2]decision{{true, "no notify rule applies to this webhook"}, {true, "no notify rule applies to this webhook"}},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			plan, err := planNotifications(context.Background(), c.rules, webhooks, event, model.WebhookEventDeploymentFailed, nil, time.Now())
+			if err != nil {
+				t.Fatalf("plan: %v", err)
+			}
+			for i, want := range c.want {
+				got := plan.Webhooks[i]
+				if got.Deliver != want.deliver || !strings.HasPrefix(got.Reason, want.reason) {
+					t.Errorf("webhook %d: deliver %v %q, want %v %q", got.WebhookID, got.Deliver, got.Reason, want.deliver, want.reason)
+				}
+			}
+		})
+	}
+}
+
+// a failure of srv-1 recorded by a refresh, with the cache showing it failed
+func recordFailure(t *testing.T, cred *model.PlatformCredential, render *fakeRender) *model.DeploymentEvent {
+	t.Helper()
+	ctx := context.Background()
+	render.setStatus("srv-1", "failed")
+	if _, _, err := GetFreshOrUpdateCache(ctx, cred, true); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	events, err := storage.Deployments.ListEvents(ctx, cred.UserID, model.DeploymentEventFilter{CredentialID: &cred.ID, DeploymentID: "srv-1", Limit: 1})
+	if err != nil || len(events) == 0 || events[0].NewStatus != model.DeploymentStatusFailed {
+		t.Fatalf("no failure recorded: %v %v", events, err)
+	}
+	return &events[0]
+}
+
+func createTestWebhook(t *testing.T, userID string, eventTypes ...model.WebhookEventType) *model.Webhook {
+	t.Helper()
+	hook := &model.Webhook{UserID: userID, Type: model.WebhookTypeGeneric, URL: "https://hooks.example.com/" + userID, EventTypes: eventTypes, Enabled: true, CreatedAt: time.Now()}
+	id, err := storage.Webhooks.Create(context.Background(), hook)
+	if err != nil {
+		t.Fatalf("create webhook: %v", err)
+	}
+	hook.ID = id
+	return hook
+}
+
+func createTestRule(t *testing.T, rule *model.NotificationRule) {
+	t.Helper()
+	rule.Enabled = true
+	rule.CreatedAt = time.Now()
+	id, err := storage.Rules.Create(context.Background(), rule)
+	if err != nil {
+		t.Fatalf("create rule: %v", err)
+	}
+	rule.ID = id
+}
+
+// repeats of a deployment's event within the window of the rule are dropped, the window is read from the delivery log
+func TestRuleDecisionDedupWindow(t *testing.T) {
+	openTestDB(t)
+	ctx := context.Background()
+	cred := createTestCredential(t, "user-dedup")
+	render := startFakeRender(t, renderService("srv-1", "api", "live"))
+	if _, _, err := GetFreshOrUpdateCache(ctx, cred, true); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	hook := createTestWebhook(t, cred.UserID, model.WebhookEventDeploymentFailed)
+	rule := &model.NotificationRule{UserID: cred.UserID, Name: "once per half hour", Action: model.NotificationRuleNotify, DedupMinutes: 30}
+	createTestRule(t, rule)
+
+	// the refresh delivers the first failure
+	event := recordFailure(t, cred, render)
+	deliveries, err := storage.Webhooks.ListDeliveries(ctx, hook.ID, 0, 10)
+	if err != nil || len(deliveries) != 1 {
+		t.Fatalf("first failure queued %d deliveries (%v), want 1", len(deliveries), err)
+	}
+	sentAt := deliveries[0].CreatedAt
+
+	rules := []model.NotificationRule{*rule}
+	webhooks := []model.Webhook{*hook}
+	for _, c := range []struct {
+		after   time.Duration
+		deliver bool
+	}{
+		{10 * time.Minute, false},
+		{29 * time.Minute, false},
+		{31 * time.Minute, true},
+	} {
+		plan, err := planNotifications(ctx, rules, webhooks, event, model.WebhookEventDeploymentFailed, nil, sentAt.Add(c.after))
+		if err != nil {
+			t.Fatalf("plan: %v", err)
+		}
+		if got := plan.Webhooks[0]; got.Deliver != c.deliver {
+			t.Errorf("%v after the last delivery: deliver %v (%s), want %v", c.after, got.Deliver, got.Reason, c.deliver)
+		}
+	}
+
+	// other deployments and event types have their own window
+	other := *event
+	other.DeploymentID = "srv-2"
+	plan, err := planNotifications(ctx, rules, webhooks, &other, model.WebhookEventDeploymentFailed, nil, sentAt.Add(time.Minute))
+	if err != nil {
+		t.Fatalf("plan: %v", err)
+	}
+	if !plan.Webhooks[0].Deliver {
+		t.Errorf("another deployment was deduplicated: %s", plan.Webhooks[0].Reason)
+	}
+}
+
+// escalation set up: srv-1 failed with a rule escalating it to a webhook after 10 minutes
+type escalationFixture struct {
+	cred   *model.PlatformCredential
+	render *fakeRender
+	hook   *model.Webhook
+	rule   *model.NotificationRule
+	event  *model.DeploymentEvent
+}
+
+func setupEscalation(t *testing.T, userID string) *escalationFixture {
+	t.Helper()
+	openTestDB(t)
+	f := &escalationFixture{cred: createTestCredential(t, userID)}
+	f.render = startFakeRender(t, renderService("srv-1", "api", "live"))
+	if _, _, err := GetFreshOrUpdateCache(context.Background(), f.cred, true); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	// escalations ignore subscriptions, this one doesn't get the failure itself
+	f.hook = createTestWebhook(t, userID, model.WebhookEventDeploymentSucceeded)
+	f.rule = &model.NotificationRule{UserID: userID, Name: "page", Action: model.NotificationRuleNotify, EscalateAfterMinutes: 10, EscalateWebhookIDs: []int{f.hook.ID}}
+	createTestRule(t, f.rule)
+	// the refresh queues the escalation
+	f.event = recordFailure(t, f.cred, f.render)
+	return f
+}
+
+// escalation deliveries of the fixture webhook
+func (f *escalationFixture) escalated(t *testing.T) int {
+	t.Helper()
+	deliveries, err := storage.Webhooks.ListDeliveries(context.Background(), f.hook.ID, 0, 10)
+	if err != nil {
+		t.Fatalf("list deliveries: %v", err)
+	}
+	n := 0
+	for _, d := range deliveries {
+		if d.EventType == model.WebhookEventDeploymentEscalated {
+			if d.EventID == nil || *d.EventID != f.event.ID {
+				t.Errorf("escalation delivery for event %v, want %d", d.EventID, f.event.ID)
+			}
+			n++
+		}
+	}
+	return n
+}
+
+func pendingEscalations(t *testing.T, now time.Time) []storage.Escalation {
+	t.Helper()
+	due, err := storage.Rules.ListDueEscalations(context.Background(), now, 10)
+	if err != nil {
+		t.Fatalf("list escalations: %v", err)
+	}
+	return due
+}
+
+func TestEscalationSentOnce(t *testing.T) {
+	f := setupEscalation(t, "user-escalate")
+	ctx := context.Background()
+
+	if due := pendingEscalations(t, time.Now()); len(due) != 0 {
+		t.Fatalf("%d escalations due before the delay", len(due))
+	}
+	later := time.Now().Add(11 * time.Minute)
+	due := pendingEscalations(t, later)
+	if len(due) != 1 || due[0].RuleID != f.rule.ID || due[0].EventID != f.event.ID {
+		t.Fatalf("due escalations %+v, want the failure for rule %d", due, f.rule.ID)
+	}
+
+	// two instances picked it up, only the one that claims it queues
+	first, err := escalate(ctx, &due[0], later)
+	if err != nil {
+		t.Fatalf("escalate: %v", err)
+	}
+	second, err := escalate(ctx, &due[0], later)
+	if err != nil {
+		t.Fatalf("escalate again: %v", err)
+	}
+	if first != 1 || second != 0 {
+		t.Fatalf("queued %d then %d deliveries, want 1 then 0", first, second)
+	}
+
+	runDueEscalations(ctx, later.Add(time.Hour))
+	if n := f.escalated(t); n != 1 {
+		t.Fatalf("%d escalation deliveries, want 1", n)
+	}
+}
+
+func TestEscalationCancelled(t *testing.T) {
+	cases := []struct {
+		name   string
+		change func(t *testing.T, f *escalationFixture)
+	}{
+		{"acknowledged", func(t *testing.T, f *escalationFixture) {
+			if _, err := storage.Deployments.AcknowledgeEvent(context.Background(), f.cred.UserID, f.event.ID, time.Now()); err != nil {
+				t.Fatalf("acknowledge: %v", err)
+			}
+		}},
+		{"newer event", func(t *testing.T, f *escalationFixture) {
+			f.render.setStatus("srv-1", "deploying")
+			if _, _, err := GetFreshOrUpdateCache(context.Background(), f.cred, true); err != nil {
+				t.Fatalf("refresh: %v", err)
+			}
+		}},
+		{"rule disabled", func(t *testing.T, f *escalationFixture) {
+			f.rule.Enabled = false
+			if _, err := storage.Rules.Update(context.Background(), f.rule); err != nil {
+				t.Fatalf("disable rule: %v", err)
+			}
+		}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			f := setupEscalation(t, "user-cancel")
+			c.change(t, f)
+
+			later := time.Now().Add(11 * time.Minute)
+			runDueEscalations(context.Background(), later)
+			if n := f.escalated(t); n != 0 {
+				t.Errorf("%d escalation deliveries, want none", n)
+			}
+			if due := pendingEscalations(t, later); len(due) != 0 {
+				t.Errorf("escalation still pending after it was cancelled")
+			}
+		})
+	}
+}
+
+func TestPreviewNotificationRules(t *testing.T) {
+	openTestDB(t)
+	ctx := context.Background()
+	cred := createTestCredential(t, "user-preview")
+	render := startFakeRender(t, renderService("srv-1", "api", "live"), renderService("srv-2", "worker", "live"))
+	if _, _, err := GetFreshOrUpdateCache(ctx, cred, true); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	ops := createTestWebhook(t, cred.UserID, model.WebhookEventDeploymentFailed, model.WebhookEventDeploymentRecovered)
+	chat := createTestWebhook(t, cred.UserID, model.WebhookEventDeploymentFailed)
+	pager := createTestWebhook(t, cred.UserID, model.WebhookEventDeploymentSucceeded)
+
+	for _, input := range []model.NotificationRuleInput{
+		{Name: "api to ops", Action: model.NotificationRuleNotify, Services: []string{"api"}, WebhookIDs: []int{ops.ID}, EscalateAfterMinutes: 15, EscalateWebhookIDs: []int{pager.ID}},
+		{Name: "quiet nights", Action: model.NotificationRuleMute, WebhookIDs: []int{chat.ID}, Schedule: &model.RuleSchedule{Start: "22:00", End: "07:00", Timezone: "Europe/Paris"}},
+	} {
+		if _, err := CreateNotificationRule(ctx, cred.UserID, &input); err != nil {
+			t.Fatalf("create rule %q: %v", input.Name, err)
+		}
+	}
+
+	// a made up failure of api at 23:30 in paris
+	night := time.Date(2026, 6, 10, 21, 30, 0, 0, time.UTC)
+	preview, err := PreviewNotificationRules(ctx, cred.UserID, &model.RulePreviewInput{
+		CredentialID: cred.ID, DeploymentID: "srv-1", NewStatus: model.DeploymentStatusFailed, At: &night,
+	})
+	if err != nil {
+		t.Fatalf("preview: %v", err)
+	}
+	if preview.EventType != model.WebhookEventDeploymentFailed {
+		t.Fatalf("event type %q, want deployment.failed", preview.EventType)
+	}
+	for _, r := range preview.Rules {
+		if !r.Matched {
+			t.Errorf("rule %q didn't match: %s", r.Name, r.Reason)
+		}
+	}
+	want := map[int]bool{ops.ID: true, chat.ID: false, pager.ID: false}
+	for _, d := range preview.Webhooks {
+		if d.Deliver != want[d.WebhookID] {
+			t.Errorf("webhook %d: deliver %v (%s), want %v", d.WebhookID, d.Deliver, d.Reason, want[d.WebhookID])
+		}
+	}
+	if len(preview.Escalations) != 1 || !preview.Escalations[0].DueAt.Equal(night.Add(15*time.Minute)) {
+		t.Errorf("escalations %+v, want one due 15 minutes after the failure", preview.Escalations)
+	}
+
+	// a stored event, seen now -> api still goes to ops, worker isn't in the notify rule
+	render.setStatus("srv-2", "failed")
+	if _, _, err := GetFreshOrUpdateCache(ctx, cred, true); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	events, err := storage.Deployments.ListEvents(ctx, cred.UserID, model.DeploymentEventFilter{CredentialID: &cred.ID, DeploymentID: "srv-2", Limit: 1})
+	if err != nil || len(events) != 1 {
+		t.Fatalf("no failure of srv-2: %v", err)
+	}
+	noon := time.Date(2026, 6, 10, 10, 0, 0, 0, time.UTC)
+	preview, err = PreviewNotificationRules(ctx, cred.UserID, &model.RulePreviewInput{EventID: events[0].ID, At: &noon})
+	if err != nil {
+		t.Fatalf("preview stored event: %v", err)
+	}
+	want = map[int]bool{ops.ID: false, chat.ID: true, pager.ID: false}
+	for _, d := range preview.Webhooks {
+		if d.Deliver != want[d.WebhookID] {
+			t.Errorf("stored event, webhook %d: deliver %v (%s), want %v", d.WebhookID, d.Deliver, d.Reason, want[d.WebhookID])
+		}
+	}
+	if len(preview.Escalations) != 0 {
+		t.Errorf("worker failure escalated by a rule for api: %+v", preview.Escalations)
+	}
+
+	// events webhooks don't care about aren't planned
+	preview, err = PreviewNotificationRules(ctx, cred.UserID, &model.RulePreviewInput{
+		CredentialID: cred.ID, DeploymentID: "srv-1", OldStatus: model.DeploymentStatusLive, NewStatus: model.DeploymentStatusLive,
+	})
+	if err != nil || preview.EventType != "" || len(preview.Webhooks) != 0 {
+		t.Errorf("live to live previewed as %+v (%v), want nothing", preview, err)
+	}
+
+	for _, input := range []model.RulePreviewInput{
+		{CredentialID: cred.ID, DeploymentID: "srv-1"},
+		{CredentialID: cred.ID, DeploymentID: "srv-1", NewStatus: "exploded"},
+	} {
+		if _, err := PreviewNotificationRules(ctx, cred.UserID, &input); !errors.Is(err, ErrInvalidInput) {
+			t.Errorf("preview %+v: %v, want invalid input", input, err)
+		}
+	}
+	if _, err := PreviewNotificationRules(ctx, cred.UserID, &model.RulePreviewInput{EventID: 9999}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("unknown event: %v, want not found", err)
+	}
+}
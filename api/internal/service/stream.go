@@ -0,0 +1,287 @@
+package service
+
+import (
+	"checkmate/api/internal/model"
+	"checkmate/api/internal/storage"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+//Live deployment changes -> every cache write that records events publishes them to the streams of the credential owner
+// a stream that falls behind is dropped, the client reconnects with Last-Event-ID and the missed events are replayed from deployment_events
+
+const (
+	DefaultStreamHeartbeatInterval = 25 * time.Second // below the usual 30-60s proxy idle timeouts
+	DefaultStreamRefreshInterval   = 30 * time.Second
+
+	// changes a stream can have pending before it is dropped
+	streamBufferSize = 64
+	// events replayed on reconnect, further behind than this the client gets a new snapshot
+	streamMaxReplay = 500
+	// longer than a cache write transaction runs, an id sent this long ago can't have a lower one still uncommitted
+	streamSettleWindow = time.Minute
+)
+
+var (
+	// comment line sent on idle streams so proxies and clients don't time them out
+	StreamHeartbeatInterval = DefaultStreamHeartbeatInterval
+	// how often an open stream revalidates the cache of its user, nothing else refreshes it once the client stops polling
+	StreamRefreshInterval = DefaultStreamRefreshInterval
+)
+
+// loads stream settings from the environment -> STREAM_HEARTBEAT_INTERVAL and STREAM_REFRESH_INTERVAL
+func InitStreamSettings() error {
+	var err error
+	if StreamHeartbeatInterval, err = durationFromEnv("STREAM_HEARTBEAT_INTERVAL", DefaultStreamHeartbeatInterval); err != nil {
+		return err
+	}
+	if StreamRefreshInterval, err = durationFromEnv("STREAM_REFRESH_INTERVAL", DefaultStreamRefreshInterval); err != nil {
+		return err
+	}
+	return nil
+}
+
+// one open stream of a user, C is closed when the stream has to end (shutdown or too slow)
+type DeploymentSubscription struct {
+	C       <-chan model.DeploymentChangeEvent
+	ch      chan model.DeploymentChangeEvent
+	userID  string
+	dropped bool // guarded by the streams lock
+}
+
+var streams = struct {
+	sync.Mutex
+	subs   map[string]map[*DeploymentSubscription]struct{} // by user id
+	closed bool
+}{subs: make(map[string]map[*DeploymentSubscription]struct{})}
+
+// registers a stream for the user's deployment changes, Close must be called when the stream ends
+func SubscribeDeployments(userID string) *DeploymentSubscription {
+	ch := make(chan model.DeploymentChangeEvent, streamBufferSize)
+	sub := &DeploymentSubscription{C: ch, ch: ch, userID: userID}
+
+	streams.Lock()
+	defer streams.Unlock()
+
+	// shutting down, the stream ends right away
+	if streams.closed {
+		sub.dropped = true
+		close(ch)
+		return sub
+	}
+
+	if streams.subs[userID] == nil {
+		streams.subs[userID] = make(map[*DeploymentSubscription]struct{})
+	}
+	streams.subs[userID][sub] = struct{}{}
+	return sub
+}
+
+func (s *DeploymentSubscription) Close() {
+	streams.Lock()
+	defer streams.Unlock()
+	s.drop()
+}
+
+// removes the subscription and closes its channel, streams lock must be held
+func (s *DeploymentSubscription) drop() {
+	if s.dropped {
+		return
+	}
+	s.dropped = true
+
+	if subs := streams.subs[s.userID]; subs != nil {
+		delete(subs, s)
+		if len(subs) == 0 {
+			delete(streams.subs, s.userID)
+		}
+	}
+	close(s.ch)
+}
+
+// ends every open stream, registered with http.Server.RegisterOnShutdown so Shutdown doesn't wait on them
+func CloseDeploymentStreams() {
+	streams.Lock()
+	defer streams.Unlock()
+
+	streams.closed = true
+	count := 0
+	for _, subs := range streams.subs {
+		for sub := range subs {
+			sub.drop()
+			count++
+		}
+	}
+
+	log.WithFields(log.Fields{
+		"func":    "CloseDeploymentStreams",
+		"streams": count,
+	}).Info("Closed deployment streams")
+}
+
+// pushes stored events to the streams of the credential owner
+// deployments is the cache after the write, it provides the current state of added/changed deployments
+func publishDeploymentChanges(userID string, events []model.DeploymentEvent, deployments []model.Deployment) {
+	if len(events) == 0 {
+		return
+	}
+
+	byID := make(map[string]*model.Deployment, len(deployments))
+	for i := range deployments {
+		byID[deployments[i].ID] = &deployments[i]
+	}
+
+	changes := make([]model.DeploymentChangeEvent, 0, len(events))
+	for _, event := range events {
+		change := model.DeploymentChangeEvent{Type: event.Change(), Event: event}
+		if change.Type != model.DeploymentChangeRemoved {
+			change.Deployment = byID[event.DeploymentID]
+		}
+		changes = append(changes, change)
+	}
+
+	streams.Lock()
+	defer streams.Unlock()
+
+	for sub := range streams.subs[userID] {
+		for _, change := range changes {
+			select {
+			case sub.ch <- change:
+			default:
+				// never block the refresh on a slow client, it resumes from Last-Event-ID
+				log.WithFields(log.Fields{
+					"func":    "publishDeploymentChanges",
+					"user_id": userID,
+				}).Warn("Deployment stream fell behind, dropping it")
+				sub.drop()
+			}
+			if sub.dropped {
+				break
+			}
+		}
+	}
+}
+
+// current deployments of the user, the first message of a stream
+// the last event id is read before the deployments so every event up to it is already in them
+func GetDeploymentSnapshot(ctx context.Context, userID string) (*model.DeploymentSnapshot, error) {
+	lastEventID, err := storage.Deployments.LatestEventID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get latest event id: %w", err)
+	}
+
+	deployments, cacheInfos, err := GetAllUserDeployments(ctx, userID, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.DeploymentSnapshot{
+		Deployments: deployments,
+		Cache:       cacheInfos,
+		LastEventID: lastEventID,
+	}, nil
+}
+
+// changes of the user after afterID, oldest first
+// ok is false when the client is too far behind (or the id is unknown) and needs a new snapshot instead
+func ReplayDeploymentChanges(ctx context.Context, userID string, afterID int64) ([]model.DeploymentChangeEvent, bool, error) {
+	latest, err := storage.Deployments.LatestEventID(ctx, userID)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get latest event id: %w", err)
+	}
+	// ids from before a database reset
+	if afterID > latest {
+		return nil, false, nil
+	}
+
+	events, err := storage.Deployments.ListEventsAfter(ctx, userID, afterID, streamMaxReplay+1)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to list events: %w", err)
+	}
+	if len(events) > streamMaxReplay {
+		return nil, false, nil
+	}
+
+	changes := make([]model.DeploymentChangeEvent, 0, len(events))
+	for _, event := range events {
+		change := model.DeploymentChangeEvent{Type: event.Change(), Event: event}
+		// replayed changes carry the current cached state, not the one at the time of the event
+		if change.Type != model.DeploymentChangeRemoved {
+			if dep, err := storage.Deployments.Get(ctx, event.PlatformCredentialID, event.DeploymentID); err == nil {
+				change.Deployment = dep
+			}
+		}
+		changes = append(changes, change)
+	}
+	return changes, true, nil
+}
+
+// position of a stream in the events of its user, shared by the SSE and websocket streams
+// postgres hands out ids before commit so a lower id can become visible after a higher one was sent,
+// the ids sent recently are remembered and every catch up reads back from below them
+type StreamCursor struct {
+	userID string
+	after  int64               // every event up to it was sent or can't show up anymore
+	sent   map[int64]time.Time // sent above after, with when
+}
+
+// cursor of a stream that already has everything up to afterID (snapshot or Last-Event-ID)
+func NewStreamCursor(userID string, afterID int64) *StreamCursor {
+	return &StreamCursor{userID: userID, after: afterID, sent: make(map[int64]time.Time)}
+}
+
+// reports if the event was already sent on the stream
+func (c *StreamCursor) Sent(id int64) bool {
+	if id <= c.after {
+		return true
+	}
+	_, ok := c.sent[id]
+	return ok
+}
+
+// records an event sent outside CatchUp, ex by a replay on resume
+func (c *StreamCursor) MarkSent(id int64) {
+	if id > c.after {
+		c.sent[id] = time.Now()
+	}
+}
+
+// committed changes the stream didn't get yet, oldest first, they count as sent once returned
+// ok is false when the stream is too far behind and needs a new snapshot
+func (c *StreamCursor) CatchUp(ctx context.Context) ([]model.DeploymentChangeEvent, bool, error) {
+	changes, ok, err := ReplayDeploymentChanges(ctx, c.userID, c.after)
+	if err != nil || !ok {
+		return nil, ok, err
+	}
+
+	now := time.Now()
+	missed := changes[:0]
+	for _, change := range changes {
+		if _, sent := c.sent[change.Event.ID]; sent {
+			continue
+		}
+		c.sent[change.Event.ID] = now
+		missed = append(missed, change)
+	}
+
+	// ids sent before the settle window are final, nothing below them can commit anymore
+	var settled int64
+	for id, at := range c.sent {
+		if now.Sub(at) >= streamSettleWindow && id > settled {
+			settled = id
+		}
+	}
+	if settled > c.after {
+		c.after = settled
+		for id := range c.sent {
+			if id <= settled {
+				delete(c.sent, id)
+			}
+		}
+	}
+	return missed, true, nil
+}
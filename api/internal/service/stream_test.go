@@ -0,0 +1,74 @@
+package service
+
+import (
+	"checkmate/api/internal/model"
+	"checkmate/api/internal/storage"
+	"context"
+	"testing"
+	"time"
+)
+
+// event with a chosen id, the way a postgres transaction that got its id early commits it late
+func insertEventWithID(t *testing.T, cred *model.PlatformCredential, id int64) {
+	t.Helper()
+	_, err := storage.DB.ExecContext(context.Background(), `
+		INSERT INTO deployment_events (id, platform_credential_id, deployment_id, deployment_name, old_status, new_status, observed_at)
+		VALUES (?, ?, 'srv-1', 'api', 'live', 'failed', ?)`, id, cred.ID, time.Now().UTC())
+	if err != nil {
+		t.Fatalf("insert event %d: %v", id, err)
+	}
+}
+
+func caughtUpIDs(t *testing.T, cursor *StreamCursor) []int64 {
+	t.Helper()
+	changes, ok, err := cursor.CatchUp(context.Background())
+	if err != nil || !ok {
+		t.Fatalf("catch up: ok %v, %v", ok, err)
+	}
+	var ids []int64
+	for _, change := range changes {
+		ids = append(ids, change.Event.ID)
+	}
+	return ids
+}
+
+func TestStreamCursorSendsLateLowerIDs(t *testing.T) {
+	openTestDB(t)
+	cred := createTestCredential(t, "user-cursor")
+	cursor := NewStreamCursor(cred.UserID, 0)
+
+	insertEventWithID(t, cred, 2)
+	if ids := caughtUpIDs(t, cursor); len(ids) != 1 || ids[0] != 2 {
+		t.Fatalf("first catch up sent %v, want [2]", ids)
+	}
+	if !cursor.Sent(2) {
+		t.Fatal("2 isn't marked sent")
+	}
+
+	// 1 commits after 2 was sent, a cursor keeping only the highest id would skip it for good
+	insertEventWithID(t, cred, 1)
+	if cursor.Sent(1) {
+		t.Fatal("1 counts as sent before it was")
+	}
+	if ids := caughtUpIDs(t, cursor); len(ids) != 1 || ids[0] != 1 {
+		t.Fatalf("second catch up sent %v, want [1]", ids)
+	}
+	if ids := caughtUpIDs(t, cursor); len(ids) != 0 {
+		t.Fatalf("nothing new, catch up sent %v", ids)
+	}
+
+	// once the window passed the ids settle, the replay starts above them and they're still sent
+	for id := range cursor.sent {
+		cursor.sent[id] = time.Now().Add(-streamSettleWindow)
+	}
+	insertEventWithID(t, cred, 3)
+	if ids := caughtUpIDs(t, cursor); len(ids) != 1 || ids[0] != 3 {
+		t.Fatalf("catch up after settling sent %v, want [3]", ids)
+	}
+	if cursor.after != 2 || len(cursor.sent) != 1 {
+		t.Fatalf("cursor after %d with %d remembered ids, want after 2 and only 3 remembered", cursor.after, len(cursor.sent))
+	}
+	if !cursor.Sent(1) || !cursor.Sent(2) {
+		t.Fatal("settled ids don't count as sent")
+	}
+}
@@ -0,0 +1,503 @@
+package service
+
+import (
+	"bytes"
+	"checkmate/api/internal/model"
+	"checkmate/api/internal/storage"
+	"checkmate/api/internal/utils"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+//Webhook delivery worker -> sends the queued deliveries, retries failures with exponential backoff
+// every POST to a generic webhook is signed: X-Checkmate-Signature = "sha256=" + hex(hmac_sha256(secret, timestamp + "." + body))
+// with the unix timestamp from X-Checkmate-Timestamp, so receivers can reject replays of old requests
+// slack and discord messages go unsigned, the chats authenticate the url or the bot token, emails go over smtp
+
+const (
+	DefaultWebhookTimeout        = 10 * time.Second
+	DefaultWebhookMaxAttempts    = 6
+	DefaultWebhookRetryBaseDelay = 30 * time.Second // doubles after every failed attempt
+
+	webhookRetryMaxDelay = time.Hour
+	// how often the worker looks for due retries, new deliveries wake it right away
+	deliveryPollInterval = 5 * time.Second
+	deliveryBatchSize    = 20
+	// deliveries sent at the same time
+	deliveryConcurrency = 4
+	// response bodies are only read to reuse the connection, and kept as the error when small
+	maxWebhookResponseBytes = 64 << 10
+	maxWebhookErrorLength   = 200
+
+	webhookUserAgent = "checkmate-webhooks/1"
+)
+
+var (
+	WebhookTimeout        = DefaultWebhookTimeout
+	WebhookMaxAttempts    = DefaultWebhookMaxAttempts
+	WebhookRetryBaseDelay = DefaultWebhookRetryBaseDelay
+	// lets webhooks reach loopback and private addresses, off by default so a webhook can't be used
+	// to probe the network the server runs in
+	WebhookAllowPrivateNetworks = false
+
+	webhookClient = newWebhookClient()
+)
+
+// errors for addresses webhooks may not reach
+var errPrivateAddress = errors.New("webhook url resolves to a private or loopback address")
+
+// nudges the worker when new deliveries are queued
+var deliveryWake = make(chan struct{}, 1)
+
+// loads webhook settings from the environment
+// WEBHOOK_TIMEOUT and WEBHOOK_RETRY_BASE_DELAY are go durations, WEBHOOK_MAX_ATTEMPTS a count,
+// WEBHOOK_ALLOW_PRIVATE_NETWORKS=true allows local receivers (development)
+func InitWebhookSettings() error {
+	var err error
+
+	if WebhookTimeout, err = durationFromEnv("WEBHOOK_TIMEOUT", DefaultWebhookTimeout); err != nil {
+		return err
+	}
+	if WebhookRetryBaseDelay, err = durationFromEnv("WEBHOOK_RETRY_BASE_DELAY", DefaultWebhookRetryBaseDelay); err != nil {
+		return err
+	}
+
+	WebhookMaxAttempts = DefaultWebhookMaxAttempts
+	if v := os.Getenv("WEBHOOK_MAX_ATTEMPTS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return fmt.Errorf("invalid WEBHOOK_MAX_ATTEMPTS %q", v)
+		}
+		WebhookMaxAttempts = n
+	}
+
+	WebhookAllowPrivateNetworks = false
+	if v := os.Getenv("WEBHOOK_ALLOW_PRIVATE_NETWORKS"); v != "" {
+		allow, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid WEBHOOK_ALLOW_PRIVATE_NETWORKS %q", v)
+		}
+		WebhookAllowPrivateNetworks = allow
+	}
+
+	webhookClient = newWebhookClient()
+	return nil
+}
+
+// no proxy (it would hide the address actually dialed), no redirects (a 3xx is a failed delivery),
+// and the dialer checks every resolved address so dns can't point a webhook at the internal network
+func newWebhookClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 5 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			if WebhookAllowPrivateNetworks {
+				return nil
+			}
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+				ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsMulticast() {
+				return errPrivateAddress
+			}
+			return nil
+		},
+	}
+
+	return &http.Client{
+		Timeout: WebhookTimeout,
+		Transport: &http.Transport{
+			Proxy:               nil,
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: 5 * time.Second,
+			MaxIdleConnsPerHost: 2,
+			IdleConnTimeout:     90 * time.Second,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// how long a claimed delivery is kept from other workers, enough for one attempt
+func deliveryLease() time.Duration {
+	return 2*WebhookTimeout + 30*time.Second
+}
+
+// delay before the retry that follows attempt n (1 based)
+func webhookRetryDelay(attempt int) time.Duration {
+	delay := WebhookRetryBaseDelay
+	for i := 1; i < attempt && delay < webhookRetryMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > webhookRetryMaxDelay {
+		delay = webhookRetryMaxDelay
+	}
+	return delay
+}
+
+func wakeDeliveryWorker() {
+	select {
+	case deliveryWake <- struct{}{}:
+	default:
+	}
+}
+
+// sends due deliveries until ctx is cancelled
+// deliveries left pending by a stop are picked up again after the next start
+func StartWebhookDeliveries(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(deliveryPollInterval)
+		defer ticker.Stop()
+
+		for {
+			runDueDeliveries(ctx)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			case <-deliveryWake:
+			}
+		}
+	}()
+}
+
+// sends everything that is due, batch after batch
+func runDueDeliveries(ctx context.Context) {
+	logger := log.WithFields(log.Fields{
+		"func": "runDueDeliveries",
+	})
+
+	for ctx.Err() == nil {
+		now := time.Now()
+		claimed, err := storage.Webhooks.ClaimDueDeliveries(ctx, now, now.Add(deliveryLease()), deliveryBatchSize)
+		if err != nil {
+			if ctx.Err() == nil {
+				logger.WithError(err).Error("Failed to claim webhook deliveries")
+			}
+			return
+		}
+		if len(claimed) == 0 {
+			return
+		}
+
+		var wg sync.WaitGroup
+		sem := make(chan struct{}, deliveryConcurrency)
+		for i := range claimed {
+			sem <- struct{}{}
+			wg.Add(1)
+			go func(c *storage.ClaimedDelivery) {
+				defer func() {
+					<-sem
+					wg.Done()
+				}()
+				if err := attemptDelivery(ctx, c, false); err != nil && ctx.Err() == nil {
+					logger.WithError(err).WithField("delivery_id", c.Delivery.ID).Error("Failed to record webhook delivery")
+				}
+			}(&claimed[i])
+		}
+		wg.Wait()
+
+		// a partial batch means nothing else is due
+		if len(claimed) < deliveryBatchSize {
+			return
+		}
+	}
+}
+
+// sends one attempt of a claimed delivery and records the outcome, c.Delivery is updated with it
+// final makes a failure permanent instead of scheduling a retry
+func attemptDelivery(ctx context.Context, c *storage.ClaimedDelivery, final bool) error {
+	d := &c.Delivery
+	logger := log.WithFields(log.Fields{
+		"func":        "attemptDelivery",
+		"webhook_id":  d.WebhookID,
+		"delivery_id": d.ID,
+		"event_type":  d.EventType,
+		"attempt":     d.Attempts + 1,
+		"request_id":  ctx.Value("request_id"),
+	})
+
+	start := time.Now()
+	responseStatus, sendErr := sendWebhook(ctx, c)
+	// the worker was stopped mid request, the lease runs out and the delivery is sent again later
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	attempt := storage.DeliveryAttempt{
+		Status:     model.WebhookDeliverySucceeded,
+		DurationMs: time.Since(start).Milliseconds(),
+		At:         time.Now(),
+	}
+	if responseStatus != 0 {
+		attempt.ResponseStatus = &responseStatus
+	}
+
+	if sendErr != nil {
+		attempt.Error = sendErr.Error()
+		if final || d.Attempts+1 >= WebhookMaxAttempts {
+			attempt.Status = model.WebhookDeliveryFailed
+			logger.WithError(sendErr).Warn("Webhook delivery failed, giving up")
+		} else {
+			attempt.Status = model.WebhookDeliveryPending
+			next := attempt.At.Add(webhookRetryDelay(d.Attempts + 1))
+			attempt.NextAttemptAt = &next
+			logger.WithError(sendErr).WithField("next_attempt_at", next).Info("Webhook delivery failed, will retry")
+		}
+	} else {
+		logger.WithField("duration_ms", attempt.DurationMs).Debug("Webhook delivered")
+	}
+
+	// the attempt happened, it is recorded even if ctx ends meanwhile
+	if err := storage.Webhooks.RecordDeliveryAttempt(context.WithoutCancel(ctx), d.ID, attempt); err != nil {
+		return fmt.Errorf("failed to record delivery attempt: %w", err)
+	}
+
+	d.Status = attempt.Status
+	d.Attempts++
+	d.ResponseStatus = attempt.ResponseStatus
+	d.Error = attempt.Error
+	d.DurationMs = &attempt.DurationMs
+	d.NextAttemptAt = attempt.NextAttemptAt
+	if attempt.NextAttemptAt == nil {
+		d.CompletedAt = &attempt.At
+	}
+	return nil
+}
+
+// sends the payload the way the webhook type wants it
+// returns the response status (0 when there was no response) and why the delivery failed
+func sendWebhook(ctx context.Context, c *storage.ClaimedDelivery) (int, error) {
+	switch c.Webhook.Type {
+	case model.WebhookTypeSlack:
+		if c.Webhook.SlackChannel != "" {
+			return sendSlackMessage(ctx, c)
+		}
+		return postWebhook(ctx, c.Webhook.URL, c.Delivery.Payload, nil, nil)
+	case model.WebhookTypeDiscord:
+		return sendDiscordMessage(ctx, c)
+	case model.WebhookTypeEmail:
+		return sendEmailDelivery(ctx, c)
+	}
+	return sendSignedWebhook(ctx, c)
+}
+
+// mails the queued message to the current recipients of the webhook
+func sendEmailDelivery(ctx context.Context, c *storage.ClaimedDelivery) (int, error) {
+	to, err := emailRecipients(c.Webhook.URL)
+	if err != nil {
+		return 0, err
+	}
+	var msg model.EmailMessage
+	if err := json.Unmarshal(c.Delivery.Payload, &msg); err != nil {
+		return 0, fmt.Errorf("invalid email message: %w", err)
+	}
+	return sendEmail(ctx, to, &msg, map[string]string{
+		"X-Checkmate-Event":    string(c.Delivery.EventType),
+		"X-Checkmate-Delivery": strconv.FormatInt(c.Delivery.ID, 10),
+	})
+}
+
+// POSTs the payload signed with the webhook secret
+func sendSignedWebhook(ctx context.Context, c *storage.ClaimedDelivery) (int, error) {
+	secret, err := utils.DecryptString(c.Webhook.Secret)
+	if err != nil {
+		return 0, fmt.Errorf("failed to decrypt webhook secret: %w", err)
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(c.Delivery.Payload)
+
+	return postWebhook(ctx, c.Webhook.URL, c.Delivery.Payload, http.Header{
+		"X-Checkmate-Event":     {string(c.Delivery.EventType)},
+		"X-Checkmate-Delivery":  {strconv.FormatInt(c.Delivery.ID, 10)},
+		"X-Checkmate-Timestamp": {timestamp},
+		"X-Checkmate-Signature": {"sha256=" + hex.EncodeToString(mac.Sum(nil))},
+	}, nil)
+}
+
+// chat.postMessage with the bot token, replies go to the thread of the first message of the deploy
+// slack answers 200 with ok false for most errors, that is a failed delivery too
+func sendSlackMessage(ctx context.Context, c *storage.ClaimedDelivery) (int, error) {
+	token, err := utils.DecryptString(c.Webhook.Secret)
+	if err != nil {
+		return 0, fmt.Errorf("failed to decrypt slack bot token: %w", err)
+	}
+
+	var message map[string]interface{}
+	if err := json.Unmarshal(c.Delivery.Payload, &message); err != nil {
+		return 0, fmt.Errorf("invalid slack message: %w", err)
+	}
+	message["channel"] = c.Webhook.SlackChannel
+
+	threadRef, err := deliveryThread(ctx, c)
+	if err != nil {
+		return 0, err
+	}
+	if threadRef != "" {
+		message["thread_ts"] = threadRef
+	}
+
+	body, err := json.Marshal(message)
+	if err != nil {
+		return 0, fmt.Errorf("invalid slack message: %w", err)
+	}
+
+	var result struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+		TS    string `json:"ts"`
+	}
+	status, err := postWebhook(ctx, c.Webhook.URL, body, http.Header{
+		"Authorization": {"Bearer " + token},
+	}, &result)
+	if err != nil {
+		return status, err
+	}
+	if !result.OK {
+		return status, fmt.Errorf("slack error: %s", result.Error)
+	}
+
+	if threadRef == "" {
+		saveDeliveryThread(ctx, c, result.TS)
+	}
+	return status, nil
+}
+
+// posts to the discord webhook and waits for the message, in a forum the first message of a deploy
+// opens a post and the next ones go to it
+func sendDiscordMessage(ctx context.Context, c *storage.ClaimedDelivery) (int, error) {
+	u, err := url.Parse(c.Webhook.URL)
+	if err != nil {
+		return 0, fmt.Errorf("invalid webhook url: %w", err)
+	}
+	query := u.Query()
+	query.Set("wait", "true")
+
+	body := []byte(c.Delivery.Payload)
+	threadRef := ""
+	if c.Webhook.DiscordForum {
+		if threadRef, err = deliveryThread(ctx, c); err != nil {
+			return 0, err
+		}
+		if threadRef != "" {
+			query.Set("thread_id", threadRef)
+		} else {
+			var message map[string]interface{}
+			if err := json.Unmarshal(c.Delivery.Payload, &message); err != nil {
+				return 0, fmt.Errorf("invalid discord message: %w", err)
+			}
+			message["thread_name"] = discordThreadName(message, string(c.Delivery.EventType))
+			if body, err = json.Marshal(message); err != nil {
+				return 0, fmt.Errorf("invalid discord message: %w", err)
+			}
+		}
+	}
+	u.RawQuery = query.Encode()
+
+	var result struct {
+		ChannelID string `json:"channel_id"`
+	}
+	status, err := postWebhook(ctx, u.String(), body, nil, &result)
+	if err != nil {
+		return status, err
+	}
+
+	// the message opening a forum post is in the new thread, its channel is the thread id
+	if c.Webhook.DiscordForum && threadRef == "" {
+		saveDeliveryThread(ctx, c, result.ChannelID)
+	}
+	return status, nil
+}
+
+// thread the delivery replies to, empty when it isn't threaded or is the first message of its deploy
+func deliveryThread(ctx context.Context, c *storage.ClaimedDelivery) (string, error) {
+	if c.Delivery.ThreadKey == "" {
+		return "", nil
+	}
+	ref, err := storage.Webhooks.GetThread(ctx, c.Webhook.ID, c.Delivery.ThreadKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to get thread: %w", err)
+	}
+	return ref, nil
+}
+
+// keeps the message that was just sent as the thread of its deploy
+// the message is out already, a failure here only costs the threading of the next ones
+func saveDeliveryThread(ctx context.Context, c *storage.ClaimedDelivery, ref string) {
+	if c.Delivery.ThreadKey == "" || ref == "" {
+		return
+	}
+	err := storage.Webhooks.SaveThread(context.WithoutCancel(ctx), c.Webhook.ID, c.Delivery.ThreadKey, ref, time.Now())
+	if err != nil {
+		log.WithFields(log.Fields{
+			"func":        "saveDeliveryThread",
+			"webhook_id":  c.Webhook.ID,
+			"delivery_id": c.Delivery.ID,
+		}).WithError(err).Error("Failed to save webhook thread")
+	}
+}
+
+// POSTs a json body, any 2xx is a success and is decoded into result when it isn't nil
+func postWebhook(ctx context.Context, target string, payload []byte, header http.Header, result interface{}) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(payload))
+	if err != nil {
+		return 0, fmt.Errorf("invalid webhook request: %w", err)
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.Header.Set("User-Agent", webhookUserAgent)
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		if errors.Is(err, errPrivateAddress) {
+			return 0, errPrivateAddress
+		}
+		return 0, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxWebhookResponseBytes))
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		if result != nil {
+			if err := json.Unmarshal(body, result); err != nil {
+				return resp.StatusCode, fmt.Errorf("invalid response: %w", err)
+			}
+		}
+		return resp.StatusCode, nil
+	}
+
+	msg := fmt.Sprintf("unexpected status %d", resp.StatusCode)
+	if snippet := bytes.TrimSpace(body); len(snippet) > 0 {
+		if len(snippet) > maxWebhookErrorLength {
+			snippet = snippet[:maxWebhookErrorLength]
+		}
+		msg += ": " + strings.ToValidUTF8(string(snippet), "")
+	}
+	return resp.StatusCode, errors.New(msg)
+}
@@ -0,0 +1,658 @@
+package service
+
+import (
+	"checkmate/api/internal/model"
+	"checkmate/api/internal/storage"
+	"checkmate/api/internal/utils"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+//Outbound webhooks CRUD and the deployment events they get
+// -> every matching event is queued as a delivery, the delivery worker sends it (see webhook_delivery.go)
+// a webhook is a generic signed json endpoint, a slack or discord channel getting formatted messages (see chat.go),
+// or email addresses (see email.go)
+
+const (
+	MaxWebhooksPerUser    = 10
+	MaxWebhookURLLength   = 2048
+	MaxSlackChannelLength = 100
+	DefaultDeliveryLimit  = 50
+	MaxDeliveryLimit      = 200
+
+	webhookSecretPrefix = "whsec_"
+)
+
+// event types a webhook can subscribe to, in the order they are documented
+var WebhookEventTypes = []model.WebhookEventType{
+	model.WebhookEventDeploymentFailed,
+	model.WebhookEventDeploymentRecovered,
+	model.WebhookEventDeploymentDeploying,
+	model.WebhookEventDeploymentSucceeded,
+	model.WebhookEventDigest,
+}
+
+// type of webhook event a deployment event stands for, false when webhooks don't care about it
+// deployments seen for the first time don't count, the first refresh of a credential would notify everything
+// settled is where the deployment last settled before the event (settledStatusBefore), going live after a failure
+// is a recovery even when a deploy ran in between
+func webhookEventType(event model.DeploymentEvent, settled model.DeploymentStatus) (model.WebhookEventType, bool) {
+	if event.OldStatus == "" || event.OldStatus == event.NewStatus {
+		return "", false
+	}
+	switch {
+	case event.NewStatus == model.DeploymentStatusFailed:
+		return model.WebhookEventDeploymentFailed, true
+	case event.NewStatus == model.DeploymentStatusLive && settled == model.DeploymentStatusFailed:
+		return model.WebhookEventDeploymentRecovered, true
+	case event.NewStatus == model.DeploymentStatusDeploying:
+		return model.WebhookEventDeploymentDeploying, true
+	case event.OldStatus == model.DeploymentStatusDeploying && event.NewStatus == model.DeploymentStatusLive:
+		return model.WebhookEventDeploymentSucceeded, true
+	}
+	return "", false
+}
+
+// live or failed, whichever the deployment was in last before the event, empty when unknown
+// only looked up for events going live, the only ones it changes the type of
+func settledStatusBefore(ctx context.Context, event *model.DeploymentEvent) model.DeploymentStatus {
+	if event.NewStatus != model.DeploymentStatusLive {
+		return ""
+	}
+	switch event.OldStatus {
+	case "", model.DeploymentStatusLive, model.DeploymentStatusFailed:
+		return event.OldStatus
+	}
+
+	status, err := storage.Deployments.LastSettledStatus(ctx, event.PlatformCredentialID, event.DeploymentID, event.ID)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"func":          "settledStatusBefore",
+			"credential_id": event.PlatformCredentialID,
+			"deployment_id": event.DeploymentID,
+			"request_id":    ctx.Value("request_id"),
+		}).WithError(err).Warn("Failed to read the last settled status, assuming none")
+		return ""
+	}
+	return status
+}
+
+// checks a webhook input against its type, the url and channel are trimmed and the lists deduplicated
+// slack with a channel always posts to chat.postMessage, the url of the input is ignored
+// the credentials of the filter are checked against the user's in checkWebhookCredentials
+func ValidateWebhookInput(input *model.WebhookInput) error {
+	if input.Type == "" {
+		input.Type = model.WebhookTypeGeneric
+	}
+	input.URL = strings.TrimSpace(input.URL)
+	input.SlackChannel = strings.TrimSpace(input.SlackChannel)
+	input.SlackBotToken = strings.TrimSpace(input.SlackBotToken)
+
+	switch input.Type {
+	case model.WebhookTypeGeneric, model.WebhookTypeSlack, model.WebhookTypeDiscord, model.WebhookTypeEmail:
+	default:
+		return newError(ErrInvalidInput, "invalid type %q, expected generic, slack, discord or email", input.Type)
+	}
+	if input.Type != model.WebhookTypeSlack && (input.SlackChannel != "" || input.SlackBotToken != "") {
+		return newError(ErrInvalidInput, "slackChannel and slackBotToken are for slack webhooks only")
+	}
+	if input.Type != model.WebhookTypeDiscord && input.DiscordForum {
+		return newError(ErrInvalidInput, "discordForum is for discord webhooks only")
+	}
+
+	if input.Type == model.WebhookTypeSlack && input.SlackChannel != "" {
+		if len(input.SlackChannel) > MaxSlackChannelLength {
+			return newError(ErrInvalidInput, "slackChannel is too long (max %d characters)", MaxSlackChannelLength)
+		}
+		input.URL = slackPostMessageURL
+	} else if input.Type == model.WebhookTypeEmail {
+		recipients, err := emailRecipients(input.URL)
+		if err != nil {
+			return err
+		}
+		input.URL = "mailto:" + strings.Join(recipients, ",")
+	} else {
+		if input.SlackBotToken != "" {
+			return newError(ErrInvalidInput, "slackBotToken needs a slackChannel")
+		}
+		if input.URL == "" {
+			return newError(ErrInvalidInput, "url is required")
+		}
+		if len(input.URL) > MaxWebhookURLLength {
+			return newError(ErrInvalidInput, "url is too long (max %d characters)", MaxWebhookURLLength)
+		}
+		u, err := url.Parse(input.URL)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return newError(ErrInvalidInput, "url must be an absolute http or https url")
+		}
+		if input.Type != model.WebhookTypeGeneric {
+			if err := validateChatURL(input.Type, u); err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(input.EventTypes) == 0 {
+		return newError(ErrInvalidInput, "at least one event type is required")
+	}
+	seen := make(map[model.WebhookEventType]bool, len(input.EventTypes))
+	types := input.EventTypes[:0]
+	for _, t := range input.EventTypes {
+		if !isWebhookEventType(t) {
+			return newError(ErrInvalidInput, "unknown event type %q", t)
+		}
+		if t == model.WebhookEventDigest && input.Type != model.WebhookTypeEmail {
+			return newError(ErrInvalidInput, "%s is for email webhooks only", t)
+		}
+		if !seen[t] {
+			seen[t] = true
+			types = append(types, t)
+		}
+	}
+	input.EventTypes = types
+
+	seenStatuses := make(map[model.DeploymentStatus]bool, len(input.Statuses))
+	statuses := []model.DeploymentStatus{}
+	for _, status := range input.Statuses {
+		switch status {
+		case model.DeploymentStatusLive, model.DeploymentStatusDeploying, model.DeploymentStatusCanceled,
+			model.DeploymentStatusFailed, model.DeploymentStatusUnknown, model.DeploymentStatusGone:
+		default:
+			return newError(ErrInvalidInput, "invalid status %q", status)
+		}
+		if !seenStatuses[status] {
+			seenStatuses[status] = true
+			statuses = append(statuses, status)
+		}
+	}
+	input.Statuses = statuses
+
+	seenCredentials := make(map[int]bool, len(input.CredentialIDs))
+	credentialIDs := []int{}
+	for _, id := range input.CredentialIDs {
+		if !seenCredentials[id] {
+			seenCredentials[id] = true
+			credentialIDs = append(credentialIDs, id)
+		}
+	}
+	input.CredentialIDs = credentialIDs
+	return nil
+}
+
+// every credential of the filter has to be one of the user's
+func checkWebhookCredentials(ctx context.Context, logger *log.Entry, userID string, ids []int) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	creds, err := storage.Credentials.ListByUser(ctx, userID)
+	if err != nil {
+		logger.WithError(err).Error("Failed to query credentials")
+		return fmt.Errorf("failed to query credentials: %w", err)
+	}
+	owned := make(map[int]bool, len(creds))
+	for _, cred := range creds {
+		owned[cred.ID] = true
+	}
+	for _, id := range ids {
+		if !owned[id] {
+			return newError(ErrInvalidInput, "credential %d not found", id)
+		}
+	}
+	return nil
+}
+
+func isWebhookEventType(t model.WebhookEventType) bool {
+	for _, known := range WebhookEventTypes {
+		if t == known {
+			return true
+		}
+	}
+	return false
+}
+
+func hasEventType(hook *model.Webhook, t model.WebhookEventType) bool {
+	for _, subscribed := range hook.EventTypes {
+		if subscribed == t {
+			return true
+		}
+	}
+	return false
+}
+
+// the credential and status filters of the webhook let the event through
+func matchesWebhookFilters(hook *model.Webhook, event *model.DeploymentEvent) bool {
+	if len(hook.CredentialIDs) > 0 && !slices.Contains(hook.CredentialIDs, event.PlatformCredentialID) {
+		return false
+	}
+	if len(hook.Statuses) > 0 && !slices.Contains(hook.Statuses, event.NewStatus) {
+		return false
+	}
+	return true
+}
+
+// webhooks of the user, secrets left out
+func GetWebhooks(ctx context.Context, userID string) ([]model.Webhook, error) {
+	logger := log.WithFields(log.Fields{
+		"func":       "GetWebhooks",
+		"user_id":    userID,
+		"request_id": ctx.Value("request_id"),
+	})
+
+	webhooks, err := storage.Webhooks.ListByUser(ctx, userID)
+	if err != nil {
+		logger.WithError(err).Error("Failed to query webhooks")
+		return nil, fmt.Errorf("failed to query webhooks: %w", err)
+	}
+	for i := range webhooks {
+		webhooks[i].Secret = ""
+	}
+
+	logger.WithField("webhooks_count", len(webhooks)).Debug("Retrieved webhooks successfully")
+	return webhooks, nil
+}
+
+// webhook of the user with its secret still encrypted
+func getWebhook(ctx context.Context, logger *log.Entry, id int, userID string) (*model.Webhook, error) {
+	hook, err := storage.Webhooks.GetByID(ctx, id, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		// other users' webhooks look the same as missing ones
+		logger.Warn("Webhook not found")
+		return nil, newError(ErrNotFound, "webhook %d not found", id)
+	} else if err != nil {
+		logger.WithError(err).Error("Failed to get webhook")
+		return nil, fmt.Errorf("failed to get webhook: %w", err)
+	}
+	return hook, nil
+}
+
+// registers a webhook, a generic one is returned with its signing secret in clear, the only time it is shown
+func CreateWebhook(ctx context.Context, userID string, input *model.WebhookInput) (*model.Webhook, error) {
+	logger := log.WithFields(log.Fields{
+		"func":       "CreateWebhook",
+		"user_id":    userID,
+		"request_id": ctx.Value("request_id"),
+	})
+
+	logger.Debug("Creating webhook started")
+
+	if err := ValidateWebhookInput(input); err != nil {
+		logger.WithError(err).Warn("Validation failed for webhook")
+		return nil, err
+	}
+	if input.Type == model.WebhookTypeEmail && !EmailEnabled() {
+		logger.Warn("Email webhook refused, email is not configured")
+		return nil, newError(ErrInvalidInput, "%s", errEmailDisabled)
+	}
+
+	existing, err := storage.Webhooks.ListByUser(ctx, userID)
+	if err != nil {
+		logger.WithError(err).Error("Failed to query webhooks")
+		return nil, fmt.Errorf("failed to query webhooks: %w", err)
+	}
+	if len(existing) >= MaxWebhooksPerUser {
+		logger.Warn("Webhook limit reached")
+		return nil, newError(ErrConflict, "webhook limit reached (max %d)", MaxWebhooksPerUser)
+	}
+	if err := checkWebhookCredentials(ctx, logger, userID, input.CredentialIDs); err != nil {
+		return nil, err
+	}
+
+	hook := &model.Webhook{
+		UserID:    userID,
+		Enabled:   input.Enabled == nil || *input.Enabled,
+		CreatedAt: time.Now(),
+	}
+	applyWebhookInput(hook, input)
+
+	secret, err := webhookSecret(hook, input, "")
+	if err != nil {
+		logger.WithError(err).Warn("Failed to set webhook secret")
+		return nil, err
+	}
+
+	hook.ID, err = storage.Webhooks.Create(ctx, hook)
+	if err != nil {
+		logger.WithError(err).Error("Failed to create webhook in database")
+		return nil, fmt.Errorf("failed to create webhook: %w", err)
+	}
+
+	hook.Secret = secret
+	logger.WithFields(log.Fields{
+		"webhook_id": hook.ID,
+		"type":       hook.Type,
+	}).Info("Webhook created successfully")
+	return hook, nil
+}
+
+// copies the validated input, enabled is left to the caller
+func applyWebhookInput(hook *model.Webhook, input *model.WebhookInput) {
+	hook.Type = input.Type
+	hook.URL = input.URL
+	hook.EventTypes = input.EventTypes
+	hook.CredentialIDs = input.CredentialIDs
+	hook.Statuses = input.Statuses
+	hook.SlackChannel = input.SlackChannel
+	hook.DiscordForum = input.DiscordForum
+}
+
+// sets hook.Secret to what its type needs, encrypted, previousType is the type the webhook had (empty on create)
+// returns the signing secret in clear when a new one was generated, it is shown once
+func webhookSecret(hook *model.Webhook, input *model.WebhookInput, previousType model.WebhookType) (string, error) {
+	switch {
+	case hook.Type == model.WebhookTypeGeneric:
+		if previousType == model.WebhookTypeGeneric {
+			return "", nil
+		}
+		secret, err := newWebhookSecret()
+		if err != nil {
+			return "", fmt.Errorf("failed to generate webhook secret: %w", err)
+		}
+		if hook.Secret, err = utils.EncryptString(secret); err != nil {
+			return "", fmt.Errorf("failed to encrypt webhook secret: %w", err)
+		}
+		return secret, nil
+
+	case hook.Type == model.WebhookTypeSlack && hook.SlackChannel != "":
+		if input.SlackBotToken == "" {
+			// the token of a webhook that already posted with one is kept
+			if previousType == model.WebhookTypeSlack && hook.Secret != "" {
+				return "", nil
+			}
+			return "", newError(ErrInvalidInput, "slackBotToken is required with a slackChannel")
+		}
+		token, err := utils.EncryptString(input.SlackBotToken)
+		if err != nil {
+			return "", fmt.Errorf("failed to encrypt slack bot token: %w", err)
+		}
+		hook.Secret = token
+		return "", nil
+	}
+
+	// incoming webhook urls are the credential themselves
+	hook.Secret = ""
+	return "", nil
+}
+
+// replaces the webhook settings, enabled only changes when it is set
+// a webhook becoming generic gets a new signing secret, returned like on create
+func UpdateWebhook(ctx context.Context, id int, userID string, input *model.WebhookInput) (*model.Webhook, error) {
+	logger := log.WithFields(log.Fields{
+		"func":       "UpdateWebhook",
+		"webhook_id": id,
+		"user_id":    userID,
+		"request_id": ctx.Value("request_id"),
+	})
+
+	logger.Debug("Updating webhook started")
+
+	if err := ValidateWebhookInput(input); err != nil {
+		logger.WithError(err).Warn("Validation failed for webhook")
+		return nil, err
+	}
+
+	if input.Type == model.WebhookTypeEmail && !EmailEnabled() {
+		logger.Warn("Email webhook refused, email is not configured")
+		return nil, newError(ErrInvalidInput, "%s", errEmailDisabled)
+	}
+
+	hook, err := getWebhook(ctx, logger, id, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkWebhookCredentials(ctx, logger, userID, input.CredentialIDs); err != nil {
+		return nil, err
+	}
+
+	previousType := hook.Type
+	// a slack bot token only stays with a webhook that was already posting with one
+	if previousType == model.WebhookTypeSlack && hook.SlackChannel == "" {
+		hook.Secret = ""
+	}
+	applyWebhookInput(hook, input)
+	if input.Enabled != nil {
+		hook.Enabled = *input.Enabled
+	}
+
+	secret, err := webhookSecret(hook, input, previousType)
+	if err != nil {
+		logger.WithError(err).Warn("Failed to set webhook secret")
+		return nil, err
+	}
+
+	found, err := storage.Webhooks.Update(ctx, hook)
+	if err != nil {
+		logger.WithError(err).Error("Failed to update webhook in database")
+		return nil, fmt.Errorf("failed to update webhook: %w", err)
+	}
+	// deleted in between
+	if !found {
+		logger.Warn("Webhook not found")
+		return nil, newError(ErrNotFound, "webhook %d not found", id)
+	}
+
+	hook.Secret = secret
+	logger.Info("Webhook updated successfully")
+	return hook, nil
+}
+
+// removes the webhook with its delivery log, pending deliveries are dropped
+func DeleteWebhook(ctx context.Context, id int, userID string) error {
+	logger := log.WithFields(log.Fields{
+		"func":       "DeleteWebhook",
+		"webhook_id": id,
+		"user_id":    userID,
+		"request_id": ctx.Value("request_id"),
+	})
+
+	found, err := storage.Webhooks.Delete(ctx, id, userID)
+	if err != nil {
+		logger.WithError(err).Error("Failed to delete webhook from database")
+		return fmt.Errorf("failed to delete webhook: %w", err)
+	}
+	if !found {
+		logger.Warn("Webhook not found")
+		return newError(ErrNotFound, "webhook %d not found", id)
+	}
+
+	logger.Info("Webhook deleted successfully")
+	return nil
+}
+
+// delivery log of a webhook, newest first, beforeID pages back from the last id of the previous page
+func GetWebhookDeliveries(ctx context.Context, id int, userID string, beforeID int64, limit int) ([]model.WebhookDelivery, error) {
+	logger := log.WithFields(log.Fields{
+		"func":       "GetWebhookDeliveries",
+		"webhook_id": id,
+		"user_id":    userID,
+		"request_id": ctx.Value("request_id"),
+	})
+
+	if limit <= 0 {
+		limit = DefaultDeliveryLimit
+	}
+	if limit > MaxDeliveryLimit {
+		return nil, newError(ErrInvalidInput, "limit must be at most %d", MaxDeliveryLimit)
+	}
+
+	if _, err := getWebhook(ctx, logger, id, userID); err != nil {
+		return nil, err
+	}
+
+	deliveries, err := storage.Webhooks.ListDeliveries(ctx, id, beforeID, limit)
+	if err != nil {
+		logger.WithError(err).Error("Failed to query webhook deliveries")
+		return nil, fmt.Errorf("failed to query webhook deliveries: %w", err)
+	}
+
+	logger.WithField("deliveries_count", len(deliveries)).Debug("Retrieved webhook deliveries successfully")
+	return deliveries, nil
+}
+
+// sends a webhook.test event right away, once and without retries, and returns how it went
+// works on disabled webhooks too so they can be checked before being turned on
+func SendTestWebhook(ctx context.Context, id int, userID string) (*model.WebhookDelivery, error) {
+	logger := log.WithFields(log.Fields{
+		"func":       "SendTestWebhook",
+		"webhook_id": id,
+		"user_id":    userID,
+		"request_id": ctx.Value("request_id"),
+	})
+
+	hook, err := getWebhook(ctx, logger, id, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	payload, err := webhookPayload(hook.Type, model.WebhookEventTest, "", nil, nil, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode webhook payload: %w", err)
+	}
+
+	// the lease keeps the worker away from it while it is sent here
+	lease := now.Add(deliveryLease())
+	delivery := &model.WebhookDelivery{
+		WebhookID:     hook.ID,
+		EventType:     model.WebhookEventTest,
+		Payload:       payload,
+		Status:        model.WebhookDeliveryPending,
+		CreatedAt:     now,
+		NextAttemptAt: &lease,
+	}
+	if delivery.ID, err = storage.Webhooks.CreateDelivery(ctx, delivery); err != nil {
+		logger.WithError(err).Error("Failed to queue test delivery")
+		return nil, fmt.Errorf("failed to queue test delivery: %w", err)
+	}
+
+	// detached from the request, a test delivery left pending would be retried by the worker
+	claimed := storage.ClaimedDelivery{Delivery: *delivery, Webhook: *hook}
+	if err := attemptDelivery(context.WithoutCancel(ctx), &claimed, true); err != nil {
+		return nil, err
+	}
+
+	logger.WithFields(log.Fields{
+		"delivery_id": delivery.ID,
+		"status":      claimed.Delivery.Status,
+	}).Info("Test webhook sent")
+	return &claimed.Delivery, nil
+}
+
+// queues a delivery for every enabled webhook of the user that subscribed to the events, whose filters match
+// and that the notification rules of the user let through (see rules.go), and the escalations the rules ask for
+// deployments is the cache after the write, errors are logged, they never fail the refresh
+func queueWebhookDeliveries(ctx context.Context, cred *model.PlatformCredential, events []model.DeploymentEvent, deployments []model.Deployment) {
+	logger := log.WithFields(log.Fields{
+		"func":          "queueWebhookDeliveries",
+		"credential_id": cred.ID,
+		"user_id":       cred.UserID,
+		"request_id":    ctx.Value("request_id"),
+	})
+
+	var notify []model.DeploymentEvent
+	var eventTypes []model.WebhookEventType
+	for i := range events {
+		if eventType, ok := webhookEventType(events[i], settledStatusBefore(ctx, &events[i])); ok {
+			notify = append(notify, events[i])
+			eventTypes = append(eventTypes, eventType)
+		}
+	}
+	if len(notify) == 0 {
+		return
+	}
+
+	webhooks, err := storage.Webhooks.ListByUser(ctx, cred.UserID)
+	if err != nil {
+		logger.WithError(err).Error("Failed to query webhooks")
+		return
+	}
+
+	// rules that can't be read don't hold back the events, every subscribed webhook gets them
+	rules, err := storage.Rules.ListByUser(ctx, cred.UserID)
+	if err != nil {
+		logger.WithError(err).Error("Failed to query notification rules")
+	}
+
+	byID := make(map[string]*model.Deployment, len(deployments))
+	for i := range deployments {
+		byID[deployments[i].ID] = &deployments[i]
+	}
+
+	now := time.Now()
+	queued := 0
+	for i := range notify {
+		event := notify[i]
+		eventType := eventTypes[i]
+
+		plan, err := planNotifications(ctx, rules, webhooks, &event, eventType, byID[event.DeploymentID], event.ObservedAt)
+		if err != nil {
+			logger.WithError(err).WithField("event_id", event.ID).Error("Failed to apply notification rules")
+			plan, _ = planNotifications(ctx, nil, webhooks, &event, eventType, byID[event.DeploymentID], event.ObservedAt)
+		}
+		deliver := make(map[int]bool, len(plan.Webhooks))
+		for _, decision := range plan.Webhooks {
+			deliver[decision.WebhookID] = decision.Deliver
+		}
+		queueEscalations(ctx, logger, &event, plan.Escalations, now)
+
+		// same body for every webhook of a type, built once
+		payloads := make(map[model.WebhookType][]byte)
+		for j := range webhooks {
+			hook := &webhooks[j]
+			if !deliver[hook.ID] {
+				continue
+			}
+
+			payload, ok := payloads[hook.Type]
+			if !ok {
+				payload, err = webhookPayload(hook.Type, eventType, cred.Platform, &event, byID[event.DeploymentID], now)
+				if err != nil {
+					logger.WithError(err).WithField("webhook_id", hook.ID).Error("Failed to encode webhook payload")
+					continue
+				}
+				payloads[hook.Type] = payload
+			}
+
+			delivery := &model.WebhookDelivery{
+				WebhookID:     hook.ID,
+				EventType:     eventType,
+				EventID:       &event.ID,
+				Payload:       payload,
+				Status:        model.WebhookDeliveryPending,
+				CreatedAt:     now,
+				NextAttemptAt: &now,
+			}
+			if hook.Threaded() {
+				delivery.ThreadKey = webhookThreadKey(&event)
+			}
+			if _, err := storage.Webhooks.CreateDelivery(ctx, delivery); err != nil {
+				logger.WithError(err).WithField("webhook_id", hook.ID).Error("Failed to queue webhook delivery")
+				continue
+			}
+			queued++
+		}
+	}
+
+	if queued > 0 {
+		logger.WithField("deliveries_count", queued).Debug("Queued webhook deliveries")
+		wakeDeliveryWorker()
+	}
+}
+
+// random signing secret, shown to the user once
+func newWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return webhookSecretPrefix + hex.EncodeToString(b), nil
+}
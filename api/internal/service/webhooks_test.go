@@ -0,0 +1,59 @@
+package service
+
+import (
+	"checkmate/api/internal/model"
+	"checkmate/api/internal/storage"
+	"context"
+	"sort"
+	"testing"
+)
+
+// a failed deployment that goes live through a new deploy is a recovery, a healthy one redeploying isn't
+func TestWebhookEventTypeUsesLastSettledStatus(t *testing.T) {
+	openTestDB(t)
+	cred := createTestCredential(t, "user-recovered")
+	render := startFakeRender(t, renderService("srv-1", "api", "live"))
+	ctx := context.Background()
+
+	refresh := func(status string) {
+		t.Helper()
+		render.setStatus("srv-1", status)
+		if _, _, err := GetFreshOrUpdateCache(ctx, cred, true); err != nil {
+			t.Fatalf("refresh to %s: %v", status, err)
+		}
+	}
+	refresh("live")
+	refresh("failed")
+	refresh("deploying")
+	refresh("live")
+	refresh("deploying")
+	refresh("live")
+
+	events, err := storage.Deployments.ListEvents(ctx, cred.UserID, model.DeploymentEventFilter{CredentialID: &cred.ID, Limit: 100})
+	if err != nil {
+		t.Fatalf("list events: %v", err)
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].ID < events[j].ID })
+
+	var got []model.WebhookEventType
+	for i := range events {
+		if eventType, ok := webhookEventType(events[i], settledStatusBefore(ctx, &events[i])); ok {
+			got = append(got, eventType)
+		}
+	}
+	want := []model.WebhookEventType{
+		model.WebhookEventDeploymentFailed,
+		model.WebhookEventDeploymentDeploying,
+		model.WebhookEventDeploymentRecovered,
+		model.WebhookEventDeploymentDeploying,
+		model.WebhookEventDeploymentSucceeded,
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got event types %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("event %d is %s, want %s (all: %v)", i, got[i], want[i], got)
+		}
+	}
+}
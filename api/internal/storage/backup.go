@@ -0,0 +1,460 @@
+package storage
+
+import (
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	sqlite3 "github.com/mattn/go-sqlite3"
+)
+
+//Backups of the sqlite database
+// -> snapshots are taken with sqlite's online backup api, consistent even while the server keeps writing
+// -> restore validates the snapshot and swaps the files, the server has to be stopped for it (checked with a lock)
+// postgres has its own tooling (pg_dump), none of this applies to it
+
+const (
+	DefaultBackupDir       = "./backups"
+	DefaultBackupRetention = 7
+
+	backupPrefix     = "checkmate-"
+	backupTimeFormat = "20060102T150405Z"
+)
+
+var (
+	ErrBackupUnsupported = errors.New("backups are only available for sqlite, use pg_dump for postgres")
+	ErrDatabaseInUse     = errors.New("database is in use, stop the server before restoring")
+)
+
+// where and how often backups are taken, see InitBackupSettings
+var (
+	BackupDir       = DefaultBackupDir
+	BackupInterval  time.Duration // 0 disables scheduled backups
+	BackupRetention = DefaultBackupRetention
+	BackupCompress  = true
+)
+
+// one backup at a time, scheduled and manual backups share the directory
+var backupMu sync.Mutex
+
+type BackupInfo struct {
+	Path          string    `json:"path"`
+	SizeBytes     int64     `json:"sizeBytes"`
+	Compressed    bool      `json:"compressed"`
+	SchemaVersion int       `json:"schemaVersion"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
+
+type RestoreInfo struct {
+	SchemaVersion int    `json:"schemaVersion"`
+	PreviousPath  string `json:"previousPath,omitempty"` // where the replaced database was moved
+}
+
+// loads the backup settings from the environment
+// BACKUP_DIR, BACKUP_INTERVAL (ex 24h, unset or 0 disables scheduled backups), BACKUP_RETENTION (backups kept) and BACKUP_COMPRESS
+func InitBackupSettings() error {
+	if v := os.Getenv("BACKUP_DIR"); v != "" {
+		BackupDir = v
+	}
+
+	if v := os.Getenv("BACKUP_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return fmt.Errorf("invalid BACKUP_INTERVAL %q", v)
+		}
+		BackupInterval = d
+	}
+
+	if v := os.Getenv("BACKUP_RETENTION"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return fmt.Errorf("invalid BACKUP_RETENTION %q", v)
+		}
+		BackupRetention = n
+	}
+
+	if v := os.Getenv("BACKUP_COMPRESS"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid BACKUP_COMPRESS %q", v)
+		}
+		BackupCompress = b
+	}
+
+	return nil
+}
+
+// takes a backup into BackupDir and prunes the oldest ones past BackupRetention
+func BackupToDir(ctx context.Context) (*BackupInfo, error) {
+	name := backupPrefix + time.Now().UTC().Format(backupTimeFormat) + ".db"
+	if BackupCompress {
+		name += ".gz"
+	}
+
+	info, err := Backup(ctx, filepath.Join(BackupDir, name))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := pruneBackups(BackupDir, BackupRetention); err != nil {
+		// the backup itself is fine, old files just stay around
+		log.Printf("Failed to prune old backups: %v", err)
+	}
+	return info, nil
+}
+
+// writes a consistent snapshot of the database to destPath, gzip'd when destPath ends in .gz
+func Backup(ctx context.Context, destPath string) (*BackupInfo, error) {
+	if currentDialect != sqliteDialect {
+		return nil, ErrBackupUnsupported
+	}
+
+	backupMu.Lock()
+	defer backupMu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(destPath), 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	compressed := strings.HasSuffix(destPath, ".gz")
+	snapshotPath := strings.TrimSuffix(destPath, ".gz") + ".tmp"
+	defer os.Remove(snapshotPath)
+
+	if err := snapshot(ctx, snapshotPath); err != nil {
+		return nil, err
+	}
+
+	version, err := snapshotSchemaVersion(ctx, snapshotPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if compressed {
+		if err := gzipFile(snapshotPath, destPath); err != nil {
+			return nil, err
+		}
+	} else if err := os.Rename(snapshotPath, destPath); err != nil {
+		return nil, fmt.Errorf("failed to move backup into place: %w", err)
+	}
+
+	stat, err := os.Stat(destPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return &BackupInfo{
+		Path:          destPath,
+		SizeBytes:     stat.Size(),
+		Compressed:    compressed,
+		SchemaVersion: version,
+		CreatedAt:     time.Now().UTC(),
+	}, nil
+}
+
+// copies the live database into path with the online backup api
+func snapshot(ctx context.Context, path string) error {
+	dest, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return fmt.Errorf("failed to open backup file: %w", err)
+	}
+	defer dest.Close()
+
+	destConn, err := dest.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to open backup file: %w", err)
+	}
+	defer destConn.Close()
+
+	srcConn, err := DB.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get database connection: %w", err)
+	}
+	defer srcConn.Close()
+
+	err = destConn.Raw(func(destDriverConn interface{}) error {
+		return srcConn.Raw(func(srcDriverConn interface{}) error {
+			backup, err := destDriverConn.(*sqlite3.SQLiteConn).Backup("main", srcDriverConn.(*sqlite3.SQLiteConn), "main")
+			if err != nil {
+				return fmt.Errorf("failed to start backup: %w", err)
+			}
+
+			// -1 copies every page in one step, a single read transaction so the copy is consistent
+			if _, err := backup.Step(-1); err != nil {
+				backup.Finish()
+				return fmt.Errorf("backup failed: %w", err)
+			}
+			if err := backup.Finish(); err != nil {
+				return fmt.Errorf("failed to finish backup: %w", err)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	// the copy inherits wal mode from the live database, a backup should be a single self-contained file
+	if _, err := destConn.ExecContext(ctx, "PRAGMA journal_mode=DELETE"); err != nil {
+		return fmt.Errorf("failed to switch backup out of wal mode: %w", err)
+	}
+	return nil
+}
+
+// checks the file is a healthy checkmate database and returns its schema version
+func snapshotSchemaVersion(ctx context.Context, path string) (int, error) {
+	db, err := sql.Open("sqlite3", "file:"+path+"?mode=ro")
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	var integrity string
+	if err := db.QueryRowContext(ctx, "PRAGMA integrity_check").Scan(&integrity); err != nil {
+		return 0, fmt.Errorf("failed to check backup integrity: %w", err)
+	}
+	if integrity != "ok" {
+		return 0, fmt.Errorf("backup failed integrity check: %s", integrity)
+	}
+
+	var version sql.NullInt64
+	if err := db.QueryRowContext(ctx, "SELECT MAX(version) FROM schema_migrations").Scan(&version); err != nil {
+		return 0, fmt.Errorf("not a checkmate database, failed to read schema version: %w", err)
+	}
+	if !version.Valid {
+		return 0, fmt.Errorf("not a checkmate database, no migrations applied")
+	}
+	return int(version.Int64), nil
+}
+
+// replaces the sqlite database with a backup, the server must not be running
+// backups from an older schema are accepted and migrated on the next start, newer ones are refused
+func Restore(ctx context.Context, srcPath string) (*RestoreInfo, error) {
+	// the database isn't opened for a restore, so check the setting instead of the active backend
+	if os.Getenv("DATABASE_URL") != "" {
+		return nil, ErrBackupUnsupported
+	}
+
+	dbPath := SQLitePath()
+	stagedPath := dbPath + ".restore"
+	defer os.Remove(stagedPath)
+
+	// work on a copy, the backup file itself is left untouched
+	if strings.HasSuffix(srcPath, ".gz") {
+		if err := gunzipFile(srcPath, stagedPath); err != nil {
+			return nil, err
+		}
+	} else if err := copyFile(srcPath, stagedPath); err != nil {
+		return nil, err
+	}
+
+	version, err := snapshotSchemaVersion(ctx, stagedPath)
+	if err != nil {
+		return nil, err
+	}
+
+	latest, err := LatestVersion()
+	if err != nil {
+		return nil, err
+	}
+	if version > latest {
+		return nil, fmt.Errorf("backup is at schema version %d but this build only knows up to %d, restore it with a newer build", version, latest)
+	}
+
+	// a running server would keep writing to the file moved aside
+	if err := checkDatabaseNotInUse(ctx, dbPath); err != nil {
+		return nil, err
+	}
+
+	info := &RestoreInfo{SchemaVersion: version}
+
+	// keep the current database next to the restored one instead of deleting it
+	if _, err := os.Stat(dbPath); err == nil {
+		info.PreviousPath = dbPath + ".pre-restore-" + time.Now().UTC().Format(backupTimeFormat)
+		if err := os.Rename(dbPath, info.PreviousPath); err != nil {
+			return nil, fmt.Errorf("failed to move current database aside: %w", err)
+		}
+		// the wal may hold commits of the old database, it goes with it
+		for _, suffix := range []string{"-wal", "-shm"} {
+			if _, err := os.Stat(dbPath + suffix); err == nil {
+				if err := os.Rename(dbPath+suffix, info.PreviousPath+suffix); err != nil {
+					return nil, fmt.Errorf("failed to move %s aside: %w", dbPath+suffix, err)
+				}
+			}
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	if err := os.Rename(stagedPath, dbPath); err != nil {
+		return nil, fmt.Errorf("failed to move restored database into place: %w", err)
+	}
+
+	return info, nil
+}
+
+// fails with ErrDatabaseInUse while another connection has the database open
+// every open connection holds a lock on it, so an exclusive lock can only be taken when there is none
+// closing the probe checkpoints a wal left by a crash, a -wal file still there afterwards belongs to someone else
+func checkDatabaseNotInUse(ctx context.Context, dbPath string) error {
+	if _, err := os.Stat(dbPath); os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	// mode=rw so the probe never creates a database
+	db, err := sql.Open("sqlite3", "file:"+dbPath+"?mode=rw&_locking_mode=EXCLUSIVE&_busy_timeout=0")
+	if err != nil {
+		return fmt.Errorf("failed to open current database: %w", err)
+	}
+	_, err = db.ExecContext(ctx, "BEGIN EXCLUSIVE; COMMIT")
+	closeErr := db.Close()
+
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) && (sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked) {
+		return ErrDatabaseInUse
+	}
+	if err != nil {
+		return fmt.Errorf("failed to lock current database: %w", err)
+	}
+	if closeErr != nil {
+		return fmt.Errorf("failed to close current database: %w", closeErr)
+	}
+
+	if _, err := os.Stat(dbPath + "-wal"); err == nil {
+		return ErrDatabaseInUse
+	}
+	return nil
+}
+
+// takes a backup every BackupInterval until ctx is cancelled, no-op when the interval is 0
+func StartScheduledBackups(ctx context.Context) {
+	if BackupInterval <= 0 || currentDialect != sqliteDialect {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(BackupInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				info, err := BackupToDir(ctx)
+				if err != nil {
+					log.Printf("Scheduled backup failed: %v", err)
+					continue
+				}
+				log.Printf("Scheduled backup written to %s (%d bytes)", info.Path, info.SizeBytes)
+			}
+		}
+	}()
+}
+
+// deletes the oldest backups in dir so that only keep remain
+// names sort by creation time, only files written by BackupToDir are considered
+func pruneBackups(dir string, keep int) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	var backups []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, backupPrefix) {
+			continue
+		}
+		if strings.HasSuffix(name, ".db") || strings.HasSuffix(name, ".db.gz") {
+			backups = append(backups, name)
+		}
+	}
+	if len(backups) <= keep {
+		return nil
+	}
+
+	sort.Strings(backups)
+	for _, name := range backups[:len(backups)-keep] {
+		if err := os.Remove(filepath.Join(dir, name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func gzipFile(srcPath, destPath string) error {
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dest, err := os.OpenFile(destPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to create backup file: %w", err)
+	}
+
+	zw := gzip.NewWriter(dest)
+	if _, err := io.Copy(zw, src); err != nil {
+		dest.Close()
+		os.Remove(destPath)
+		return fmt.Errorf("failed to compress backup: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		dest.Close()
+		os.Remove(destPath)
+		return fmt.Errorf("failed to compress backup: %w", err)
+	}
+	return dest.Close()
+}
+
+func gunzipFile(srcPath, destPath string) error {
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	zr, err := gzip.NewReader(src)
+	if err != nil {
+		return fmt.Errorf("failed to read compressed backup: %w", err)
+	}
+	defer zr.Close()
+
+	return writeFile(destPath, zr)
+}
+
+func copyFile(srcPath, destPath string) error {
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	return writeFile(destPath, src)
+}
+
+func writeFile(path string, r io.Reader) error {
+	dest, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dest, r); err != nil {
+		dest.Close()
+		return err
+	}
+	return dest.Close()
+}
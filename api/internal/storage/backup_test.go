@@ -0,0 +1,145 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// checks which of the users are in the open database
+func checkUsers(t *testing.T, ctx context.Context, present string, gone string) {
+	t.Helper()
+	if user, err := Users.GetByID(ctx, present); err != nil || user == nil {
+		t.Errorf("user %s is missing (err %v)", present, err)
+	}
+	if user, err := Users.GetByID(ctx, gone); err != nil || user != nil {
+		t.Errorf("user %s is still there (err %v)", gone, err)
+	}
+}
+
+func TestBackupRestoreRoundTrip(t *testing.T) {
+	for _, name := range []string{"snapshot.db", "snapshot.db.gz"} {
+		t.Run(name, func(t *testing.T) {
+			openBackend(t, "")
+			ctx := context.Background()
+			kept := createTestUser(t, ctx)
+			createTestCredential(t, ctx, kept, "render")
+
+			backupPath := filepath.Join(t.TempDir(), name)
+			backup, err := Backup(ctx, backupPath)
+			if err != nil {
+				t.Fatalf("backup: %v", err)
+			}
+			latest, err := LatestVersion()
+			if err != nil {
+				t.Fatalf("latest version: %v", err)
+			}
+			if backup.SchemaVersion != latest {
+				t.Errorf("backup at schema version %d, want %d", backup.SchemaVersion, latest)
+			}
+
+			// written after the backup, the restore drops it
+			later := createTestUser(t, ctx)
+			DB.Close()
+
+			info, err := Restore(ctx, backupPath)
+			if err != nil {
+				t.Fatalf("restore: %v", err)
+			}
+			if info.SchemaVersion != latest {
+				t.Errorf("restored schema version %d, want %d", info.SchemaVersion, latest)
+			}
+			if _, err := os.Stat(info.PreviousPath); err != nil {
+				t.Errorf("replaced database not kept: %v", err)
+			}
+			if _, err := os.Stat(backupPath); err != nil {
+				t.Errorf("backup file gone after the restore: %v", err)
+			}
+
+			if err := Open(); err != nil {
+				t.Fatalf("reopen db: %v", err)
+			}
+			checkUsers(t, ctx, kept, later)
+		})
+	}
+}
+
+// a snapshot from a newer build would be run against queries that don't know its schema
+func TestRestoreRefusesNewerSchema(t *testing.T) {
+	openBackend(t, "")
+	ctx := context.Background()
+	current := createTestUser(t, ctx)
+
+	backupPath := filepath.Join(t.TempDir(), "newer.db")
+	if _, err := Backup(ctx, backupPath); err != nil {
+		t.Fatalf("backup: %v", err)
+	}
+	latest, err := LatestVersion()
+	if err != nil {
+		t.Fatalf("latest version: %v", err)
+	}
+	snapshot, err := sql.Open("sqlite3", backupPath)
+	if err != nil {
+		t.Fatalf("open snapshot: %v", err)
+	}
+	_, err = snapshot.Exec(`INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)`,
+		latest+1, "from_the_future", time.Now().UTC())
+	snapshot.Close()
+	if err != nil {
+		t.Fatalf("bump snapshot version: %v", err)
+	}
+	DB.Close()
+
+	if _, err := Restore(ctx, backupPath); err == nil {
+		t.Fatal("restored a snapshot newer than this build")
+	}
+	// the current database stays where it was, nothing moved aside
+	moved, _ := filepath.Glob(SQLitePath() + ".pre-restore-*")
+	if len(moved) != 0 {
+		t.Errorf("current database moved aside to %v", moved)
+	}
+	if err := Open(); err != nil {
+		t.Fatalf("reopen db: %v", err)
+	}
+	if user, err := Users.GetByID(ctx, current); err != nil || user == nil {
+		t.Errorf("current database lost user %s (err %v)", current, err)
+	}
+}
+
+// the server keeps its connections open, swapping the file under it would lose its writes
+func TestRestoreRefusesDatabaseInUse(t *testing.T) {
+	openBackend(t, "")
+	ctx := context.Background()
+	kept := createTestUser(t, ctx)
+
+	backupPath := filepath.Join(t.TempDir(), "snapshot.db")
+	if _, err := Backup(ctx, backupPath); err != nil {
+		t.Fatalf("backup: %v", err)
+	}
+	later := createTestUser(t, ctx)
+
+	if _, err := Restore(ctx, backupPath); !errors.Is(err, ErrDatabaseInUse) {
+		t.Fatalf("restore over an open database: got %v, want ErrDatabaseInUse", err)
+	}
+	if _, err := os.Stat(SQLitePath()); err != nil {
+		t.Fatalf("current database moved: %v", err)
+	}
+	// still usable by the server
+	if user, err := Users.GetByID(ctx, later); err != nil || user == nil {
+		t.Errorf("user %s is missing after the refused restore (err %v)", later, err)
+	}
+
+	// once stopped the same restore goes through
+	DB.Close()
+	if _, err := Restore(ctx, backupPath); err != nil {
+		t.Fatalf("restore after closing: %v", err)
+	}
+	if err := Open(); err != nil {
+		t.Fatalf("reopen db: %v", err)
+	}
+	checkUsers(t, ctx, kept, later)
+}
@@ -0,0 +1,112 @@
+package storage
+
+import (
+	"checkmate/api/internal/model"
+	"context"
+	"database/sql"
+	"time"
+)
+
+type credentialRepository struct {
+	*sqlStore
+}
+
+const credentialColumns = `id, user_id, name, platform, api_key, created_at, cache_ttl_seconds`
+
+// scans a row selected with credentialColumns
+func scanCredential(row interface{ Scan(...interface{}) error }) (*model.PlatformCredential, error) {
+	var cred model.PlatformCredential
+	var createdAt sql.NullTime
+	var cacheTTL sql.NullInt64
+	if err := row.Scan(&cred.ID, &cred.UserID, &cred.Name, &cred.Platform, &cred.APIKey, &createdAt, &cacheTTL); err != nil {
+		return nil, err
+	}
+	cred.CreatedAt = createdAt.Time
+	cred.CacheTTLSeconds = intPtr(cacheTTL)
+	return &cred, nil
+}
+
+func (r *credentialRepository) ListByUser(ctx context.Context, userID string) ([]model.PlatformCredential, error) {
+	rows, err := r.query(ctx, r.db,
+		`SELECT `+credentialColumns+` FROM platform_credentials WHERE user_id = ? ORDER BY LOWER(name), id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var credentials []model.PlatformCredential
+	for rows.Next() {
+		cred, err := scanCredential(rows)
+		if err != nil {
+			return nil, err
+		}
+		credentials = append(credentials, *cred)
+	}
+	return credentials, rows.Err()
+}
+
+func (r *credentialRepository) GetByID(ctx context.Context, id int, userID string) (*model.PlatformCredential, error) {
+	return scanCredential(r.queryRow(ctx, r.db,
+		`SELECT `+credentialColumns+` FROM platform_credentials WHERE id = ? AND user_id = ?`, id, userID))
+}
+
+func (r *credentialRepository) Create(ctx context.Context, cred *model.PlatformCredential) (int, error) {
+	id, err := r.insertID(ctx, r.db,
+		`INSERT INTO platform_credentials (user_id, name, platform, api_key, created_at) VALUES (?, ?, ?, ?, ?)`,
+		cred.UserID, cred.Name, cred.Platform, cred.APIKey, cred.CreatedAt)
+	if isUniqueViolation(err) {
+		return 0, ErrDuplicate
+	}
+	return int(id), err
+}
+
+func (r *credentialRepository) Update(ctx context.Context, id int, userID string, name string, platform string, encryptedAPIKey string) (bool, error) {
+	found, err := r.execFound(ctx,
+		`UPDATE platform_credentials
+		SET name = COALESCE(NULLIF(?, ''), name), platform = ?, api_key = ?
+		WHERE id = ? AND user_id = ?`,
+		name, platform, encryptedAPIKey, id, userID)
+	if isUniqueViolation(err) {
+		return false, ErrDuplicate
+	}
+	return found, err
+}
+
+func (r *credentialRepository) SetCacheTTL(ctx context.Context, id int, userID string, ttlSeconds *int) (bool, error) {
+	var ttl sql.NullInt64
+	if ttlSeconds != nil {
+		ttl = sql.NullInt64{Int64: int64(*ttlSeconds), Valid: true}
+	}
+	return r.execFound(ctx,
+		`UPDATE platform_credentials SET cache_ttl_seconds = ? WHERE id = ? AND user_id = ?`,
+		ttl, id, userID)
+}
+
+func (r *credentialRepository) Delete(ctx context.Context, id int, userID string) (bool, error) {
+	return r.execFound(ctx, `DELETE FROM platform_credentials WHERE id = ? AND user_id = ?`, id, userID)
+}
+
+func (r *credentialRepository) GetCacheRefreshedAt(ctx context.Context, id int) (*time.Time, error) {
+	var refreshedAt sql.NullTime
+	err := r.queryRow(ctx, r.db,
+		`SELECT cache_refreshed_at FROM platform_credentials WHERE id = ?`, id).Scan(&refreshedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return timePtr(refreshedAt), nil
+}
+
+// runs an UPDATE/DELETE and reports if it matched any row
+func (r *credentialRepository) execFound(ctx context.Context, query string, args ...interface{}) (bool, error) {
+	result, err := r.exec(ctx, r.db, query, args...)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected > 0, nil
+}
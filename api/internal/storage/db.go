@@ -1,79 +1,249 @@
 package storage
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
 	"log"
+	"net/url"
+	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
+	_ "github.com/jackc/pgx/v5/stdlib"
 	_ "github.com/mattn/go-sqlite3"
 )
 
 var DB *sql.DB
 
+// repositories used by the services, backed by sqlite (default) or postgres
+var (
+	Users       UserRepository
+	Credentials CredentialRepository
+	Deployments DeploymentCacheRepository
+	Maintenance MaintenanceRepository
+	Webhooks    WebhookRepository
+	Rules       NotificationRuleRepository
+)
+
+// active backend, set by Open
+var currentDialect = sqliteDialect
+
+const (
+	DefaultSQLitePath = "./checkmate.db"
+	// ms a connection waits on a locked database before failing with SQLITE_BUSY
+	DefaultSQLiteBusyTimeout = 5000
+
+	// sqlite has a single writer, a few connections are enough for concurrent readers in wal mode
+	DefaultSQLiteMaxOpenConns   = 4
+	DefaultPostgresMaxOpenConns = 10
+	DefaultConnMaxIdleTime      = 5 * time.Minute
+)
+
+// opens the database and brings the schema up to date
 func InitDb() {
-	dbPath := filepath.Join(".", "checkmate.db")
+	if err := Open(); err != nil {
+		log.Fatal("Failed to open db:", err)
+	}
+
+	settings, err := CheckSettings(context.Background())
+	if err != nil {
+		log.Fatal("Database self-check failed:", err)
+	}
+	log.Printf("Database %s ready: %s", Backend(), formatSettings(settings))
+
+	applied, err := MigrateUp(context.Background())
+	if err != nil {
+		log.Fatal("Failed to migrate db:", err)
+	}
+	if applied > 0 {
+		log.Printf("Applied %d database migrations", applied)
+	}
+}
+
+// opens the database without touching the schema -> used by the migrate command
+// DATABASE_URL=postgres://... selects postgres, otherwise sqlite at SQLITE_PATH (default ./checkmate.db) is used
+// pool limits come from DB_MAX_OPEN_CONNS, DB_MAX_IDLE_CONNS and DB_CONN_MAX_IDLE_TIME
+func Open() error {
+	dsn := os.Getenv("DATABASE_URL")
+
 	var err error
+	maxOpen := DefaultSQLiteMaxOpenConns
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		currentDialect = postgresDialect
+		maxOpen = DefaultPostgresMaxOpenConns
+		DB, err = sql.Open("pgx", dsn)
+	} else {
+		if dsn != "" {
+			return fmt.Errorf("unsupported DATABASE_URL, expected postgres:// or postgresql://")
+		}
+		currentDialect = sqliteDialect
 
-	DB, err = sql.Open("sqlite3", dbPath)
+		var sqliteDSN string
+		sqliteDSN, err = sqliteDSNFromEnv()
+		if err != nil {
+			return err
+		}
+		DB, err = sql.Open("sqlite3", sqliteDSN)
+	}
 	if err != nil {
-		log.Fatal("Failed to open db:", err)
+		return err
+	}
+
+	if err := configurePool(DB, maxOpen); err != nil {
+		return err
 	}
 
 	if err := DB.Ping(); err != nil {
-		log.Fatal("Failed to connect to db:", err)
+		return err
 	}
 
-	createTables()
+	store := &sqlStore{db: DB, dialect: currentDialect}
+	Users = &userRepository{store}
+	Credentials = &credentialRepository{store}
+	Deployments = &deploymentCacheRepository{store}
+	Maintenance = &maintenanceRepository{store}
+	Webhooks = &webhookRepository{store}
+	Rules = &notificationRuleRepository{store}
+
+	return nil
 }
 
-// creates tables only if the don't exist
-func createTables() error {
-	//don't need to save password, will use firebase auth to handle it
-	_, err := DB.Exec(
-		//todo: index the email for faster lookup->INDEX idx_email (email)
-		//todo: can't currently since i am using sqlite
-		`
-		-- Users table;
-	CREATE TABLE IF NOT EXISTS users (
-    	id VARCHAR(128) PRIMARY KEY, 
-    	email VARCHAR(255) NOT NULL,
-	    display_name VARCHAR(255),
-    	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-	);
-
-	-- Platform credentials;
-	CREATE TABLE IF NOT EXISTS platform_credentials (
-    	id INTEGER PRIMARY KEY AUTOINCREMENT,
-	    user_id VARCHAR(128) NOT NULL,
-    	platform VARCHAR(50) NOT NULL,  
-	    name VARCHAR(255) NOT NULL,     
-	    api_key TEXT NOT NULL,          
-	    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
-	);
-
-	-- Cache for deployment data
-	CREATE TABLE IF NOT EXISTS deployment_cache (
-    	id VARCHAR(255) NOT NULL,       
-    	platform_credential_id INTEGER NOT NULL,
-    	name VARCHAR(255) NOT NULL,
-    	status VARCHAR(50) NOT NULL,    
-    	url VARCHAR(255),
-    	last_deployed_at TIMESTAMP,
-	    branch VARCHAR(255),
-    	service_type VARCHAR(100),      
-    	framework VARCHAR(100),         
-	    last_updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    	metadata TEXT,                  
-	    PRIMARY KEY (id, platform_credential_id),
-    	FOREIGN KEY (platform_credential_id) REFERENCES platform_credentials(id) ON DELETE CASCADE
-	);
-	
-		`)
-	if err != nil {
-		log.Printf("Failed to create tables: %v", err)
-		return err
+// name of the active backend -> "sqlite" or "postgres"
+func Backend() string {
+	return currentDialect.name
+}
+
+// path of the sqlite database file, SQLITE_PATH or ./checkmate.db
+func SQLitePath() string {
+	if p := os.Getenv("SQLITE_PATH"); p != "" {
+		return p
+	}
+	return DefaultSQLitePath
+}
+
+// the pragmas are set through the dsn so every connection of the pool gets them, not only the first one
+// -> wal so readers don't block the writer, busy timeout instead of failing right away on a locked db,
+// foreign keys so the ON DELETE CASCADE clauses actually run, and BEGIN IMMEDIATE so a transaction
+// takes the write lock up front instead of failing when it upgrades from read to write
+func sqliteDSNFromEnv() (string, error) {
+	path := SQLitePath()
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return "", fmt.Errorf("failed to create database directory %s: %w", dir, err)
+		}
+	}
+
+	busyTimeout := DefaultSQLiteBusyTimeout
+	if v := os.Getenv("SQLITE_BUSY_TIMEOUT_MS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return "", fmt.Errorf("invalid SQLITE_BUSY_TIMEOUT_MS %q", v)
+		}
+		busyTimeout = n
+	}
+
+	params := url.Values{}
+	params.Set("_journal_mode", "WAL")
+	params.Set("_synchronous", "NORMAL") // safe with wal, only the last commits can be lost on power failure
+	params.Set("_busy_timeout", strconv.Itoa(busyTimeout))
+	params.Set("_foreign_keys", "on")
+	params.Set("_txlock", "immediate")
+
+	return "file:" + path + "?" + params.Encode(), nil
+}
+
+func configurePool(db *sql.DB, defaultMaxOpen int) error {
+	maxOpen := defaultMaxOpen
+	if v := os.Getenv("DB_MAX_OPEN_CONNS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return fmt.Errorf("invalid DB_MAX_OPEN_CONNS %q", v)
+		}
+		maxOpen = n
+	}
+
+	maxIdle := maxOpen
+	if v := os.Getenv("DB_MAX_IDLE_CONNS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid DB_MAX_IDLE_CONNS %q", v)
+		}
+		maxIdle = n
+	}
+
+	idleTime := DefaultConnMaxIdleTime
+	if v := os.Getenv("DB_CONN_MAX_IDLE_TIME"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return fmt.Errorf("invalid DB_CONN_MAX_IDLE_TIME %q", v)
+		}
+		idleTime = d
 	}
 
+	db.SetMaxOpenConns(maxOpen)
+	db.SetMaxIdleConns(maxIdle)
+	db.SetConnMaxIdleTime(idleTime)
 	return nil
 }
+
+// reads back the effective connection settings and fails when the ones we rely on are off
+// sqlite ignores unknown or invalid pragmas silently, so checking the dsn isn't enough
+func CheckSettings(ctx context.Context) (map[string]string, error) {
+	settings := map[string]string{
+		"max_open_conns": strconv.Itoa(DB.Stats().MaxOpenConnections),
+	}
+
+	if currentDialect != sqliteDialect {
+		var version string
+		if err := DB.QueryRowContext(ctx, "SHOW server_version").Scan(&version); err != nil {
+			return nil, fmt.Errorf("failed to read server version: %w", err)
+		}
+		settings["server_version"] = version
+		return settings, nil
+	}
+
+	// all on the same connection, pragmas are per connection
+	conn, err := DB.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	for _, pragma := range []string{"journal_mode", "synchronous", "busy_timeout", "foreign_keys"} {
+		var value string
+		if err := conn.QueryRowContext(ctx, "PRAGMA "+pragma).Scan(&value); err != nil {
+			return nil, fmt.Errorf("failed to read pragma %s: %w", pragma, err)
+		}
+		settings[pragma] = value
+	}
+	settings["path"] = SQLitePath()
+
+	if settings["foreign_keys"] != "1" {
+		return settings, fmt.Errorf("foreign keys are not enforced")
+	}
+	// wal can't be enabled on some filesystems (network mounts), sqlite falls back without an error
+	if !strings.EqualFold(settings["journal_mode"], "wal") {
+		log.Printf("Warning: sqlite journal_mode is %s, not wal", settings["journal_mode"])
+	}
+
+	return settings, nil
+}
+
+// key=value pairs sorted by key, for logging
+func formatSettings(settings map[string]string) string {
+	keys := make([]string, 0, len(settings))
+	for k := range settings {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, k+"="+settings[k])
+	}
+	return strings.Join(parts, " ")
+}
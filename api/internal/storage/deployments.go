@@ -0,0 +1,603 @@
+package storage
+
+import (
+	"checkmate/api/internal/model"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type deploymentCacheRepository struct {
+	*sqlStore
+}
+
+const deploymentColumns = `
+	d.id, d.platform_credential_id, d.name, d.status, d.url, d.last_deployed_at, d.branch,
+	d.service_type, d.framework, d.last_updated_at, d.metadata,
+	d.first_seen_at, d.last_seen_at`
+
+// scans deploymentColumns followed by extra
+func scanDeployment(rows *sql.Rows, extra ...interface{}) (model.Deployment, error) {
+	var dep model.Deployment
+	var status string
+	var url, branch, serviceType, framework, metadataJSON sql.NullString
+	var lastDeployedAt, lastUpdatedAt, firstSeenAt, lastSeenAt sql.NullTime
+
+	dest := []interface{}{
+		&dep.ID, &dep.PlatformCredentialID, &dep.Name, &status, &url, &lastDeployedAt, &branch,
+		&serviceType, &framework, &lastUpdatedAt, &metadataJSON,
+		&firstSeenAt, &lastSeenAt,
+	}
+	if err := rows.Scan(append(dest, extra...)...); err != nil {
+		return dep, err
+	}
+
+	dep.Status = model.DeploymentStatus(status)
+	dep.URL = url.String
+	dep.Branch = branch.String
+	dep.ServiceType = serviceType.String
+	dep.Framework = framework.String
+	dep.LastUpdatedAt = lastUpdatedAt.Time
+	dep.LastDeployedAt = timePtr(lastDeployedAt)
+	// rows cached before these columns existed have them null
+	dep.FirstSeenAt = timePtr(firstSeenAt)
+	dep.LastSeenAt = timePtr(lastSeenAt)
+
+	if metadataJSON.String != "" {
+		if err := json.Unmarshal([]byte(metadataJSON.String), &dep.Metadata); err != nil {
+			return dep, fmt.Errorf("failed to unmarshal metadata of deployment %s: %w", dep.ID, err)
+		}
+	} else {
+		dep.Metadata = make(map[string]interface{})
+	}
+	return dep, nil
+}
+
+func (r *deploymentCacheRepository) ListCached(ctx context.Context, credentialID int) ([]model.Deployment, error) {
+	rows, err := r.query(ctx, r.db, `
+		SELECT `+deploymentColumns+`
+		FROM deployment_cache d
+		WHERE d.platform_credential_id = ?
+		ORDER BY d.id
+	`, credentialID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deployments []model.Deployment
+	for rows.Next() {
+		dep, err := scanDeployment(rows)
+		if err != nil {
+			return nil, err
+		}
+		deployments = append(deployments, dep)
+	}
+	return deployments, rows.Err()
+}
+
+func (r *deploymentCacheRepository) Get(ctx context.Context, credentialID int, deploymentID string) (*model.Deployment, error) {
+	rows, err := r.query(ctx, r.db, `
+		SELECT `+deploymentColumns+`
+		FROM deployment_cache d
+		WHERE d.platform_credential_id = ? AND d.id = ?
+	`, credentialID, deploymentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		return nil, sql.ErrNoRows
+	}
+
+	dep, err := scanDeployment(rows)
+	if err != nil {
+		return nil, err
+	}
+	return &dep, nil
+}
+
+// stands in for a null last_deployed_at when sorting, never deployed sorts as the oldest
+var neverDeployed = time.Unix(0, 0).UTC()
+
+// one column of the ORDER BY, args are the parameters used inside expr
+type sortKey struct {
+	expr  string
+	args  []interface{}
+	desc  bool
+	value interface{} // value of the cursor row, for the keyset condition
+}
+
+func (r *deploymentCacheRepository) List(ctx context.Context, userID string, credentialIDs []int, query model.DeploymentQuery, after *DeploymentCursor) ([]model.Deployment, *DeploymentCursor, error) {
+	if len(credentialIDs) == 0 {
+		return []model.Deployment{}, nil, nil
+	}
+
+	conditions := []string{
+		"c.user_id = ?",
+		"d.platform_credential_id IN (" + strings.TrimSuffix(strings.Repeat("?,", len(credentialIDs)), ",") + ")",
+	}
+	args := []interface{}{userID}
+	for _, id := range credentialIDs {
+		args = append(args, id)
+	}
+
+	if query.Platform != "" {
+		conditions = append(conditions, "c.platform = ?")
+		args = append(args, query.Platform)
+	}
+	if query.CredentialID != nil {
+		conditions = append(conditions, "d.platform_credential_id = ?")
+		args = append(args, *query.CredentialID)
+	}
+	if len(query.Statuses) > 0 {
+		conditions = append(conditions, "d.status IN ("+strings.TrimSuffix(strings.Repeat("?,", len(query.Statuses)), ",")+")")
+		for _, status := range query.Statuses {
+			args = append(args, string(status))
+		}
+	}
+	if query.ServiceType != "" {
+		conditions = append(conditions, "d.service_type = ?")
+		args = append(args, query.ServiceType)
+	}
+	if query.Branch != "" {
+		conditions = append(conditions, "d.branch = ?")
+		args = append(args, query.Branch)
+	}
+	if query.Name != "" {
+		conditions = append(conditions, `LOWER(d.name) LIKE ? ESCAPE '\'`)
+		args = append(args, "%"+escapeLike(strings.ToLower(query.Name))+"%")
+	}
+
+	var cursor DeploymentCursor
+	if after != nil {
+		cursor = *after
+	}
+
+	// the sort column(s), then credential and id so the order is total and the keyset unambiguous
+	var keys []sortKey
+	switch query.Sort {
+	case model.DeploymentSortStatus:
+		keys = append(keys,
+			sortKey{expr: "d.status", desc: query.Desc, value: cursor.Status},
+			sortKey{expr: "LOWER(d.name)", value: cursor.SortName})
+	case model.DeploymentSortLastDeployed:
+		keys = append(keys,
+			sortKey{expr: "COALESCE(d.last_deployed_at, ?)", args: []interface{}{neverDeployed}, desc: query.Desc, value: cursor.LastDeployedAt.UTC()})
+	default:
+		keys = append(keys, sortKey{expr: "LOWER(d.name)", desc: query.Desc, value: cursor.SortName})
+	}
+	keys = append(keys,
+		sortKey{expr: "d.platform_credential_id", value: cursor.CredentialID},
+		sortKey{expr: "d.id", value: cursor.ID})
+
+	// keyset pagination -> rows strictly after the cursor row in the sort order
+	if after != nil {
+		var alternatives []string
+		for i, key := range keys {
+			var parts []string
+			for _, prev := range keys[:i] {
+				parts = append(parts, prev.expr+" = ?")
+				args = append(append(args, prev.args...), prev.value)
+			}
+			op := ">"
+			if key.desc {
+				op = "<"
+			}
+			parts = append(parts, key.expr+" "+op+" ?")
+			args = append(append(args, key.args...), key.value)
+			alternatives = append(alternatives, "("+strings.Join(parts, " AND ")+")")
+		}
+		conditions = append(conditions, "("+strings.Join(alternatives, " OR ")+")")
+	}
+
+	var order []string
+	for _, key := range keys {
+		if key.desc {
+			order = append(order, key.expr+" DESC")
+		} else {
+			order = append(order, key.expr)
+		}
+		args = append(args, key.args...)
+	}
+
+	// one extra row tells whether there is a next page
+	args = append(args, query.Limit+1)
+
+	rows, err := r.query(ctx, r.db, `
+		SELECT `+deploymentColumns+`, LOWER(d.name)
+		FROM deployment_cache d
+		JOIN platform_credentials c ON c.id = d.platform_credential_id
+		WHERE `+strings.Join(conditions, " AND ")+`
+		ORDER BY `+strings.Join(order, ", ")+`
+		LIMIT ?
+	`, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	deployments := []model.Deployment{}
+	var sortNames []string
+	for rows.Next() {
+		var sortName string
+		dep, err := scanDeployment(rows, &sortName)
+		if err != nil {
+			return nil, nil, err
+		}
+		deployments = append(deployments, dep)
+		sortNames = append(sortNames, sortName)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	if len(deployments) <= query.Limit {
+		return deployments, nil, nil
+	}
+
+	deployments = deployments[:query.Limit]
+	last := deployments[len(deployments)-1]
+	next := &DeploymentCursor{
+		SortName:       sortNames[query.Limit-1],
+		Status:         string(last.Status),
+		LastDeployedAt: neverDeployed,
+		CredentialID:   last.PlatformCredentialID,
+		ID:             last.ID,
+	}
+	if last.LastDeployedAt != nil {
+		next.LastDeployedAt = last.LastDeployedAt.UTC()
+	}
+	return deployments, next, nil
+}
+
+// LIKE wildcards in user input match literally
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+func (r *deploymentCacheRepository) WriteCache(ctx context.Context, credentialID int, plan CachePlanFunc) (*CacheWrite, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback() //roll back if not committed
+
+	previous, err := r.cachedStates(ctx, tx, credentialID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read existing cache: %w", err)
+	}
+
+	write, err := plan(previous)
+	if err != nil {
+		return nil, err
+	}
+	// stored in utc so the retention cutoffs compare right on sqlite
+	at := write.At.UTC()
+
+	for _, up := range write.Upserts {
+		dep := up.Deployment
+		metadataJSON, err := json.Marshal(dep.Metadata)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal metadata of deployment %s: %w", dep.ID, err)
+		}
+
+		// utc like every other timestamp, the deployments listing sorts and pages on it
+		var lastDeployedAt sql.NullTime
+		if dep.LastDeployedAt != nil {
+			lastDeployedAt = sql.NullTime{Time: dep.LastDeployedAt.UTC(), Valid: true}
+		}
+
+		_, err = r.exec(ctx, tx, `
+			INSERT INTO deployment_cache (
+				id, platform_credential_id, name, status, url,
+				last_deployed_at, branch, service_type, framework,
+				last_updated_at, metadata, fingerprint, first_seen_at, last_seen_at
+			) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT (id, platform_credential_id) DO UPDATE SET
+				name = excluded.name,
+				status = excluded.status,
+				url = excluded.url,
+				last_deployed_at = excluded.last_deployed_at,
+				branch = excluded.branch,
+				service_type = excluded.service_type,
+				framework = excluded.framework,
+				last_updated_at = excluded.last_updated_at,
+				metadata = excluded.metadata,
+				fingerprint = excluded.fingerprint,
+				last_seen_at = excluded.last_seen_at
+		`,
+			dep.ID, credentialID, dep.Name, string(dep.Status), dep.URL,
+			lastDeployedAt, dep.Branch, dep.ServiceType, dep.Framework,
+			at, string(metadataJSON), up.Fingerprint, at, at)
+		if err != nil {
+			return nil, fmt.Errorf("failed to cache deployment %s: %w", dep.ID, err)
+		}
+	}
+
+	for _, id := range write.Seen {
+		_, err := r.exec(ctx, tx,
+			`UPDATE deployment_cache SET last_seen_at = ? WHERE id = ? AND platform_credential_id = ?`,
+			at, id, credentialID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to touch cached deployment %s: %w", id, err)
+		}
+	}
+
+	for _, id := range write.Gone {
+		_, err := r.exec(ctx, tx,
+			`UPDATE deployment_cache SET status = ?, last_updated_at = ? WHERE id = ? AND platform_credential_id = ?`,
+			string(model.DeploymentStatusGone), at, id, credentialID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to mark cached deployment %s as gone: %w", id, err)
+		}
+	}
+
+	// freshness is tracked per credential, so a credential without deployments still has a fresh cache
+	_, err = r.exec(ctx, tx,
+		`UPDATE platform_credentials SET cache_refreshed_at = ? WHERE id = ?`, at, credentialID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update cache refresh time: %w", err)
+	}
+
+	// live streams read the events of a user back by id, an id must never become visible after a higher one
+	// sqlite already runs one write transaction at a time, postgres hands out ids before commit so the writes of a user queue here
+	if len(write.Events) > 0 && r.dialect != sqliteDialect {
+		_, err := r.exec(ctx, tx,
+			`SELECT pg_advisory_xact_lock(hashtext(user_id)) FROM platform_credentials WHERE id = ?`, credentialID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to lock events of the credential owner: %w", err)
+		}
+	}
+
+	for i, event := range write.Events {
+		id, err := r.insertID(ctx, tx, `
+			INSERT INTO deployment_events (
+				platform_credential_id, deployment_id, deployment_name, old_status, new_status,
+				deploy_id, commit_id, commit_message, observed_at
+			) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			event.PlatformCredentialID, event.DeploymentID, event.DeploymentName,
+			nullString(string(event.OldStatus)), string(event.NewStatus),
+			nullString(event.DeployID), nullString(event.CommitID), nullString(event.CommitMessage),
+			event.ObservedAt.UTC())
+		if err != nil {
+			return nil, fmt.Errorf("failed to insert event for deployment %s: %w", event.DeploymentID, err)
+		}
+		write.Events[i].ID = id
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return write, nil
+}
+
+// what is currently cached for a credential, read inside the write transaction
+func (r *deploymentCacheRepository) cachedStates(ctx context.Context, tx *sql.Tx, credentialID int) (map[string]CachedDeploymentState, error) {
+	rows, err := r.query(ctx, tx, `
+		SELECT id, name, status, fingerprint, last_seen_at, last_updated_at
+		FROM deployment_cache
+		WHERE platform_credential_id = ?
+	`, credentialID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	states := make(map[string]CachedDeploymentState)
+	for rows.Next() {
+		var id, status string
+		var state CachedDeploymentState
+		var fingerprint sql.NullString
+		var lastSeenAt, lastUpdatedAt sql.NullTime
+
+		if err := rows.Scan(&id, &state.Name, &status, &fingerprint, &lastSeenAt, &lastUpdatedAt); err != nil {
+			return nil, err
+		}
+
+		state.Status = model.DeploymentStatus(status)
+		state.Fingerprint = fingerprint.String
+		// rows cached before last_seen_at existed
+		if lastSeenAt.Valid {
+			state.LastSeenAt = lastSeenAt.Time
+		} else {
+			state.LastSeenAt = lastUpdatedAt.Time
+		}
+		states[id] = state
+	}
+	return states, rows.Err()
+}
+
+func (r *deploymentCacheRepository) ListEvents(ctx context.Context, userID string, filter model.DeploymentEventFilter) ([]model.DeploymentEvent, error) {
+	// only events of credentials owned by the user
+	conditions := []string{"c.user_id = ?"}
+	args := []interface{}{userID}
+
+	if filter.CredentialID != nil {
+		conditions = append(conditions, "e.platform_credential_id = ?")
+		args = append(args, *filter.CredentialID)
+	}
+	if filter.DeploymentID != "" {
+		conditions = append(conditions, "e.deployment_id = ?")
+		args = append(args, filter.DeploymentID)
+	}
+	// timestamps are stored in utc so the string comparison sqlite does holds
+	if filter.Since != nil {
+		conditions = append(conditions, "e.observed_at >= ?")
+		args = append(args, filter.Since.UTC())
+	}
+	if filter.Until != nil {
+		conditions = append(conditions, "e.observed_at <= ?")
+		args = append(args, filter.Until.UTC())
+	}
+	args = append(args, filter.Limit)
+
+	rows, err := r.query(ctx, r.db, `
+		SELECT `+eventColumns+`
+		FROM deployment_events e
+		JOIN platform_credentials c ON c.id = e.platform_credential_id
+		WHERE `+strings.Join(conditions, " AND ")+`
+		ORDER BY e.observed_at DESC, e.id DESC
+		LIMIT ?
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanEvents(rows)
+}
+
+func (r *deploymentCacheRepository) ListEventsAfter(ctx context.Context, userID string, afterID int64, limit int) ([]model.DeploymentEvent, error) {
+	rows, err := r.query(ctx, r.db, `
+		SELECT `+eventColumns+`
+		FROM deployment_events e
+		JOIN platform_credentials c ON c.id = e.platform_credential_id
+		WHERE c.user_id = ? AND e.id > ?
+		ORDER BY e.id
+		LIMIT ?
+	`, userID, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanEvents(rows)
+}
+
+func (r *deploymentCacheRepository) LatestEventID(ctx context.Context, userID string) (int64, error) {
+	var id sql.NullInt64
+	err := r.queryRow(ctx, r.db, `
+		SELECT MAX(e.id)
+		FROM deployment_events e
+		JOIN platform_credentials c ON c.id = e.platform_credential_id
+		WHERE c.user_id = ?
+	`, userID).Scan(&id)
+	return id.Int64, err
+}
+
+const eventColumns = `
+	e.id, e.platform_credential_id, e.deployment_id, e.deployment_name, e.old_status, e.new_status,
+	e.deploy_id, e.commit_id, e.commit_message, e.observed_at, e.acknowledged_at`
+
+// scans rows of eventColumns
+func scanEvents(rows *sql.Rows) ([]model.DeploymentEvent, error) {
+	events := []model.DeploymentEvent{}
+	for rows.Next() {
+		var event model.DeploymentEvent
+		var oldStatus, deployID, commitID, commitMessage sql.NullString
+		var newStatus string
+		var acknowledgedAt sql.NullTime
+
+		err := rows.Scan(
+			&event.ID, &event.PlatformCredentialID, &event.DeploymentID, &event.DeploymentName,
+			&oldStatus, &newStatus, &deployID, &commitID, &commitMessage, &event.ObservedAt, &acknowledgedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		event.OldStatus = model.DeploymentStatus(oldStatus.String)
+		event.NewStatus = model.DeploymentStatus(newStatus)
+		event.DeployID = deployID.String
+		event.CommitID = commitID.String
+		event.CommitMessage = commitMessage.String
+		event.AcknowledgedAt = timePtr(acknowledgedAt)
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+func (r *deploymentCacheRepository) AcknowledgeEvent(ctx context.Context, userID string, eventID int64, at time.Time) (*model.DeploymentEvent, error) {
+	// ownership through the credential, acknowledging twice keeps the first time
+	res, err := r.exec(ctx, r.db, `
+		UPDATE deployment_events
+		SET acknowledged_at = COALESCE(acknowledged_at, ?)
+		WHERE id = ? AND new_status = ? AND platform_credential_id IN (
+			SELECT id FROM platform_credentials WHERE user_id = ?
+		)
+	`, at.UTC(), eventID, string(model.DeploymentStatusFailed), userID)
+	if err != nil {
+		return nil, err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return nil, err
+	} else if n == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	rows, err := r.query(ctx, r.db, `
+		SELECT `+eventColumns+`
+		FROM deployment_events e
+		WHERE e.id = ?
+	`, eventID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events, err := scanEvents(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(events) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return &events[0], nil
+}
+
+func (r *deploymentCacheRepository) GetEvent(ctx context.Context, userID string, eventID int64) (*model.DeploymentEvent, error) {
+	rows, err := r.query(ctx, r.db, `
+		SELECT `+eventColumns+`
+		FROM deployment_events e
+		JOIN platform_credentials c ON c.id = e.platform_credential_id
+		WHERE e.id = ? AND c.user_id = ?
+	`, eventID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events, err := scanEvents(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(events) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return &events[0], nil
+}
+
+func (r *deploymentCacheRepository) SetEventDeploy(ctx context.Context, eventID int64, deploy *model.DeployInfo) error {
+	_, err := r.exec(ctx, r.db, `
+		UPDATE deployment_events
+		SET deploy_id = ?, commit_id = ?, commit_message = ?
+		WHERE id = ?
+	`, nullString(deploy.ID), nullString(deploy.CommitID), nullString(deploy.CommitMessage), eventID)
+	return err
+}
+
+func (r *deploymentCacheRepository) LastSettledStatus(ctx context.Context, credentialID int, deploymentID string, beforeEventID int64) (model.DeploymentStatus, error) {
+	query := `
+		SELECT new_status FROM deployment_events
+		WHERE platform_credential_id = ? AND deployment_id = ? AND new_status IN (?, ?)`
+	args := []interface{}{credentialID, deploymentID, string(model.DeploymentStatusLive), string(model.DeploymentStatusFailed)}
+	if beforeEventID > 0 {
+		query += ` AND id < ?`
+		args = append(args, beforeEventID)
+	}
+
+	var status string
+	err := r.queryRow(ctx, r.db, query+` ORDER BY id DESC LIMIT 1`, args...).Scan(&status)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return model.DeploymentStatus(status), err
+}
@@ -0,0 +1,126 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	sqlite3 "github.com/mattn/go-sqlite3"
+)
+
+// a unique constraint rejected the write, ex a duplicate credential name
+var ErrDuplicate = errors.New("duplicate value")
+
+// differences between the sql backends, queries are written with ? placeholders and rebound
+type dialect struct {
+	name          string
+	migrationsDir string
+	numbered      bool // $1, $2... placeholders
+	returning     bool // no LastInsertId, ids come from INSERT ... RETURNING id
+}
+
+var (
+	sqliteDialect   = dialect{name: "sqlite", migrationsDir: "migrations/sqlite"}
+	postgresDialect = dialect{name: "postgres", migrationsDir: "migrations/postgres", numbered: true, returning: true}
+)
+
+// converts ? placeholders to the backend syntax
+func (d dialect) rebind(query string) string {
+	if !d.numbered {
+		return query
+	}
+
+	var b strings.Builder
+	b.Grow(len(query) + 16)
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// *sql.DB and *sql.Tx
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// shared by all repositories
+type sqlStore struct {
+	db      *sql.DB
+	dialect dialect
+}
+
+func (s *sqlStore) exec(ctx context.Context, ex execer, query string, args ...interface{}) (sql.Result, error) {
+	return ex.ExecContext(ctx, s.dialect.rebind(query), args...)
+}
+
+func (s *sqlStore) query(ctx context.Context, ex execer, query string, args ...interface{}) (*sql.Rows, error) {
+	return ex.QueryContext(ctx, s.dialect.rebind(query), args...)
+}
+
+func (s *sqlStore) queryRow(ctx context.Context, ex execer, query string, args ...interface{}) *sql.Row {
+	return ex.QueryRowContext(ctx, s.dialect.rebind(query), args...)
+}
+
+// runs an INSERT into a table with an id column and returns the new id
+func (s *sqlStore) insertID(ctx context.Context, ex execer, query string, args ...interface{}) (int64, error) {
+	if s.dialect.returning {
+		var id int64
+		err := s.queryRow(ctx, ex, query+" RETURNING id", args...).Scan(&id)
+		return id, err
+	}
+
+	result, err := s.exec(ctx, ex, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// empty strings are stored as null
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// converts a nullable timestamp column to *time.Time
+func timePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+// converts a nullable integer column to *int
+func intPtr(v sql.NullInt64) *int {
+	if !v.Valid {
+		return nil
+	}
+	i := int(v.Int64)
+	return &i
+}
+
+// reports if err comes from a unique constraint, on either backend
+// primary keys count too, postgres reports both as unique_violation
+func isUniqueViolation(err error) bool {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique || sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == "23505" // unique_violation
+	}
+	return false
+}
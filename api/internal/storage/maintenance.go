@@ -0,0 +1,191 @@
+package storage
+
+import (
+	"checkmate/api/internal/model"
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ids per DELETE ... WHERE id IN (...), stays well below the sqlite variable limit
+const deleteBatchSize = 500
+
+type maintenanceRepository struct {
+	*sqlStore
+}
+
+func (r *maintenanceRepository) DeleteEventsBefore(ctx context.Context, cutoff time.Time) (int64, error) {
+	return r.execCount(ctx, r.db, `DELETE FROM deployment_events WHERE observed_at < ?`, cutoff.UTC())
+}
+
+func (r *maintenanceRepository) TrimEventsPerDeployment(ctx context.Context, keep int) (int64, error) {
+	return r.execCount(ctx, r.db, `
+		DELETE FROM deployment_events
+		WHERE id IN (
+			SELECT id FROM (
+				SELECT id, ROW_NUMBER() OVER (
+					PARTITION BY platform_credential_id, deployment_id
+					ORDER BY observed_at DESC, id DESC
+				) AS rn
+				FROM deployment_events
+			) ranked
+			WHERE rn > ?
+		)
+	`, keep)
+}
+
+func (r *maintenanceRepository) DownsampleEventsBefore(ctx context.Context, cutoff time.Time) (int64, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback() //roll back if not committed
+
+	rows, err := r.query(ctx, tx, `
+		SELECT id, platform_credential_id, deployment_id, observed_at
+		FROM deployment_events
+		WHERE observed_at < ?
+		ORDER BY platform_credential_id, deployment_id, observed_at, id
+	`, cutoff.UTC())
+	if err != nil {
+		return 0, err
+	}
+
+	// rows come grouped by deployment and in time order, so a day is a run of consecutive rows
+	// everything between the first and the last event of a run is dropped
+	var drop []int64
+	var groupKey string
+	var middle []int64 // events after the first one of the current group, the last of them is kept
+	for rows.Next() {
+		var id int64
+		var credentialID int
+		var deploymentID string
+		var observedAt time.Time
+		if err := rows.Scan(&id, &credentialID, &deploymentID, &observedAt); err != nil {
+			rows.Close()
+			return 0, err
+		}
+
+		key := fmt.Sprintf("%d/%s/%s", credentialID, deploymentID, observedAt.UTC().Format("2006-01-02"))
+		if key != groupKey {
+			if len(middle) > 1 {
+				drop = append(drop, middle[:len(middle)-1]...)
+			}
+			groupKey = key
+			middle = middle[:0]
+			continue // first event of the day is kept
+		}
+		middle = append(middle, id)
+	}
+	if len(middle) > 1 {
+		drop = append(drop, middle[:len(middle)-1]...)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	var deleted int64
+	for start := 0; start < len(drop); start += deleteBatchSize {
+		end := start + deleteBatchSize
+		if end > len(drop) {
+			end = len(drop)
+		}
+		batch := drop[start:end]
+
+		args := make([]interface{}, len(batch))
+		for i, id := range batch {
+			args[i] = id
+		}
+		placeholders := strings.TrimSuffix(strings.Repeat("?,", len(batch)), ",")
+
+		n, err := r.execCount(ctx, tx, `DELETE FROM deployment_events WHERE id IN (`+placeholders+`)`, args...)
+		if err != nil {
+			return 0, err
+		}
+		deleted += n
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return deleted, nil
+}
+
+func (r *maintenanceRepository) DeleteGoneDeploymentsBefore(ctx context.Context, cutoff time.Time) (int64, error) {
+	return r.execCount(ctx, r.db,
+		`DELETE FROM deployment_cache WHERE status = ? AND last_updated_at < ?`,
+		string(model.DeploymentStatusGone), cutoff.UTC())
+}
+
+func (r *maintenanceRepository) DeleteWebhookDeliveriesBefore(ctx context.Context, cutoff time.Time) (int64, error) {
+	// a deploy still talked about after the cutoff starts a new thread, not worth keeping them longer
+	if _, err := r.exec(ctx, r.db, `DELETE FROM webhook_threads WHERE created_at < ?`, cutoff.UTC()); err != nil {
+		return 0, err
+	}
+	return r.execCount(ctx, r.db,
+		`DELETE FROM webhook_deliveries WHERE status <> ? AND created_at < ?`,
+		string(model.WebhookDeliveryPending), cutoff.UTC())
+}
+
+// refreshes the query planner statistics
+func (r *maintenanceRepository) Analyze(ctx context.Context) error {
+	_, err := r.db.ExecContext(ctx, "ANALYZE")
+	return err
+}
+
+// gives the space of deleted rows back to the filesystem
+// sqlite rewrites the whole file and blocks writers while doing it, postgres only marks the space reusable
+func (r *maintenanceRepository) Vacuum(ctx context.Context) error {
+	_, err := r.db.ExecContext(ctx, "VACUUM")
+	return err
+}
+
+func (r *maintenanceRepository) Stats(ctx context.Context) (*model.StorageStats, error) {
+	stats := &model.StorageStats{Backend: r.dialect.name}
+
+	if r.dialect == sqliteDialect {
+		var pageCount, pageSize int64
+		if err := r.db.QueryRowContext(ctx, "PRAGMA page_count").Scan(&pageCount); err != nil {
+			return nil, err
+		}
+		if err := r.db.QueryRowContext(ctx, "PRAGMA page_size").Scan(&pageSize); err != nil {
+			return nil, err
+		}
+		stats.SizeBytes = pageCount * pageSize
+	} else {
+		if err := r.db.QueryRowContext(ctx, "SELECT pg_database_size(current_database())").Scan(&stats.SizeBytes); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM deployment_events").Scan(&stats.DeploymentEvents); err != nil {
+		return nil, err
+	}
+
+	// not MIN(), sqlite returns aggregates as plain text instead of a timestamp
+	var oldest time.Time
+	err := r.db.QueryRowContext(ctx, "SELECT observed_at FROM deployment_events ORDER BY observed_at LIMIT 1").Scan(&oldest)
+	if err == nil {
+		stats.OldestEventAt = &oldest
+	} else if err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	if err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM deployment_cache").Scan(&stats.CachedDeployments); err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+// runs a statement and returns the number of affected rows
+func (r *maintenanceRepository) execCount(ctx context.Context, ex execer, query string, args ...interface{}) (int64, error) {
+	result, err := r.exec(ctx, ex, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
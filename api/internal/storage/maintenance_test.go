@@ -0,0 +1,135 @@
+package storage
+
+import (
+	"checkmate/api/internal/model"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sqlite compares timestamps as text, a server outside utc must still cut at the right instant
+func TestDeleteGoneDeploymentsBeforeAcrossZones(t *testing.T) {
+	zone := time.FixedZone("UTC+5", 5*60*60)
+	now := time.Now()
+
+	cutoffs := map[string]time.Time{
+		"local cutoff": now.Add(-time.Hour).In(zone),
+		"utc cutoff":   now.Add(-time.Hour).UTC(),
+	}
+	for name, cutoff := range cutoffs {
+		t.Run(name, func(t *testing.T) {
+			openBackend(t, "")
+			ctx := context.Background()
+			credID := createTestCredential(t, ctx, createTestUser(t, ctx), "zones")
+			writeDeployments(t, ctx, credID,
+				model.Deployment{ID: "srv-old", Name: "old", Status: model.DeploymentStatusLive},
+				model.Deployment{ID: "srv-new", Name: "new", Status: model.DeploymentStatusLive},
+			)
+
+			// the refresh marks them gone with a local time, like time.Now() on the server
+			for id, at := range map[string]time.Time{"srv-old": now.Add(-2 * time.Hour), "srv-new": now.Add(-30 * time.Minute)} {
+				_, err := Deployments.WriteCache(ctx, credID, func(map[string]CachedDeploymentState) (*CacheWrite, error) {
+					return &CacheWrite{At: at.In(zone), Gone: []string{id}}, nil
+				})
+				if err != nil {
+					t.Fatalf("mark %s gone: %v", id, err)
+				}
+			}
+
+			if n, err := Maintenance.DeleteGoneDeploymentsBefore(ctx, cutoff); err != nil || n != 1 {
+				t.Fatalf("deleted %d gone deployments (err %v), want 1", n, err)
+			}
+			cached, err := Deployments.ListCached(ctx, credID)
+			if err != nil {
+				t.Fatalf("list cached: %v", err)
+			}
+			var ids []string
+			for _, d := range cached {
+				ids = append(ids, d.ID)
+			}
+			if strings.Join(ids, " ") != "srv-new" {
+				t.Errorf("cached deployments %v, want only srv-new", ids)
+			}
+		})
+	}
+}
+
+// the compaction job downsamples then trims, the per-deployment limit counts what downsampling left
+func TestDownsampleThenTrimEvents(t *testing.T) {
+	openBackend(t, "")
+	ctx := context.Background()
+	userID := createTestUser(t, ctx)
+	credA := createTestCredential(t, ctx, userID, "a")
+	credB := createTestCredential(t, ctx, userID, "b")
+
+	at := func(day, hour, minute int) time.Time { return time.Date(2026, 1, day, hour, minute, 0, 0, time.UTC) }
+	event := func(deploymentID string, observedAt time.Time) model.DeploymentEvent {
+		return model.DeploymentEvent{DeploymentID: deploymentID, NewStatus: model.DeploymentStatusLive, ObservedAt: observedAt}
+	}
+	// utc+5 puts all three on the 3rd, the days are utc days
+	zone := time.FixedZone("UTC+5", 5*60*60)
+
+	a := writeEvents(t, ctx, credA,
+		event("srv-1", at(1, 0, 0)), event("srv-1", at(1, 6, 0)), event("srv-1", at(1, 12, 0)), event("srv-1", at(1, 18, 0)),
+		event("srv-1", at(2, 9, 0)),
+		event("srv-1", at(3, 1, 0)), event("srv-1", at(3, 2, 0)),
+		event("srv-1", at(4, 0, 0)), event("srv-1", at(4, 1, 0)), event("srv-1", at(4, 2, 0)), // after the cutoff
+		event("srv-2", at(1, 1, 0)), event("srv-2", at(1, 2, 0)), event("srv-2", at(1, 3, 0)),
+		event("srv-3", at(2, 22, 0).In(zone)), event("srv-3", at(2, 23, 30).In(zone)), event("srv-3", at(3, 0, 30).In(zone)),
+	)
+	// same deployment id under another credential is another group
+	b := writeEvents(t, ctx, credB,
+		event("srv-1", at(1, 0, 0)), event("srv-1", at(1, 1, 0)), event("srv-1", at(1, 2, 0)),
+	)
+
+	left := func(credID int, deploymentID string) []int64 {
+		t.Helper()
+		events, err := Deployments.ListEvents(ctx, userID, model.DeploymentEventFilter{CredentialID: &credID, DeploymentID: deploymentID, Limit: 100})
+		if err != nil {
+			t.Fatalf("list events: %v", err)
+		}
+		return eventIDs(events)
+	}
+	check := func(step string, credID int, deploymentID string, want ...model.DeploymentEvent) {
+		t.Helper()
+		// newest first like ListEvents
+		var ids []int64
+		for i := len(want) - 1; i >= 0; i-- {
+			ids = append(ids, want[i].ID)
+		}
+		if got := left(credID, deploymentID); fmt.Sprint(got) != fmt.Sprint(ids) {
+			t.Errorf("after %s: events of %d/%s are %v, want %v", step, credID, deploymentID, got, ids)
+		}
+	}
+
+	n, err := Maintenance.DownsampleEventsBefore(ctx, at(4, 0, 0))
+	if err != nil {
+		t.Fatalf("downsample: %v", err)
+	}
+	// 2 in the middle of srv-1's 1st, 1 of srv-2 and 1 of the other credential
+	if n != 4 {
+		t.Errorf("downsampled %d events, want 4", n)
+	}
+	check("downsampling", credA, "srv-1", a[0], a[3], a[4], a[5], a[6], a[7], a[8], a[9])
+	check("downsampling", credA, "srv-2", a[10], a[12])
+	check("downsampling", credA, "srv-3", a[13], a[14], a[15])
+	check("downsampling", credB, "srv-1", b[0], b[2])
+
+	// nothing left to thin out
+	if n, err := Maintenance.DownsampleEventsBefore(ctx, at(4, 0, 0)); err != nil || n != 0 {
+		t.Errorf("second downsample removed %d (err %v), want 0", n, err)
+	}
+
+	if n, err = Maintenance.TrimEventsPerDeployment(ctx, 5); err != nil {
+		t.Fatalf("trim: %v", err)
+	}
+	if n != 3 {
+		t.Errorf("trimmed %d events, want 3", n)
+	}
+	check("trimming", credA, "srv-1", a[5], a[6], a[7], a[8], a[9])
+	check("trimming", credA, "srv-2", a[10], a[12])
+	check("trimming", credA, "srv-3", a[13], a[14], a[15])
+	check("trimming", credB, "srv-1", b[0], b[2])
+}
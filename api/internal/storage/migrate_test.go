@@ -0,0 +1,72 @@
+package storage
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 0004 renames duplicate credential names before the unique index goes in,
+// the new names must not collide with names the user already has
+func TestCredentialNameMigrationAvoidsCollisions(t *testing.T) {
+	t.Setenv("DATABASE_URL", "")
+	t.Setenv("SQLITE_PATH", filepath.Join(t.TempDir(), "checkmate.db"))
+	if err := Open(); err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { DB.Close() })
+
+	ctx := context.Background()
+	if _, err := MigrateTo(ctx, 3); err != nil {
+		t.Fatalf("migrate to 3: %v", err)
+	}
+
+	now := time.Now().UTC()
+	if _, err := DB.ExecContext(ctx, `INSERT INTO users (id, email, created_at) VALUES ('u1', 'u1@example.com', ?), ('u2', 'u2@example.com', ?)`, now, now); err != nil {
+		t.Fatalf("insert users: %v", err)
+	}
+
+	// ids are given so the expected names are known up front
+	seed := []struct {
+		id               int
+		user, name, want string
+	}{
+		{1, "u1", "Prod", "Prod"},
+		{2, "u1", "prod", "prod (2-1)"}, // 'prod (2)' is taken by 3
+		{3, "u1", "prod (2)", "prod (2)"},
+		{4, "u1", "PROD", "PROD (4)"},
+		{5, "u1", "", "render 5"},
+		{6, "u1", "render 5", "render 5 (6)"}, // 5 got that name filled in and has the lower id
+		{7, "u2", "prod", "prod"},
+	}
+
+	for _, s := range seed {
+		if _, err := DB.ExecContext(ctx,
+			`INSERT INTO platform_credentials (id, user_id, platform, name, api_key, created_at) VALUES (?, ?, 'render', ?, 'key', ?)`,
+			s.id, s.user, s.name, now); err != nil {
+			t.Fatalf("insert credential %d: %v", s.id, err)
+		}
+	}
+
+	if _, err := MigrateUp(ctx); err != nil {
+		t.Fatalf("migrate up: %v", err)
+	}
+
+	seen := make(map[string]int)
+	for _, s := range seed {
+		var name string
+		if err := DB.QueryRowContext(ctx, `SELECT name FROM platform_credentials WHERE id = ?`, s.id).Scan(&name); err != nil {
+			t.Fatalf("read credential %d: %v", s.id, err)
+		}
+		if name != s.want {
+			t.Errorf("credential %d is named %q, want %q", s.id, name, s.want)
+		}
+		key := s.user + "/" + strings.ToLower(name)
+		if other, dup := seen[key]; dup {
+			t.Errorf("credentials %d and %d share the name %q", other, s.id, name)
+		}
+		seen[key] = s.id
+	}
+}
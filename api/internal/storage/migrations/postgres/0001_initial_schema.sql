@@ -0,0 +1,35 @@
+-- Baseline schema, same version numbers as the sqlite migrations so schema versions match across backends
+
+-- Users table, no password -> firebase auth handles it
+CREATE TABLE IF NOT EXISTS users (
+    id VARCHAR(128) PRIMARY KEY,
+    email VARCHAR(255) NOT NULL,
+    display_name VARCHAR(255),
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Platform credentials
+CREATE TABLE IF NOT EXISTS platform_credentials (
+    id SERIAL PRIMARY KEY,
+    user_id VARCHAR(128) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    platform VARCHAR(50) NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    api_key TEXT NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Cache for deployment data
+CREATE TABLE IF NOT EXISTS deployment_cache (
+    id VARCHAR(255) NOT NULL,
+    platform_credential_id INTEGER NOT NULL REFERENCES platform_credentials(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    status VARCHAR(50) NOT NULL,
+    url VARCHAR(255),
+    last_deployed_at TIMESTAMPTZ,
+    branch VARCHAR(255),
+    service_type VARCHAR(100),
+    framework VARCHAR(100),
+    last_updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP, -- last time the data changed
+    metadata TEXT,
+    PRIMARY KEY (id, platform_credential_id)
+);
@@ -0,0 +1,2 @@
+-- Faster user lookup by email
+CREATE INDEX idx_users_email ON users (email);
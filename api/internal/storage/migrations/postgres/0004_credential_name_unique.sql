@@ -0,0 +1,32 @@
+-- Credential names are chosen by the user and unique per user (case insensitive),
+-- so several accounts on the same platform can be told apart.
+
+-- fill in names for rows that have none and rename duplicates before the index goes in
+UPDATE platform_credentials SET name = platform || ' ' || id WHERE TRIM(name) = '';
+
+-- duplicates past the first get ' (id)', or ' (id-n)' with the smallest n when the user already has that name too
+-- the id in the suffix keeps renamed rows apart from each other, n only has to step over the names already taken
+UPDATE platform_credentials SET name = (
+    WITH RECURSIVE attempt(n) AS (
+        SELECT 0
+        UNION ALL
+        SELECT n + 1 FROM attempt WHERE n < (SELECT COUNT(*) FROM platform_credentials)
+    )
+    SELECT c.candidate
+    FROM (
+        SELECT n, platform_credentials.name || ' (' || platform_credentials.id
+            || CASE WHEN n = 0 THEN '' ELSE '-' || n END || ')' AS candidate
+        FROM attempt
+    ) c
+    WHERE NOT EXISTS (
+        SELECT 1 FROM platform_credentials taken
+        WHERE taken.user_id = platform_credentials.user_id AND LOWER(taken.name) = LOWER(c.candidate)
+    )
+    ORDER BY c.n
+    LIMIT 1
+)
+WHERE id NOT IN (
+    SELECT MIN(id) FROM platform_credentials GROUP BY user_id, LOWER(name)
+);
+
+CREATE UNIQUE INDEX idx_platform_credentials_user_name ON platform_credentials (user_id, LOWER(name));
@@ -0,0 +1,5 @@
+-- Indexes for listing deployments: filtered by credential, sorted by name, status or last deploy.
+
+CREATE INDEX idx_deployment_cache_credential_name ON deployment_cache (platform_credential_id, LOWER(name));
+CREATE INDEX idx_deployment_cache_credential_status ON deployment_cache (platform_credential_id, status);
+CREATE INDEX idx_deployment_cache_credential_last_deployed ON deployment_cache (platform_credential_id, last_deployed_at);
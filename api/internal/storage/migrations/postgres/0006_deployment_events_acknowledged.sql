@@ -0,0 +1,3 @@
+-- Failure events can be acknowledged from the dashboard, null until then.
+
+ALTER TABLE deployment_events ADD COLUMN acknowledged_at TIMESTAMPTZ;
@@ -0,0 +1,33 @@
+-- Outbound webhooks: a user registers urls that get the deployment events they picked,
+-- every POST is queued in webhook_deliveries so it survives restarts and keeps a log per webhook.
+
+CREATE TABLE IF NOT EXISTS webhooks (
+    id SERIAL PRIMARY KEY,
+    user_id VARCHAR(128) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    url TEXT NOT NULL,
+    event_types TEXT NOT NULL,      -- comma separated, ex "deployment.failed,deployment.recovered"
+    secret TEXT NOT NULL,           -- hmac key, encrypted like the api keys
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhooks_user ON webhooks (user_id);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id BIGSERIAL PRIMARY KEY,
+    webhook_id INTEGER NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+    event_type VARCHAR(50) NOT NULL,
+    event_id BIGINT,                -- deployment event, null for test deliveries
+    payload TEXT NOT NULL,          -- sent as is on every attempt
+    status VARCHAR(20) NOT NULL,    -- pending, succeeded, failed
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMPTZ,    -- null once the delivery is finished
+    response_status INTEGER,        -- of the last attempt
+    last_error TEXT,
+    duration_ms INTEGER,
+    created_at TIMESTAMPTZ NOT NULL,
+    completed_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook ON webhook_deliveries (webhook_id, id);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries (status, next_attempt_at);
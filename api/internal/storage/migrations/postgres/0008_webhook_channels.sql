@@ -0,0 +1,20 @@
+-- Chat channels: a webhook can post Slack or Discord messages instead of the signed json payload,
+-- every webhook can be limited to some credentials and statuses, and follow-up messages of a deploy
+-- go to the thread of the first one where the chat supports it.
+
+ALTER TABLE webhooks ADD COLUMN type VARCHAR(20) NOT NULL DEFAULT 'generic'; -- generic, slack, discord
+ALTER TABLE webhooks ADD COLUMN credential_ids TEXT NOT NULL DEFAULT '';     -- comma separated, empty means all
+ALTER TABLE webhooks ADD COLUMN statuses TEXT NOT NULL DEFAULT '';           -- comma separated, empty means all
+ALTER TABLE webhooks ADD COLUMN slack_channel VARCHAR(100);                  -- slack bot token mode, the token is the secret
+ALTER TABLE webhooks ADD COLUMN discord_forum BOOLEAN NOT NULL DEFAULT FALSE; -- the discord webhook posts to a forum channel
+
+ALTER TABLE webhook_deliveries ADD COLUMN thread_key VARCHAR(512);           -- credential/deployment/deploy of the event
+
+-- first message of each deploy per webhook, later ones reply to it
+CREATE TABLE IF NOT EXISTS webhook_threads (
+    webhook_id INTEGER NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+    thread_key VARCHAR(512) NOT NULL,
+    thread_ref VARCHAR(255) NOT NULL,   -- slack message ts or discord thread id
+    created_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (webhook_id, thread_key)
+);
@@ -0,0 +1,4 @@
+-- Email notifications are webhooks of type email with a mailto: url, the ones subscribed to digest.daily
+-- get a summary once a day, last_digest_at is the digest time of the last one queued.
+
+ALTER TABLE webhooks ADD COLUMN last_digest_at TIMESTAMPTZ;
@@ -0,0 +1,42 @@
+-- Notification rules: once a user has rules they decide which webhooks an event goes to.
+-- notify rules route matching events to their webhooks, mute rules drop them (quiet hours are a mute rule
+-- with a schedule), notify rules can drop repeats within a window and escalate failures that last.
+
+CREATE TABLE IF NOT EXISTS notification_rules (
+    id SERIAL PRIMARY KEY,
+    user_id VARCHAR(128) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    action VARCHAR(20) NOT NULL,                    -- notify, mute
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    -- conditions, comma separated lists, empty means any
+    credential_ids TEXT NOT NULL DEFAULT '',
+    branches TEXT NOT NULL DEFAULT '',              -- glob patterns
+    services TEXT NOT NULL DEFAULT '',              -- glob patterns on the deployment name
+    event_types TEXT NOT NULL DEFAULT '',
+    except_event_types TEXT NOT NULL DEFAULT '',
+    schedule_start VARCHAR(5),                      -- HH:MM, the rule only applies from start to end
+    schedule_end VARCHAR(5),
+    timezone VARCHAR(64) NOT NULL DEFAULT 'UTC',
+    -- webhooks the rule applies to, empty means all of the user's
+    webhook_ids TEXT NOT NULL DEFAULT '',
+    dedup_minutes INTEGER NOT NULL DEFAULT 0,
+    escalate_after_minutes INTEGER NOT NULL DEFAULT 0,
+    escalate_webhook_ids TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_notification_rules_user ON notification_rules (user_id);
+
+-- failures waiting to be escalated, dropped with their rule or event
+CREATE TABLE IF NOT EXISTS notification_escalations (
+    id BIGSERIAL PRIMARY KEY,
+    rule_id INTEGER NOT NULL REFERENCES notification_rules(id) ON DELETE CASCADE,
+    event_id BIGINT NOT NULL REFERENCES deployment_events(id) ON DELETE CASCADE,
+    status VARCHAR(20) NOT NULL,                    -- pending, sent, cancelled
+    due_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    completed_at TIMESTAMPTZ,
+    UNIQUE (rule_id, event_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_notification_escalations_due ON notification_escalations (status, due_at);
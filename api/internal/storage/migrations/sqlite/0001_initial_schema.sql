@@ -0,0 +1,39 @@
+-- Baseline schema, the tables as they were before versioned migrations existed.
+-- IF NOT EXISTS because databases from before schema_migrations already have these tables,
+-- everything added since goes into its own migration.
+
+-- Users table, no password -> firebase auth handles it
+CREATE TABLE IF NOT EXISTS users (
+    id VARCHAR(128) PRIMARY KEY,
+    email VARCHAR(255) NOT NULL,
+    display_name VARCHAR(255),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Platform credentials
+CREATE TABLE IF NOT EXISTS platform_credentials (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id VARCHAR(128) NOT NULL,
+    platform VARCHAR(50) NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    api_key TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- Cache for deployment data
+CREATE TABLE IF NOT EXISTS deployment_cache (
+    id VARCHAR(255) NOT NULL,
+    platform_credential_id INTEGER NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    status VARCHAR(50) NOT NULL,
+    url VARCHAR(255),
+    last_deployed_at TIMESTAMP,
+    branch VARCHAR(255),
+    service_type VARCHAR(100),
+    framework VARCHAR(100),
+    last_updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP, -- last time the data changed
+    metadata TEXT,
+    PRIMARY KEY (id, platform_credential_id),
+    FOREIGN KEY (platform_credential_id) REFERENCES platform_credentials(id) ON DELETE CASCADE
+);
@@ -0,0 +1,30 @@
+-- Columns and tables the cache refresh needs on top of the baseline:
+-- per credential ttl and last refresh, change detection and gone tracking for cached deployments,
+-- and the status transitions seen while refreshing.
+
+ALTER TABLE platform_credentials ADD COLUMN cache_ttl_seconds INTEGER;      -- null means platform/global ttl
+ALTER TABLE platform_credentials ADD COLUMN cache_refreshed_at TIMESTAMP;   -- last successful fetch from the platform
+
+ALTER TABLE deployment_cache ADD COLUMN fingerprint VARCHAR(64);            -- hash of the platform data, to detect changes
+ALTER TABLE deployment_cache ADD COLUMN first_seen_at TIMESTAMP;
+ALTER TABLE deployment_cache ADD COLUMN last_seen_at TIMESTAMP;             -- last time the platform returned it
+
+-- Status transitions observed when refreshing the cache
+CREATE TABLE deployment_events (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    platform_credential_id INTEGER NOT NULL,
+    deployment_id VARCHAR(255) NOT NULL,
+    deployment_name VARCHAR(255) NOT NULL,
+    old_status VARCHAR(50),         -- null the first time a deployment is seen
+    new_status VARCHAR(50) NOT NULL,
+    deploy_id VARCHAR(255),
+    commit_id VARCHAR(255),
+    commit_message TEXT,
+    observed_at TIMESTAMP NOT NULL,
+    FOREIGN KEY (platform_credential_id) REFERENCES platform_credentials(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_deployment_events_deployment
+    ON deployment_events (platform_credential_id, deployment_id, observed_at);
+CREATE INDEX idx_deployment_events_observed_at
+    ON deployment_events (observed_at);
@@ -0,0 +1,45 @@
+-- Notification rules: once a user has rules they decide which webhooks an event goes to.
+-- notify rules route matching events to their webhooks, mute rules drop them (quiet hours are a mute rule
+-- with a schedule), notify rules can drop repeats within a window and escalate failures that last.
+
+CREATE TABLE IF NOT EXISTS notification_rules (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id VARCHAR(128) NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    action VARCHAR(20) NOT NULL,                    -- notify, mute
+    enabled BOOLEAN NOT NULL DEFAULT 1,
+    -- conditions, comma separated lists, empty means any
+    credential_ids TEXT NOT NULL DEFAULT '',
+    branches TEXT NOT NULL DEFAULT '',              -- glob patterns
+    services TEXT NOT NULL DEFAULT '',              -- glob patterns on the deployment name
+    event_types TEXT NOT NULL DEFAULT '',
+    except_event_types TEXT NOT NULL DEFAULT '',
+    schedule_start VARCHAR(5),                      -- HH:MM, the rule only applies from start to end
+    schedule_end VARCHAR(5),
+    timezone VARCHAR(64) NOT NULL DEFAULT 'UTC',
+    -- webhooks the rule applies to, empty means all of the user's
+    webhook_ids TEXT NOT NULL DEFAULT '',
+    dedup_minutes INTEGER NOT NULL DEFAULT 0,
+    escalate_after_minutes INTEGER NOT NULL DEFAULT 0,
+    escalate_webhook_ids TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_notification_rules_user ON notification_rules (user_id);
+
+-- failures waiting to be escalated, dropped with their rule or event
+CREATE TABLE IF NOT EXISTS notification_escalations (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    rule_id INTEGER NOT NULL,
+    event_id INTEGER NOT NULL,
+    status VARCHAR(20) NOT NULL,                    -- pending, sent, cancelled
+    due_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    completed_at TIMESTAMP,
+    UNIQUE (rule_id, event_id),
+    FOREIGN KEY (rule_id) REFERENCES notification_rules(id) ON DELETE CASCADE,
+    FOREIGN KEY (event_id) REFERENCES deployment_events(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_notification_escalations_due ON notification_escalations (status, due_at);
@@ -0,0 +1,186 @@
+package storage
+
+import (
+	"checkmate/api/internal/model"
+	"context"
+	"time"
+)
+
+//Repository interfaces -> the services only talk to the database through these
+
+type UserRepository interface {
+	// nil, nil when the user doesn't exist
+	GetByID(ctx context.Context, id string) (*model.User, error)
+	Create(ctx context.Context, user *model.User) error
+	Update(ctx context.Context, user *model.User) error
+	Delete(ctx context.Context, id string) error
+}
+
+// api keys go in and come out encrypted, encryption is the service's job
+type CredentialRepository interface {
+	ListByUser(ctx context.Context, userID string) ([]model.PlatformCredential, error)
+	// sql.ErrNoRows when the credential doesn't exist or isn't the user's
+	GetByID(ctx context.Context, id int, userID string) (*model.PlatformCredential, error)
+	// returns the new id, ErrDuplicate when the user already has a credential with that name
+	Create(ctx context.Context, cred *model.PlatformCredential) (int, error)
+	// the bool reports if a credential of the user was found, an empty name keeps the current one
+	Update(ctx context.Context, id int, userID string, name string, platform string, encryptedAPIKey string) (bool, error)
+	SetCacheTTL(ctx context.Context, id int, userID string, ttlSeconds *int) (bool, error)
+	Delete(ctx context.Context, id int, userID string) (bool, error)
+	// nil when the cache of the credential was never refreshed
+	GetCacheRefreshedAt(ctx context.Context, id int) (*time.Time, error)
+}
+
+type DeploymentCacheRepository interface {
+	ListCached(ctx context.Context, credentialID int) ([]model.Deployment, error)
+	// one cached deployment, sql.ErrNoRows when the credential doesn't have it
+	Get(ctx context.Context, credentialID int, deploymentID string) (*model.Deployment, error)
+	// cached deployments of the given credentials of the user, filtered, sorted and paged as query says
+	// returns the cursor of the last row when there are more rows after it
+	List(ctx context.Context, userID string, credentialIDs []int, query model.DeploymentQuery, after *DeploymentCursor) ([]model.Deployment, *DeploymentCursor, error)
+	// reads the cached state and applies what plan returns, all in one transaction
+	WriteCache(ctx context.Context, credentialID int, plan CachePlanFunc) (*CacheWrite, error)
+	ListEvents(ctx context.Context, userID string, filter model.DeploymentEventFilter) ([]model.DeploymentEvent, error)
+	// events of the user newer than afterID, oldest first
+	ListEventsAfter(ctx context.Context, userID string, afterID int64, limit int) ([]model.DeploymentEvent, error)
+	// id of the newest event of the user, 0 when there is none
+	LatestEventID(ctx context.Context, userID string) (int64, error)
+	// marks a failure event of the user as acknowledged, sql.ErrNoRows when the user doesn't have such an event
+	AcknowledgeEvent(ctx context.Context, userID string, eventID int64, at time.Time) (*model.DeploymentEvent, error)
+	SetEventDeploy(ctx context.Context, eventID int64, deploy *model.DeployInfo) error
+	// one event of the user, sql.ErrNoRows when the user doesn't have it
+	GetEvent(ctx context.Context, userID string, eventID int64) (*model.DeploymentEvent, error)
+	// live or failed, whichever the deployment reached last before the event (any event when beforeEventID is 0)
+	// empty when it never settled or that history was compacted away
+	LastSettledStatus(ctx context.Context, credentialID int, deploymentID string, beforeEventID int64) (model.DeploymentStatus, error)
+}
+
+// webhook secrets go in and come out encrypted, like the api keys
+type WebhookRepository interface {
+	ListByUser(ctx context.Context, userID string) ([]model.Webhook, error)
+	// sql.ErrNoRows when the webhook doesn't exist or isn't the user's
+	GetByID(ctx context.Context, id int, userID string) (*model.Webhook, error)
+	Create(ctx context.Context, hook *model.Webhook) (int, error)
+	// saves every field but the creation time, the bool reports if a webhook of the user was found
+	Update(ctx context.Context, hook *model.Webhook) (bool, error)
+	Delete(ctx context.Context, id int, userID string) (bool, error)
+
+	CreateDelivery(ctx context.Context, delivery *model.WebhookDelivery) (int64, error)
+	// newest first, beforeID 0 starts at the newest
+	ListDeliveries(ctx context.Context, webhookID int, beforeID int64, limit int) ([]model.WebhookDelivery, error)
+	// pending deliveries of enabled webhooks that are due, moved to leaseUntil so no other worker picks them up meanwhile
+	ClaimDueDeliveries(ctx context.Context, now time.Time, leaseUntil time.Time, limit int) ([]ClaimedDelivery, error)
+	RecordDeliveryAttempt(ctx context.Context, id int64, attempt DeliveryAttempt) error
+	// when the webhook was last given an event of that type for the deployment before the given time, nil when never
+	LastDeliveryAt(ctx context.Context, webhookID int, eventType model.WebhookEventType, credentialID int, deploymentID string, before time.Time) (*time.Time, error)
+
+	// reference of the first message of a deploy in a threaded chat, empty when there is none yet
+	GetThread(ctx context.Context, webhookID int, threadKey string) (string, error)
+	// keeps the reference already saved for the key, if any
+	SaveThread(ctx context.Context, webhookID int, threadKey string, threadRef string, at time.Time) error
+
+	// enabled email webhooks subscribed to the daily digest that didn't get the one of due yet,
+	// a webhook created after due waits for the next one
+	ListDigestsDue(ctx context.Context, due time.Time) ([]model.Webhook, error)
+	// sets last_digest_at to due unless it already is, false when another instance was first
+	MarkDigestQueued(ctx context.Context, id int, due time.Time) (bool, error)
+}
+
+type NotificationRuleRepository interface {
+	ListByUser(ctx context.Context, userID string) ([]model.NotificationRule, error)
+	// sql.ErrNoRows when the rule doesn't exist or isn't the user's
+	GetByID(ctx context.Context, id int, userID string) (*model.NotificationRule, error)
+	Create(ctx context.Context, rule *model.NotificationRule) (int, error)
+	// saves every field but the creation time, the bool reports if a rule of the user was found
+	Update(ctx context.Context, rule *model.NotificationRule) (bool, error)
+	Delete(ctx context.Context, id int, userID string) (bool, error)
+
+	// a rule escalates an event once, creating it again is a no-op
+	CreateEscalation(ctx context.Context, ruleID int, eventID int64, dueAt time.Time, at time.Time) error
+	// pending escalations due at now, oldest first
+	ListDueEscalations(ctx context.Context, now time.Time, limit int) ([]Escalation, error)
+	// moves a pending escalation to status, false when it wasn't pending anymore (another instance took it)
+	CompleteEscalation(ctx context.Context, id int64, status string, at time.Time) (bool, error)
+}
+
+// statuses of an escalation
+const (
+	EscalationPending   = "pending"
+	EscalationSent      = "sent"
+	EscalationCancelled = "cancelled"
+)
+
+// failure waiting for its rule's delay
+type Escalation struct {
+	ID      int64
+	RuleID  int
+	EventID int64
+	UserID  string
+	DueAt   time.Time
+}
+
+// delivery taken by a worker with the webhook it goes to, the secret still encrypted
+type ClaimedDelivery struct {
+	Delivery model.WebhookDelivery
+	Webhook  model.Webhook
+}
+
+// outcome of one delivery attempt
+type DeliveryAttempt struct {
+	Status         model.WebhookDeliveryStatus
+	ResponseStatus *int
+	Error          string
+	DurationMs     int64
+	At             time.Time
+	NextAttemptAt  *time.Time // nil when the delivery is finished, completed_at is set to At
+}
+
+// cached state of one deployment, what a refresh is compared against
+type CachedDeploymentState struct {
+	Name        string
+	Status      model.DeploymentStatus
+	Fingerprint string
+	LastSeenAt  time.Time
+}
+
+// sort values of the last row of a page, the next page starts after that row
+type DeploymentCursor struct {
+	SortName       string    `json:"n"` // LOWER(name) as the database computes it
+	Status         string    `json:"s"`
+	LastDeployedAt time.Time `json:"d"` // never deployed -> unix epoch
+	CredentialID   int       `json:"c"`
+	ID             string    `json:"i"`
+}
+
+// deployment to insert or update together with the fingerprint of its data
+type CachedDeployment struct {
+	Deployment  model.Deployment
+	Fingerprint string
+}
+
+// changes to apply to the cache of one credential
+type CacheWrite struct {
+	Upserts []CachedDeployment // new or changed deployments
+	Seen    []string           // unchanged deployments, only last_seen_at moves
+	Gone    []string           // deployments to mark as gone
+	Events  []model.DeploymentEvent
+	At      time.Time // refresh time, used for last_seen_at/last_updated_at/cache_refreshed_at
+}
+
+// decides the cache write from the current cached state
+type CachePlanFunc func(previous map[string]CachedDeploymentState) (*CacheWrite, error)
+
+// pruning and housekeeping of the history tables, used by the compaction job
+type MaintenanceRepository interface {
+	DeleteEventsBefore(ctx context.Context, cutoff time.Time) (int64, error)
+	// keeps the newest keep events of every deployment
+	TrimEventsPerDeployment(ctx context.Context, keep int) (int64, error)
+	// events before cutoff keep only the first and last transition of each deployment and day
+	DownsampleEventsBefore(ctx context.Context, cutoff time.Time) (int64, error)
+	DeleteGoneDeploymentsBefore(ctx context.Context, cutoff time.Time) (int64, error)
+	// finished webhook deliveries and chat threads created before cutoff, pending deliveries are kept
+	DeleteWebhookDeliveriesBefore(ctx context.Context, cutoff time.Time) (int64, error)
+	Analyze(ctx context.Context) error
+	Vacuum(ctx context.Context) error
+	Stats(ctx context.Context) (*model.StorageStats, error)
+}
@@ -0,0 +1,1063 @@
+package storage
+
+import (
+	"bytes"
+	"checkmate/api/internal/model"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	embeddedpostgres "github.com/fergusstrange/embedded-postgres"
+)
+
+// the same cases run against every backend through the repository interfaces
+// -> sqlite in a temp dir, postgres at DATABASE_URL or an embedded one started for the test
+// the maintenance cases prune whole tables, DATABASE_URL must be a throwaway database
+
+type repoCase struct {
+	name string
+	run  func(t *testing.T, ctx context.Context, userID string)
+}
+
+var repoCases = []repoCase{
+	{"rebind", testRebind},
+	{"insert id", testInsertID},
+	{"unique violation", testUniqueViolation},
+	{"keyset list", testKeysetList},
+	{"write cache upsert", testWriteCacheUpsert},
+	{"events", testEvents},
+	{"webhooks", testWebhooks},
+	{"rules", testRules},
+	{"maintenance", testMaintenance},
+}
+
+func TestRepositories(t *testing.T) {
+	backends := []struct {
+		name string
+		dsn  func(t *testing.T) string // empty selects sqlite
+	}{
+		{"sqlite", func(*testing.T) string { return "" }},
+		{"postgres", postgresDSN},
+	}
+
+	for _, backend := range backends {
+		t.Run(backend.name, func(t *testing.T) {
+			openBackend(t, backend.dsn(t))
+
+			for _, c := range repoCases {
+				t.Run(c.name, func(t *testing.T) {
+					ctx := context.Background()
+					c.run(t, ctx, createTestUser(t, ctx))
+				})
+			}
+		})
+	}
+}
+
+// DATABASE_URL when set, otherwise an embedded postgres running until the test ends
+// its binaries are downloaded once to ~/.embedded-postgres-go, without network and cache the test is skipped
+func postgresDSN(t *testing.T) string {
+	t.Helper()
+	if dsn := os.Getenv("DATABASE_URL"); dsn != "" {
+		return dsn
+	}
+	if os.Geteuid() == 0 {
+		t.Skip("postgres refuses to run as root, set DATABASE_URL")
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("find a free port: %v", err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	var logs bytes.Buffer
+	config := embeddedpostgres.DefaultConfig().
+		Port(uint32(port)).
+		RuntimePath(t.TempDir()).
+		StartTimeout(time.Minute).
+		Logger(&logs)
+	postgres := embeddedpostgres.NewDatabase(config)
+	if err := postgres.Start(); err != nil {
+		// the library has no typed errors, these are the ones of the binaries download
+		msg := err.Error()
+		if strings.HasPrefix(msg, "unable to connect to http") || strings.HasPrefix(msg, "no version found matching") {
+			t.Skipf("postgres binaries not available: %v", err)
+		}
+		t.Fatalf("start embedded postgres: %v\n%s", err, logs.String())
+	}
+	t.Cleanup(func() {
+		if err := postgres.Stop(); err != nil {
+			t.Errorf("stop embedded postgres: %v", err)
+		}
+	})
+	return config.GetConnectionURL() + "?sslmode=disable"
+}
+
+// points the storage globals at the backend with the schema migrated
+func openBackend(t *testing.T, dsn string) {
+	t.Helper()
+	t.Setenv("DATABASE_URL", dsn)
+	t.Setenv("SQLITE_PATH", filepath.Join(t.TempDir(), "checkmate.db"))
+	if err := Open(); err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { DB.Close() })
+	if _, err := MigrateUp(context.Background()); err != nil {
+		t.Fatalf("migrate db: %v", err)
+	}
+}
+
+// user only this test knows about, a shared postgres keeps the rows of earlier runs
+// deleting the user cascades to its credentials, cache and events
+func createTestUser(t *testing.T, ctx context.Context) string {
+	t.Helper()
+	id := fmt.Sprintf("test-%s-%d", strings.NewReplacer("/", "-", " ", "-").Replace(t.Name()), time.Now().UnixNano())
+	if err := Users.Create(ctx, &model.User{ID: id, Email: id + "@example.com", CreatedAt: time.Now().UTC()}); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	t.Cleanup(func() { Users.Delete(context.Background(), id) })
+	return id
+}
+
+func createTestCredential(t *testing.T, ctx context.Context, userID, name string) int {
+	t.Helper()
+	id, err := Credentials.Create(ctx, &model.PlatformCredential{
+		UserID: userID, Name: name, Platform: "render", APIKey: "encrypted", CreatedAt: time.Now().UTC(),
+	})
+	if err != nil {
+		t.Fatalf("create credential %q: %v", name, err)
+	}
+	return id
+}
+
+func testRebind(t *testing.T, ctx context.Context, userID string) {
+	tests := []struct {
+		query, sqlite, postgres string
+	}{
+		{"SELECT 1", "SELECT 1", "SELECT 1"},
+		{"WHERE id = ?", "WHERE id = ?", "WHERE id = $1"},
+		{"WHERE id = ? AND user_id = ? LIMIT ?", "WHERE id = ? AND user_id = ? LIMIT ?", "WHERE id = $1 AND user_id = $2 LIMIT $3"},
+		{"VALUES (?, ?, 'é', ?)", "VALUES (?, ?, 'é', ?)", "VALUES ($1, $2, 'é', $3)"},
+	}
+	for _, tt := range tests {
+		want := tt.sqlite
+		if currentDialect.numbered {
+			want = tt.postgres
+		}
+		if got := currentDialect.rebind(tt.query); got != want {
+			t.Errorf("rebind(%q) = %q, want %q", tt.query, got, want)
+		}
+	}
+
+	// several placeholders of different types through a repository, wrong numbering fails here
+	id := createTestCredential(t, ctx, userID, "rebind")
+	cred, err := Credentials.GetByID(ctx, id, userID)
+	if err != nil {
+		t.Fatalf("get credential: %v", err)
+	}
+	if cred.ID != id || cred.UserID != userID {
+		t.Errorf("got credential %d of %s, want %d of %s", cred.ID, cred.UserID, id, userID)
+	}
+}
+
+func testInsertID(t *testing.T, ctx context.Context, userID string) {
+	first := createTestCredential(t, ctx, userID, "first")
+	second := createTestCredential(t, ctx, userID, "second")
+	if first <= 0 || second <= first {
+		t.Fatalf("ids %d then %d, want positive and increasing", first, second)
+	}
+
+	for id, name := range map[int]string{first: "first", second: "second"} {
+		cred, err := Credentials.GetByID(ctx, id, userID)
+		if err != nil {
+			t.Fatalf("get credential %d: %v", id, err)
+		}
+		if cred.Name != name {
+			t.Errorf("credential %d is named %q, want %q", id, cred.Name, name)
+		}
+	}
+
+	// int64 ids of the events table
+	write, err := Deployments.WriteCache(ctx, first, func(map[string]CachedDeploymentState) (*CacheWrite, error) {
+		at := time.Now().UTC()
+		return &CacheWrite{
+			At: at,
+			Events: []model.DeploymentEvent{
+				{PlatformCredentialID: first, DeploymentID: "srv-a", DeploymentName: "a", NewStatus: model.DeploymentStatusLive, ObservedAt: at},
+				{PlatformCredentialID: first, DeploymentID: "srv-b", DeploymentName: "b", NewStatus: model.DeploymentStatusLive, ObservedAt: at},
+			},
+		}, nil
+	})
+	if err != nil {
+		t.Fatalf("write cache: %v", err)
+	}
+	if a, b := write.Events[0].ID, write.Events[1].ID; a <= 0 || b <= a {
+		t.Fatalf("event ids %d then %d, want positive and increasing", a, b)
+	}
+}
+
+func testUniqueViolation(t *testing.T, ctx context.Context, userID string) {
+	if isUniqueViolation(nil) || isUniqueViolation(errors.New("boom")) {
+		t.Fatal("isUniqueViolation is true for an error that isn't a constraint violation")
+	}
+
+	// raw driver error of a primary key
+	_, err := Users.(*userRepository).exec(ctx, DB,
+		`INSERT INTO users (id, email, created_at) VALUES (?, ?, ?)`, userID, "dup@example.com", time.Now().UTC())
+	if !isUniqueViolation(err) {
+		t.Fatalf("duplicate user id: isUniqueViolation(%v) = false", err)
+	}
+
+	existing := createTestCredential(t, ctx, userID, "Production")
+	other := createTestCredential(t, ctx, userID, "Staging")
+
+	// names are unique per user, case insensitive
+	_, err = Credentials.Create(ctx, &model.PlatformCredential{
+		UserID: userID, Name: "production", Platform: "render", APIKey: "encrypted", CreatedAt: time.Now().UTC(),
+	})
+	if !errors.Is(err, ErrDuplicate) {
+		t.Fatalf("create with a taken name: got %v, want ErrDuplicate", err)
+	}
+
+	_, err = Credentials.Update(ctx, other, userID, "PRODUCTION", "render", "encrypted")
+	if !errors.Is(err, ErrDuplicate) {
+		t.Fatalf("rename to a taken name: got %v, want ErrDuplicate", err)
+	}
+
+	// keeping its own name is no conflict
+	found, err := Credentials.Update(ctx, existing, userID, "Production", "render", "encrypted")
+	if err != nil || !found {
+		t.Fatalf("update keeping the name: found %v, err %v", found, err)
+	}
+
+	// another user may use the same name
+	otherUser := createTestUser(t, ctx)
+	createTestCredential(t, ctx, otherUser, "Production")
+}
+
+func testKeysetList(t *testing.T, ctx context.Context, userID string) {
+	credA := createTestCredential(t, ctx, userID, "a")
+	credB := createTestCredential(t, ctx, userID, "b")
+
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	deployed := func(hours int) *time.Time {
+		at := base.Add(time.Duration(hours) * time.Hour)
+		return &at
+	}
+
+	// same names on both credentials and a never deployed one, so the tie breakers matter
+	seed := map[int][]model.Deployment{
+		credA: {
+			{ID: "srv-1", Name: "api", Status: model.DeploymentStatusLive, LastDeployedAt: deployed(3)},
+			{ID: "srv-2", Name: "Web", Status: model.DeploymentStatusFailed, LastDeployedAt: deployed(1)},
+			{ID: "srv-3", Name: "worker", Status: model.DeploymentStatusLive},
+		},
+		credB: {
+			{ID: "srv-1", Name: "API", Status: model.DeploymentStatusDeploying, LastDeployedAt: deployed(2)},
+			{ID: "srv-4", Name: "web", Status: model.DeploymentStatusLive, LastDeployedAt: deployed(1)},
+		},
+	}
+	for credID, deployments := range seed {
+		writeDeployments(t, ctx, credID, deployments...)
+	}
+
+	key := func(d model.Deployment) string { return fmt.Sprintf("%d/%s", d.PlatformCredentialID, d.ID) }
+	a1, a2, a3 := fmt.Sprintf("%d/srv-1", credA), fmt.Sprintf("%d/srv-2", credA), fmt.Sprintf("%d/srv-3", credA)
+	b1, b4 := fmt.Sprintf("%d/srv-1", credB), fmt.Sprintf("%d/srv-4", credB)
+
+	tests := []struct {
+		name  string
+		query model.DeploymentQuery
+		want  []string
+	}{
+		{"name", model.DeploymentQuery{Sort: model.DeploymentSortName}, []string{a1, b1, a2, b4, a3}},
+		{"name desc", model.DeploymentQuery{Sort: model.DeploymentSortName, Desc: true}, []string{a3, a2, b4, a1, b1}},
+		{"status", model.DeploymentQuery{Sort: model.DeploymentSortStatus}, []string{b1, a2, a1, b4, a3}},
+		{"last deployed desc", model.DeploymentQuery{Sort: model.DeploymentSortLastDeployed, Desc: true}, []string{a1, b1, a2, b4, a3}},
+		{"last deployed", model.DeploymentQuery{Sort: model.DeploymentSortLastDeployed}, []string{a3, a2, b4, b1, a1}},
+		{"filtered", model.DeploymentQuery{Sort: model.DeploymentSortName, Statuses: []model.DeploymentStatus{model.DeploymentStatusLive}}, []string{a1, b4, a3}},
+	}
+
+	for _, tt := range tests {
+		for _, limit := range []int{1, 2, 10} {
+			t.Run(fmt.Sprintf("%s/limit %d", tt.name, limit), func(t *testing.T) {
+				query := tt.query
+				query.Limit = limit
+
+				var got []string
+				var after *DeploymentCursor
+				for page := 0; ; page++ {
+					if page > len(tt.want) {
+						t.Fatalf("more pages than rows, got %v so far", got)
+					}
+					deployments, next, err := Deployments.List(ctx, userID, []int{credA, credB}, query, after)
+					if err != nil {
+						t.Fatalf("list page %d: %v", page, err)
+					}
+					if len(deployments) > limit {
+						t.Fatalf("page %d has %d rows, limit is %d", page, len(deployments), limit)
+					}
+					for _, d := range deployments {
+						got = append(got, key(d))
+					}
+					if next == nil {
+						break
+					}
+					after = next
+				}
+
+				if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+					t.Errorf("got %v, want %v", got, tt.want)
+				}
+			})
+		}
+	}
+
+	// credentials of another user never show up
+	otherUser := createTestUser(t, ctx)
+	deployments, _, err := Deployments.List(ctx, otherUser, []int{credA, credB}, model.DeploymentQuery{Limit: 10}, nil)
+	if err != nil {
+		t.Fatalf("list as another user: %v", err)
+	}
+	if len(deployments) != 0 {
+		t.Errorf("another user sees %d deployments, want none", len(deployments))
+	}
+}
+
+func testWriteCacheUpsert(t *testing.T, ctx context.Context, userID string) {
+	credID := createTestCredential(t, ctx, userID, "cache")
+
+	if at, err := Credentials.GetCacheRefreshedAt(ctx, credID); err != nil || at != nil {
+		t.Fatalf("never refreshed credential: refreshed at %v, err %v", at, err)
+	}
+
+	first := time.Date(2026, 2, 1, 12, 0, 0, 0, time.UTC)
+	_, err := Deployments.WriteCache(ctx, credID, func(previous map[string]CachedDeploymentState) (*CacheWrite, error) {
+		if len(previous) != 0 {
+			t.Errorf("empty cache has %d states", len(previous))
+		}
+		return &CacheWrite{
+			At: first,
+			Upserts: []CachedDeployment{
+				{Deployment: model.Deployment{ID: "srv-1", Name: "api", Status: model.DeploymentStatusDeploying, Metadata: map[string]interface{}{"plan": "free"}}, Fingerprint: "f1"},
+				{Deployment: model.Deployment{ID: "srv-2", Name: "web", Status: model.DeploymentStatusLive}, Fingerprint: "f2"},
+				{Deployment: model.Deployment{ID: "srv-3", Name: "cron", Status: model.DeploymentStatusLive}, Fingerprint: "f3"},
+			},
+			Events: []model.DeploymentEvent{
+				{PlatformCredentialID: credID, DeploymentID: "srv-1", DeploymentName: "api", NewStatus: model.DeploymentStatusDeploying, ObservedAt: first},
+			},
+		}, nil
+	})
+	if err != nil {
+		t.Fatalf("first write: %v", err)
+	}
+
+	// srv-1 changed, srv-2 unchanged, srv-3 disappeared
+	second := first.Add(time.Minute)
+	_, err = Deployments.WriteCache(ctx, credID, func(previous map[string]CachedDeploymentState) (*CacheWrite, error) {
+		want := map[string]CachedDeploymentState{
+			"srv-1": {Name: "api", Status: model.DeploymentStatusDeploying, Fingerprint: "f1"},
+			"srv-2": {Name: "web", Status: model.DeploymentStatusLive, Fingerprint: "f2"},
+			"srv-3": {Name: "cron", Status: model.DeploymentStatusLive, Fingerprint: "f3"},
+		}
+		for id, w := range want {
+			got, ok := previous[id]
+			if !ok {
+				t.Errorf("state of %s missing", id)
+				continue
+			}
+			if got.Name != w.Name || got.Status != w.Status || got.Fingerprint != w.Fingerprint || !got.LastSeenAt.Equal(first) {
+				t.Errorf("state of %s = %+v, want %+v seen at %v", id, got, w, first)
+			}
+		}
+		return &CacheWrite{
+			At: second,
+			Upserts: []CachedDeployment{
+				{Deployment: model.Deployment{ID: "srv-1", Name: "api-v2", Status: model.DeploymentStatusLive, Branch: "main"}, Fingerprint: "f1b"},
+			},
+			Seen: []string{"srv-2"},
+			Gone: []string{"srv-3"},
+			Events: []model.DeploymentEvent{
+				{PlatformCredentialID: credID, DeploymentID: "srv-1", DeploymentName: "api-v2", OldStatus: model.DeploymentStatusDeploying, NewStatus: model.DeploymentStatusLive, ObservedAt: second},
+			},
+		}, nil
+	})
+	if err != nil {
+		t.Fatalf("second write: %v", err)
+	}
+
+	cached, err := Deployments.ListCached(ctx, credID)
+	if err != nil {
+		t.Fatalf("list cached: %v", err)
+	}
+	if len(cached) != 3 {
+		t.Fatalf("%d cached deployments after the upsert, want 3", len(cached))
+	}
+
+	wantStatus := map[string]model.DeploymentStatus{
+		"srv-1": model.DeploymentStatusLive,
+		"srv-2": model.DeploymentStatusLive,
+		"srv-3": model.DeploymentStatusGone,
+	}
+	for id, status := range wantStatus {
+		dep, err := Deployments.Get(ctx, credID, id)
+		if err != nil {
+			t.Fatalf("get %s: %v", id, err)
+		}
+		if dep.Status != status {
+			t.Errorf("%s is %s, want %s", id, dep.Status, status)
+		}
+	}
+
+	updated, _ := Deployments.Get(ctx, credID, "srv-1")
+	if updated.Name != "api-v2" || updated.Branch != "main" || !updated.LastUpdatedAt.Equal(second) {
+		t.Errorf("upserted row = %+v, want the second write", updated)
+	}
+
+	// the unchanged row keeps its data, only last_seen_at moved
+	var states map[string]CachedDeploymentState
+	_, err = Deployments.WriteCache(ctx, credID, func(previous map[string]CachedDeploymentState) (*CacheWrite, error) {
+		states = previous
+		return &CacheWrite{At: second}, nil
+	})
+	if err != nil {
+		t.Fatalf("third write: %v", err)
+	}
+	if s := states["srv-2"]; !s.LastSeenAt.Equal(second) || s.Fingerprint != "f2" {
+		t.Errorf("seen row = %+v, want fingerprint f2 seen at %v", s, second)
+	}
+	unchanged, _ := Deployments.Get(ctx, credID, "srv-2")
+	if !unchanged.LastUpdatedAt.Equal(first) {
+		t.Errorf("seen row updated at %v, want %v", unchanged.LastUpdatedAt, first)
+	}
+
+	refreshedAt, err := Credentials.GetCacheRefreshedAt(ctx, credID)
+	if err != nil || refreshedAt == nil || !refreshedAt.Equal(second) {
+		t.Errorf("cache refreshed at %v (err %v), want %v", refreshedAt, err, second)
+	}
+
+	events, err := Deployments.ListEventsAfter(ctx, userID, 0, 10)
+	if err != nil {
+		t.Fatalf("list events: %v", err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("%d events, want 2", len(events))
+	}
+	if events[0].OldStatus != "" || events[1].OldStatus != model.DeploymentStatusDeploying || events[1].NewStatus != model.DeploymentStatusLive {
+		t.Errorf("events = %+v, want first sighting then deploying -> live", events)
+	}
+	if latest, err := Deployments.LatestEventID(ctx, userID); err != nil || latest != events[1].ID {
+		t.Errorf("latest event id %d (err %v), want %d", latest, err, events[1].ID)
+	}
+}
+
+// caches the deployments as new rows of the credential
+func writeDeployments(t *testing.T, ctx context.Context, credID int, deployments ...model.Deployment) {
+	t.Helper()
+	_, err := Deployments.WriteCache(ctx, credID, func(map[string]CachedDeploymentState) (*CacheWrite, error) {
+		write := &CacheWrite{At: time.Now().UTC()}
+		for _, d := range deployments {
+			write.Upserts = append(write.Upserts, CachedDeployment{Deployment: d, Fingerprint: d.ID})
+		}
+		return write, nil
+	})
+	if err != nil {
+		t.Fatalf("write cache of credential %d: %v", credID, err)
+	}
+}
+
+// records the events with a cache write at their latest time, returns them with their ids
+func writeEvents(t *testing.T, ctx context.Context, credID int, events ...model.DeploymentEvent) []model.DeploymentEvent {
+	t.Helper()
+	write, err := Deployments.WriteCache(ctx, credID, func(map[string]CachedDeploymentState) (*CacheWrite, error) {
+		write := &CacheWrite{}
+		for _, e := range events {
+			e.PlatformCredentialID = credID
+			if e.DeploymentName == "" {
+				e.DeploymentName = e.DeploymentID
+			}
+			if e.ObservedAt.After(write.At) {
+				write.At = e.ObservedAt
+			}
+			write.Events = append(write.Events, e)
+		}
+		return write, nil
+	})
+	if err != nil {
+		t.Fatalf("write events of credential %d: %v", credID, err)
+	}
+	return write.Events
+}
+
+func eventIDs(events []model.DeploymentEvent) []int64 {
+	ids := make([]int64, len(events))
+	for i, e := range events {
+		ids[i] = e.ID
+	}
+	return ids
+}
+
+func testEvents(t *testing.T, ctx context.Context, userID string) {
+	credA := createTestCredential(t, ctx, userID, "a")
+	credB := createTestCredential(t, ctx, userID, "b")
+
+	t0 := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	a := writeEvents(t, ctx, credA,
+		model.DeploymentEvent{DeploymentID: "srv-1", NewStatus: model.DeploymentStatusLive, ObservedAt: t0},
+		model.DeploymentEvent{DeploymentID: "srv-1", OldStatus: model.DeploymentStatusLive, NewStatus: model.DeploymentStatusFailed, ObservedAt: t0.Add(time.Hour)},
+		model.DeploymentEvent{DeploymentID: "srv-1", OldStatus: model.DeploymentStatusFailed, NewStatus: model.DeploymentStatusDeploying, ObservedAt: t0.Add(2 * time.Hour)},
+	)
+	b := writeEvents(t, ctx, credB,
+		model.DeploymentEvent{DeploymentID: "srv-2", NewStatus: model.DeploymentStatusFailed, ObservedAt: t0.Add(time.Hour)},
+	)
+	// b[0] has the observed_at of a[1], the higher id comes first
+	all := []int64{a[2].ID, b[0].ID, a[1].ID, a[0].ID}
+
+	at := func(hours int) *time.Time {
+		v := t0.Add(time.Duration(hours) * time.Hour)
+		return &v
+	}
+	tests := []struct {
+		name   string
+		filter model.DeploymentEventFilter
+		want   []int64
+	}{
+		{"all", model.DeploymentEventFilter{Limit: 10}, all},
+		{"limit", model.DeploymentEventFilter{Limit: 2}, all[:2]},
+		{"credential", model.DeploymentEventFilter{CredentialID: &credA, Limit: 10}, []int64{a[2].ID, a[1].ID, a[0].ID}},
+		{"deployment", model.DeploymentEventFilter{DeploymentID: "srv-2", Limit: 10}, []int64{b[0].ID}},
+		{"since until", model.DeploymentEventFilter{Since: at(1), Until: at(1), Limit: 10}, []int64{b[0].ID, a[1].ID}},
+	}
+	for _, tt := range tests {
+		events, err := Deployments.ListEvents(ctx, userID, tt.filter)
+		if err != nil {
+			t.Fatalf("%s: list events: %v", tt.name, err)
+		}
+		if got := eventIDs(events); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("%s: got events %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	after, err := Deployments.ListEventsAfter(ctx, userID, a[0].ID, 2)
+	if err != nil {
+		t.Fatalf("list events after: %v", err)
+	}
+	if got, want := eventIDs(after), []int64{a[1].ID, a[2].ID}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("events after %d = %v, want %v", a[0].ID, got, want)
+	}
+
+	// only failures can be acknowledged, the first time sticks
+	if _, err := Deployments.AcknowledgeEvent(ctx, userID, a[0].ID, t0); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("acknowledge a live event: got %v, want sql.ErrNoRows", err)
+	}
+	acked, err := Deployments.AcknowledgeEvent(ctx, userID, a[1].ID, t0.Add(3*time.Hour))
+	if err != nil {
+		t.Fatalf("acknowledge: %v", err)
+	}
+	if acked.AcknowledgedAt == nil || !acked.AcknowledgedAt.Equal(t0.Add(3*time.Hour)) {
+		t.Errorf("acknowledged at %v, want %v", acked.AcknowledgedAt, t0.Add(3*time.Hour))
+	}
+	acked, err = Deployments.AcknowledgeEvent(ctx, userID, a[1].ID, t0.Add(4*time.Hour))
+	if err != nil || acked.AcknowledgedAt == nil || !acked.AcknowledgedAt.Equal(t0.Add(3*time.Hour)) {
+		t.Errorf("acknowledge twice: acknowledged at %v (err %v), want the first time", acked, err)
+	}
+
+	err = Deployments.SetEventDeploy(ctx, a[2].ID, &model.DeployInfo{ID: "dep-1", CommitID: "abc123", CommitMessage: "fix the build"})
+	if err != nil {
+		t.Fatalf("set event deploy: %v", err)
+	}
+	event, err := Deployments.GetEvent(ctx, userID, a[2].ID)
+	if err != nil {
+		t.Fatalf("get event: %v", err)
+	}
+	if event.DeployID != "dep-1" || event.CommitID != "abc123" || event.CommitMessage != "fix the build" || event.OldStatus != model.DeploymentStatusFailed {
+		t.Errorf("event = %+v, want the deploy and failed -> deploying", event)
+	}
+
+	// deploying isn't settled, before the failure there was only the first live
+	settled := []struct {
+		before int64
+		want   model.DeploymentStatus
+	}{
+		{0, model.DeploymentStatusFailed},
+		{a[1].ID, model.DeploymentStatusLive},
+		{a[0].ID, ""},
+	}
+	for _, tt := range settled {
+		status, err := Deployments.LastSettledStatus(ctx, credA, "srv-1", tt.before)
+		if err != nil || status != tt.want {
+			t.Errorf("last settled status before %d = %q (err %v), want %q", tt.before, status, err, tt.want)
+		}
+	}
+
+	// nothing of it is visible to another user
+	otherUser := createTestUser(t, ctx)
+	if events, err := Deployments.ListEvents(ctx, otherUser, model.DeploymentEventFilter{Limit: 10}); err != nil || len(events) != 0 {
+		t.Errorf("another user lists %d events (err %v), want none", len(events), err)
+	}
+	if _, err := Deployments.GetEvent(ctx, otherUser, a[0].ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("get as another user: got %v, want sql.ErrNoRows", err)
+	}
+	if _, err := Deployments.AcknowledgeEvent(ctx, otherUser, b[0].ID, t0); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("acknowledge as another user: got %v, want sql.ErrNoRows", err)
+	}
+	if latest, err := Deployments.LatestEventID(ctx, otherUser); err != nil || latest != 0 {
+		t.Errorf("latest event id of another user %d (err %v), want 0", latest, err)
+	}
+}
+
+func testWebhooks(t *testing.T, ctx context.Context, userID string) {
+	credID := createTestCredential(t, ctx, userID, "hooks")
+	events := writeEvents(t, ctx, credID,
+		model.DeploymentEvent{DeploymentID: "srv-1", NewStatus: model.DeploymentStatusFailed, ObservedAt: time.Now().UTC()},
+	)
+
+	created := time.Date(2026, 4, 1, 8, 0, 0, 0, time.UTC)
+	hook := &model.Webhook{
+		UserID:        userID,
+		Type:          model.WebhookTypeSlack,
+		URL:           "https://hooks.slack.com/services/T/B/X",
+		EventTypes:    []model.WebhookEventType{model.WebhookEventDeploymentFailed, model.WebhookEventDeploymentRecovered},
+		CredentialIDs: []int{credID},
+		Statuses:      []model.DeploymentStatus{},
+		SlackChannel:  "#deploys",
+		Secret:        "encrypted",
+		Enabled:       true,
+		CreatedAt:     created,
+	}
+	id, err := Webhooks.Create(ctx, hook)
+	if err != nil {
+		t.Fatalf("create webhook: %v", err)
+	}
+	hook.ID = id
+
+	got, err := Webhooks.GetByID(ctx, id, userID)
+	if err != nil {
+		t.Fatalf("get webhook: %v", err)
+	}
+	if !got.CreatedAt.Equal(created) {
+		t.Errorf("webhook created at %v, want %v", got.CreatedAt, created)
+	}
+	got.CreatedAt = created // postgres reads it back in the local zone
+	if g, w := fmt.Sprintf("%+v", *got), fmt.Sprintf("%+v", *hook); g != w {
+		t.Errorf("webhook = %s, want %s", g, w)
+	}
+
+	hook.Statuses = []model.DeploymentStatus{model.DeploymentStatusFailed}
+	hook.SlackChannel = ""
+	if found, err := Webhooks.Update(ctx, hook); err != nil || !found {
+		t.Fatalf("update webhook: found %v, err %v", found, err)
+	}
+	got, _ = Webhooks.GetByID(ctx, id, userID)
+	if len(got.Statuses) != 1 || got.Statuses[0] != model.DeploymentStatusFailed || got.SlackChannel != "" {
+		t.Errorf("updated webhook = %+v", got)
+	}
+
+	otherUser := createTestUser(t, ctx)
+	if _, err := Webhooks.GetByID(ctx, id, otherUser); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("get as another user: got %v, want sql.ErrNoRows", err)
+	}
+	if found, err := Webhooks.Update(ctx, &model.Webhook{ID: id, UserID: otherUser}); err != nil || found {
+		t.Errorf("update as another user: found %v, err %v", found, err)
+	}
+
+	// due long ago so it comes first whatever else is pending
+	due := time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC)
+	deliveryAt := time.Now().UTC().Add(-time.Minute).Truncate(time.Microsecond)
+	deliveryID, err := Webhooks.CreateDelivery(ctx, &model.WebhookDelivery{
+		WebhookID:     id,
+		EventType:     model.WebhookEventDeploymentFailed,
+		EventID:       &events[0].ID,
+		Payload:       json.RawMessage(`{"text":"srv-1 failed"}`),
+		Status:        model.WebhookDeliveryPending,
+		NextAttemptAt: &due,
+		CreatedAt:     deliveryAt,
+		ThreadKey:     "srv-1/dep-1",
+	})
+	if err != nil {
+		t.Fatalf("create delivery: %v", err)
+	}
+
+	// the lease hides the delivery from a second claim
+	now := time.Now().UTC().Truncate(time.Microsecond) // postgres precision
+	claim := func() *ClaimedDelivery {
+		t.Helper()
+		claimed, err := Webhooks.ClaimDueDeliveries(ctx, now, now.Add(time.Minute), 100)
+		if err != nil {
+			t.Fatalf("claim deliveries: %v", err)
+		}
+		for _, c := range claimed {
+			if c.Delivery.ID == deliveryID {
+				return &c
+			}
+		}
+		return nil
+	}
+	first := claim()
+	if first == nil {
+		t.Fatal("due delivery not claimed")
+	}
+	if first.Webhook.ID != id || first.Delivery.ThreadKey != "srv-1/dep-1" || string(first.Delivery.Payload) != `{"text":"srv-1 failed"}` {
+		t.Errorf("claimed %+v", first)
+	}
+	if claim() != nil {
+		t.Error("leased delivery claimed again")
+	}
+
+	status := 200
+	err = Webhooks.RecordDeliveryAttempt(ctx, deliveryID, DeliveryAttempt{
+		Status: model.WebhookDeliverySucceeded, ResponseStatus: &status, DurationMs: 42, At: now,
+	})
+	if err != nil {
+		t.Fatalf("record attempt: %v", err)
+	}
+	deliveries, err := Webhooks.ListDeliveries(ctx, id, 0, 10)
+	if err != nil {
+		t.Fatalf("list deliveries: %v", err)
+	}
+	if len(deliveries) != 1 {
+		t.Fatalf("%d deliveries, want 1", len(deliveries))
+	}
+	d := deliveries[0]
+	if d.Status != model.WebhookDeliverySucceeded || d.Attempts != 1 || d.ResponseStatus == nil || *d.ResponseStatus != 200 ||
+		d.NextAttemptAt != nil || d.CompletedAt == nil || !d.CompletedAt.Equal(now) {
+		t.Errorf("delivery after the attempt = %+v", d)
+	}
+	if older, err := Webhooks.ListDeliveries(ctx, id, deliveryID, 10); err != nil || len(older) != 0 {
+		t.Errorf("deliveries before %d: %d (err %v), want none", deliveryID, len(older), err)
+	}
+
+	// dedup looks at the deliveries of the deployment created before the given time
+	last, err := Webhooks.LastDeliveryAt(ctx, id, model.WebhookEventDeploymentFailed, credID, "srv-1", now)
+	if err != nil || last == nil || !last.Equal(deliveryAt) {
+		t.Errorf("last delivery at %v (err %v), want %v", last, err, deliveryAt)
+	}
+	if last, err := Webhooks.LastDeliveryAt(ctx, id, model.WebhookEventDeploymentFailed, credID, "srv-1", deliveryAt); err != nil || last != nil {
+		t.Errorf("last delivery before the only one = %v (err %v), want none", last, err)
+	}
+	if last, err := Webhooks.LastDeliveryAt(ctx, id, model.WebhookEventDeploymentRecovered, credID, "srv-1", now); err != nil || last != nil {
+		t.Errorf("last delivery of another event type = %v (err %v), want none", last, err)
+	}
+
+	// ON CONFLICT DO NOTHING, the first thread saved stays
+	if ref, err := Webhooks.GetThread(ctx, id, "srv-1/dep-1"); err != nil || ref != "" {
+		t.Errorf("unknown thread = %q (err %v), want empty", ref, err)
+	}
+	for _, ref := range []string{"1700000000.000100", "1700000000.000200"} {
+		if err := Webhooks.SaveThread(ctx, id, "srv-1/dep-1", ref, now); err != nil {
+			t.Fatalf("save thread %s: %v", ref, err)
+		}
+	}
+	if ref, err := Webhooks.GetThread(ctx, id, "srv-1/dep-1"); err != nil || ref != "1700000000.000100" {
+		t.Errorf("thread = %q (err %v), want the first one saved", ref, err)
+	}
+
+	// digests go to enabled email webhooks subscribed to them, once per due time
+	digest, err := Webhooks.Create(ctx, &model.Webhook{
+		UserID: userID, Type: model.WebhookTypeEmail, URL: "mailto:ops@example.com",
+		EventTypes: []model.WebhookEventType{model.WebhookEventDeploymentFailed, model.WebhookEventDigest},
+		Enabled:    true, CreatedAt: created,
+	})
+	if err != nil {
+		t.Fatalf("create digest webhook: %v", err)
+	}
+	digestDue := created.Add(24 * time.Hour)
+	dueIDs := func(due time.Time) map[int]bool {
+		t.Helper()
+		hooks, err := Webhooks.ListDigestsDue(ctx, due)
+		if err != nil {
+			t.Fatalf("list digests due: %v", err)
+		}
+		ids := make(map[int]bool)
+		for _, h := range hooks {
+			ids[h.ID] = true
+		}
+		return ids
+	}
+	if ids := dueIDs(digestDue); !ids[digest] || ids[id] {
+		t.Errorf("digests due %v, want %d and not %d", ids, digest, id)
+	}
+	if queued, err := Webhooks.MarkDigestQueued(ctx, digest, digestDue); err != nil || !queued {
+		t.Fatalf("mark digest queued: %v, err %v", queued, err)
+	}
+	if queued, err := Webhooks.MarkDigestQueued(ctx, digest, digestDue); err != nil || queued {
+		t.Errorf("mark the same digest queued twice: %v, err %v", queued, err)
+	}
+	if ids := dueIDs(digestDue); ids[digest] {
+		t.Error("queued digest still due")
+	}
+	if ids := dueIDs(digestDue.Add(24 * time.Hour)); !ids[digest] {
+		t.Error("digest of the next day not due")
+	}
+}
+
+func testRules(t *testing.T, ctx context.Context, userID string) {
+	credID := createTestCredential(t, ctx, userID, "rules")
+	events := writeEvents(t, ctx, credID,
+		model.DeploymentEvent{DeploymentID: "srv-1", NewStatus: model.DeploymentStatusFailed, ObservedAt: time.Now().UTC()},
+	)
+
+	rule := &model.NotificationRule{
+		UserID:               userID,
+		Name:                 "night",
+		Action:               model.NotificationRuleNotify,
+		Enabled:              true,
+		CredentialIDs:        []int{credID},
+		Branches:             []string{"main", "release/*"},
+		Services:             []string{},
+		EventTypes:           []model.WebhookEventType{model.WebhookEventDeploymentFailed},
+		ExceptEventTypes:     []model.WebhookEventType{},
+		Schedule:             &model.RuleSchedule{Start: "22:00", End: "06:00", Timezone: "Europe/Paris"},
+		WebhookIDs:           []int{},
+		DedupMinutes:         15,
+		EscalateAfterMinutes: 30,
+		EscalateWebhookIDs:   []int{7, 9},
+		CreatedAt:            time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC),
+	}
+	id, err := Rules.Create(ctx, rule)
+	if err != nil {
+		t.Fatalf("create rule: %v", err)
+	}
+	rule.ID = id
+
+	got, err := Rules.GetByID(ctx, id, userID)
+	if err != nil {
+		t.Fatalf("get rule: %v", err)
+	}
+	if !got.CreatedAt.Equal(rule.CreatedAt) {
+		t.Errorf("rule created at %v, want %v", got.CreatedAt, rule.CreatedAt)
+	}
+	got.CreatedAt = rule.CreatedAt
+	if got.Schedule == nil || *got.Schedule != *rule.Schedule {
+		t.Fatalf("rule schedule = %+v, want %+v", got.Schedule, rule.Schedule)
+	}
+	got.Schedule = rule.Schedule
+	if g, w := fmt.Sprintf("%+v", *got), fmt.Sprintf("%+v", *rule); g != w {
+		t.Errorf("rule = %s, want %s", g, w)
+	}
+
+	// no schedule is stored as nulls, read back as nil
+	rule.Schedule = nil
+	rule.Action = model.NotificationRuleMute
+	if found, err := Rules.Update(ctx, rule); err != nil || !found {
+		t.Fatalf("update rule: found %v, err %v", found, err)
+	}
+	got, _ = Rules.GetByID(ctx, id, userID)
+	if got.Schedule != nil || got.Action != model.NotificationRuleMute {
+		t.Errorf("updated rule = %+v", got)
+	}
+
+	otherUser := createTestUser(t, ctx)
+	if rules, err := Rules.ListByUser(ctx, otherUser); err != nil || len(rules) != 0 {
+		t.Errorf("another user lists %d rules (err %v), want none", len(rules), err)
+	}
+	if found, err := Rules.Delete(ctx, id, otherUser); err != nil || found {
+		t.Errorf("delete as another user: found %v, err %v", found, err)
+	}
+
+	// ON CONFLICT DO NOTHING, the second one keeps the first due time
+	due := time.Date(2001, 1, 1, 0, 30, 0, 0, time.UTC)
+	for _, at := range []time.Time{due, due.Add(time.Hour)} {
+		if err := Rules.CreateEscalation(ctx, id, events[0].ID, at, at.Add(-30*time.Minute)); err != nil {
+			t.Fatalf("create escalation due %v: %v", at, err)
+		}
+	}
+
+	mine := func(now time.Time) []Escalation {
+		t.Helper()
+		escalations, err := Rules.ListDueEscalations(ctx, now, 100)
+		if err != nil {
+			t.Fatalf("list due escalations: %v", err)
+		}
+		var found []Escalation
+		for _, e := range escalations {
+			if e.RuleID == id {
+				found = append(found, e)
+			}
+		}
+		return found
+	}
+	if early := mine(due.Add(-time.Minute)); len(early) != 0 {
+		t.Errorf("%d escalations due before their time", len(early))
+	}
+	escalations := mine(due)
+	if len(escalations) != 1 {
+		t.Fatalf("%d escalations due, want 1", len(escalations))
+	}
+	e := escalations[0]
+	if e.EventID != events[0].ID || e.UserID != userID || !e.DueAt.Equal(due) {
+		t.Errorf("escalation = %+v, want event %d of %s due %v", e, events[0].ID, userID, due)
+	}
+
+	// claimed once, the second instance gets false
+	if done, err := Rules.CompleteEscalation(ctx, e.ID, EscalationSent, due); err != nil || !done {
+		t.Fatalf("complete escalation: %v, err %v", done, err)
+	}
+	if done, err := Rules.CompleteEscalation(ctx, e.ID, EscalationCancelled, due); err != nil || done {
+		t.Errorf("complete a sent escalation: %v, err %v", done, err)
+	}
+	if left := mine(due.Add(time.Hour)); len(left) != 0 {
+		t.Errorf("%d escalations due after being sent", len(left))
+	}
+}
+
+// the maintenance statements work on whole tables, rows dated 2001 keep them off anything else in the database
+func testMaintenance(t *testing.T, ctx context.Context, userID string) {
+	credID := createTestCredential(t, ctx, userID, "maintenance")
+	day := func(d, hour int) time.Time { return time.Date(2001, 1, d, hour, 0, 0, 0, time.UTC) }
+
+	events := writeEvents(t, ctx, credID,
+		model.DeploymentEvent{DeploymentID: "srv-old", NewStatus: model.DeploymentStatusLive, ObservedAt: day(1, 0)},
+		model.DeploymentEvent{DeploymentID: "srv-old", NewStatus: model.DeploymentStatusFailed, ObservedAt: day(3, 0)},
+		model.DeploymentEvent{DeploymentID: "srv-busy", NewStatus: model.DeploymentStatusDeploying, ObservedAt: day(5, 0)},
+		model.DeploymentEvent{DeploymentID: "srv-busy", NewStatus: model.DeploymentStatusLive, ObservedAt: day(5, 1)},
+		model.DeploymentEvent{DeploymentID: "srv-busy", NewStatus: model.DeploymentStatusDeploying, ObservedAt: day(5, 2)},
+		model.DeploymentEvent{DeploymentID: "srv-busy", NewStatus: model.DeploymentStatusLive, ObservedAt: day(5, 3)},
+	)
+	remaining := func() []int64 {
+		t.Helper()
+		list, err := Deployments.ListEvents(ctx, userID, model.DeploymentEventFilter{CredentialID: &credID, Limit: 100})
+		if err != nil {
+			t.Fatalf("list events: %v", err)
+		}
+		return eventIDs(list)
+	}
+
+	if n, err := Maintenance.DeleteEventsBefore(ctx, day(2, 0)); err != nil || n < 1 {
+		t.Fatalf("delete events before: %d, err %v", n, err)
+	}
+	// ROW_NUMBER() per deployment, the newest ones stay
+	if n, err := Maintenance.TrimEventsPerDeployment(ctx, 2); err != nil || n < 2 {
+		t.Fatalf("trim events: %d, err %v", n, err)
+	}
+	if got, want := remaining(), []int64{events[5].ID, events[4].ID, events[1].ID}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("events left %v, want %v", got, want)
+	}
+
+	// gone long enough ago goes, gone recently or old but still there stays
+	writeDeployments(t, ctx, credID,
+		model.Deployment{ID: "srv-a", Name: "a", Status: model.DeploymentStatusLive},
+		model.Deployment{ID: "srv-b", Name: "b", Status: model.DeploymentStatusLive},
+		model.Deployment{ID: "srv-c", Name: "c", Status: model.DeploymentStatusLive},
+	)
+	for _, gone := range []struct {
+		id string
+		at time.Time
+	}{{"srv-a", day(1, 0)}, {"srv-b", day(5, 0)}} {
+		_, err := Deployments.WriteCache(ctx, credID, func(map[string]CachedDeploymentState) (*CacheWrite, error) {
+			return &CacheWrite{At: gone.at, Gone: []string{gone.id}}, nil
+		})
+		if err != nil {
+			t.Fatalf("mark %s gone: %v", gone.id, err)
+		}
+	}
+	if n, err := Maintenance.DeleteGoneDeploymentsBefore(ctx, day(3, 0)); err != nil || n < 1 {
+		t.Fatalf("delete gone deployments: %d, err %v", n, err)
+	}
+	cached, err := Deployments.ListCached(ctx, credID)
+	if err != nil {
+		t.Fatalf("list cached: %v", err)
+	}
+	var ids []string
+	for _, d := range cached {
+		ids = append(ids, d.ID)
+	}
+	if strings.Join(ids, " ") != "srv-b srv-c" {
+		t.Errorf("cached deployments %v, want srv-b and srv-c", ids)
+	}
+
+	// finished deliveries and threads before the cutoff go, pending ones are kept
+	hookID, err := Webhooks.Create(ctx, &model.Webhook{
+		UserID: userID, Type: model.WebhookTypeGeneric, URL: "https://example.com/hook",
+		EventTypes: []model.WebhookEventType{model.WebhookEventDeploymentFailed}, Enabled: true, CreatedAt: day(1, 0),
+	})
+	if err != nil {
+		t.Fatalf("create webhook: %v", err)
+	}
+	later := time.Date(2999, 1, 1, 0, 0, 0, 0, time.UTC)
+	deliveries := []struct {
+		status model.WebhookDeliveryStatus
+		at     time.Time
+		kept   bool
+	}{
+		{model.WebhookDeliverySucceeded, day(1, 0), false},
+		{model.WebhookDeliveryFailed, day(1, 1), false},
+		{model.WebhookDeliveryPending, day(1, 2), true},
+		{model.WebhookDeliverySucceeded, day(5, 0), true},
+	}
+	var want []int64
+	for _, d := range deliveries {
+		delivery := &model.WebhookDelivery{
+			WebhookID: hookID, EventType: model.WebhookEventDeploymentFailed, Payload: json.RawMessage(`{}`),
+			Status: d.status, CreatedAt: d.at,
+		}
+		if d.status == model.WebhookDeliveryPending {
+			delivery.NextAttemptAt = &later
+		}
+		id, err := Webhooks.CreateDelivery(ctx, delivery)
+		if err != nil {
+			t.Fatalf("create delivery: %v", err)
+		}
+		if d.kept {
+			want = append([]int64{id}, want...)
+		}
+	}
+	for key, at := range map[string]time.Time{"old": day(1, 0), "new": day(5, 0)} {
+		if err := Webhooks.SaveThread(ctx, hookID, key, key+"-ref", at); err != nil {
+			t.Fatalf("save thread %s: %v", key, err)
+		}
+	}
+
+	if n, err := Maintenance.DeleteWebhookDeliveriesBefore(ctx, day(3, 0)); err != nil || n < 2 {
+		t.Fatalf("delete webhook deliveries: %d, err %v", n, err)
+	}
+	kept, err := Webhooks.ListDeliveries(ctx, hookID, 0, 10)
+	if err != nil {
+		t.Fatalf("list deliveries: %v", err)
+	}
+	var got []int64
+	for _, d := range kept {
+		got = append(got, d.ID)
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("deliveries left %v, want %v", got, want)
+	}
+	if ref, _ := Webhooks.GetThread(ctx, hookID, "old"); ref != "" {
+		t.Errorf("old thread still there: %q", ref)
+	}
+	if ref, _ := Webhooks.GetThread(ctx, hookID, "new"); ref != "new-ref" {
+		t.Errorf("new thread = %q, want new-ref", ref)
+	}
+
+	if err := Maintenance.Analyze(ctx); err != nil {
+		t.Errorf("analyze: %v", err)
+	}
+	if err := Maintenance.Vacuum(ctx); err != nil {
+		t.Errorf("vacuum: %v", err)
+	}
+
+	// page_count * page_size on sqlite, pg_database_size() on postgres
+	stats, err := Maintenance.Stats(ctx)
+	if err != nil {
+		t.Fatalf("stats: %v", err)
+	}
+	if stats.Backend != currentDialect.name || stats.SizeBytes <= 0 {
+		t.Errorf("stats of %s with %d bytes, want %s and a size", stats.Backend, stats.SizeBytes, currentDialect.name)
+	}
+	if stats.DeploymentEvents < 3 || stats.CachedDeployments < 2 {
+		t.Errorf("stats count %d events and %d deployments, want at least ours", stats.DeploymentEvents, stats.CachedDeployments)
+	}
+	if stats.OldestEventAt == nil || stats.OldestEventAt.After(day(3, 0)) {
+		t.Errorf("oldest event at %v, want %v at the latest", stats.OldestEventAt, day(3, 0))
+	}
+}
@@ -0,0 +1,162 @@
+package storage
+
+import (
+	"checkmate/api/internal/model"
+	"context"
+	"database/sql"
+	"strconv"
+	"time"
+)
+
+type notificationRuleRepository struct {
+	*sqlStore
+}
+
+const ruleColumns = `
+	r.id, r.user_id, r.name, r.action, r.enabled, r.credential_ids, r.branches, r.services,
+	r.event_types, r.except_event_types, r.schedule_start, r.schedule_end, r.timezone,
+	r.webhook_ids, r.dedup_minutes, r.escalate_after_minutes, r.escalate_webhook_ids, r.created_at`
+
+// scans a row selected with ruleColumns
+func scanRule(row interface{ Scan(...interface{}) error }) (*model.NotificationRule, error) {
+	var rule model.NotificationRule
+	var action, credentialIDs, branches, services, eventTypes, exceptEventTypes, timezone, webhookIDs, escalateWebhookIDs string
+	var scheduleStart, scheduleEnd sql.NullString
+	err := row.Scan(&rule.ID, &rule.UserID, &rule.Name, &action, &rule.Enabled, &credentialIDs, &branches, &services,
+		&eventTypes, &exceptEventTypes, &scheduleStart, &scheduleEnd, &timezone,
+		&webhookIDs, &rule.DedupMinutes, &rule.EscalateAfterMinutes, &escalateWebhookIDs, &rule.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	parseID := func(s string) int { id, _ := strconv.Atoi(s); return id }
+	parseString := func(s string) string { return s }
+	parseEventType := func(s string) model.WebhookEventType { return model.WebhookEventType(s) }
+
+	rule.Action = model.NotificationRuleAction(action)
+	rule.CredentialIDs = splitList(credentialIDs, parseID)
+	rule.Branches = splitList(branches, parseString)
+	rule.Services = splitList(services, parseString)
+	rule.EventTypes = splitList(eventTypes, parseEventType)
+	rule.ExceptEventTypes = splitList(exceptEventTypes, parseEventType)
+	rule.WebhookIDs = splitList(webhookIDs, parseID)
+	rule.EscalateWebhookIDs = splitList(escalateWebhookIDs, parseID)
+	if scheduleStart.Valid && scheduleEnd.Valid {
+		rule.Schedule = &model.RuleSchedule{Start: scheduleStart.String, End: scheduleEnd.String, Timezone: timezone}
+	}
+	return &rule, nil
+}
+
+// schedule columns of a rule, the timezone column is never null
+func scheduleValues(rule *model.NotificationRule) (interface{}, interface{}, string) {
+	if rule.Schedule == nil {
+		return nil, nil, "UTC"
+	}
+	return rule.Schedule.Start, rule.Schedule.End, rule.Schedule.Timezone
+}
+
+func (r *notificationRuleRepository) ListByUser(ctx context.Context, userID string) ([]model.NotificationRule, error) {
+	rows, err := r.query(ctx, r.db,
+		`SELECT `+ruleColumns+` FROM notification_rules r WHERE r.user_id = ? ORDER BY r.id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rules := []model.NotificationRule{}
+	for rows.Next() {
+		rule, err := scanRule(rows)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, *rule)
+	}
+	return rules, rows.Err()
+}
+
+func (r *notificationRuleRepository) GetByID(ctx context.Context, id int, userID string) (*model.NotificationRule, error) {
+	return scanRule(r.queryRow(ctx, r.db,
+		`SELECT `+ruleColumns+` FROM notification_rules r WHERE r.id = ? AND r.user_id = ?`, id, userID))
+}
+
+func (r *notificationRuleRepository) Create(ctx context.Context, rule *model.NotificationRule) (int, error) {
+	start, end, timezone := scheduleValues(rule)
+	id, err := r.insertID(ctx, r.db, `
+		INSERT INTO notification_rules (user_id, name, action, enabled, credential_ids, branches, services,
+			event_types, except_event_types, schedule_start, schedule_end, timezone,
+			webhook_ids, dedup_minutes, escalate_after_minutes, escalate_webhook_ids, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, rule.UserID, rule.Name, string(rule.Action), rule.Enabled, joinList(rule.CredentialIDs), joinList(rule.Branches), joinList(rule.Services),
+		joinList(rule.EventTypes), joinList(rule.ExceptEventTypes), start, end, timezone,
+		joinList(rule.WebhookIDs), rule.DedupMinutes, rule.EscalateAfterMinutes, joinList(rule.EscalateWebhookIDs), rule.CreatedAt.UTC())
+	return int(id), err
+}
+
+func (r *notificationRuleRepository) Update(ctx context.Context, rule *model.NotificationRule) (bool, error) {
+	start, end, timezone := scheduleValues(rule)
+	return r.execFound(ctx, `
+		UPDATE notification_rules
+		SET name = ?, action = ?, enabled = ?, credential_ids = ?, branches = ?, services = ?,
+			event_types = ?, except_event_types = ?, schedule_start = ?, schedule_end = ?, timezone = ?,
+			webhook_ids = ?, dedup_minutes = ?, escalate_after_minutes = ?, escalate_webhook_ids = ?
+		WHERE id = ? AND user_id = ?
+	`, rule.Name, string(rule.Action), rule.Enabled, joinList(rule.CredentialIDs), joinList(rule.Branches), joinList(rule.Services),
+		joinList(rule.EventTypes), joinList(rule.ExceptEventTypes), start, end, timezone,
+		joinList(rule.WebhookIDs), rule.DedupMinutes, rule.EscalateAfterMinutes, joinList(rule.EscalateWebhookIDs),
+		rule.ID, rule.UserID)
+}
+
+func (r *notificationRuleRepository) Delete(ctx context.Context, id int, userID string) (bool, error) {
+	return r.execFound(ctx, `DELETE FROM notification_rules WHERE id = ? AND user_id = ?`, id, userID)
+}
+
+func (r *notificationRuleRepository) execFound(ctx context.Context, query string, args ...interface{}) (bool, error) {
+	res, err := r.exec(ctx, r.db, query, args...)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (r *notificationRuleRepository) CreateEscalation(ctx context.Context, ruleID int, eventID int64, dueAt time.Time, at time.Time) error {
+	// the same failure seen twice (two refreshes racing) is escalated once
+	_, err := r.exec(ctx, r.db, `
+		INSERT INTO notification_escalations (rule_id, event_id, status, due_at, created_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (rule_id, event_id) DO NOTHING
+	`, ruleID, eventID, EscalationPending, dueAt.UTC(), at.UTC())
+	return err
+}
+
+func (r *notificationRuleRepository) ListDueEscalations(ctx context.Context, now time.Time, limit int) ([]Escalation, error) {
+	rows, err := r.query(ctx, r.db, `
+		SELECT x.id, x.rule_id, x.event_id, r.user_id, x.due_at
+		FROM notification_escalations x
+		JOIN notification_rules r ON r.id = x.rule_id
+		WHERE x.status = ? AND x.due_at <= ?
+		ORDER BY x.due_at, x.id
+		LIMIT ?
+	`, EscalationPending, now.UTC(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var escalations []Escalation
+	for rows.Next() {
+		var e Escalation
+		if err := rows.Scan(&e.ID, &e.RuleID, &e.EventID, &e.UserID, &e.DueAt); err != nil {
+			return nil, err
+		}
+		escalations = append(escalations, e)
+	}
+	return escalations, rows.Err()
+}
+
+func (r *notificationRuleRepository) CompleteEscalation(ctx context.Context, id int64, status string, at time.Time) (bool, error) {
+	return r.execFound(ctx, `
+		UPDATE notification_escalations SET status = ?, completed_at = ?
+		WHERE id = ? AND status = ?
+	`, status, at.UTC(), id, EscalationPending)
+}
@@ -0,0 +1,48 @@
+package storage
+
+import (
+	"checkmate/api/internal/model"
+	"context"
+	"database/sql"
+)
+
+type userRepository struct {
+	*sqlStore
+}
+
+func (r *userRepository) GetByID(ctx context.Context, id string) (*model.User, error) {
+	var user model.User
+	var displayName sql.NullString
+	var createdAt sql.NullTime
+	err := r.queryRow(ctx, r.db,
+		`SELECT id, email, display_name, created_at FROM users WHERE id = ?`, id,
+	).Scan(&user.ID, &user.Email, &displayName, &createdAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	user.DisplayName = displayName.String
+	user.CreatedAt = createdAt.Time
+	return &user, nil
+}
+
+func (r *userRepository) Create(ctx context.Context, user *model.User) error {
+	_, err := r.exec(ctx, r.db,
+		`INSERT INTO users (id, email, display_name, created_at) VALUES (?, ?, ?, ?)`,
+		user.ID, user.Email, user.DisplayName, user.CreatedAt)
+	return err
+}
+
+func (r *userRepository) Update(ctx context.Context, user *model.User) error {
+	_, err := r.exec(ctx, r.db,
+		`UPDATE users SET email = ?, display_name = ? WHERE id = ?`,
+		user.Email, user.DisplayName, user.ID)
+	return err
+}
+
+func (r *userRepository) Delete(ctx context.Context, id string) error {
+	_, err := r.exec(ctx, r.db, `DELETE FROM users WHERE id = ?`, id)
+	return err
+}
@@ -0,0 +1,357 @@
+package storage
+
+import (
+	"checkmate/api/internal/model"
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type webhookRepository struct {
+	*sqlStore
+}
+
+const webhookColumns = `
+	w.id, w.user_id, w.type, w.url, w.event_types, w.credential_ids, w.statuses,
+	w.slack_channel, w.discord_forum, w.secret, w.enabled, w.created_at, w.last_digest_at`
+
+// scans a row selected with webhookColumns
+func scanWebhook(row interface{ Scan(...interface{}) error }) (*model.Webhook, error) {
+	var hook model.Webhook
+	var hookType, eventTypes, credentialIDs, statuses string
+	var slackChannel sql.NullString
+	var lastDigestAt sql.NullTime
+	err := row.Scan(&hook.ID, &hook.UserID, &hookType, &hook.URL, &eventTypes, &credentialIDs, &statuses,
+		&slackChannel, &hook.DiscordForum, &hook.Secret, &hook.Enabled, &hook.CreatedAt, &lastDigestAt)
+	if err != nil {
+		return nil, err
+	}
+	hook.Type = model.WebhookType(hookType)
+	hook.EventTypes = splitList(eventTypes, func(s string) model.WebhookEventType { return model.WebhookEventType(s) })
+	hook.CredentialIDs = splitList(credentialIDs, func(s string) int { id, _ := strconv.Atoi(s); return id })
+	hook.Statuses = splitList(statuses, func(s string) model.DeploymentStatus { return model.DeploymentStatus(s) })
+	hook.SlackChannel = slackChannel.String
+	hook.LastDigestAt = timePtr(lastDigestAt)
+	return &hook, nil
+}
+
+// lists are stored comma separated
+func joinList[T any](values []T) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = fmt.Sprint(v)
+	}
+	return strings.Join(parts, ",")
+}
+
+func splitList[T any](s string, parse func(string) T) []T {
+	values := []T{}
+	for _, part := range strings.Split(s, ",") {
+		if part != "" {
+			values = append(values, parse(part))
+		}
+	}
+	return values
+}
+
+func (r *webhookRepository) ListByUser(ctx context.Context, userID string) ([]model.Webhook, error) {
+	rows, err := r.query(ctx, r.db,
+		`SELECT `+webhookColumns+` FROM webhooks w WHERE w.user_id = ? ORDER BY w.id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	webhooks := []model.Webhook{}
+	for rows.Next() {
+		hook, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, *hook)
+	}
+	return webhooks, rows.Err()
+}
+
+func (r *webhookRepository) GetByID(ctx context.Context, id int, userID string) (*model.Webhook, error) {
+	return scanWebhook(r.queryRow(ctx, r.db,
+		`SELECT `+webhookColumns+` FROM webhooks w WHERE w.id = ? AND w.user_id = ?`, id, userID))
+}
+
+func (r *webhookRepository) Create(ctx context.Context, hook *model.Webhook) (int, error) {
+	id, err := r.insertID(ctx, r.db, `
+		INSERT INTO webhooks (user_id, type, url, event_types, credential_ids, statuses, slack_channel, discord_forum, secret, enabled, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, hook.UserID, string(hook.Type), hook.URL, joinList(hook.EventTypes), joinList(hook.CredentialIDs), joinList(hook.Statuses),
+		nullString(hook.SlackChannel), hook.DiscordForum, hook.Secret, hook.Enabled, hook.CreatedAt.UTC())
+	return int(id), err
+}
+
+func (r *webhookRepository) Update(ctx context.Context, hook *model.Webhook) (bool, error) {
+	return r.execFound(ctx, `
+		UPDATE webhooks
+		SET type = ?, url = ?, event_types = ?, credential_ids = ?, statuses = ?, slack_channel = ?, discord_forum = ?,
+			secret = ?, enabled = ?
+		WHERE id = ? AND user_id = ?
+	`, string(hook.Type), hook.URL, joinList(hook.EventTypes), joinList(hook.CredentialIDs), joinList(hook.Statuses),
+		nullString(hook.SlackChannel), hook.DiscordForum, hook.Secret, hook.Enabled, hook.ID, hook.UserID)
+}
+
+func (r *webhookRepository) Delete(ctx context.Context, id int, userID string) (bool, error) {
+	return r.execFound(ctx, `DELETE FROM webhooks WHERE id = ? AND user_id = ?`, id, userID)
+}
+
+// runs an UPDATE/DELETE and reports if it matched any row
+func (r *webhookRepository) execFound(ctx context.Context, query string, args ...interface{}) (bool, error) {
+	result, err := r.exec(ctx, r.db, query, args...)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected > 0, nil
+}
+
+const deliveryColumns = `
+	d.id, d.webhook_id, d.event_type, d.event_id, d.payload, d.status, d.attempts,
+	d.next_attempt_at, d.response_status, d.last_error, d.duration_ms, d.created_at, d.completed_at, d.thread_key`
+
+// scans a row selected with deliveryColumns
+func scanDelivery(row interface{ Scan(...interface{}) error }) (*model.WebhookDelivery, error) {
+	var d model.WebhookDelivery
+	var eventType, payload, status string
+	var eventID, responseStatus, durationMs sql.NullInt64
+	var lastError, threadKey sql.NullString
+	var nextAttemptAt, completedAt sql.NullTime
+
+	dest := []interface{}{
+		&d.ID, &d.WebhookID, &eventType, &eventID, &payload, &status, &d.Attempts,
+		&nextAttemptAt, &responseStatus, &lastError, &durationMs, &d.CreatedAt, &completedAt, &threadKey,
+	}
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+
+	d.EventType = model.WebhookEventType(eventType)
+	d.Payload = []byte(payload)
+	d.Status = model.WebhookDeliveryStatus(status)
+	if eventID.Valid {
+		d.EventID = &eventID.Int64
+	}
+	d.ResponseStatus = intPtr(responseStatus)
+	d.Error = lastError.String
+	if durationMs.Valid {
+		d.DurationMs = &durationMs.Int64
+	}
+	d.NextAttemptAt = timePtr(nextAttemptAt)
+	d.CompletedAt = timePtr(completedAt)
+	d.ThreadKey = threadKey.String
+	return &d, nil
+}
+
+func (r *webhookRepository) CreateDelivery(ctx context.Context, d *model.WebhookDelivery) (int64, error) {
+	var nextAttemptAt sql.NullTime
+	if d.NextAttemptAt != nil {
+		nextAttemptAt = sql.NullTime{Time: d.NextAttemptAt.UTC(), Valid: true}
+	}
+	return r.insertID(ctx, r.db, `
+		INSERT INTO webhook_deliveries (webhook_id, event_type, event_id, payload, status, attempts, next_attempt_at, created_at, thread_key)
+		VALUES (?, ?, ?, ?, ?, 0, ?, ?, ?)
+	`, d.WebhookID, string(d.EventType), d.EventID, string(d.Payload), string(d.Status), nextAttemptAt, d.CreatedAt.UTC(),
+		nullString(d.ThreadKey))
+}
+
+func (r *webhookRepository) ListDeliveries(ctx context.Context, webhookID int, beforeID int64, limit int) ([]model.WebhookDelivery, error) {
+	query := `SELECT ` + deliveryColumns + ` FROM webhook_deliveries d WHERE d.webhook_id = ?`
+	args := []interface{}{webhookID}
+	if beforeID > 0 {
+		query += ` AND d.id < ?`
+		args = append(args, beforeID)
+	}
+	query += ` ORDER BY d.id DESC LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := r.query(ctx, r.db, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []model.WebhookDelivery{}
+	for rows.Next() {
+		d, err := scanDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, *d)
+	}
+	return deliveries, rows.Err()
+}
+
+func (r *webhookRepository) ClaimDueDeliveries(ctx context.Context, now time.Time, leaseUntil time.Time, limit int) ([]ClaimedDelivery, error) {
+	// timestamps are stored in utc so the string comparison sqlite does holds
+	rows, err := r.query(ctx, r.db, `
+		SELECT `+deliveryColumns+`
+		FROM webhook_deliveries d
+		JOIN webhooks w ON w.id = d.webhook_id
+		WHERE d.status = ? AND d.next_attempt_at <= ? AND w.enabled = ?
+		ORDER BY d.next_attempt_at, d.id
+		LIMIT ?
+	`, string(model.WebhookDeliveryPending), now.UTC(), true, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	var due []model.WebhookDelivery
+	for rows.Next() {
+		d, err := scanDelivery(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		due = append(due, *d)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// webhooks of the batch, usually a handful
+	webhooks := make(map[int]*model.Webhook)
+	for _, d := range due {
+		if _, ok := webhooks[d.WebhookID]; ok {
+			continue
+		}
+		hook, err := scanWebhook(r.queryRow(ctx, r.db,
+			`SELECT `+webhookColumns+` FROM webhooks w WHERE w.id = ?`, d.WebhookID))
+		if err == sql.ErrNoRows {
+			// deleted meanwhile, its deliveries went with it
+			webhooks[d.WebhookID] = nil
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		webhooks[d.WebhookID] = hook
+	}
+
+	// the lease moves next_attempt_at past now, another instance that read the same rows
+	// and comes second matches nothing
+	var claimed []ClaimedDelivery
+	for _, d := range due {
+		hook := webhooks[d.WebhookID]
+		if hook == nil {
+			continue
+		}
+		found, err := r.execFound(ctx, `
+			UPDATE webhook_deliveries SET next_attempt_at = ?
+			WHERE id = ? AND status = ? AND next_attempt_at <= ?
+		`, leaseUntil.UTC(), d.ID, string(model.WebhookDeliveryPending), now.UTC())
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			claimed = append(claimed, ClaimedDelivery{Delivery: d, Webhook: *hook})
+		}
+	}
+	return claimed, nil
+}
+
+func (r *webhookRepository) RecordDeliveryAttempt(ctx context.Context, id int64, attempt DeliveryAttempt) error {
+	var responseStatus sql.NullInt64
+	if attempt.ResponseStatus != nil {
+		responseStatus = sql.NullInt64{Int64: int64(*attempt.ResponseStatus), Valid: true}
+	}
+	var nextAttemptAt, completedAt sql.NullTime
+	if attempt.NextAttemptAt != nil {
+		nextAttemptAt = sql.NullTime{Time: attempt.NextAttemptAt.UTC(), Valid: true}
+	} else {
+		completedAt = sql.NullTime{Time: attempt.At.UTC(), Valid: true}
+	}
+
+	_, err := r.exec(ctx, r.db, `
+		UPDATE webhook_deliveries
+		SET status = ?, attempts = attempts + 1, response_status = ?, last_error = ?, duration_ms = ?,
+			next_attempt_at = ?, completed_at = ?
+		WHERE id = ?
+	`, string(attempt.Status), responseStatus, nullString(attempt.Error), attempt.DurationMs,
+		nextAttemptAt, completedAt, id)
+	return err
+}
+
+func (r *webhookRepository) LastDeliveryAt(ctx context.Context, webhookID int, eventType model.WebhookEventType, credentialID int, deploymentID string, before time.Time) (*time.Time, error) {
+	// not MAX(created_at), sqlite returns aggregates of timestamps as text
+	var at time.Time
+	err := r.queryRow(ctx, r.db, `
+		SELECT d.created_at
+		FROM webhook_deliveries d
+		JOIN deployment_events e ON e.id = d.event_id
+		WHERE d.webhook_id = ? AND d.event_type = ? AND e.platform_credential_id = ? AND e.deployment_id = ?
+			AND d.created_at < ?
+		ORDER BY d.id DESC
+		LIMIT 1
+	`, webhookID, string(eventType), credentialID, deploymentID, before.UTC()).Scan(&at)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &at, nil
+}
+
+func (r *webhookRepository) GetThread(ctx context.Context, webhookID int, threadKey string) (string, error) {
+	var ref string
+	err := r.queryRow(ctx, r.db,
+		`SELECT thread_ref FROM webhook_threads WHERE webhook_id = ? AND thread_key = ?`, webhookID, threadKey).Scan(&ref)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return ref, err
+}
+
+func (r *webhookRepository) SaveThread(ctx context.Context, webhookID int, threadKey string, threadRef string, at time.Time) error {
+	// two first messages sent at the same time, the first one saved stays the thread
+	_, err := r.exec(ctx, r.db, `
+		INSERT INTO webhook_threads (webhook_id, thread_key, thread_ref, created_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT (webhook_id, thread_key) DO NOTHING
+	`, webhookID, threadKey, threadRef, at.UTC())
+	return err
+}
+
+func (r *webhookRepository) ListDigestsDue(ctx context.Context, due time.Time) ([]model.Webhook, error) {
+	// event_types is a comma separated list, no event type is a prefix of another one
+	rows, err := r.query(ctx, r.db, `
+		SELECT `+webhookColumns+`
+		FROM webhooks w
+		WHERE w.type = ? AND w.enabled = ? AND w.event_types LIKE ?
+			AND COALESCE(w.last_digest_at, w.created_at) < ?
+		ORDER BY w.id
+	`, string(model.WebhookTypeEmail), true, "%"+string(model.WebhookEventDigest)+"%", due.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var webhooks []model.Webhook
+	for rows.Next() {
+		hook, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, *hook)
+	}
+	return webhooks, rows.Err()
+}
+
+func (r *webhookRepository) MarkDigestQueued(ctx context.Context, id int, due time.Time) (bool, error) {
+	return r.execFound(ctx, `
+		UPDATE webhooks SET last_digest_at = ?
+		WHERE id = ? AND COALESCE(last_digest_at, created_at) < ?
+	`, due.UTC(), id, due.UTC())
+}
@@ -7,10 +7,12 @@ import (
 // converts a PlatformCredential to SafeCredential
 func ConvertToSafeCredential(cred *model.PlatformCredential) model.SafeCredential {
 	return model.SafeCredential{
-		ID:        cred.ID,
-		UserID:    cred.UserID,
-		Platform:  cred.Platform,
-		CreatedAt: cred.CreatedAt,
+		ID:              cred.ID,
+		UserID:          cred.UserID,
+		Name:            cred.Name,
+		Platform:        cred.Platform,
+		CreatedAt:       cred.CreatedAt,
+		CacheTTLSeconds: cred.CacheTTLSeconds,
 	}
 }
 
@@ -0,0 +1,32 @@
+package utils
+
+import (
+	"checkmate/api/internal/model"
+	"encoding/json"
+	"net/http"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// writes a model.APIError as the response, used instead of http.Error so every error is json
+func WriteError(w http.ResponseWriter, r *http.Request, status int, code, message string, details interface{}) {
+	apiErr := model.APIError{
+		Code:    code,
+		Message: message,
+		Details: details,
+	}
+	if requestID, ok := r.Context().Value(RequestIDKey).(string); ok {
+		apiErr.RequestID = requestID
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(apiErr); err != nil {
+		log.WithFields(log.Fields{
+			"func":       "WriteError",
+			"request_id": apiErr.RequestID,
+		}).WithError(err).Error("Failed to encode error response")
+	}
+}
@@ -1,7 +1,8 @@
 import axios from "axios";
 import { auth } from "../firebase";
 
-const API_URL = import.meta.env.VITE_API_URL;
+// every endpoint is versioned under /api/v1
+const API_URL = `${import.meta.env.VITE_API_URL}/api/v1`;
 
 const api = axios.create({
   baseURL: API_URL,
@@ -10,7 +10,7 @@ export const getCredentials = async (): Promise<safeCredential[]> => {
 export const newCredential = async (
   credential: platformCredentialInput
 ): Promise<safeCredential> => {
-  const res = await api.post("/credentials/new", credential);
+  const res = await api.post("/credentials", credential);
   return res.data;
 };
 
@@ -19,11 +19,11 @@ export const updateCredential = async (
   id: number,
   updateCred: platformCredentialInput
 ) => {
-  const res = await api.put(`/credentials/update?id=${id}`, updateCred);
+  const res = await api.put(`/credentials/${id}`, updateCred);
   return res.data;
 };
 
 export const deleteCredential = async (id: number) => {
-  const res = await api.delete(`/credentials/delete?id=${id}`);
+  const res = await api.delete(`/credentials/${id}`);
   return res.data;
 };
@@ -1,8 +1,31 @@
 import api from "./api";
-import type { Deployment } from "../types";
+import type { Deployment, DeploymentDetail, DeploymentQuery } from "../types";
 
-export const getDeployments = async (): Promise<Deployment[]> => {
-  const res = await api.get("/deployments");
-  console.log(res);
-  return res.data.deployments;
+// the api pages the list, follow nextCursor until the last page
+export const getDeployments = async (
+  query: DeploymentQuery = {}
+): Promise<Deployment[]> => {
+  const deployments: Deployment[] = [];
+  let cursor: string | undefined;
+
+  do {
+    const res = await api.get("/deployments", {
+      params: { ...query, cursor },
+    });
+    deployments.push(...res.data.deployments);
+    cursor = res.data.nextCursor;
+  } while (cursor);
+
+  return deployments;
+};
+
+
+export const getDeployment = async (
+  credentialId: number,
+  deploymentId: string
+): Promise<DeploymentDetail> => {
+  const res = await api.get(
+    `/deployments/${credentialId}/${encodeURIComponent(deploymentId)}`
+  );
+  return res.data;
 };
@@ -1,2 +1,4 @@
 export * from "./credentials";
 export * from "./deployments";
+export * from "./rules";
+export * from "./webhooks";
@@ -0,0 +1,40 @@
+import type {
+  notificationRule,
+  notificationRuleInput,
+  rulePreview,
+  rulePreviewInput,
+} from "../types";
+import api from "./api";
+
+export const getNotificationRules = async (): Promise<notificationRule[]> => {
+  const res = await api.get("/notification-rules");
+  return res.data.rules;
+};
+
+export const newNotificationRule = async (
+  input: notificationRuleInput
+): Promise<notificationRule> => {
+  const res = await api.post("/notification-rules", input);
+  return res.data;
+};
+
+export const updateNotificationRule = async (
+  id: number,
+  input: notificationRuleInput
+): Promise<notificationRule> => {
+  const res = await api.put(`/notification-rules/${id}`, input);
+  return res.data;
+};
+
+export const deleteNotificationRule = async (id: number) => {
+  const res = await api.delete(`/notification-rules/${id}`);
+  return res.data;
+};
+
+// nothing is sent, says which webhooks would get the event and why
+export const previewNotificationRules = async (
+  input: rulePreviewInput
+): Promise<rulePreview> => {
+  const res = await api.post("/notification-rules/preview", input);
+  return res.data;
+};
@@ -0,0 +1,43 @@
+import type { webhook, webhookDelivery, webhookInput } from "../types";
+import api from "./api";
+
+export const getWebhooks = async (): Promise<webhook[]> => {
+  const res = await api.get("/webhooks");
+  return res.data.webhooks;
+};
+
+// the returned webhook has the signing secret, it can't be read again later
+export const newWebhook = async (input: webhookInput): Promise<webhook> => {
+  const res = await api.post("/webhooks", input);
+  return res.data;
+};
+
+export const updateWebhook = async (
+  id: number,
+  input: webhookInput
+): Promise<webhook> => {
+  const res = await api.put(`/webhooks/${id}`, input);
+  return res.data;
+};
+
+export const deleteWebhook = async (id: number) => {
+  const res = await api.delete(`/webhooks/${id}`);
+  return res.data;
+};
+
+// newest first, pass the id of the last delivery to get the next page
+export const getWebhookDeliveries = async (
+  id: number,
+  before?: number
+): Promise<webhookDelivery[]> => {
+  const res = await api.get(`/webhooks/${id}/deliveries`, {
+    params: before ? { before } : undefined,
+  });
+  return res.data.deliveries;
+};
+
+// sent right away without retries, a failed delivery still resolves
+export const testWebhook = async (id: number): Promise<webhookDelivery> => {
+  const res = await api.post(`/webhooks/${id}/test`);
+  return res.data;
+};
@@ -1,7 +1,7 @@
 import { useEffect, useState } from "react";
 import { useAuth } from "../contexts/auth-context";
 import api from "../api/api";
-import type { User } from "../types";
+import type { apiError, User } from "../types";
 import { useDeployments } from "../hooks";
 import DeploymentCard from "./deployment-card";
 import DarkModeToggle from "./dark-mode-toggle";
@@ -44,8 +44,11 @@ const Deployments = () => {
         if (err.response) {
           console.error("Error response data:", err.response.data);
           console.error("Error response status:", err.response.status);
+          const apiErr = err.response.data as apiError | undefined;
           setError(
-            `Failed to load user profile (Status: ${err.response.status})`
+            apiErr?.message
+              ? `Failed to load user profile: ${apiErr.message}`
+              : `Failed to load user profile (Status: ${err.response.status})`
           );
         } else if (err.request) {
           // request made but no response received
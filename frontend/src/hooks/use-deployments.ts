@@ -75,6 +75,7 @@ export const useDeployments = create<DeploymentsList>()(
         const optimisticCredential: safeCredential = {
           id: tempId,
           user_id: "temp-user", // this will be replaced by the actual response
+          name: credential.name,
           platform: credential.platform,
           created_at: new Date(),
         };
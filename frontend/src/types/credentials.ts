@@ -1,11 +1,13 @@
 export interface safeCredential {
   id: number;
   user_id: string;
+  name: string;
   platform: string;
   created_at: Date;
 }
 
 export interface platformCredentialInput {
+  name: string; // unique per user, ex "Render - personal"
   platform: string;
   apiKey: string;
 }
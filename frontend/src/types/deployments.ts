@@ -3,7 +3,8 @@ export type DeploymentStatus =
   | "deploying"
   | "canceled"
   | "failed"
-  | "unknown";
+  | "unknown"
+  | "gone";
 
 export interface Deployment {
   id: string;
@@ -17,4 +18,43 @@ export interface Deployment {
   framework: string;
   lastUpdatedAt: string;
   metadata: Record<string, any>;
+  firstSeenAt: string | null;
+  lastSeenAt: string | null;
+}
+
+export type DeploymentSort = "name" | "status" | "lastDeployedAt";
+
+// GET /deployments query params, all optional
+export interface DeploymentQuery {
+  platform?: string;
+  credentialId?: number;
+  status?: string; // comma separated DeploymentStatus values
+  serviceType?: string;
+  branch?: string;
+  name?: string;
+  sort?: DeploymentSort | `-${DeploymentSort}`;
+  limit?: number;
+}
+
+export interface DeployInfo {
+  id: string;
+  status: string;
+  commitId: string;
+  commitMessage: string;
+  createdAt: string;
+  finishedAt: string | null;
+}
+
+// fetched live from the platform, only on the single deployment endpoint
+export interface DeploymentDetails {
+  latestDeploy: DeployInfo | null;
+  instanceCount: number | null;
+  plan?: string;
+  region?: string;
+  runtime?: string;
+}
+
+export interface DeploymentDetail extends Deployment {
+  details: DeploymentDetails | null;
+  detailsError?: string;
 }
@@ -0,0 +1,7 @@
+// body of every error response from the api
+export interface apiError {
+  code: string;
+  message: string;
+  requestId?: string;
+  details?: unknown;
+}
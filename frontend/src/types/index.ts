@@ -1,3 +1,6 @@
 export * from "./credentials.ts";
 export * from "./deployments.ts";
-export * from "./user.ts"
\ No newline at end of file
+export * from "./errors.ts";
+export * from "./rules.ts";
+export * from "./user.ts"
+export * from "./webhooks.ts";
@@ -0,0 +1,86 @@
+import type { DeploymentStatus } from "./deployments.ts";
+import type { webhookType } from "./webhooks.ts";
+
+// notify sends the matching events, mute drops them (quiet hours are a mute rule with a schedule)
+export type notificationRuleAction = "notify" | "mute";
+
+export type ruleEventType =
+  | "deployment.failed"
+  | "deployment.recovered"
+  | "deployment.deploying"
+  | "deployment.succeeded";
+
+export interface ruleSchedule {
+  start: string; // HH:MM
+  end: string; // HH:MM, before start wraps past midnight
+  timezone?: string; // IANA name, left out -> UTC
+}
+
+// conditions left empty match anything
+export interface notificationRule {
+  id: number;
+  userId: string;
+  name: string;
+  action: notificationRuleAction;
+  enabled: boolean;
+  credentialIds: number[];
+  branches: string[]; // glob patterns, ex "release/*"
+  services: string[]; // glob patterns on the deployment name
+  eventTypes: ruleEventType[];
+  exceptEventTypes: ruleEventType[];
+  schedule?: ruleSchedule; // left out -> at any time
+  webhookIds: number[]; // empty -> all webhooks
+  dedupMinutes: number; // notify only
+  escalateAfterMinutes: number; // notify only, 0 -> off
+  escalateWebhookIds: number[];
+  createdAt: string;
+}
+
+export interface notificationRuleInput {
+  name: string;
+  action: notificationRuleAction;
+  credentialIds?: number[];
+  branches?: string[];
+  services?: string[];
+  eventTypes?: ruleEventType[];
+  exceptEventTypes?: ruleEventType[];
+  schedule?: ruleSchedule;
+  webhookIds?: number[];
+  dedupMinutes?: number;
+  escalateAfterMinutes?: number;
+  escalateWebhookIds?: number[]; // required with escalateAfterMinutes
+  enabled?: boolean; // left out -> enabled on create, unchanged on update
+}
+
+// a stored event, or a made up change of a cached deployment
+export interface rulePreviewInput {
+  eventId?: number;
+  credentialId?: number;
+  deploymentId?: string;
+  oldStatus?: DeploymentStatus; // left out -> the cached status
+  newStatus?: DeploymentStatus;
+  at?: string; // left out -> now, or when the stored event was seen
+}
+
+export interface rulePreview {
+  eventType?: ruleEventType; // left out when the change notifies nothing
+  at: string;
+  rules: {
+    ruleId: number;
+    name: string;
+    action: notificationRuleAction;
+    matched: boolean;
+    reason?: string;
+  }[];
+  webhooks: {
+    webhookId: number;
+    type: webhookType;
+    deliver: boolean;
+    reason: string;
+  }[];
+  escalations: {
+    ruleId: number;
+    webhookIds: number[];
+    dueAt: string;
+  }[];
+}
@@ -0,0 +1,56 @@
+import type { DeploymentStatus } from "./deployments.ts";
+
+export type webhookEventType =
+  | "deployment.failed"
+  | "deployment.recovered"
+  | "deployment.deploying"
+  | "deployment.succeeded"
+  | "digest.daily"; // email webhooks only
+
+export type webhookType = "generic" | "slack" | "discord" | "email";
+
+export interface webhook {
+  id: number;
+  userId: string;
+  type: webhookType;
+  url: string;
+  eventTypes: webhookEventType[];
+  credentialIds: number[]; // empty -> all credentials
+  statuses: DeploymentStatus[]; // empty -> all statuses
+  slackChannel?: string; // slack with a bot token, messages of a deploy are threaded
+  discordForum?: boolean;
+  secret?: string; // generic only, returned when it is created (or made generic), show it once
+  enabled: boolean;
+  createdAt: string;
+  lastDigestAt?: string; // email webhooks subscribed to digest.daily
+}
+
+export interface webhookInput {
+  type?: webhookType; // left out -> generic
+  url?: string; // not needed for slack with slackChannel, "mailto:a@example.com,b@example.com" for email
+  eventTypes: webhookEventType[];
+  credentialIds?: number[];
+  statuses?: DeploymentStatus[];
+  slackChannel?: string;
+  slackBotToken?: string; // required with slackChannel, left out on update keeps the current one
+  discordForum?: boolean;
+  enabled?: boolean; // left out -> enabled on create, unchanged on update
+}
+
+export type webhookDeliveryStatus = "pending" | "succeeded" | "failed";
+
+export interface webhookDelivery {
+  id: number;
+  webhookId: number;
+  eventType: webhookEventType | "deployment.escalated" | "webhook.test"; // escalated: sent by a notification rule
+  eventId?: number;
+  payload: unknown; // generic payload, the slack / discord message, or the email (subject, text, html)
+  status: webhookDeliveryStatus;
+  attempts: number;
+  responseStatus?: number; // smtp reply code for email
+  error?: string;
+  durationMs?: number;
+  createdAt: string;
+  nextAttemptAt?: string;
+  completedAt?: string;
+}